@@ -0,0 +1,290 @@
+package gobackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlbumDownloadRequest downloads a whole album with one call. The album is
+// taken from Album when the client already has it, otherwise it is resolved
+// from SpotifyURL or DeezerAlbumID. Settings carries the per-track options
+// (output_dir, service, quality, filename_format, use_fallback, ...) shared by
+// every track.
+type AlbumDownloadRequest struct {
+	Album         *AlbumResponsePayload `json:"album,omitempty"`
+	SpotifyURL    string                `json:"spotify_url,omitempty"`
+	DeezerAlbumID string                `json:"deezer_album_id,omitempty"`
+	Settings      DownloadRequest       `json:"settings"`
+	Concurrency   int                   `json:"concurrency,omitempty"`
+	SkipCoverFile bool                  `json:"skip_cover_file,omitempty"`
+}
+
+type AlbumTrackResult struct {
+	Index       int              `json:"index"`
+	ItemID      string           `json:"item_id,omitempty"`
+	TrackName   string           `json:"track_name"`
+	ArtistName  string           `json:"artist_name"`
+	ISRC        string           `json:"isrc,omitempty"`
+	TrackNumber int              `json:"track_number,omitempty"`
+	DiscNumber  int              `json:"disc_number,omitempty"`
+	Result      DownloadResponse `json:"result"`
+}
+
+type AlbumDownloadResponse struct {
+	Success       bool               `json:"success"`
+	Album         string             `json:"album"`
+	Artist        string             `json:"artist"`
+	OutputDir     string             `json:"output_dir"`
+	CoverPath     string             `json:"cover_path,omitempty"`
+	TotalTracks   int                `json:"total_tracks"`
+	Downloaded    int                `json:"downloaded"`
+	AlreadyExists int                `json:"already_exists"`
+	Failed        int                `json:"failed"`
+	Tracks        []AlbumTrackResult `json:"tracks"`
+	ReplayGain    *ReplayGainResult  `json:"replay_gain,omitempty"`
+	Error         string             `json:"error,omitempty"`
+}
+
+const albumCoverFileName = "cover.jpg"
+
+func resolveAlbumPayload(req AlbumDownloadRequest) (*AlbumResponsePayload, error) {
+	if req.Album != nil {
+		return req.Album, nil
+	}
+
+	if req.SpotifyURL != "" {
+		data, err := GetSpotifyMetadataWithDeezerFallback(req.SpotifyURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve album: %w", err)
+		}
+		var album AlbumResponsePayload
+		if err := json.Unmarshal([]byte(data), &album); err != nil {
+			return nil, fmt.Errorf("failed to parse album metadata: %w", err)
+		}
+		if len(album.TrackList) == 0 {
+			return nil, fmt.Errorf("URL did not resolve to an album with tracks")
+		}
+		return &album, nil
+	}
+
+	if req.DeezerAlbumID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return GetDeezerClient().GetAlbum(ctx, req.DeezerAlbumID)
+	}
+
+	return nil, fmt.Errorf("album, spotify_url or deezer_album_id is required")
+}
+
+// albumHasMultipleDiscs reports whether tracks span more than one disc, in
+// which case each disc gets its own "Disc N" folder.
+func albumHasMultipleDiscs(tracks []AlbumTrackMetadata) bool {
+	first := 0
+	for _, track := range tracks {
+		if track.DiscNumber <= 0 {
+			continue
+		}
+		if first == 0 {
+			first = track.DiscNumber
+		} else if track.DiscNumber != first {
+			return true
+		}
+	}
+	return false
+}
+
+// buildAlbumTrackRequest fills a per-track DownloadRequest from the shared
+// settings, the track and album-level metadata.
+func buildAlbumTrackRequest(settings DownloadRequest, album *AlbumResponsePayload, track AlbumTrackMetadata, index int, outputDir string) DownloadRequest {
+	req := settings
+	info := album.AlbumInfo
+
+	req.TrackName = track.Name
+	req.ArtistName = track.Artists
+	req.SpotifyID = track.SpotifyID
+	req.ISRC = track.ISRC
+	req.TrackNumber = track.TrackNumber
+	req.DiscNumber = track.DiscNumber
+	req.DurationMS = track.DurationMS
+	req.OutputDir = outputDir
+	req.OutputPath = ""
+	req.OutputFD = 0
+
+	req.AlbumName = firstNonEmpty(track.AlbumName, info.Name)
+	req.AlbumArtist = firstNonEmpty(track.AlbumArtist, info.Artists)
+	req.ReleaseDate = firstNonEmpty(track.ReleaseDate, info.ReleaseDate)
+	req.CoverURL = firstNonEmpty(info.Images, track.Images)
+	req.Genre = firstNonEmpty(settings.Genre, info.Genre)
+	req.Label = firstNonEmpty(settings.Label, info.Label)
+	req.Copyright = firstNonEmpty(settings.Copyright, info.Copyright)
+
+	req.TotalTracks = info.TotalTracks
+	if req.TotalTracks == 0 {
+		req.TotalTracks = len(album.TrackList)
+	}
+
+	if settings.ItemID != "" {
+		req.ItemID = fmt.Sprintf("%s_%d", settings.ItemID, index+1)
+	} else {
+		req.ItemID = track.SpotifyID
+	}
+	return req
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// saveAlbumCover fetches the album cover once and writes it next to the
+// tracks. The fetched image stays in the cover cache, so each track's embed
+// reuses it instead of downloading it again.
+func saveAlbumCover(coverURL, outputDir string, maxQuality bool) (string, error) {
+	coverPath := filepath.Join(outputDir, albumCoverFileName)
+	if info, err := os.Stat(coverPath); err == nil && info.Size() > 0 {
+		// Still warm the cache for the per-track embeds.
+		_, _ = downloadCoverToMemory(coverURL, maxQuality)
+		return coverPath, nil
+	}
+
+	data, err := downloadCoverToMemory(coverURL, maxQuality)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(coverPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write cover: %w", err)
+	}
+	return coverPath, nil
+}
+
+func downloadAlbum(req AlbumDownloadRequest, downloadFn func(requestJSON string) (string, error)) (*AlbumDownloadResponse, error) {
+	settings := req.Settings
+	baseDir := strings.TrimSpace(settings.OutputDir)
+	if baseDir == "" || settings.OutputFD > 0 || strings.TrimSpace(settings.OutputPath) != "" {
+		return nil, fmt.Errorf("album downloads require settings.output_dir")
+	}
+
+	album, err := resolveAlbumPayload(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	AddAllowedDownloadDir(baseDir)
+
+	resp := &AlbumDownloadResponse{
+		Album:       album.AlbumInfo.Name,
+		Artist:      album.AlbumInfo.Artists,
+		OutputDir:   baseDir,
+		TotalTracks: len(album.TrackList),
+		Tracks:      make([]AlbumTrackResult, len(album.TrackList)),
+	}
+
+	GoLog("[Album] Downloading %q by %s (%d tracks)\n", resp.Album, resp.Artist, resp.TotalTracks)
+
+	coverURL := firstNonEmpty(album.AlbumInfo.Images)
+	if coverURL == "" && len(album.TrackList) > 0 {
+		coverURL = album.TrackList[0].Images
+	}
+	if coverURL != "" && !req.SkipCoverFile {
+		if coverPath, err := saveAlbumCover(coverURL, baseDir, settings.EmbedMaxQualityCover); err != nil {
+			GoLog("[Album] Warning: failed to save cover: %v\n", err)
+		} else {
+			resp.CoverPath = coverPath
+		}
+	}
+
+	multiDisc := albumHasMultipleDiscs(album.TrackList)
+
+	workers := clampQueueWorkers(req.Concurrency)
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	for i, track := range album.TrackList {
+		outputDir := baseDir
+		if multiDisc && track.DiscNumber > 0 {
+			outputDir = filepath.Join(baseDir, fmt.Sprintf("Disc %d", track.DiscNumber))
+		}
+		trackReq := buildAlbumTrackRequest(settings, album, track, i, outputDir)
+		// The album pass below writes track gains as well, so measuring each
+		// track during its own download would only decode it twice.
+		trackReq.ReplayGain = false
+
+		resp.Tracks[i] = AlbumTrackResult{
+			Index:       i,
+			ItemID:      trackReq.ItemID,
+			TrackName:   trackReq.TrackName,
+			ArtistName:  trackReq.ArtistName,
+			ISRC:        trackReq.ISRC,
+			TrackNumber: trackReq.TrackNumber,
+			DiscNumber:  trackReq.DiscNumber,
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, trackReq DownloadRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := os.MkdirAll(trackReq.OutputDir, 0755); err != nil {
+				resp.Tracks[i].Result = newErrorResponse("failed to create directory: " + err.Error())
+				return
+			}
+
+			var result DownloadResponse
+			requestJSON, err := json.Marshal(trackReq)
+			if err == nil {
+				var resultJSON string
+				resultJSON, err = downloadFn(string(requestJSON))
+				if err == nil {
+					err = json.Unmarshal([]byte(resultJSON), &result)
+				}
+			}
+			if err != nil {
+				result = newErrorResponse(err.Error())
+			}
+			resp.Tracks[i].Result = result
+		}(i, trackReq)
+	}
+	wg.Wait()
+
+	for _, track := range resp.Tracks {
+		switch {
+		case track.Result.Success && track.Result.AlreadyExists:
+			resp.AlreadyExists++
+		case track.Result.Success:
+			resp.Downloaded++
+		default:
+			resp.Failed++
+		}
+	}
+	resp.Success = resp.Failed == 0
+
+	if settings.ReplayGain {
+		var paths []string
+		for _, track := range resp.Tracks {
+			if track.Result.Success && track.Result.FilePath != "" {
+				paths = append(paths, track.Result.FilePath)
+			}
+		}
+		if len(paths) > 0 {
+			resp.ReplayGain = applyReplayGain(paths, true)
+		}
+	}
+
+	GoLog("[Album] Finished %q: %d downloaded, %d already existed, %d failed\n",
+		resp.Album, resp.Downloaded, resp.AlreadyExists, resp.Failed)
+	return resp, nil
+}
@@ -0,0 +1,84 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDownloadAlbum_DiscFoldersAndAggregation(t *testing.T) {
+	dir := t.TempDir()
+	album := &AlbumResponsePayload{
+		AlbumInfo: AlbumInfoMetadata{
+			Name:        "Album",
+			Artists:     "Artist",
+			ReleaseDate: "2020-01-01",
+			Label:       "Label",
+		},
+		TrackList: []AlbumTrackMetadata{
+			{SpotifyID: "a", Name: "One", Artists: "Artist", TrackNumber: 1, DiscNumber: 1},
+			{SpotifyID: "b", Name: "Two", Artists: "Artist", TrackNumber: 1, DiscNumber: 2},
+			{SpotifyID: "c", Name: "Three", Artists: "Artist", TrackNumber: 2, DiscNumber: 2},
+		},
+	}
+
+	var mu sync.Mutex
+	seen := map[string]DownloadRequest{}
+	stub := func(requestJSON string) (string, error) {
+		var req DownloadRequest
+		if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+			t.Fatalf("invalid track request: %v", err)
+		}
+		mu.Lock()
+		seen[req.SpotifyID] = req
+		mu.Unlock()
+
+		resp := DownloadResponse{Success: true, FilePath: filepath.Join(req.OutputDir, req.TrackName+".flac")}
+		switch req.SpotifyID {
+		case "b":
+			resp.AlreadyExists = true
+		case "c":
+			resp = newErrorResponse("not found")
+		}
+		jsonBytes, _ := json.Marshal(resp)
+		return string(jsonBytes), nil
+	}
+
+	resp, err := downloadAlbum(AlbumDownloadRequest{
+		Album:    album,
+		Settings: DownloadRequest{OutputDir: dir, Service: "tidal", ItemID: "job", ReplayGain: true},
+	}, stub)
+	if err != nil {
+		t.Fatalf("downloadAlbum failed: %v", err)
+	}
+
+	if resp.Downloaded != 1 || resp.AlreadyExists != 1 || resp.Failed != 1 || resp.Success {
+		t.Fatalf("unexpected counts: %+v", resp)
+	}
+	if got := seen["a"].OutputDir; got != filepath.Join(dir, "Disc 1") {
+		t.Fatalf("expected Disc 1 folder, got %q", got)
+	}
+	if got := seen["c"].OutputDir; got != filepath.Join(dir, "Disc 2") {
+		t.Fatalf("expected Disc 2 folder, got %q", got)
+	}
+	if req := seen["b"]; req.AlbumName != "Album" || req.Label != "Label" || req.TotalTracks != 3 || req.ItemID != "job_2" {
+		t.Fatalf("album metadata not applied: %+v", req)
+	}
+	if seen["a"].ReplayGain || resp.ReplayGain == nil {
+		t.Fatalf("expected ReplayGain in the album pass only, got track=%v album=%+v", seen["a"].ReplayGain, resp.ReplayGain)
+	}
+	if resp.Tracks[2].Result.Error != "not found" {
+		t.Fatalf("expected per-track error, got %+v", resp.Tracks[2])
+	}
+}
+
+func TestAlbumHasMultipleDiscs(t *testing.T) {
+	single := []AlbumTrackMetadata{{DiscNumber: 1}, {DiscNumber: 0}, {DiscNumber: 1}}
+	if albumHasMultipleDiscs(single) {
+		t.Fatal("expected single-disc album")
+	}
+	if !albumHasMultipleDiscs(append(single, AlbumTrackMetadata{DiscNumber: 2})) {
+		t.Fatal("expected multi-disc album")
+	}
+}
@@ -1,7 +1,6 @@
 package gobackend
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
@@ -22,6 +21,8 @@ const (
 	amazonAPITimeoutMobile = 30 * time.Second // Longer timeout for unstable mobile networks
 	amazonMaxRetries       = 2                // Number of retry attempts
 	amazonRetryDelay       = 500 * time.Millisecond
+
+	amazonAfkarMirror = "https://amazon.afkarxyz.fun"
 )
 
 type AmazonDownloader struct {
@@ -77,18 +78,7 @@ func (a *AmazonDownloader) fetchAmazonURLWithRetry(amazonURL string) (string, st
 		}
 
 		lastErr = err
-		errStr := strings.ToLower(err.Error())
-
-		// Check if error is retryable
-		isRetryable := strings.Contains(errStr, "timeout") ||
-			strings.Contains(errStr, "connection reset") ||
-			strings.Contains(errStr, "connection refused") ||
-			strings.Contains(errStr, "eof") ||
-			strings.Contains(errStr, "status 5") ||
-			strings.Contains(errStr, "status 429") ||
-			strings.Contains(errStr, "http 429")
-
-		if !isRetryable {
+		if !isTransientNetworkError(err) && !ClassifyDownloadError(err).Retryable() {
 			return "", "", "", err
 		}
 
@@ -179,7 +169,7 @@ func (a *AmazonDownloader) doAfkarXYZRequestNew(asin string) (string, string, st
 	ctx, cancel := context.WithTimeout(context.Background(), amazonAPITimeoutMobile)
 	defer cancel()
 
-	apiURL := fmt.Sprintf("https://amazon.afkarxyz.fun/api/track/%s", asin)
+	apiURL := fmt.Sprintf("%s/api/track/%s", amazonAfkarMirror, asin)
 	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
 		return "", "", "", fmt.Errorf("failed to create request: %w", err)
@@ -194,7 +184,7 @@ func (a *AmazonDownloader) doAfkarXYZRequestNew(asin string) (string, string, st
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", "", "", fmt.Errorf("Amazon API returned status %d", resp.StatusCode)
+		return "", "", "", httpStatusError("amazon", resp.StatusCode, "Amazon API returned error")
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -219,7 +209,7 @@ func (a *AmazonDownloader) doAfkarXYZRequestLegacy(amazonURL string) (string, st
 	ctx, cancel := context.WithTimeout(context.Background(), amazonAPITimeoutMobile)
 	defer cancel()
 
-	apiURL := "https://amazon.afkarxyz.fun/convert?url=" + url.QueryEscape(amazonURL)
+	apiURL := amazonAfkarMirror + "/convert?url=" + url.QueryEscape(amazonURL)
 	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
 		return "", "", "", fmt.Errorf("failed to create legacy request: %w", err)
@@ -234,7 +224,7 @@ func (a *AmazonDownloader) doAfkarXYZRequestLegacy(amazonURL string) (string, st
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", "", "", fmt.Errorf("legacy AfkarXYZ API returned status %d", resp.StatusCode)
+		return "", "", "", httpStatusError("amazon", resp.StatusCode, "legacy AfkarXYZ API returned error")
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -277,7 +267,9 @@ func (a *AmazonDownloader) downloadFromAfkarXYZ(amazonURL string) (string, strin
 	return downloadURL, fileName, decryptionKey, nil
 }
 
-func (a *AmazonDownloader) DownloadFile(downloadURL, outputPath string, outputFD int, itemID string) error {
+// DownloadFile downloads a track URL. source identifies the track, so a
+// partial file is only resumed for it.
+func (a *AmazonDownloader) DownloadFile(downloadURL, outputPath string, outputFD int, itemID, source string) error {
 	ctx := context.Background()
 
 	if itemID != "" {
@@ -291,69 +283,10 @@ func (a *AmazonDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 		return ErrDownloadCancelled
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("User-Agent", getRandomUserAgent())
-
-	resp, err := a.client.Do(req)
+	written, err := downloadWithResume(ctx, a.client, downloadURL, outputPath, outputFD, itemID, source)
 	if err != nil {
-		if isDownloadCancelled(itemID) {
-			return ErrDownloadCancelled
-		}
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("download failed: HTTP %d", resp.StatusCode)
-	}
-
-	expectedSize := resp.ContentLength
-	if expectedSize > 0 && itemID != "" {
-		SetItemBytesTotal(itemID, expectedSize)
-	}
-
-	out, err := openOutputForWrite(outputPath, outputFD)
-	if err != nil {
-		return err
-	}
-
-	bufWriter := bufio.NewWriterSize(out, 256*1024)
-
-	var written int64
-	if itemID != "" {
-		pw := NewItemProgressWriter(bufWriter, itemID)
-		written, err = io.Copy(pw, resp.Body)
-	} else {
-		written, err = io.Copy(bufWriter, resp.Body)
-	}
-
-	flushErr := bufWriter.Flush()
-	closeErr := out.Close()
-
-	if err != nil {
-		cleanupOutputOnError(outputPath, outputFD)
-		if isDownloadCancelled(itemID) {
-			return ErrDownloadCancelled
-		}
-		return fmt.Errorf("download interrupted: %w", err)
-	}
-	if flushErr != nil {
-		cleanupOutputOnError(outputPath, outputFD)
-		return fmt.Errorf("failed to flush buffer: %w", flushErr)
-	}
-	if closeErr != nil {
-		cleanupOutputOnError(outputPath, outputFD)
-		return fmt.Errorf("failed to close file: %w", closeErr)
-	}
-
-	if expectedSize > 0 && written != expectedSize {
-		cleanupOutputOnError(outputPath, outputFD)
-		return fmt.Errorf("incomplete download: expected %d bytes, got %d bytes", expectedSize, written)
-	}
 
 	GoLog("[Amazon] Downloaded: %.2f MB (Complete)\n", float64(written)/(1024*1024))
 	return nil
@@ -373,18 +306,16 @@ type AmazonDownloadResult struct {
 	ISRC          string
 	LyricsLRC     string
 	DecryptionKey string
-}
 
-func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
-	downloader := NewAmazonDownloader()
-
-	isSafOutput := isFDOutput(req.OutputFD) || strings.TrimSpace(req.OutputPath) != ""
-	if !isSafOutput {
-		if existingFile, exists := checkISRCExistsInternal(req.OutputDir, req.ISRC); exists {
-			return AmazonDownloadResult{FilePath: "EXISTS:" + existingFile}, nil
-		}
-	}
+	ProviderTrackID string
+	Mirror          string
+	LyricsSource    string
+	ReplacedFile    string
+}
 
+// resolveAmazonURL returns the Amazon Music URL for req from the track ID
+// cache or SongLink.
+func resolveAmazonURL(req DownloadRequest) (string, error) {
 	amazonURL := ""
 	if req.ISRC != "" {
 		if cached := GetTrackIDCache().Get(req.ISRC); cached != nil && cached.AmazonURL != "" {
@@ -404,15 +335,15 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 		} else if req.SpotifyID != "" {
 			availability, err = songlink.CheckTrackAvailability(req.SpotifyID, req.ISRC)
 		} else {
-			return AmazonDownloadResult{}, fmt.Errorf("no valid Spotify or Deezer ID provided for Amazon lookup")
+			return "", fmt.Errorf("no valid Spotify or Deezer ID provided for Amazon lookup")
 		}
 
 		if err != nil {
-			return AmazonDownloadResult{}, fmt.Errorf("failed to check Amazon availability via SongLink: %w", err)
+			return "", fmt.Errorf("failed to check Amazon availability via SongLink: %w", err)
 		}
 
 		if !availability.Amazon || availability.AmazonURL == "" {
-			return AmazonDownloadResult{}, fmt.Errorf("track not available on Amazon Music (SongLink returned no Amazon URL)")
+			return "", newDownloadError(ErrKindNotFound, "amazon", nil, "track not available on Amazon Music (SongLink returned no Amazon URL)")
 		}
 
 		amazonURL = availability.AmazonURL
@@ -421,6 +352,25 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 		}
 	}
 
+	return amazonURL, nil
+}
+
+func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
+	downloader := NewAmazonDownloader()
+
+	isSafOutput := isFDOutput(req.OutputFD) || strings.TrimSpace(req.OutputPath) != ""
+	var upgrade *pendingUpgrade
+	if !isSafOutput {
+		if existingFile, exists := checkISRCExistsInternal(req.OutputDir, req.ISRC); exists && keepExistingFile(req, existingFile, &upgrade) {
+			return AmazonDownloadResult{FilePath: "EXISTS:" + existingFile}, nil
+		}
+	}
+
+	amazonURL, err := resolveAmazonURL(req)
+	if err != nil {
+		return AmazonDownloadResult{}, err
+	}
+
 	if !isSafOutput && req.OutputDir != "." {
 		if err := os.MkdirAll(req.OutputDir, 0755); err != nil {
 			return AmazonDownloadResult{}, fmt.Errorf("failed to create output directory: %w", err)
@@ -434,6 +384,7 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 	}
 
 	GoLog("[Amazon] Match found: '%s' by '%s'\n", req.TrackName, req.ArtistName)
+	applyTagRulesToRequest(&req)
 
 	filename := buildFilenameFromTemplate(req.FilenameFormat, map[string]any{
 		"title":  req.TrackName,
@@ -444,6 +395,11 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 		"date":   req.ReleaseDate,
 		"disc":   req.DiscNumber,
 	})
+	outputExt := strings.ToLower(filepath.Ext(afkarFileName))
+	if outputExt == "" {
+		outputExt = ".flac"
+	}
+
 	var outputPath string
 	if isSafOutput {
 		outputPath = strings.TrimSpace(req.OutputPath)
@@ -451,18 +407,31 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 			outputPath = fmt.Sprintf("/proc/self/fd/%d", req.OutputFD)
 		}
 	} else {
-		outputExt := strings.ToLower(filepath.Ext(afkarFileName))
-		if outputExt == "" {
-			outputExt = ".flac"
-		}
 		filename = sanitizeFilename(filename) + outputExt
 		outputPath = filepath.Join(req.OutputDir, filename)
-		if fileInfo, statErr := os.Stat(outputPath); statErr == nil && fileInfo.Size() > 0 {
+		if fileInfo, statErr := os.Stat(outputPath); statErr == nil && fileInfo.Size() > 0 && keepExistingFile(req, outputPath, &upgrade) {
 			return AmazonDownloadResult{FilePath: "EXISTS:" + outputPath}, nil
 		}
+		if upgrade == nil {
+			if legacy := findLegacyVersion(req, outputPath); legacy != "" && keepExistingFile(req, legacy, &upgrade) {
+				return AmazonDownloadResult{FilePath: "EXISTS:" + legacy}, nil
+			}
+		}
+		if upgrade != nil {
+			// Encrypted downloads cannot be probed here, so there is no way
+			// to tell whether they would improve on the existing file.
+			if strings.TrimSpace(decryptionKey) != "" {
+				GoLog("[Amazon] Download is encrypted, keeping existing %s\n", filepath.Base(upgrade.path))
+				return AmazonDownloadResult{FilePath: "EXISTS:" + upgrade.path}, nil
+			}
+			if !upgrade.worthDownloading(expectedAudioGrade(strings.TrimPrefix(outputExt, "."), 0, 0)) {
+				return AmazonDownloadResult{FilePath: "EXISTS:" + upgrade.path}, nil
+			}
+		}
 	}
 
-	// START PARALLEL: Fetch cover and lyrics while downloading audio
+	// START PARALLEL: Fetch cover, lyrics and MusicBrainz IDs while downloading audio
+	musicBrainzIDs := startMusicBrainzLookup(req, req.ISRC)
 	var parallelResult *ParallelDownloadResult
 	parallelDone := make(chan struct{})
 	go func() {
@@ -478,15 +447,30 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 		)
 	}()
 
+	var stage *stagedOutput
+	if isSafOutput {
+		stage, err = newSAFStagedOutput(outputPath, req.OutputFD, outputExt)
+		if err != nil {
+			<-parallelDone
+			return AmazonDownloadResult{}, err
+		}
+	} else {
+		stage = newStagedOutput(outputPath)
+		stage.upgrade = upgrade
+	}
+	stage.replayGain = req.ReplayGain
+	stage.policy = qualityPolicyFromRequest(req)
+
 	// Download audio file with item ID for progress tracking
-	if err := downloader.DownloadFile(downloadURL, outputPath, req.OutputFD, req.ItemID); err != nil {
+	if err := downloader.DownloadFile(downloadURL, stage.workPath, 0, req.ItemID, "amazon:"+amazonURL); err != nil {
+		stage.discard()
 		if errors.Is(err, ErrDownloadCancelled) {
 			return AmazonDownloadResult{}, ErrDownloadCancelled
 		}
 		return AmazonDownloadResult{}, fmt.Errorf("download failed: %w", err)
 	}
 
-	actualOutputPath := outputPath
+	actualOutputPath := stage.workPath
 	needsDecryption := strings.TrimSpace(decryptionKey) != ""
 	if needsDecryption {
 		GoLog("[Amazon] Download requires decryption; deferring decrypt to Flutter FFmpeg path\n")
@@ -544,6 +528,10 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 		Genre:       req.Genre,
 		Label:       req.Label,
 		Copyright:   req.Copyright,
+		Provenance:  newDownloadProvenance(req, "amazon", amazonURL),
+		MusicBrainz: musicBrainzIDs(),
+
+		ArtistCredits: req.ArtistCredits,
 	}
 
 	var coverData []byte
@@ -563,13 +551,13 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 	if isSafOutput || needsDecryption {
 		GoLog("[Amazon] SAF output detected - skipping in-backend metadata/lyrics embedding (handled in Flutter)\n")
 	} else {
-		isFlacOutput := strings.HasSuffix(strings.ToLower(actualOutputPath), ".flac")
-		if isFlacOutput {
+		canEmbed := strings.HasSuffix(strings.ToLower(actualOutputPath), ".flac") || isM4AFile(actualOutputPath)
+		if canEmbed {
 			if err := EmbedMetadataWithCoverData(actualOutputPath, metadata, coverData); err != nil {
 				GoLog("[Amazon] Warning: failed to embed metadata: %v\n", err)
 			}
 		} else {
-			GoLog("[Amazon] Non-FLAC output detected (%s), skipping native metadata embedding\n", filepath.Ext(actualOutputPath))
+			GoLog("[Amazon] Unsupported output format (%s), skipping native metadata embedding\n", filepath.Ext(actualOutputPath))
 		}
 
 		if req.EmbedLyrics && parallelResult != nil && parallelResult.LyricsLRC != "" {
@@ -580,22 +568,22 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 
 			if lyricsMode == "external" || lyricsMode == "both" {
 				GoLog("[Amazon] Saving external LRC file...\n")
-				if lrcPath, lrcErr := SaveLRCFile(actualOutputPath, parallelResult.LyricsLRC); lrcErr != nil {
+				if lrcPath, lrcErr := SaveLRCFile(outputPath, parallelResult.LyricsLRC); lrcErr != nil {
 					GoLog("[Amazon] Warning: failed to save LRC file: %v\n", lrcErr)
 				} else {
 					GoLog("[Amazon] LRC file saved: %s\n", lrcPath)
 				}
 			}
 
-			if (lyricsMode == "embed" || lyricsMode == "both") && isFlacOutput {
+			if (lyricsMode == "embed" || lyricsMode == "both") && canEmbed {
 				GoLog("[Amazon] Embedding parallel-fetched lyrics (%d lines)...\n", len(parallelResult.LyricsData.Lines))
 				if embedErr := EmbedLyrics(actualOutputPath, parallelResult.LyricsLRC); embedErr != nil {
 					GoLog("[Amazon] Warning: failed to embed lyrics: %v\n", embedErr)
 				} else {
 					GoLog("[Amazon] Lyrics embedded successfully\n")
 				}
-			} else if (lyricsMode == "embed" || lyricsMode == "both") && !isFlacOutput {
-				GoLog("[Amazon] Skipping embedded lyrics for non-FLAC output\n")
+			} else if lyricsMode == "embed" || lyricsMode == "both" {
+				GoLog("[Amazon] Skipping embedded lyrics for %s output\n", filepath.Ext(actualOutputPath))
 			}
 		} else if req.EmbedLyrics {
 			GoLog("[Amazon] No lyrics available from parallel fetch\n")
@@ -627,6 +615,17 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 		}
 	}
 
+	// Encrypted files are only checked for size; their headers are not
+	// readable until Flutter decrypts them.
+	outputPath, err = stage.commit(actualOutputPath, !needsDecryption)
+	if errors.Is(err, errNotAnUpgrade) {
+		return AmazonDownloadResult{FilePath: "EXISTS:" + upgrade.path}, nil
+	}
+	if err != nil {
+		return AmazonDownloadResult{}, err
+	}
+	actualOutputPath = outputPath
+
 	// Add to ISRC index for fast duplicate checking.
 	// When decryption is pending in Flutter, postpone indexing until final file is settled.
 	if !isSafOutput && !needsDecryption {
@@ -658,5 +657,10 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 		ISRC:          req.ISRC,
 		LyricsLRC:     lyricsLRC,
 		DecryptionKey: decryptionKey,
+
+		ProviderTrackID: amazonURL,
+		Mirror:          amazonAfkarMirror,
+		LyricsSource:    parallelLyricsSource(parallelResult, lyricsLRC),
+		ReplacedFile:    upgrade.replacedFile(),
 	}, nil
 }
@@ -0,0 +1,195 @@
+package gobackend
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/go-flac/flacvorbis/v2"
+)
+
+// Artist credit roles.
+const (
+	ArtistRoleMain     = "main"
+	ArtistRoleFeatured = "featured"
+	ArtistRoleRemixer  = "remixer"
+	ArtistRoleComposer = "composer"
+	ArtistRoleProducer = "producer"
+)
+
+// ArtistCredit is one artist credited on a track. Keeping credits as a list
+// avoids splitting joined artist strings, which breaks names such as
+// "Tyler, The Creator".
+type ArtistCredit struct {
+	Name string `json:"name"`
+	ID   string `json:"id,omitempty"`
+	Role string `json:"role"`
+}
+
+// creditNames returns the names credited with any of roles, in order and
+// without duplicates.
+func creditNames(credits []ArtistCredit, roles ...string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, credit := range credits {
+		key := strings.ToLower(credit.Name)
+		if credit.Name == "" || seen[key] {
+			continue
+		}
+		for _, role := range roles {
+			if credit.Role == role {
+				names = append(names, credit.Name)
+				seen[key] = true
+				break
+			}
+		}
+	}
+	return names
+}
+
+// performingRole groups main and featured artists, which providers disagree
+// on, so that merging does not credit one artist as both.
+func performingRole(role string) string {
+	if role == ArtistRoleFeatured {
+		return ArtistRoleMain
+	}
+	return role
+}
+
+// mergeArtistCredits adds the credits from extra that base lacks. Base wins
+// for artists both credit, so the request's own credits keep precedence
+// over those reported by the download provider.
+func mergeArtistCredits(base, extra []ArtistCredit) []ArtistCredit {
+	if len(extra) == 0 {
+		return base
+	}
+	seen := make(map[string]bool)
+	key := func(c ArtistCredit) string {
+		return performingRole(c.Role) + "|" + strings.ToLower(strings.TrimSpace(c.Name))
+	}
+	merged := append([]ArtistCredit(nil), base...)
+	for _, credit := range base {
+		seen[key(credit)] = true
+	}
+	for _, credit := range extra {
+		if credit.Name != "" && !seen[key(credit)] {
+			merged = append(merged, credit)
+			seen[key(credit)] = true
+		}
+	}
+	return merged
+}
+
+// performerCredits returns the credits with a performing role such as
+// "vocals" as "Name (role)", the form Picard uses for PERFORMER tags. Main and
+// featured artists go to ARTISTS and the roles with their own tags are left
+// out.
+func performerCredits(credits []ArtistCredit) []string {
+	var performers []string
+	for _, credit := range credits {
+		switch credit.Role {
+		case "", ArtistRoleMain, ArtistRoleFeatured, ArtistRoleComposer, ArtistRoleRemixer, ArtistRoleProducer:
+			continue
+		}
+		if credit.Name != "" {
+			performers = append(performers, credit.Name+" ("+credit.Role+")")
+		}
+	}
+	return performers
+}
+
+// splitArtistsWithCredits returns the lowercased performing artists from
+// credits, falling back to splitting the joined artists string.
+func splitArtistsWithCredits(artists string, credits []ArtistCredit) []string {
+	names := creditNames(credits, ArtistRoleMain, ArtistRoleFeatured)
+	if len(names) == 0 {
+		return splitArtists(artists)
+	}
+	for i, name := range names {
+		names[i] = strings.ToLower(strings.TrimSpace(name))
+	}
+	return names
+}
+
+// setCommentValues replaces every comment named key with one per value,
+// leaving existing comments when there are no values.
+func setCommentValues(cmt *flacvorbis.MetaDataBlockVorbisComment, key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	removeComments(cmt, key)
+	for _, value := range values {
+		cmt.Comments = append(cmt.Comments, key+"="+value)
+	}
+}
+
+// qobuzPerformerRoles maps the roles in Qobuz's performers string to credit
+// roles. Vocal and instrument roles are kept as performer roles; roles mapped
+// to "" are recognised but not kept.
+var qobuzPerformerRoles = map[string]string{
+	"mainartist":          ArtistRoleMain,
+	"featuredartist":      ArtistRoleFeatured,
+	"featuring":           ArtistRoleFeatured,
+	"remixer":             ArtistRoleRemixer,
+	"composer":            ArtistRoleComposer,
+	"composerlyricist":    ArtistRoleComposer,
+	"writer":              ArtistRoleComposer,
+	"producer":            ArtistRoleProducer,
+	"coproducer":          ArtistRoleProducer,
+	"executiveproducer":   "",
+	"lyricist":            "",
+	"author":              "",
+	"performer":           "",
+	"associatedperformer": "",
+	"arranger":            "",
+	"conductor":           "",
+	"engineer":            "",
+	"masteringengineer":   "",
+	"mixingengineer":      "",
+	"recordingengineer":   "",
+	"mixer":               "",
+	"programmer":          "",
+	"musicpublisher":      "",
+	"label":               "",
+	"vocals":              "vocals",
+	"leadvocals":          "lead vocals",
+	"backgroundvocals":    "background vocals",
+	"guitar":              "guitar",
+	"bass":                "bass",
+	"bassguitar":          "bass guitar",
+	"drums":               "drums",
+	"percussion":          "percussion",
+	"keyboards":           "keyboards",
+	"piano":               "piano",
+	"synthesizer":         "synthesizer",
+}
+
+// parseQobuzPerformers parses Qobuz's performers string, in which entries
+// such as "Tyler, The Creator, MainArtist, Composer" are separated by " - ".
+// The roles are peeled off the end of each entry, so commas inside the
+// artist's name survive.
+func parseQobuzPerformers(performers string) []ArtistCredit {
+	var credits []ArtistCredit
+	for _, entry := range strings.Split(performers, " - ") {
+		parts := strings.Split(entry, ",")
+		var roles []string
+		for len(parts) > 1 {
+			role, known := qobuzPerformerRoles[strings.ToLower(strings.Join(strings.Fields(parts[len(parts)-1]), ""))]
+			if !known {
+				break
+			}
+			if role != "" && !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+			parts = parts[:len(parts)-1]
+		}
+		name := strings.TrimSpace(strings.Join(parts, ","))
+		if name == "" {
+			continue
+		}
+		// Roles were collected from the end; restore their order.
+		for i := len(roles) - 1; i >= 0; i-- {
+			credits = append(credits, ArtistCredit{Name: name, Role: roles[i]})
+		}
+	}
+	return credits
+}
@@ -0,0 +1,141 @@
+package gobackend
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-flac/flacvorbis/v2"
+	"github.com/go-flac/go-flac/v2"
+)
+
+func TestParseQobuzPerformers(t *testing.T) {
+	credits := parseQobuzPerformers("Tyler, The Creator, MainArtist, Composer, ComposerLyricist - Kali Uchis, FeaturedArtist - Rick Rubin, Producer, Engineer - Earth, Wind & Fire, AssociatedPerformer")
+	want := []ArtistCredit{
+		{Name: "Tyler, The Creator", Role: ArtistRoleMain},
+		{Name: "Tyler, The Creator", Role: ArtistRoleComposer},
+		{Name: "Kali Uchis", Role: ArtistRoleFeatured},
+		{Name: "Rick Rubin", Role: ArtistRoleProducer},
+	}
+	if !reflect.DeepEqual(credits, want) {
+		t.Fatalf("unexpected credits: %+v", credits)
+	}
+}
+
+func TestQobuzPerformerRolesEmbedded(t *testing.T) {
+	credits := parseQobuzPerformers("Kali Uchis, FeaturedArtist, Vocals - Thundercat, Bass Guitar, Background Vocals - Rick Rubin, Producer")
+	path := writeTestFLAC(t, t.TempDir(), "song.flac", 44100, 16)
+	if err := EmbedMetadata(path, Metadata{Artist: "Kali Uchis", ArtistCredits: credits}, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+	f, err := flac.ParseFile(path)
+	if err != nil {
+		t.Fatalf("failed to parse FLAC: %v", err)
+	}
+	var got []string
+	for _, block := range f.Meta {
+		if block.Type != flac.VorbisComment {
+			continue
+		}
+		cmt, _ := flacvorbis.ParseFromMetaDataBlock(*block)
+		for _, comment := range cmt.Comments {
+			if strings.HasPrefix(comment, "PERFORMER=") {
+				got = append(got, comment)
+			}
+		}
+	}
+	want := []string{
+		"PERFORMER=Kali Uchis (vocals)",
+		"PERFORMER=Thundercat (bass guitar)",
+		"PERFORMER=Thundercat (background vocals)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected performer comments: %q", got)
+	}
+}
+
+func TestMergeArtistCredits(t *testing.T) {
+	base := []ArtistCredit{{Name: "Tyler, The Creator", Role: ArtistRoleMain}, {Name: "Kali Uchis", Role: ArtistRoleMain}}
+	extra := []ArtistCredit{
+		{Name: "tyler, the creator", Role: ArtistRoleMain},
+		{Name: "Kali Uchis", Role: ArtistRoleFeatured},
+		{Name: "Tyler, The Creator", Role: ArtistRoleComposer},
+	}
+	merged := mergeArtistCredits(base, extra)
+	if len(merged) != 3 || merged[1].Role != ArtistRoleMain || merged[2].Role != ArtistRoleComposer {
+		t.Fatalf("unexpected merge: %+v", merged)
+	}
+}
+
+func TestArtistsMatchUsesCredits(t *testing.T) {
+	credits := []ArtistCredit{{Name: "Tyler, The Creator", Role: ArtistRoleMain}}
+	if !artistsMatch("Tyler, The Creator", "The Creator Band", nil) {
+		t.Fatal("expected the joined string to split into a false match")
+	}
+	if artistsMatch("Tyler, The Creator", "The Creator Band", credits) {
+		t.Fatal("expected credits to keep the name whole")
+	}
+	if !qobuzArtistsMatch("Tyler, The Creator", "Tyler, The Creator", credits) {
+		t.Fatal("expected the same artist to match")
+	}
+}
+
+func TestArtistCreditsEmbedded(t *testing.T) {
+	dir := t.TempDir()
+	credits := []ArtistCredit{
+		{Name: "Tyler, The Creator", Role: ArtistRoleMain},
+		{Name: "Kali Uchis", Role: ArtistRoleFeatured},
+		{Name: "Tyler, The Creator", Role: ArtistRoleComposer},
+		{Name: "Rick Rubin", Role: ArtistRoleProducer},
+		{Name: "Kali Uchis", Role: "vocals"},
+	}
+	metadata := Metadata{Artist: "Tyler, The Creator, Kali Uchis", Composer: "Old Composer", ArtistCredits: credits}
+
+	flacPath := writeTestFLAC(t, dir, "song.flac", 44100, 16)
+	if err := EmbedMetadata(flacPath, metadata, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+	f, err := flac.ParseFile(flacPath)
+	if err != nil {
+		t.Fatalf("failed to parse FLAC: %v", err)
+	}
+	var comments []string
+	for _, block := range f.Meta {
+		if block.Type == flac.VorbisComment {
+			cmt, _ := flacvorbis.ParseFromMetaDataBlock(*block)
+			comments = cmt.Comments
+		}
+	}
+	var got []string
+	for _, comment := range comments {
+		if strings.HasPrefix(comment, "ARTISTS=") || strings.HasPrefix(comment, "COMPOSER=") || strings.HasPrefix(comment, "PERFORMER=") || strings.HasPrefix(comment, "PRODUCER=") {
+			got = append(got, comment)
+		}
+	}
+	want := []string{
+		"ARTISTS=Tyler, The Creator",
+		"ARTISTS=Kali Uchis",
+		"COMPOSER=Tyler, The Creator",
+		"PERFORMER=Kali Uchis (vocals)",
+		"PRODUCER=Rick Rubin",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected credit comments: %q", got)
+	}
+
+	mp3Path := writeTestMP3(t, dir, "song.mp3", map[string]string{"TIT2": "Song"})
+	if err := EmbedMetadata(mp3Path, metadata, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+	data, _ := os.ReadFile(mp3Path)
+	if !bytes.Contains(data, []byte("ARTISTS\x00Tyler, The Creator\x00Kali Uchis")) ||
+		!bytes.Contains(data, []byte("producer\x00Rick Rubin")) {
+		t.Fatal("expected ARTISTS and TIPL frames")
+	}
+	read, err := ReadID3Tags(mp3Path)
+	if err != nil || read.Composer != "Tyler, The Creator" {
+		t.Fatalf("unexpected composer: %+v, %v", read, err)
+	}
+}
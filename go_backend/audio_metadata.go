@@ -28,6 +28,7 @@ type AudioMetadata struct {
 	Copyright   string
 	Composer    string
 	Comment     string
+	Provenance  *Provenance
 }
 
 // MP3Quality represents MP3 specific quality info
@@ -191,6 +192,12 @@ func parseID3v22Frames(data []byte, metadata *AudioMetadata, tagUnsync bool) {
 			desc, userValue := extractUserTextFrame(frameData)
 			if isLyricsDescription(desc) && userValue != "" && metadata.Lyrics == "" {
 				metadata.Lyrics = userValue
+			} else if strings.EqualFold(desc, "ISRC") {
+				if metadata.ISRC == "" {
+					metadata.ISRC = userValue
+				}
+			} else if userValue != "" {
+				setProvenanceTag(&metadata.Provenance, desc, userValue)
 			}
 		}
 
@@ -316,6 +323,12 @@ func parseID3v23Frames(data []byte, metadata *AudioMetadata, version byte, tagUn
 			desc, userValue := extractUserTextFrame(frameData)
 			if isLyricsDescription(desc) && userValue != "" && metadata.Lyrics == "" {
 				metadata.Lyrics = userValue
+			} else if strings.EqualFold(desc, "ISRC") {
+				if metadata.ISRC == "" {
+					metadata.ISRC = userValue
+				}
+			} else if userValue != "" {
+				setProvenanceTag(&metadata.Provenance, desc, userValue)
 			}
 		}
 
@@ -851,12 +864,13 @@ func ReadOggVorbisComments(filePath string) (*AudioMetadata, error) {
 }
 
 type oggPage struct {
+	header       []byte
 	headerType   byte
 	segmentTable []byte
 	data         []byte
 }
 
-func readOggPageWithHeader(file *os.File) (*oggPage, error) {
+func readOggPageWithHeader(file io.Reader) (*oggPage, error) {
 	header := make([]byte, 27)
 	if _, err := io.ReadFull(file, header); err != nil {
 		return nil, err
@@ -885,6 +899,7 @@ func readOggPageWithHeader(file *os.File) (*oggPage, error) {
 	}
 
 	return &oggPage{
+		header:       header,
 		headerType:   headerType,
 		segmentTable: segmentTable,
 		data:         pageData,
@@ -1064,6 +1079,8 @@ func parseVorbisComments(data []byte, metadata *AudioMetadata) {
 			metadata.Label = value
 		case "COPYRIGHT":
 			metadata.Copyright = value
+		default:
+			setProvenanceTag(&metadata.Provenance, key, value)
 		}
 	}
 }
@@ -1570,8 +1587,8 @@ func extractAnyCoverArt(filePath string) ([]byte, string, error) {
 	case ".opus", ".ogg":
 		return extractOggCoverArt(filePath)
 
-	case ".m4a":
-		return nil, "", fmt.Errorf("M4A cover extraction not yet supported")
+	case ".m4a", ".mp4", ".m4b":
+		return extractM4ACoverArt(filePath)
 
 	default:
 		return nil, "", fmt.Errorf("unsupported format: %s", ext)
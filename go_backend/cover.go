@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -24,11 +26,76 @@ func convertSmallToMedium(imageURL string) string {
 	return imageURL
 }
 
+// Tracks of one album share a cover URL, so recently fetched covers are kept
+// briefly to avoid downloading the same image once per track.
+const (
+	coverCacheTTL        = 10 * time.Minute
+	coverCacheMaxEntries = 8
+)
+
+type coverCacheEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+var (
+	coverCache   = make(map[string]coverCacheEntry)
+	coverCacheMu sync.Mutex
+)
+
+func coverCacheKey(coverURL string, maxQuality bool) string {
+	return fmt.Sprintf("%t|%s", maxQuality, coverURL)
+}
+
+func getCachedCover(key string) []byte {
+	coverCacheMu.Lock()
+	defer coverCacheMu.Unlock()
+
+	entry, ok := coverCache[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(coverCache, key)
+		return nil
+	}
+	return entry.data
+}
+
+func putCachedCover(key string, data []byte) {
+	coverCacheMu.Lock()
+	defer coverCacheMu.Unlock()
+
+	now := time.Now()
+	for k, entry := range coverCache {
+		if now.After(entry.expiresAt) {
+			delete(coverCache, k)
+		}
+	}
+	if len(coverCache) >= coverCacheMaxEntries {
+		var oldestKey string
+		var oldest time.Time
+		for k, entry := range coverCache {
+			if oldestKey == "" || entry.expiresAt.Before(oldest) {
+				oldestKey, oldest = k, entry.expiresAt
+			}
+		}
+		delete(coverCache, oldestKey)
+	}
+	coverCache[key] = coverCacheEntry{data: data, expiresAt: now.Add(coverCacheTTL)}
+}
+
 func downloadCoverToMemory(coverURL string, maxQuality bool) ([]byte, error) {
 	if coverURL == "" {
 		return nil, fmt.Errorf("no cover URL provided")
 	}
 
+	cacheKey := coverCacheKey(coverURL, maxQuality)
+	if data := getCachedCover(cacheKey); data != nil {
+		GoLog("[Cover] Using cached cover (%d KB)", len(data)/1024)
+		return data, nil
+	}
+
 	GoLog("[Cover] Original URL: %s", coverURL)
 
 	downloadURL := convertSmallToMedium(coverURL)
@@ -82,6 +149,7 @@ func downloadCoverToMemory(coverURL string, maxQuality bool) ([]byte, error) {
 	}
 	GoLog("[Cover] Downloaded %d KB (%s)", sizeKB, resolution)
 
+	putCachedCover(cacheKey, data)
 	return data, nil
 }
 
@@ -0,0 +1,203 @@
+package gobackend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	dashSegmentWorkers    = 6
+	dashSegmentMaxRetries = 3
+	dashSegmentRetryDelay = 500 * time.Millisecond
+)
+
+type dashSegmentResult struct {
+	data []byte
+	err  error
+}
+
+// dashSegmentFetcher downloads DASH segments concurrently and hands them back
+// strictly in manifest order. At most `workers` segments are fetched or held
+// in memory at once, so a slow segment stalls the window instead of letting
+// buffered data grow without bound.
+type dashSegmentFetcher struct {
+	client  *http.Client
+	itemID  string
+	workers int
+
+	// received counts bytes read from the network across all workers,
+	// including segments not yet written, so progress moves while the
+	// head-of-line segment is still downloading.
+	received  atomic.Int64
+	completed atomic.Int64
+}
+
+func newDashSegmentFetcher(client *http.Client, itemID string) *dashSegmentFetcher {
+	return &dashSegmentFetcher{
+		client:  client,
+		itemID:  itemID,
+		workers: dashSegmentWorkers,
+	}
+}
+
+// fetchInto downloads urls and writes each one to out in order. The first
+// error stops scheduling new segments and is returned after in-flight fetches
+// are cancelled.
+func (f *dashSegmentFetcher) fetchInto(ctx context.Context, urls []string, out io.Writer) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	total := len(urls)
+	results := make([]chan dashSegmentResult, total)
+	for i := range results {
+		results[i] = make(chan dashSegmentResult, 1)
+	}
+
+	slots := make(chan struct{}, f.workers)
+	go func() {
+		for i, segmentURL := range urls {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(i int, segmentURL string) {
+				data, err := f.fetchSegment(ctx, i, segmentURL)
+				results[i] <- dashSegmentResult{data: data, err: err}
+			}(i, segmentURL)
+		}
+	}()
+
+	startTime := time.Now()
+	var written int64
+	for i := 0; i < total; i++ {
+		var result dashSegmentResult
+		select {
+		case result = <-results[i]:
+		case <-ctx.Done():
+			return written, ctx.Err()
+		}
+		<-slots
+
+		if result.err != nil {
+			return written, result.err
+		}
+		n, err := out.Write(result.data)
+		written += int64(n)
+		if err != nil {
+			return written, fmt.Errorf("failed to write segment %d: %w", i+1, err)
+		}
+
+		done := f.completed.Add(1)
+		if i%10 == 0 || i == total-1 {
+			GoLog("[Tidal] Wrote segment %d/%d (%.2f MB)\n", i+1, total, float64(written)/(1024*1024))
+		}
+		f.reportProgress(int(done), total, written, startTime)
+	}
+
+	return written, nil
+}
+
+// reportProgress publishes byte progress. The total is extrapolated from the
+// average size of completed segments, which converges quickly because DASH
+// segments have a fixed duration.
+func (f *dashSegmentFetcher) reportProgress(done, total int, written int64, startTime time.Time) {
+	if f.itemID == "" || done == 0 {
+		return
+	}
+
+	received := f.received.Load()
+	estimatedTotal := written * int64(total) / int64(done)
+	if received > estimatedTotal {
+		estimatedTotal = received
+	}
+
+	var speedMBps float64
+	if elapsed := time.Since(startTime).Seconds(); elapsed > 0 {
+		speedMBps = float64(received) / (1024 * 1024) / elapsed
+	}
+
+	SetItemBytesTotal(f.itemID, estimatedTotal)
+	SetItemBytesReceivedWithSpeed(f.itemID, received, speedMBps)
+}
+
+// fetchSegment downloads one segment, retrying network errors and 5xx/429
+// responses. Other HTTP errors (an expired signed URL, for example) fail
+// immediately since retrying will not help.
+func (f *dashSegmentFetcher) fetchSegment(ctx context.Context, index int, segmentURL string) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt < dashSegmentMaxRetries; attempt++ {
+		if attempt > 0 {
+			GoLog("[Tidal] Retrying segment %d (attempt %d/%d): %v\n", index+1, attempt+1, dashSegmentMaxRetries, lastErr)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(dashSegmentRetryDelay * time.Duration(attempt)):
+			}
+		}
+		if isDownloadCancelled(f.itemID) {
+			return nil, ErrDownloadCancelled
+		}
+
+		data, retry, err := f.fetchSegmentOnce(ctx, index, segmentURL)
+		if err == nil {
+			return data, nil
+		}
+		if isDownloadCancelled(f.itemID) {
+			return nil, ErrDownloadCancelled
+		}
+		if !retry || ctx.Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (f *dashSegmentFetcher) fetchSegmentOnce(ctx context.Context, index int, segmentURL string) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", segmentURL, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create segment %d request: %w", index+1, err)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to download segment %d: %w", index+1, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retry, fmt.Errorf("segment %d download failed with status %d", index+1, resp.StatusCode)
+	}
+
+	var buf bytes.Buffer
+	if resp.ContentLength > 0 {
+		buf.Grow(int(resp.ContentLength))
+	}
+	n, err := io.Copy(&buf, &countingReader{r: resp.Body, counter: &f.received})
+	if err != nil {
+		// Drop the bytes of the failed attempt so the retry is not double counted.
+		f.received.Add(-n)
+		return nil, true, fmt.Errorf("failed to read segment %d: %w", index+1, err)
+	}
+	return buf.Bytes(), false, nil
+}
+
+type countingReader struct {
+	r       io.Reader
+	counter *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.counter.Add(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,105 @@
+package gobackend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDashSegmentFetcher_WritesInOrderAndRetries(t *testing.T) {
+	const segmentCount = 40
+
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	failedOnce := make(map[int]bool)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		index, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/seg/"))
+
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		shouldFail := index%13 == 3 && !failedOnce[index]
+		failedOnce[index] = true
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+
+		// Later segments answer faster so completion order differs from manifest order.
+		time.Sleep(time.Duration(segmentCount-index) * time.Millisecond / 4)
+
+		if shouldFail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "[%03d]", index)
+	}))
+	defer server.Close()
+
+	urls := make([]string, segmentCount)
+	var want bytes.Buffer
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/seg/%d", server.URL, i)
+		fmt.Fprintf(&want, "[%03d]", i)
+	}
+
+	itemID := "dash-test"
+	StartItemProgress(itemID)
+	defer RemoveItemProgress(itemID)
+
+	fetcher := newDashSegmentFetcher(server.Client(), itemID)
+	var out bytes.Buffer
+	written, err := fetcher.fetchInto(context.Background(), urls, &out)
+	if err != nil {
+		t.Fatalf("fetchInto failed: %v", err)
+	}
+
+	if out.String() != want.String() {
+		t.Fatalf("segments written out of order:\n got %s\nwant %s", out.String(), want.String())
+	}
+	if written != int64(want.Len()) {
+		t.Fatalf("expected %d bytes written, got %d", want.Len(), written)
+	}
+	if maxActive > dashSegmentWorkers {
+		t.Fatalf("expected at most %d concurrent requests, saw %d", dashSegmentWorkers, maxActive)
+	}
+	if got := fetcher.received.Load(); got != written {
+		t.Fatalf("expected received bytes %d to match written %d", got, written)
+	}
+}
+
+func TestDashSegmentFetcher_StopsOnPermanentError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/2") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/0", server.URL + "/1", server.URL + "/2", server.URL + "/3"}
+	fetcher := newDashSegmentFetcher(server.Client(), "")
+
+	var out bytes.Buffer
+	_, err := fetcher.fetchInto(context.Background(), urls, &out)
+	if err == nil || !strings.Contains(err.Error(), "segment 3 download failed with status 403") {
+		t.Fatalf("expected segment 3 to fail with 403, got %v", err)
+	}
+	if out.String() != "okok" {
+		t.Fatalf("expected only segments before the failure to be written, got %q", out.String())
+	}
+}
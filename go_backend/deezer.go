@@ -182,6 +182,7 @@ type deezerArtist struct {
 	PictureBig    string `json:"picture_big"`
 	PictureXL     string `json:"picture_xl"`
 	NbFan         int    `json:"nb_fan"`
+	Role          string `json:"role,omitempty"`
 }
 
 type deezerAlbumSimple struct {
@@ -234,7 +235,27 @@ func (c *DeezerClient) convertTrack(track deezerTrack) TrackMetadata {
 		DiscNumber:  track.DiskNumber,
 		ExternalURL: track.Link,
 		ISRC:        track.ISRC,
+
+		ArtistCredits: deezerArtistCredits(track),
+	}
+}
+
+// deezerArtistCredits returns the track's contributors, which Deezer marks
+// as "Main" or "Featured".
+func deezerArtistCredits(track deezerTrack) []ArtistCredit {
+	contributors := track.Contributors
+	if len(contributors) == 0 {
+		contributors = []deezerArtist{track.Artist}
+	}
+	credits := make([]ArtistCredit, 0, len(contributors))
+	for _, a := range contributors {
+		role := ArtistRoleMain
+		if strings.EqualFold(a.Role, "Featured") {
+			role = ArtistRoleFeatured
+		}
+		credits = append(credits, ArtistCredit{Name: a.Name, ID: fmt.Sprintf("%d", a.ID), Role: role})
 	}
+	return credits
 }
 
 type deezerGenre struct {
@@ -0,0 +1,265 @@
+package gobackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// DownloadErrorKind is the stable code reported as DownloadResponse.ErrorType.
+// Values are part of the JSON contract with the app; add new kinds rather than
+// renaming existing ones.
+type DownloadErrorKind string
+
+const (
+	ErrKindUnknown            DownloadErrorKind = "unknown"
+	ErrKindNotFound           DownloadErrorKind = "not_found"
+	ErrKindRegionLocked       DownloadErrorKind = "region_locked"
+	ErrKindRateLimited        DownloadErrorKind = "rate_limit"
+	ErrKindISPBlocked         DownloadErrorKind = "isp_blocked"
+	ErrKindAuthRequired       DownloadErrorKind = "auth_required"
+	ErrKindQualityUnavailable DownloadErrorKind = "quality_unavailable"
+	ErrKindCancelled          DownloadErrorKind = "cancelled"
+	ErrKindDiskFull           DownloadErrorKind = "disk_full"
+	ErrKindProviderBroken     DownloadErrorKind = "provider_broken"
+	ErrKindPermission         DownloadErrorKind = "permission"
+	ErrKindNetwork            DownloadErrorKind = "network"
+)
+
+// Retryable reports whether the same provider may succeed if asked again.
+func (k DownloadErrorKind) Retryable() bool {
+	switch k {
+	case ErrKindRateLimited, ErrKindNetwork, ErrKindProviderBroken:
+		return true
+	}
+	return false
+}
+
+// DownloadError is a classified download failure. It wraps the underlying
+// cause so errors.Is/As keep working on the original error.
+type DownloadError struct {
+	Kind     DownloadErrorKind
+	Provider string
+	Message  string
+	Err      error
+}
+
+// Error keeps the provider's original wording; Provider is metadata only so
+// existing messages shown to users do not change.
+func (e *DownloadError) Error() string {
+	switch {
+	case e.Err == nil:
+		return e.Message
+	case e.Message == "":
+		return e.Err.Error()
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// Is lets errors.Is(err, &DownloadError{Kind: ErrKindNotFound}) match by kind.
+func (e *DownloadError) Is(target error) bool {
+	t, ok := target.(*DownloadError)
+	return ok && t.Kind == e.Kind && t.Provider == "" && t.Message == "" && t.Err == nil
+}
+
+func newDownloadError(kind DownloadErrorKind, provider string, cause error, format string, args ...interface{}) *DownloadError {
+	return &DownloadError{
+		Kind:     kind,
+		Provider: provider,
+		Message:  fmt.Sprintf(format, args...),
+		Err:      cause,
+	}
+}
+
+// kindForHTTPStatus maps an unsuccessful provider API status to an error kind.
+func kindForHTTPStatus(statusCode int) DownloadErrorKind {
+	switch {
+	case statusCode == http.StatusNotFound || statusCode == http.StatusGone:
+		return ErrKindNotFound
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrKindAuthRequired
+	case statusCode == http.StatusUnavailableForLegalReasons:
+		return ErrKindRegionLocked
+	case statusCode == http.StatusTooManyRequests:
+		return ErrKindRateLimited
+	case statusCode >= 500:
+		return ErrKindProviderBroken
+	}
+	return ErrKindUnknown
+}
+
+// httpStatusError builds a DownloadError for an unexpected HTTP status.
+func httpStatusError(provider string, statusCode int, format string, args ...interface{}) *DownloadError {
+	msg := fmt.Sprintf(format, args...)
+	if msg == "" {
+		msg = fmt.Sprintf("HTTP %d", statusCode)
+	} else {
+		msg = fmt.Sprintf("%s: HTTP %d", msg, statusCode)
+	}
+	return &DownloadError{
+		Kind:     kindForHTTPStatus(statusCode),
+		Provider: provider,
+		Message:  msg,
+	}
+}
+
+// isTransientNetworkError reports connection-level failures worth retrying:
+// timeouts, resets, refused connections and truncated responses.
+func isTransientNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	// Some transports only surface these as text (e.g. HTTP/2 stream resets).
+	errStr := strings.ToLower(err.Error())
+	return strings.Contains(errStr, "timeout") ||
+		strings.Contains(errStr, "reset") ||
+		strings.Contains(errStr, "connection refused") ||
+		strings.Contains(errStr, "eof")
+}
+
+// ClassifyDownloadError returns the kind for err. Typed errors are checked
+// first; plain messages (e.g. from extensions) fall back to text matching.
+func ClassifyDownloadError(err error) DownloadErrorKind {
+	if err == nil {
+		return ErrKindUnknown
+	}
+
+	var dlErr *DownloadError
+	if errors.As(err, &dlErr) && dlErr.Kind != ErrKindUnknown {
+		return dlErr.Kind
+	}
+
+	var ispErr *ISPBlockingError
+	switch {
+	case errors.Is(err, ErrDownloadCancelled) || errors.Is(err, context.Canceled):
+		return ErrKindCancelled
+	case errors.As(err, &ispErr):
+		return ErrKindISPBlocked
+	case errors.Is(err, syscall.ENOSPC):
+		return ErrKindDiskFull
+	case errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EROFS):
+		return ErrKindPermission
+	}
+
+	return classifyErrorMessage(err.Error())
+}
+
+// classifyErrorMessage is the text-based fallback for errors that arrive as
+// strings only.
+func classifyErrorMessage(msg string) DownloadErrorKind {
+	lowerMsg := strings.ToLower(msg)
+	containsAny := func(patterns ...string) bool {
+		for _, p := range patterns {
+			if strings.Contains(lowerMsg, p) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case containsAny("isp blocking", "try using vpn", "change dns"):
+		return ErrKindISPBlocked
+	case containsAny("cancel"):
+		return ErrKindCancelled
+	case containsAny("no space left", "disk full", "not enough space"):
+		return ErrKindDiskFull
+	case containsAny("permission", "operation not permitted", "access denied",
+		"failed to create file", "failed to create directory"):
+		return ErrKindPermission
+	case containsAny("region locked", "region-locked", "not available in your region",
+		"not available in your country", "geo-restricted", "geo restricted"):
+		return ErrKindRegionLocked
+	case containsAny("unauthorized", "login required", "authentication", "invalid token", "http 401"):
+		return ErrKindAuthRequired
+	case containsAny("not found", "not available", "no results", "all services failed"):
+		return ErrKindNotFound
+	case containsAny("rate limit", "429", "too many requests"):
+		return ErrKindRateLimited
+	case containsAny("network", "connection", "timeout", "dial"):
+		return ErrKindNetwork
+	}
+	return ErrKindUnknown
+}
+
+// downloadErrorResponse converts an error into a failed DownloadResponse with
+// its stable error code.
+func downloadErrorResponse(err error) DownloadResponse {
+	kind := ClassifyDownloadError(err)
+	return DownloadResponse{
+		Success:   false,
+		Error:     err.Error(),
+		ErrorType: string(kind),
+		Retryable: kind.Retryable(),
+	}
+}
+
+// parseDownloadErrorKind accepts an error_type reported by an extension if it
+// is one of the known codes.
+func parseDownloadErrorKind(code string) (DownloadErrorKind, bool) {
+	switch kind := DownloadErrorKind(strings.ToLower(strings.TrimSpace(code))); kind {
+	case ErrKindNotFound, ErrKindRegionLocked, ErrKindRateLimited, ErrKindISPBlocked,
+		ErrKindAuthRequired, ErrKindQualityUnavailable, ErrKindCancelled, ErrKindDiskFull,
+		ErrKindProviderBroken, ErrKindPermission, ErrKindNetwork:
+		return kind, true
+	}
+	return ErrKindUnknown, false
+}
+
+// reportedDownloadError turns an error message/type pair returned by an
+// extension into a DownloadError.
+func reportedDownloadError(provider, errorType, message string) *DownloadError {
+	kind, ok := parseDownloadErrorKind(errorType)
+	if !ok {
+		kind = classifyErrorMessage(message)
+	}
+	return &DownloadError{Kind: kind, Provider: provider, Message: message}
+}
+
+// fallbackFailureResponse builds the response after every provider in a
+// fallback chain failed. The error code follows the last failure; if every
+// attempt was rejected by the quality policy it is quality_unavailable.
+func fallbackFailureResponse(prefix string, lastErr error, attempts []ProviderAttempt, rejectedCount int) DownloadResponse {
+	if lastErr == nil {
+		return DownloadResponse{
+			Success:   false,
+			Error:     prefix + ": no attempts allowed",
+			ErrorType: string(ErrKindNotFound),
+			Attempts:  attempts,
+		}
+	}
+
+	kind := ClassifyDownloadError(lastErr)
+	if rejectedCount > 0 && rejectedCount == len(attempts) {
+		kind = ErrKindQualityUnavailable
+	} else if kind == ErrKindUnknown {
+		kind = ErrKindNotFound
+	}
+	return DownloadResponse{
+		Success:   false,
+		Error:     prefix + ". Last error: " + lastErr.Error(),
+		ErrorType: string(kind),
+		Retryable: kind.Retryable(),
+		Attempts:  attempts,
+	}
+}
@@ -0,0 +1,92 @@
+package gobackend
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyDownloadError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want DownloadErrorKind
+	}{
+		{"typed through wrapping", fmt.Errorf("tidal search failed: %w", newDownloadError(ErrKindNotFound, "tidal", nil, "no tracks found for ISRC: X")), ErrKindNotFound},
+		{"http 404", httpStatusError("qobuz", 404, "search failed"), ErrKindNotFound},
+		{"http 403", httpStatusError("", 403, "download failed"), ErrKindAuthRequired},
+		{"http 451", httpStatusError("", 451, ""), ErrKindRegionLocked},
+		{"http 429", httpStatusError("", 429, ""), ErrKindRateLimited},
+		{"http 503", retryable(httpStatusError("", 503, "download failed")), ErrKindProviderBroken},
+		{"cancelled", fmt.Errorf("download failed: %w", ErrDownloadCancelled), ErrKindCancelled},
+		{"isp blocking", &ISPBlockingError{Domain: "x", Reason: "dns"}, ErrKindISPBlocked},
+		{"isp check", WrapErrorWithISPCheck(&net.DNSError{Err: "no such host", Name: "x", IsNotFound: true}, "https://x/", "HTTP"), ErrKindISPBlocked},
+		{"disk full", fmt.Errorf("write: %w", &os.PathError{Op: "write", Path: "/x", Err: syscall.ENOSPC}), ErrKindDiskFull},
+		{"extension reported type", reportedDownloadError("ext", "region_locked", "nope"), ErrKindRegionLocked},
+		{"extension message fallback", reportedDownloadError("ext", "script_error", "Track not found"), ErrKindNotFound},
+		{"plain text", errors.New("something odd"), ErrKindUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := ClassifyDownloadError(tt.err); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestDoRequestWithRetryReturnsTypedISPBlock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnavailableForLegalReasons)
+		w.Write([]byte("This site is blocked by court order"))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	_, err := DoRequestWithRetry(server.Client(), req, RetryConfig{})
+	var ispErr *ISPBlockingError
+	if !errors.As(err, &ispErr) || ClassifyDownloadError(err) != ErrKindISPBlocked {
+		t.Fatalf("expected a typed ISP blocking error, got %v", err)
+	}
+}
+
+func TestDownloadErrorKeepsMessageAndCause(t *testing.T) {
+	cause := errors.New("connection reset by peer")
+	err := newDownloadError(ErrKindNetwork, "amazon", cause, "failed to call Amazon API")
+	if err.Error() != "failed to call Amazon API: connection reset by peer" {
+		t.Fatalf("unexpected message: %q", err.Error())
+	}
+	if !errors.Is(err, cause) {
+		t.Fatal("expected cause to be unwrappable")
+	}
+	if !errors.Is(fmt.Errorf("wrapped: %w", err), &DownloadError{Kind: ErrKindNetwork}) {
+		t.Fatal("expected errors.Is to match by kind")
+	}
+
+	resp := downloadErrorResponse(err)
+	if resp.ErrorType != "network" || !resp.Retryable {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestFallbackFailureResponse(t *testing.T) {
+	attempts := []ProviderAttempt{{Service: "tidal", Rejected: true}, {Service: "qobuz"}}
+	resp := fallbackFailureResponse("All services failed", httpStatusError("qobuz", 429, ""), attempts, 1)
+	if resp.ErrorType != string(ErrKindRateLimited) || len(resp.Attempts) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	resp = fallbackFailureResponse("All services failed", errors.New("qobuz: 16-bit"), attempts[:1], 1)
+	if resp.ErrorType != string(ErrKindQualityUnavailable) {
+		t.Fatalf("expected quality_unavailable, got %s", resp.ErrorType)
+	}
+
+	resp = fallbackFailureResponse("All services failed", errors.New("weird"), attempts, 0)
+	if resp.ErrorType != string(ErrKindNotFound) {
+		t.Fatalf("expected not_found default, got %s", resp.ErrorType)
+	}
+}
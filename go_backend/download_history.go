@@ -0,0 +1,398 @@
+package gobackend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	downloadHistoryFileName = "download_history.jsonl"
+	maxHistoryLineSize      = 1024 * 1024
+)
+
+// HistoryRecord is one download attempt and its outcome, including where the
+// file came from: service, mirror, the provider's track ID, delivered quality
+// and lyrics source.
+type HistoryRecord struct {
+	ID               string            `json:"id"`
+	Timestamp        int64             `json:"timestamp"`
+	DurationMS       int64             `json:"duration_ms"`
+	ItemID           string            `json:"item_id,omitempty"`
+	Success          bool              `json:"success"`
+	AlreadyExists    bool              `json:"already_exists,omitempty"`
+	RequestedService string            `json:"requested_service,omitempty"`
+	Service          string            `json:"service,omitempty"`
+	Mirror           string            `json:"mirror,omitempty"`
+	ProviderTrackID  string            `json:"provider_track_id,omitempty"`
+	SpotifyID        string            `json:"spotify_id,omitempty"`
+	ISRC             string            `json:"isrc,omitempty"`
+	TrackName        string            `json:"track_name"`
+	ArtistName       string            `json:"artist_name"`
+	AlbumName        string            `json:"album_name,omitempty"`
+	FilePath         string            `json:"file_path,omitempty"`
+	ReplacedFile     string            `json:"replaced_file,omitempty"`
+	RequestedQuality string            `json:"requested_quality,omitempty"`
+	BitDepth         int               `json:"bit_depth,omitempty"`
+	SampleRate       int               `json:"sample_rate,omitempty"`
+	LyricsSource     string            `json:"lyrics_source,omitempty"`
+	Error            string            `json:"error,omitempty"`
+	ErrorType        string            `json:"error_type,omitempty"`
+	Attempts         []ProviderAttempt `json:"attempts,omitempty"`
+}
+
+// HistoryQuery filters history records. Empty fields match everything; From
+// and To are Unix milliseconds, inclusive. Text matches title, artist or album.
+type HistoryQuery struct {
+	ISRC    string `json:"isrc,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Service string `json:"service,omitempty"`
+	Text    string `json:"text,omitempty"`
+	From    int64  `json:"from,omitempty"`
+	To      int64  `json:"to,omitempty"`
+	Status  string `json:"status,omitempty"` // "success" or "failed"
+	Limit   int    `json:"limit,omitempty"`
+	Offset  int    `json:"offset,omitempty"`
+}
+
+// HistoryPruneRequest selects records to delete. Records older than Before
+// (Unix milliseconds) are removed; KeepLatest > 0 additionally caps the
+// history to the newest N records. FailedOnly restricts both to failures.
+type HistoryPruneRequest struct {
+	Before     int64 `json:"before,omitempty"`
+	KeepLatest int   `json:"keep_latest,omitempty"`
+	FailedOnly bool  `json:"failed_only,omitempty"`
+}
+
+type HistoryQueryResult struct {
+	Total   int             `json:"total"`
+	Records []HistoryRecord `json:"records"`
+}
+
+// DownloadHistory is an append-only log of download outcomes. Each record is
+// one JSON line, so a crash mid-write loses at most the last record. Nothing
+// is recorded until SetDataDir is called.
+type DownloadHistory struct {
+	mu        sync.Mutex
+	path      string
+	records   []HistoryRecord
+	idCounter int64
+	now       func() time.Time
+}
+
+var (
+	globalDownloadHistory     *DownloadHistory
+	globalDownloadHistoryOnce sync.Once
+)
+
+func GetDownloadHistory() *DownloadHistory {
+	globalDownloadHistoryOnce.Do(func() {
+		globalDownloadHistory = newDownloadHistory()
+	})
+	return globalDownloadHistory
+}
+
+func newDownloadHistory() *DownloadHistory {
+	return &DownloadHistory{now: time.Now}
+}
+
+// SetDataDir opens the history file in dataDir and loads existing records.
+func (h *DownloadHistory) SetDataDir(dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.path = filepath.Join(dataDir, downloadHistoryFileName)
+	records, skipped, err := readHistoryFile(h.path)
+	if err != nil {
+		return err
+	}
+	h.records = records
+
+	GoLog("[History] Loaded %d records (%d unreadable lines skipped)\n", len(records), skipped)
+	return nil
+}
+
+func readHistoryFile(path string) ([]HistoryRecord, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, nil
+		}
+		return nil, 0, fmt.Errorf("failed to read history: %w", err)
+	}
+	defer f.Close()
+
+	var records []HistoryRecord
+	skipped := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxHistoryLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record HistoryRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			// A torn last line after a crash is expected; keep going.
+			skipped++
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read history: %w", err)
+	}
+	return records, skipped, nil
+}
+
+// newHistoryRecord builds the record for a finished DownloadByStrategy call.
+func newHistoryRecord(req DownloadRequest, resp DownloadResponse, elapsed time.Duration) HistoryRecord {
+	record := HistoryRecord{
+		DurationMS:       elapsed.Milliseconds(),
+		ItemID:           req.ItemID,
+		Success:          resp.Success,
+		AlreadyExists:    resp.AlreadyExists,
+		RequestedService: req.Service,
+		Service:          resp.Service,
+		Mirror:           resp.Mirror,
+		ProviderTrackID:  resp.ProviderTrackID,
+		SpotifyID:        req.SpotifyID,
+		ISRC:             firstNonEmpty(resp.ISRC, req.ISRC),
+		TrackName:        firstNonEmpty(resp.Title, req.TrackName),
+		ArtistName:       firstNonEmpty(resp.Artist, req.ArtistName),
+		AlbumName:        firstNonEmpty(resp.Album, req.AlbumName),
+		FilePath:         strings.TrimPrefix(resp.FilePath, "EXISTS:"),
+		ReplacedFile:     resp.ReplacedFile,
+		RequestedQuality: req.Quality,
+		BitDepth:         resp.ActualBitDepth,
+		SampleRate:       resp.ActualSampleRate,
+		LyricsSource:     resp.LyricsSource,
+		Error:            resp.Error,
+		ErrorType:        resp.ErrorType,
+		Attempts:         resp.Attempts,
+	}
+	if record.Service == "" && resp.Success {
+		record.Service = req.Service
+	}
+	return record
+}
+
+// Record appends record to the history. It is a no-op until SetDataDir has
+// been called.
+func (h *DownloadHistory) Record(record HistoryRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.path == "" {
+		return
+	}
+
+	now := h.now()
+	h.idCounter++
+	if record.ID == "" {
+		record.ID = fmt.Sprintf("h_%d_%d", now.UnixMilli(), h.idCounter)
+	}
+	if record.Timestamp == 0 {
+		record.Timestamp = now.UnixMilli()
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		GoLog("[History] Failed to encode record: %v\n", err)
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		GoLog("[History] Failed to open history: %v\n", err)
+		return
+	}
+	// A write torn by a crash leaves the last line unterminated; end it so
+	// the torn line is the only one lost.
+	if info, statErr := f.Stat(); statErr == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, readErr := f.ReadAt(last, info.Size()-1); readErr == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		GoLog("[History] Failed to write history: %v\n", err)
+		return
+	}
+
+	h.records = append(h.records, record)
+}
+
+func historyPathsEqual(recordPath, queryPath string) bool {
+	if recordPath == "" {
+		return false
+	}
+	if recordPath == queryPath {
+		return true
+	}
+	if strings.Contains(queryPath, "://") || strings.Contains(recordPath, "://") {
+		return false
+	}
+	return filepath.Clean(recordPath) == filepath.Clean(queryPath)
+}
+
+func (q HistoryQuery) matches(record *HistoryRecord) bool {
+	if q.ISRC != "" && !strings.EqualFold(record.ISRC, q.ISRC) {
+		return false
+	}
+	if q.Path != "" && !historyPathsEqual(record.FilePath, q.Path) {
+		return false
+	}
+	if q.Service != "" && !strings.EqualFold(record.Service, q.Service) {
+		return false
+	}
+	if q.From > 0 && record.Timestamp < q.From {
+		return false
+	}
+	if q.To > 0 && record.Timestamp > q.To {
+		return false
+	}
+	switch q.Status {
+	case "success":
+		if !record.Success {
+			return false
+		}
+	case "failed":
+		if record.Success {
+			return false
+		}
+	}
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		if !strings.Contains(strings.ToLower(record.TrackName), text) &&
+			!strings.Contains(strings.ToLower(record.ArtistName), text) &&
+			!strings.Contains(strings.ToLower(record.AlbumName), text) {
+			return false
+		}
+	}
+	return true
+}
+
+// Search returns matching records, newest first.
+func (h *DownloadHistory) Search(query HistoryQuery) HistoryQueryResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	matched := make([]HistoryRecord, 0)
+	for i := len(h.records) - 1; i >= 0; i-- {
+		if query.matches(&h.records[i]) {
+			matched = append(matched, h.records[i])
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Timestamp > matched[j].Timestamp
+	})
+
+	result := HistoryQueryResult{Total: len(matched)}
+	if query.Offset > 0 {
+		if query.Offset >= len(matched) {
+			matched = matched[:0]
+		} else {
+			matched = matched[query.Offset:]
+		}
+	}
+	if query.Limit > 0 && len(matched) > query.Limit {
+		matched = matched[:query.Limit]
+	}
+	result.Records = matched
+	return result
+}
+
+// Provenance returns the most recent successful download that produced path.
+func (h *DownloadHistory) Provenance(path string) (*HistoryRecord, bool) {
+	result := h.Search(HistoryQuery{Path: path, Status: "success", Limit: 1})
+	if len(result.Records) == 0 {
+		return nil, false
+	}
+	return &result.Records[0], true
+}
+
+// Prune deletes records selected by req, rewrites the history file and
+// returns how many records were removed.
+func (h *DownloadHistory) Prune(req HistoryPruneRequest) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.path == "" {
+		return 0, fmt.Errorf("download history is not initialized")
+	}
+
+	eligible := func(record *HistoryRecord) bool {
+		return !req.FailedOnly || !record.Success
+	}
+
+	drop := make([]bool, len(h.records))
+	if req.Before > 0 {
+		for i := range h.records {
+			if eligible(&h.records[i]) && h.records[i].Timestamp < req.Before {
+				drop[i] = true
+			}
+		}
+	}
+	if req.KeepLatest > 0 {
+		kept := 0
+		for i := len(h.records) - 1; i >= 0; i-- {
+			if drop[i] || !eligible(&h.records[i]) {
+				continue
+			}
+			kept++
+			if kept > req.KeepLatest {
+				drop[i] = true
+			}
+		}
+	}
+
+	remaining := make([]HistoryRecord, 0, len(h.records))
+	var buf bytes.Buffer
+	for i, record := range h.records {
+		if drop[i] {
+			continue
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			return 0, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		remaining = append(remaining, record)
+	}
+
+	removed := len(h.records) - len(remaining)
+	if removed == 0 {
+		return 0, nil
+	}
+	if err := writeFileAtomic(h.path, buf.Bytes()); err != nil {
+		return 0, fmt.Errorf("failed to rewrite history: %w", err)
+	}
+	h.records = remaining
+
+	GoLog("[History] Pruned %d records, %d left\n", removed, len(remaining))
+	return removed, nil
+}
+
+// parallelLyricsSource names the lyrics provider behind lyricsLRC, if any.
+func parallelLyricsSource(result *ParallelDownloadResult, lyricsLRC string) string {
+	if lyricsLRC == "" || result == nil || result.LyricsData == nil {
+		return ""
+	}
+	return result.LyricsData.Source
+}
@@ -0,0 +1,161 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestDownloadHistory(t *testing.T) (*DownloadHistory, string) {
+	t.Helper()
+	dir := t.TempDir()
+	h := newDownloadHistory()
+	clock := time.UnixMilli(1_700_000_000_000)
+	h.now = func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	}
+	if err := h.SetDataDir(dir); err != nil {
+		t.Fatalf("SetDataDir: %v", err)
+	}
+	return h, dir
+}
+
+func TestDownloadHistoryRecordAndReload(t *testing.T) {
+	h, dir := newTestDownloadHistory(t)
+
+	req := DownloadRequest{TrackName: "Song", ArtistName: "Artist", ISRC: "USABC1234567", Service: "tidal", Quality: "LOSSLESS"}
+	resp := DownloadResponse{
+		Success:          true,
+		FilePath:         "EXISTS:/music/Artist - Song.flac",
+		Service:          "qobuz",
+		Mirror:           "https://mirror.example",
+		ProviderTrackID:  "12345",
+		ActualBitDepth:   24,
+		ActualSampleRate: 96000,
+		LyricsSource:     "LRCLIB",
+	}
+	h.Record(newHistoryRecord(req, resp, 1500*time.Millisecond))
+	h.Record(newHistoryRecord(DownloadRequest{TrackName: "Other", ArtistName: "Band", Service: "amazon"},
+		DownloadResponse{Error: "track not found", ErrorType: "not_found"}, time.Second))
+
+	reloaded := newDownloadHistory()
+	if err := reloaded.SetDataDir(dir); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	record, ok := reloaded.Provenance("/music/Artist - Song.flac")
+	if !ok {
+		t.Fatalf("expected provenance for downloaded file")
+	}
+	if record.Service != "qobuz" || record.RequestedService != "tidal" || record.Mirror != "https://mirror.example" ||
+		record.ProviderTrackID != "12345" || record.BitDepth != 24 || record.LyricsSource != "LRCLIB" || record.DurationMS != 1500 {
+		t.Fatalf("unexpected provenance record: %+v", record)
+	}
+
+	failed := reloaded.Search(HistoryQuery{Status: "failed"})
+	if failed.Total != 1 || failed.Records[0].ErrorType != "not_found" || failed.Records[0].Service != "" {
+		t.Fatalf("unexpected failed records: %+v", failed)
+	}
+}
+
+func TestDownloadHistorySkipsTornLine(t *testing.T) {
+	h, dir := newTestDownloadHistory(t)
+	h.Record(HistoryRecord{TrackName: "Song", Success: true})
+
+	path := filepath.Join(dir, downloadHistoryFileName)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	f.WriteString(`{"id":"h_broken","track_na`)
+	f.Close()
+
+	reloaded := newDownloadHistory()
+	if err := reloaded.SetDataDir(dir); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := reloaded.Search(HistoryQuery{}).Total; got != 1 {
+		t.Fatalf("expected 1 readable record, got %d", got)
+	}
+
+	// A record written after the torn line is not glued onto it.
+	reloaded.Record(HistoryRecord{TrackName: "Next", Success: true})
+	again := newDownloadHistory()
+	if err := again.SetDataDir(dir); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := again.Search(HistoryQuery{}).Total; got != 2 {
+		t.Fatalf("expected 2 readable records, got %d", got)
+	}
+}
+
+func TestDownloadHistorySearchFilters(t *testing.T) {
+	h, _ := newTestDownloadHistory(t)
+	h.Record(HistoryRecord{TrackName: "Alpha", ArtistName: "One", ISRC: "AAA", Service: "tidal", Success: true})
+	h.Record(HistoryRecord{TrackName: "Beta", ArtistName: "Two", ISRC: "BBB", Service: "qobuz", Success: true})
+	h.Record(HistoryRecord{TrackName: "Gamma", ArtistName: "One", ISRC: "CCC", Service: "tidal"})
+
+	all := h.Search(HistoryQuery{})
+	if all.Total != 3 || all.Records[0].TrackName != "Gamma" {
+		t.Fatalf("expected newest first, got %+v", all.Records)
+	}
+
+	if got := h.Search(HistoryQuery{ISRC: "bbb"}); got.Total != 1 || got.Records[0].TrackName != "Beta" {
+		t.Fatalf("isrc filter: %+v", got)
+	}
+	if got := h.Search(HistoryQuery{Service: "tidal", Status: "success"}); got.Total != 1 || got.Records[0].TrackName != "Alpha" {
+		t.Fatalf("service/status filter: %+v", got)
+	}
+	if got := h.Search(HistoryQuery{Text: "one"}); got.Total != 2 {
+		t.Fatalf("text filter: %+v", got)
+	}
+
+	from := all.Records[1].Timestamp
+	if got := h.Search(HistoryQuery{From: from, To: from}); got.Total != 1 || got.Records[0].TrackName != "Beta" {
+		t.Fatalf("date filter: %+v", got)
+	}
+
+	page := h.Search(HistoryQuery{Limit: 1, Offset: 1})
+	if page.Total != 3 || len(page.Records) != 1 || page.Records[0].TrackName != "Beta" {
+		t.Fatalf("pagination: %+v", page)
+	}
+}
+
+func TestDownloadHistoryPrune(t *testing.T) {
+	h, dir := newTestDownloadHistory(t)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		h.Record(HistoryRecord{TrackName: name, Success: name != "b"})
+	}
+
+	removed, err := h.Prune(HistoryPruneRequest{KeepLatest: 2})
+	if err != nil || removed != 2 {
+		t.Fatalf("expected 2 removed, got %d (%v)", removed, err)
+	}
+
+	reloaded := newDownloadHistory()
+	if err := reloaded.SetDataDir(dir); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	records := reloaded.Search(HistoryQuery{}).Records
+	if len(records) != 2 || records[0].TrackName != "d" || records[1].TrackName != "c" {
+		t.Fatalf("unexpected records after prune: %+v", records)
+	}
+
+	removed, err = h.Prune(HistoryPruneRequest{Before: records[0].Timestamp + 1, FailedOnly: true})
+	if err != nil || removed != 0 {
+		t.Fatalf("expected no failed records to prune, got %d (%v)", removed, err)
+	}
+}
+
+func TestDownloadHistoryDisabledUntilInit(t *testing.T) {
+	h := newDownloadHistory()
+	h.Record(HistoryRecord{TrackName: "Song"})
+	if got := h.Search(HistoryQuery{}).Total; got != 0 {
+		t.Fatalf("expected nothing recorded before SetDataDir, got %d", got)
+	}
+	if _, err := h.Prune(HistoryPruneRequest{KeepLatest: 1}); err == nil {
+		t.Fatalf("expected prune to fail before SetDataDir")
+	}
+}
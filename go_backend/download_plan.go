@@ -0,0 +1,440 @@
+package gobackend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DownloadPlanStep is one provider DownloadByStrategy would try, in order.
+type DownloadPlanStep struct {
+	Provider           string `json:"provider"`
+	Type               string `json:"type"`
+	Available          bool   `json:"available"`
+	Skipped            bool   `json:"skipped,omitempty"`
+	Reason             string `json:"reason,omitempty"`
+	TrackID            string `json:"track_id,omitempty"`
+	ResolvedTitle      string `json:"resolved_title,omitempty"`
+	ResolvedArtist     string `json:"resolved_artist,omitempty"`
+	ExpectedFormat     string `json:"expected_format,omitempty"`
+	ExpectedBitDepth   int    `json:"expected_bit_depth,omitempty"`
+	ExpectedSampleRate int    `json:"expected_sample_rate,omitempty"`
+	PolicyRejectReason string `json:"policy_reject_reason,omitempty"`
+	OutputPath         string `json:"output_path,omitempty"`
+	Error              string `json:"error,omitempty"`
+	ErrorType          string `json:"error_type,omitempty"`
+}
+
+// DownloadPlan is the dry-run result of ResolveDownloadPlan.
+type DownloadPlan struct {
+	Strategy     string `json:"strategy"`
+	TrackName    string `json:"track_name"`
+	ArtistName   string `json:"artist_name"`
+	ISRC         string `json:"isrc,omitempty"`
+	ExistingFile string `json:"existing_file,omitempty"`
+	// ReplacesFile is an existing copy that replace-if-better mode would
+	// download over instead of keeping.
+	ReplacesFile     string             `json:"replaces_file,omitempty"`
+	SelectedProvider string             `json:"selected_provider,omitempty"`
+	Steps            []DownloadPlanStep `json:"steps"`
+}
+
+const (
+	planStrategyYouTube    = "youtube"
+	planStrategyExtensions = "extensions"
+	planStrategyFallback   = "fallback"
+	planStrategyDirect     = "direct"
+
+	planStepBuiltIn   = "built_in"
+	planStepExtension = "extension"
+	planStepYouTube   = "youtube"
+
+	planBatchWorkers = 4
+)
+
+// ResolveDownloadPlan runs the same routing and track resolution as
+// DownloadByStrategy without downloading anything: ID lookups (TrackIDCache,
+// SongLink, provider search), extension availability checks and output path
+// construction. Steps are in the order the download would try them.
+//
+// Nothing is written to disk, but the ID lookups store what they resolve in
+// TrackIDCache exactly as a download would. This is deliberate: a plan is
+// usually followed by the download, which then reuses the resolved IDs.
+func ResolveDownloadPlan(req DownloadRequest) *DownloadPlan {
+	req.Service = strings.TrimSpace(req.Service)
+	req.TrackName = strings.TrimSpace(req.TrackName)
+	req.ArtistName = strings.TrimSpace(req.ArtistName)
+	req.AlbumName = strings.TrimSpace(req.AlbumName)
+	req.AlbumArtist = strings.TrimSpace(req.AlbumArtist)
+	req.OutputDir = strings.TrimSpace(req.OutputDir)
+	req.OutputPath = strings.TrimSpace(req.OutputPath)
+	req.OutputExt = strings.TrimSpace(req.OutputExt)
+
+	serviceNormalized := strings.ToLower(req.Service)
+	if serviceNormalized == "youtube" || isBuiltInProvider(serviceNormalized) {
+		req.Service = serviceNormalized
+	}
+
+	plan := &DownloadPlan{
+		TrackName:  req.TrackName,
+		ArtistName: req.ArtistName,
+	}
+
+	if req.Service == "youtube" {
+		plan.Strategy = planStrategyYouTube
+		plan.ISRC = req.ISRC
+		plan.Steps = []DownloadPlanStep{planYouTubeStep(req)}
+		plan.finish(req)
+		return plan
+	}
+
+	var providers []string
+	skipBuiltIn := false
+	switch {
+	case req.UseExtensions:
+		plan.Strategy = planStrategyExtensions
+		enrichRequestFromSourceExtension(&req)
+		if req.Source != "" && !isBuiltInProvider(req.Source) {
+			if ext, err := GetExtensionManager().GetExtension(req.Source); err == nil &&
+				ext.Enabled && ext.Error == "" && ext.Manifest.IsDownloadProvider() {
+				providers = append(providers, req.Source)
+				skipBuiltIn = ext.Manifest.SkipBuiltInFallback
+			}
+		}
+		for _, providerID := range extensionProviderOrder(req.Service) {
+			if providerID != req.Source {
+				providers = append(providers, providerID)
+			}
+		}
+	case req.UseFallback:
+		plan.Strategy = planStrategyFallback
+		providers = fallbackServiceOrder(req.Service)
+	default:
+		plan.Strategy = planStrategyDirect
+		if !isBuiltInProvider(req.Service) {
+			plan.Steps = []DownloadPlanStep{{
+				Provider: req.Service,
+				Type:     planStepBuiltIn,
+				Reason:   "unknown service",
+			}}
+			return plan
+		}
+		providers = []string{req.Service}
+	}
+
+	// The looked-up ISRC is only reported; the download itself resolves
+	// without it, so the steps below must too.
+	plan.ISRC = req.ISRC
+	if plan.ISRC == "" {
+		plan.ISRC = lookupPlanISRC(req)
+	}
+
+	if !isSAFRequest(req) && req.OutputDir != "" {
+		if existing, exists := checkISRCExistsInternal(req.OutputDir, req.ISRC); exists {
+			var upgrade *pendingUpgrade
+			if keepExistingFile(req, existing, &upgrade) {
+				plan.ExistingFile = existing
+			} else {
+				plan.ReplacesFile = existing
+			}
+		}
+	}
+
+	plan.Steps = make([]DownloadPlanStep, len(providers))
+	var wg sync.WaitGroup
+	for i, providerID := range providers {
+		if skipBuiltIn && isBuiltInProvider(providerID) {
+			plan.Steps[i] = DownloadPlanStep{
+				Provider: providerID,
+				Type:     planStepBuiltIn,
+				Skipped:  true,
+				Reason:   "source extension disables built-in fallback",
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, providerID string) {
+			defer wg.Done()
+			switch {
+			case isBuiltInProvider(providerID):
+				plan.Steps[i] = planBuiltInStep(providerID, req)
+			case providerID == req.Source:
+				plan.Steps[i] = planSourceExtensionStep(providerID, req)
+			default:
+				plan.Steps[i] = planExtensionStep(providerID, req)
+			}
+		}(i, providerID)
+	}
+	wg.Wait()
+
+	plan.finish(req)
+	return plan
+}
+
+// finish applies the quality policy and attempt limit, and picks the provider
+// the download is expected to end up with.
+func (plan *DownloadPlan) finish(req DownloadRequest) {
+	policy := qualityPolicyFromRequest(req)
+	candidates := 0
+	for i := range plan.Steps {
+		step := &plan.Steps[i]
+		if step.Skipped || !step.Available {
+			continue
+		}
+		if policy.attemptsExhausted(candidates) {
+			step.Skipped = true
+			step.Reason = fmt.Sprintf("max attempts (%d) reached", policy.MaxAttempts)
+			continue
+		}
+		candidates++
+
+		lossless, known := planFormatLossless(step.ExpectedFormat)
+		step.PolicyRejectReason = policy.rejectReasonFor(lossless, known, step.ExpectedBitDepth, step.ExpectedSampleRate)
+		if plan.SelectedProvider == "" && step.PolicyRejectReason == "" {
+			plan.SelectedProvider = step.Provider
+		}
+	}
+}
+
+func isSAFRequest(req DownloadRequest) bool {
+	return isFDOutput(req.OutputFD) || req.OutputPath != ""
+}
+
+// lookupPlanISRC looks up a missing ISRC for Deezer-sourced tracks.
+func lookupPlanISRC(req DownloadRequest) string {
+	deezerID := req.DeezerID
+	if id, found := strings.CutPrefix(req.SpotifyID, "deezer:"); found {
+		deezerID = id
+	}
+	if deezerID == "" {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	isrc, err := GetDeezerClient().GetTrackISRC(ctx, deezerID)
+	if err != nil {
+		GoLog("[DownloadPlan] ISRC lookup for Deezer track %s failed: %v\n", deezerID, err)
+		return ""
+	}
+	return isrc
+}
+
+func planFormatLossless(format string) (lossless bool, known bool) {
+	switch format {
+	case "flac", "alac":
+		return true, true
+	case "aac", "mp3", "opus":
+		return false, true
+	}
+	return false, false
+}
+
+func planOutputPath(req DownloadRequest, ext string) string {
+	if isFDOutput(req.OutputFD) && req.OutputPath == "" {
+		return fmt.Sprintf("/proc/self/fd/%d", req.OutputFD)
+	}
+	if req.OutputExt == "" {
+		req.OutputExt = ext
+	}
+	return buildOutputPath(req)
+}
+
+func planStepError(step *DownloadPlanStep, err error) {
+	step.Available = false
+	step.Error = err.Error()
+	step.ErrorType = string(ClassifyDownloadError(err))
+}
+
+func planBuiltInStep(providerID string, req DownloadRequest) DownloadPlanStep {
+	step := DownloadPlanStep{Provider: providerID, Type: planStepBuiltIn}
+	req.Service = providerID
+
+	switch providerID {
+	case "tidal":
+		track, err := resolveTidalTrack(NewTidalDownloader(), req)
+		if err != nil {
+			planStepError(&step, err)
+			return step
+		}
+		step.Available = true
+		step.TrackID = strconv.FormatInt(track.ID, 10)
+		step.ResolvedTitle = track.Title
+		step.ResolvedArtist = tidalTrackArtists(track)
+		step.ExpectedFormat, step.ExpectedBitDepth, step.ExpectedSampleRate = expectedTidalQuality(track, req.Quality)
+		ext := ".flac"
+		if step.ExpectedFormat == "aac" {
+			ext = ".m4a"
+		}
+		step.OutputPath = planOutputPath(req, ext)
+	case "qobuz":
+		track, err := resolveQobuzTrack(NewQobuzDownloader(), req)
+		if err != nil {
+			planStepError(&step, err)
+			return step
+		}
+		step.Available = true
+		step.TrackID = strconv.FormatInt(track.ID, 10)
+		step.ResolvedTitle = track.Title
+		step.ResolvedArtist = track.Performer.Name
+		step.ExpectedFormat = "flac"
+		step.ExpectedBitDepth, step.ExpectedSampleRate = expectedQobuzQuality(track, req.Quality)
+		step.OutputPath = planOutputPath(req, ".flac")
+	case "amazon":
+		amazonURL, err := resolveAmazonURL(req)
+		if err != nil {
+			planStepError(&step, err)
+			return step
+		}
+		step.Available = true
+		step.TrackID = amazonURL
+		step.Reason = "format and quality are decided by the Amazon API at download time"
+		step.OutputPath = planOutputPath(req, ".flac")
+	default:
+		step.Reason = "no built-in downloader for " + providerID
+	}
+	return step
+}
+
+func tidalTrackArtists(track *TidalTrack) string {
+	if len(track.Artists) == 0 {
+		return track.Artist.Name
+	}
+	names := make([]string, 0, len(track.Artists))
+	for _, a := range track.Artists {
+		names = append(names, a.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// expectedTidalQuality estimates what downloadFromTidal will deliver. Hi-res
+// sample rates are only known from the manifest, so they are reported as 0.
+func expectedTidalQuality(track *TidalTrack, quality string) (format string, bitDepth, sampleRate int) {
+	if quality == "" {
+		quality = "LOSSLESS"
+	}
+	if quality == "HIGH" {
+		return "aac", 0, 0
+	}
+
+	hiRes := track.AudioQuality == "HI_RES_LOSSLESS"
+	for _, tag := range track.MediaMetadata.Tags {
+		if tag == "HIRES_LOSSLESS" {
+			hiRes = true
+		}
+	}
+	if quality == "HI_RES_LOSSLESS" && hiRes {
+		return "flac", 24, 0
+	}
+	return "flac", 16, 44100
+}
+
+// expectedQobuzQuality caps the track's maximum quality by the requested
+// Qobuz format (6 = CD, 7 = up to 24/96, 27 = full hi-res).
+func expectedQobuzQuality(track *QobuzTrack, quality string) (bitDepth, sampleRate int) {
+	bitDepth = track.MaximumBitDepth
+	sampleRate = int(track.MaximumSamplingRate * 1000)
+
+	switch quality {
+	case "LOSSLESS":
+		return 16, 44100
+	case "HI_RES":
+		if bitDepth > 24 {
+			bitDepth = 24
+		}
+		if sampleRate > 96000 {
+			sampleRate = 96000
+		}
+	}
+	return bitDepth, sampleRate
+}
+
+func planSourceExtensionStep(providerID string, req DownloadRequest) DownloadPlanStep {
+	return DownloadPlanStep{
+		Provider:   providerID,
+		Type:       planStepExtension,
+		Available:  true,
+		Reason:     "track source extension is tried first",
+		TrackID:    req.SpotifyID,
+		OutputPath: buildOutputPath(req),
+	}
+}
+
+func planExtensionStep(providerID string, req DownloadRequest) DownloadPlanStep {
+	step := DownloadPlanStep{Provider: providerID, Type: planStepExtension}
+
+	ext, err := GetExtensionManager().GetExtension(providerID)
+	if err != nil || !ext.Enabled || ext.Error != "" {
+		step.Reason = "extension not available"
+		return step
+	}
+	if !ext.Manifest.IsDownloadProvider() {
+		step.Reason = "extension is not a download provider"
+		return step
+	}
+
+	availability, err := NewExtensionProviderWrapper(ext).CheckAvailability(req.ISRC, req.TrackName, req.ArtistName)
+	if err != nil {
+		planStepError(&step, err)
+		return step
+	}
+	if !availability.Available {
+		step.Reason = availability.Reason
+		if step.Reason == "" {
+			step.Reason = "not available"
+		}
+		return step
+	}
+
+	step.Available = true
+	step.TrackID = availability.TrackID
+	step.OutputPath = buildOutputPath(req)
+	return step
+}
+
+func planYouTubeStep(req DownloadRequest) DownloadPlanStep {
+	step := DownloadPlanStep{
+		Provider:  "youtube",
+		Type:      planStepYouTube,
+		Available: true,
+	}
+
+	ext := ".mp3"
+	step.ExpectedFormat = "mp3"
+	switch strings.ToLower(req.Quality) {
+	case "opus_256", "opus256", "opus":
+		ext = ".opus"
+		step.ExpectedFormat = "opus"
+	}
+	step.OutputPath = planOutputPath(req, ext)
+
+	if req.SpotifyID != "" && isYouTubeVideoID(req.SpotifyID) {
+		step.TrackID = req.SpotifyID
+	} else {
+		step.Reason = "video is looked up at download time"
+	}
+	return step
+}
+
+// ResolveDownloadPlans resolves plans for a batch of requests with bounded
+// concurrency. Results are in request order.
+func ResolveDownloadPlans(requests []DownloadRequest) []*DownloadPlan {
+	plans := make([]*DownloadPlan, len(requests))
+	sem := make(chan struct{}, planBatchWorkers)
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, req DownloadRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			plans[i] = ResolveDownloadPlan(req)
+		}(i, req)
+	}
+	wg.Wait()
+	return plans
+}
@@ -0,0 +1,76 @@
+package gobackend
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExpectedProviderQuality(t *testing.T) {
+	hiRes := &TidalTrack{AudioQuality: "LOSSLESS"}
+	hiRes.MediaMetadata.Tags = []string{"LOSSLESS", "HIRES_LOSSLESS"}
+
+	if format, bd, _ := expectedTidalQuality(hiRes, "HI_RES_LOSSLESS"); format != "flac" || bd != 24 {
+		t.Fatalf("expected 24-bit FLAC, got %s %d", format, bd)
+	}
+	if format, bd, sr := expectedTidalQuality(hiRes, ""); format != "flac" || bd != 16 || sr != 44100 {
+		t.Fatalf("expected CD quality by default, got %s %d/%d", format, bd, sr)
+	}
+	if format, _, _ := expectedTidalQuality(hiRes, "HIGH"); format != "aac" {
+		t.Fatalf("expected AAC for HIGH, got %s", format)
+	}
+
+	qobuz := &QobuzTrack{MaximumBitDepth: 24, MaximumSamplingRate: 192}
+	if bd, sr := expectedQobuzQuality(qobuz, "HI_RES"); bd != 24 || sr != 96000 {
+		t.Fatalf("expected 24/96 cap, got %d/%d", bd, sr)
+	}
+	if bd, sr := expectedQobuzQuality(qobuz, "HI_RES_LOSSLESS"); bd != 24 || sr != 192000 {
+		t.Fatalf("expected 24/192, got %d/%d", bd, sr)
+	}
+}
+
+func TestDownloadPlanFinish_SelectsFirstProviderMeetingPolicy(t *testing.T) {
+	plan := &DownloadPlan{Steps: []DownloadPlanStep{
+		{Provider: "tidal", Available: true, ExpectedFormat: "flac", ExpectedBitDepth: 16, ExpectedSampleRate: 44100},
+		{Provider: "qobuz", Available: false},
+		{Provider: "amazon", Available: true},
+		{Provider: "ext", Available: true},
+	}}
+
+	plan.finish(DownloadRequest{MinBitDepth: 24, MaxAttempts: 2})
+
+	if plan.Steps[0].PolicyRejectReason == "" {
+		t.Fatal("expected 16-bit Tidal step to fail the 24-bit floor")
+	}
+	if plan.SelectedProvider != "amazon" {
+		t.Fatalf("expected amazon (unknown quality passes), got %q", plan.SelectedProvider)
+	}
+	if !plan.Steps[3].Skipped {
+		t.Fatal("expected step beyond max attempts to be skipped")
+	}
+}
+
+func TestResolveDownloadPlan_WithoutNetworkLookups(t *testing.T) {
+	dir := t.TempDir()
+
+	plan := ResolveDownloadPlan(DownloadRequest{
+		Service:        " YouTube ",
+		TrackName:      "Song",
+		ArtistName:     "Artist",
+		SpotifyID:      "dQw4w9WgXcQ",
+		Quality:        "opus_256",
+		OutputDir:      dir,
+		FilenameFormat: "{artist} - {title}",
+	})
+	if plan.Strategy != planStrategyYouTube || plan.SelectedProvider != "youtube" {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	step := plan.Steps[0]
+	if step.TrackID != "dQw4w9WgXcQ" || step.OutputPath != filepath.Join(dir, "Artist - Song.opus") {
+		t.Fatalf("unexpected youtube step: %+v", step)
+	}
+
+	plan = ResolveDownloadPlan(DownloadRequest{Service: "napster", OutputDir: dir})
+	if plan.Strategy != planStrategyDirect || plan.SelectedProvider != "" || plan.Steps[0].Reason != "unknown service" {
+		t.Fatalf("unexpected plan for unknown service: %+v", plan)
+	}
+}
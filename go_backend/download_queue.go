@@ -0,0 +1,482 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	QueueStatusQueued      = "queued"
+	QueueStatusDownloading = "downloading"
+	QueueStatusPaused      = "paused"
+	QueueStatusCompleted   = "completed"
+	QueueStatusFailed      = "failed"
+
+	defaultQueueWorkers = 2
+	maxQueueWorkers     = 8
+	queueStateFileName  = "download_queue.json"
+)
+
+// QueueItem is a single persisted download in the queue.
+type QueueItem struct {
+	ID        string            `json:"id"`
+	Request   DownloadRequest   `json:"request"`
+	Status    string            `json:"status"`
+	Attempts  int               `json:"attempts"`
+	Error     string            `json:"error,omitempty"`
+	ErrorType string            `json:"error_type,omitempty"`
+	Response  *DownloadResponse `json:"response,omitempty"`
+	AddedAt   int64             `json:"added_at"`
+	UpdatedAt int64             `json:"updated_at"`
+}
+
+type downloadQueueState struct {
+	Workers int          `json:"workers"`
+	Paused  bool         `json:"paused"`
+	Items   []*QueueItem `json:"items"`
+}
+
+// DownloadQueue runs queued DownloadRequests with a bounded number of workers
+// and persists its state so an interrupted batch survives a process restart.
+type DownloadQueue struct {
+	mu        sync.Mutex
+	statePath string
+	items     []*QueueItem
+	workers   int
+	paused    bool
+	running   int
+	idCounter int64
+	// active holds the IDs whose run goroutine has not returned yet. A paused
+	// or removed item stays here until its cancelled download unwinds, and
+	// is not started again before then.
+	active map[string]bool
+
+	// downloadFn performs one download; defaults to DownloadByStrategy.
+	downloadFn func(requestJSON string) (string, error)
+}
+
+var (
+	globalDownloadQueue     *DownloadQueue
+	globalDownloadQueueOnce sync.Once
+)
+
+func GetDownloadQueue() *DownloadQueue {
+	globalDownloadQueueOnce.Do(func() {
+		globalDownloadQueue = newDownloadQueue()
+	})
+	return globalDownloadQueue
+}
+
+func newDownloadQueue() *DownloadQueue {
+	return &DownloadQueue{
+		items:      make([]*QueueItem, 0),
+		active:     make(map[string]bool),
+		workers:    defaultQueueWorkers,
+		downloadFn: DownloadByStrategy,
+	}
+}
+
+// SetDataDir loads any persisted queue from dataDir and starts processing it.
+// Items that were downloading when the process died are queued again.
+func (q *DownloadQueue) SetDataDir(dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create queue directory: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.statePath = filepath.Join(dataDir, queueStateFileName)
+	if err := q.loadLocked(); err != nil {
+		return err
+	}
+
+	q.scheduleLocked()
+	return nil
+}
+
+func (q *DownloadQueue) loadLocked() error {
+	data, err := os.ReadFile(q.statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read queue state: %w", err)
+	}
+
+	var state downloadQueueState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse queue state: %w", err)
+	}
+
+	restored := 0
+	q.items = make([]*QueueItem, 0, len(state.Items))
+	for _, item := range state.Items {
+		if item == nil || item.ID == "" {
+			continue
+		}
+		// Descriptors do not survive the process that opened them, and the
+		// same number may now refer to any other file.
+		if holdsOutputDescriptor(item.Request) {
+			item.Request.OutputFD = 0
+			item.Request.OutputPath = ""
+			if item.Status != QueueStatusCompleted && item.Status != QueueStatusFailed {
+				item.Status = QueueStatusFailed
+				item.Error = "output file descriptor was lost on restart"
+				item.ErrorType = string(ErrKindUnknown)
+			}
+		}
+		if item.Status == QueueStatusDownloading {
+			item.Status = QueueStatusQueued
+			restored++
+		}
+		q.items = append(q.items, item)
+	}
+	if state.Workers > 0 {
+		q.workers = clampQueueWorkers(state.Workers)
+	}
+	q.paused = state.Paused
+
+	GoLog("[Queue] Loaded %d items from disk (%d interrupted downloads re-queued)\n", len(q.items), restored)
+	return nil
+}
+
+// saveLocked writes the queue to a temp file and renames it into place so a
+// crash mid-write never leaves a truncated state file behind.
+func (q *DownloadQueue) saveLocked() error {
+	if q.statePath == "" {
+		return nil
+	}
+
+	state := downloadQueueState{
+		Workers: q.workers,
+		Paused:  q.paused,
+		Items:   q.items,
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := q.statePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, q.statePath)
+}
+
+func (q *DownloadQueue) persistLocked() {
+	if err := q.saveLocked(); err != nil {
+		GoLog("[Queue] Failed to save queue state: %v\n", err)
+	}
+}
+
+func clampQueueWorkers(n int) int {
+	if n < 1 {
+		return 1
+	}
+	if n > maxQueueWorkers {
+		return maxQueueWorkers
+	}
+	return n
+}
+
+func (q *DownloadQueue) nextIDLocked() string {
+	q.idCounter++
+	return fmt.Sprintf("q_%d_%d", time.Now().UnixMilli(), q.idCounter)
+}
+
+func (q *DownloadQueue) findLocked(itemID string) (int, *QueueItem) {
+	for i, item := range q.items {
+		if item.ID == itemID {
+			return i, item
+		}
+	}
+	return -1, nil
+}
+
+// holdsOutputDescriptor reports whether req writes to a SAF file descriptor
+// rather than a path the queue can persist.
+func holdsOutputDescriptor(req DownloadRequest) bool {
+	return isFDOutput(req.OutputFD) || strings.HasPrefix(strings.TrimSpace(req.OutputPath), "/proc/self/fd/")
+}
+
+// Enqueue appends requests to the end of the queue and returns their item IDs.
+// A request's ItemID is reused as the queue ID so progress and cancellation
+// keep working with the IDs the caller already knows. Requests whose ID is
+// still waiting or running are skipped; a completed or failed item with the
+// same ID is queued again. It fails until SetDataDir has been called, since
+// nothing runs or persists before then, and for requests writing to a SAF
+// file descriptor, which would be held while waiting and lost on restart.
+func (q *DownloadQueue) Enqueue(requests []DownloadRequest) ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.statePath == "" {
+		return nil, fmt.Errorf("download queue is not initialized")
+	}
+	for _, req := range requests {
+		if holdsOutputDescriptor(req) {
+			return nil, fmt.Errorf("cannot queue %q: queued downloads need an output directory, not a file descriptor", req.TrackName)
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	ids := make([]string, 0, len(requests))
+	for _, req := range requests {
+		id := req.ItemID
+		if id == "" {
+			id = q.nextIDLocked()
+		}
+		if idx, existing := q.findLocked(id); existing != nil {
+			if existing.Status != QueueStatusCompleted && existing.Status != QueueStatusFailed {
+				GoLog("[Queue] Item %s already queued, skipping\n", id)
+				continue
+			}
+			q.items = append(q.items[:idx], q.items[idx+1:]...)
+		}
+		req.ItemID = id
+
+		q.items = append(q.items, &QueueItem{
+			ID:        id,
+			Request:   req,
+			Status:    QueueStatusQueued,
+			AddedAt:   now,
+			UpdatedAt: now,
+		})
+		ids = append(ids, id)
+	}
+
+	GoLog("[Queue] Enqueued %d items (%d total)\n", len(ids), len(q.items))
+	q.persistLocked()
+	q.scheduleLocked()
+	return ids, nil
+}
+
+// Reorder moves the given item IDs to the front of the queue in the given
+// order. IDs not listed keep their relative order after them.
+func (q *DownloadQueue) Reorder(itemIDs []string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	seen := make(map[string]bool, len(itemIDs))
+	reordered := make([]*QueueItem, 0, len(q.items))
+	for _, id := range itemIDs {
+		if seen[id] {
+			continue
+		}
+		_, item := q.findLocked(id)
+		if item == nil {
+			return fmt.Errorf("queue item not found: %s", id)
+		}
+		seen[id] = true
+		reordered = append(reordered, item)
+	}
+	for _, item := range q.items {
+		if !seen[item.ID] {
+			reordered = append(reordered, item)
+		}
+	}
+
+	q.items = reordered
+	q.persistLocked()
+	return nil
+}
+
+// SetPaused pauses or resumes the whole queue. Pausing lets running downloads
+// finish; use PauseItem to stop a specific download.
+func (q *DownloadQueue) SetPaused(paused bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.paused = paused
+	GoLog("[Queue] Queue paused: %v\n", paused)
+	q.persistLocked()
+	q.scheduleLocked()
+}
+
+// PauseItem holds a queued item back, cancelling it first if it is running.
+func (q *DownloadQueue) PauseItem(itemID string) error {
+	q.mu.Lock()
+	_, item := q.findLocked(itemID)
+	if item == nil {
+		q.mu.Unlock()
+		return fmt.Errorf("queue item not found: %s", itemID)
+	}
+	wasRunning := item.Status == QueueStatusDownloading
+	if item.Status == QueueStatusQueued || wasRunning {
+		item.Status = QueueStatusPaused
+		item.UpdatedAt = time.Now().UnixMilli()
+		q.persistLocked()
+	}
+	q.mu.Unlock()
+
+	if wasRunning {
+		cancelDownload(itemID)
+	}
+	return nil
+}
+
+// ResumeItem puts a paused or failed item back into the queue. An item
+// paused while downloading starts again only once its cancelled run has
+// returned.
+func (q *DownloadQueue) ResumeItem(itemID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, item := q.findLocked(itemID)
+	if item == nil {
+		return fmt.Errorf("queue item not found: %s", itemID)
+	}
+	if item.Status == QueueStatusPaused || item.Status == QueueStatusFailed {
+		item.Status = QueueStatusQueued
+		item.Error = ""
+		item.ErrorType = ""
+		item.UpdatedAt = time.Now().UnixMilli()
+		q.persistLocked()
+		q.scheduleLocked()
+	}
+	return nil
+}
+
+// Remove drops an item from the queue, cancelling it if it is running.
+func (q *DownloadQueue) Remove(itemID string) error {
+	q.mu.Lock()
+	idx, item := q.findLocked(itemID)
+	if item == nil {
+		q.mu.Unlock()
+		return fmt.Errorf("queue item not found: %s", itemID)
+	}
+	wasRunning := item.Status == QueueStatusDownloading
+	q.items = append(q.items[:idx], q.items[idx+1:]...)
+	q.persistLocked()
+	q.mu.Unlock()
+
+	if wasRunning {
+		cancelDownload(itemID)
+	}
+	return nil
+}
+
+// ClearFinished removes completed and failed items and returns how many were removed.
+func (q *DownloadQueue) ClearFinished() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	kept := q.items[:0]
+	removed := 0
+	for _, item := range q.items {
+		if item.Status == QueueStatusCompleted || item.Status == QueueStatusFailed {
+			removed++
+			continue
+		}
+		kept = append(kept, item)
+	}
+	q.items = kept
+	if removed > 0 {
+		q.persistLocked()
+	}
+	return removed
+}
+
+func (q *DownloadQueue) SetWorkers(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.workers = clampQueueWorkers(n)
+	GoLog("[Queue] Worker count set to %d\n", q.workers)
+	q.persistLocked()
+	q.scheduleLocked()
+}
+
+// snapshot returns a copy of the queue state safe to marshal without the lock.
+func (q *DownloadQueue) snapshot() downloadQueueState {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := make([]*QueueItem, len(q.items))
+	for i, item := range q.items {
+		copied := *item
+		items[i] = &copied
+	}
+	return downloadQueueState{
+		Workers: q.workers,
+		Paused:  q.paused,
+		Items:   items,
+	}
+}
+
+// scheduleLocked starts queued items in order until all worker slots are busy.
+func (q *DownloadQueue) scheduleLocked() {
+	if q.paused || q.statePath == "" {
+		return
+	}
+
+	for _, item := range q.items {
+		if q.running >= q.workers {
+			break
+		}
+		if item.Status != QueueStatusQueued || q.active[item.ID] {
+			continue
+		}
+
+		item.Status = QueueStatusDownloading
+		item.Attempts++
+		item.UpdatedAt = time.Now().UnixMilli()
+		q.running++
+		q.active[item.ID] = true
+
+		go q.run(item.ID, item.Request)
+	}
+	q.persistLocked()
+}
+
+func (q *DownloadQueue) run(itemID string, req DownloadRequest) {
+	GoLog("[Queue] Starting %s: %s - %s\n", itemID, req.ArtistName, req.TrackName)
+
+	// A stale cancel flag from an earlier pause would abort the new attempt.
+	clearDownloadCancel(itemID)
+
+	var resp DownloadResponse
+	requestJSON, err := json.Marshal(req)
+	if err == nil {
+		var respJSON string
+		respJSON, err = q.downloadFn(string(requestJSON))
+		if err == nil {
+			err = json.Unmarshal([]byte(respJSON), &resp)
+		}
+	}
+	if err != nil {
+		resp = downloadErrorResponse(err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.running--
+	delete(q.active, itemID)
+	_, item := q.findLocked(itemID)
+	if item != nil && item.Status == QueueStatusDownloading {
+		item.UpdatedAt = time.Now().UnixMilli()
+		item.Response = &resp
+		if resp.Success {
+			item.Status = QueueStatusCompleted
+			item.Error = ""
+			item.ErrorType = ""
+			GoLog("[Queue] Completed %s\n", itemID)
+		} else {
+			item.Status = QueueStatusFailed
+			item.Error = resp.Error
+			item.ErrorType = resp.ErrorType
+			GoLog("[Queue] Failed %s: %s\n", itemID, resp.Error)
+		}
+	}
+
+	q.persistLocked()
+	q.scheduleLocked()
+}
@@ -0,0 +1,255 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadQueue_PersistsAndRestoresInterruptedItems(t *testing.T) {
+	dataDir := t.TempDir()
+
+	q := newDownloadQueue()
+	if err := q.SetDataDir(dataDir); err != nil {
+		t.Fatalf("SetDataDir failed: %v", err)
+	}
+	q.SetPaused(true)
+
+	ids, err := q.Enqueue([]DownloadRequest{
+		{TrackName: "One", ItemID: "a"},
+		{TrackName: "Two", ItemID: "b"},
+		{TrackName: "Three"},
+	})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if len(ids) != 3 || ids[0] != "a" || ids[1] != "b" || ids[2] == "" {
+		t.Fatalf("unexpected ids: %v", ids)
+	}
+
+	if err := q.Reorder([]string{ids[2], "b"}); err != nil {
+		t.Fatalf("Reorder failed: %v", err)
+	}
+
+	// Simulate a crash while "b" was downloading.
+	q.mu.Lock()
+	q.items[1].Status = QueueStatusDownloading
+	q.persistLocked()
+	q.mu.Unlock()
+
+	restored := newDownloadQueue()
+	if err := restored.SetDataDir(dataDir); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	state := restored.snapshot()
+	if !state.Paused {
+		t.Fatal("expected paused flag to survive restart")
+	}
+	gotOrder := []string{state.Items[0].ID, state.Items[1].ID, state.Items[2].ID}
+	wantOrder := []string{ids[2], "b", "a"}
+	for i := range wantOrder {
+		if gotOrder[i] != wantOrder[i] {
+			t.Fatalf("expected order %v, got %v", wantOrder, gotOrder)
+		}
+	}
+	if state.Items[1].Status != QueueStatusQueued {
+		t.Fatalf("expected interrupted item to be re-queued, got %q", state.Items[1].Status)
+	}
+	if state.Items[0].Request.ItemID != ids[2] {
+		t.Fatalf("expected generated ID to be copied into request, got %q", state.Items[0].Request.ItemID)
+	}
+}
+
+func TestDownloadQueue_RunsWithWorkerLimit(t *testing.T) {
+	q := newDownloadQueue()
+
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	q.downloadFn = func(requestJSON string) (string, error) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+
+		var req DownloadRequest
+		_ = json.Unmarshal([]byte(requestJSON), &req)
+		resp := DownloadResponse{Success: req.TrackName != "bad", Error: "boom"}
+		if resp.Success {
+			resp.Error = ""
+		}
+		jsonBytes, _ := json.Marshal(resp)
+		return string(jsonBytes), nil
+	}
+
+	dataDir := t.TempDir()
+	if err := q.SetDataDir(dataDir); err != nil {
+		t.Fatalf("SetDataDir failed: %v", err)
+	}
+	q.SetWorkers(2)
+	if _, err := q.Enqueue([]DownloadRequest{
+		{TrackName: "ok1"}, {TrackName: "ok2"}, {TrackName: "bad"}, {TrackName: "ok3"},
+	}); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		state := q.snapshot()
+		done := 0
+		for _, item := range state.Items {
+			if item.Status == QueueStatusCompleted || item.Status == QueueStatusFailed {
+				done++
+			}
+		}
+		if done == len(state.Items) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queue did not finish: %+v", state.Items)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if maxActive > 2 {
+		t.Fatalf("expected at most 2 concurrent downloads, saw %d", maxActive)
+	}
+
+	state := q.snapshot()
+	if state.Items[2].Status != QueueStatusFailed || state.Items[2].Error != "boom" {
+		t.Fatalf("expected third item to fail with recorded error, got %+v", state.Items[2])
+	}
+	if removed := q.ClearFinished(); removed != 4 {
+		t.Fatalf("expected 4 finished items removed, got %d", removed)
+	}
+
+	if _, err := os.Stat(filepath.Join(dataDir, queueStateFileName)); err != nil {
+		t.Fatalf("expected queue state file on disk: %v", err)
+	}
+}
+
+func TestDownloadQueue_RejectsEnqueueBeforeInit(t *testing.T) {
+	q := newDownloadQueue()
+	if _, err := q.Enqueue([]DownloadRequest{{TrackName: "One"}}); err == nil {
+		t.Fatal("expected Enqueue to fail before SetDataDir")
+	}
+}
+
+func TestDownloadQueue_RejectsOutputDescriptors(t *testing.T) {
+	dataDir := t.TempDir()
+	q := newDownloadQueue()
+	if err := q.SetDataDir(dataDir); err != nil {
+		t.Fatalf("SetDataDir failed: %v", err)
+	}
+	for _, req := range []DownloadRequest{{TrackName: "One", OutputFD: 42}, {TrackName: "Two", OutputPath: "/proc/self/fd/42"}} {
+		if _, err := q.Enqueue([]DownloadRequest{req}); err == nil {
+			t.Fatalf("expected %+v to be rejected", req)
+		}
+	}
+
+	// A queue saved before descriptors were rejected fails those items.
+	state := downloadQueueState{Paused: true, Items: []*QueueItem{
+		{ID: "a", Status: QueueStatusQueued, Request: DownloadRequest{TrackName: "One", OutputFD: 42}},
+		{ID: "b", Status: QueueStatusQueued, Request: DownloadRequest{TrackName: "Two", OutputDir: dataDir}},
+	}}
+	data, _ := json.Marshal(state)
+	if err := os.WriteFile(filepath.Join(dataDir, queueStateFileName), data, 0644); err != nil {
+		t.Fatalf("failed to write state: %v", err)
+	}
+	restored := newDownloadQueue()
+	if err := restored.SetDataDir(dataDir); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	items := restored.snapshot().Items
+	if items[0].Status != QueueStatusFailed || items[0].Request.OutputFD != 0 || items[1].Status != QueueStatusQueued {
+		t.Fatalf("unexpected restored items: %+v, %+v", items[0], items[1])
+	}
+}
+
+func TestDownloadQueue_ResumeWaitsForCancelledRun(t *testing.T) {
+	q := newDownloadQueue()
+	started := make(chan string, 4)
+	release := make(chan struct{})
+	q.downloadFn = func(requestJSON string) (string, error) {
+		started <- requestJSON
+		<-release
+		return `{"success":false,"error":"cancelled"}`, nil
+	}
+	if err := q.SetDataDir(t.TempDir()); err != nil {
+		t.Fatalf("SetDataDir failed: %v", err)
+	}
+	if _, err := q.Enqueue([]DownloadRequest{{TrackName: "One", ItemID: "a"}}); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	<-started
+
+	if err := q.PauseItem("a"); err != nil {
+		t.Fatalf("PauseItem failed: %v", err)
+	}
+	if err := q.ResumeItem("a"); err != nil {
+		t.Fatalf("ResumeItem failed: %v", err)
+	}
+	select {
+	case <-started:
+		t.Fatal("resumed item started while its cancelled run was still going")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release <- struct{}{}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("resumed item did not start after its cancelled run returned")
+	}
+	q.mu.Lock()
+	running, status := q.running, q.items[0].Status
+	q.mu.Unlock()
+	if running != 1 || status != QueueStatusDownloading {
+		t.Fatalf("expected one run of the resumed item, got running=%d status=%s", running, status)
+	}
+	close(release)
+
+	// Let the second run persist its result before the data dir goes away.
+	deadline := time.Now().Add(5 * time.Second)
+	for q.snapshot().Items[0].Status == QueueStatusDownloading {
+		if time.Now().After(deadline) {
+			t.Fatal("resumed item did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDownloadQueue_RequeuesFinishedItemWithSameID(t *testing.T) {
+	q := newDownloadQueue()
+	if err := q.SetDataDir(t.TempDir()); err != nil {
+		t.Fatalf("SetDataDir failed: %v", err)
+	}
+	q.SetPaused(true)
+	if _, err := q.Enqueue([]DownloadRequest{{TrackName: "One", ItemID: "a"}, {TrackName: "Two", ItemID: "b"}}); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	q.mu.Lock()
+	q.items[0].Status = QueueStatusFailed
+	q.mu.Unlock()
+
+	ids, err := q.Enqueue([]DownloadRequest{{TrackName: "One", ItemID: "a"}, {TrackName: "Two", ItemID: "b"}})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	state := q.snapshot()
+	if len(ids) != 1 || ids[0] != "a" || len(state.Items) != 2 ||
+		state.Items[1].ID != "a" || state.Items[1].Status != QueueStatusQueued {
+		t.Fatalf("expected only the failed item to be queued again, got ids=%v items=%+v", ids, state.Items)
+	}
+}
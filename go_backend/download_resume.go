@@ -0,0 +1,392 @@
+package gobackend
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	partialFileSuffix = ".part"
+
+	resumeMaxAttempts = 4
+	resumeRetryDelay  = 2 * time.Second
+)
+
+// partialDownloadInfo is the sidecar written next to a .part file. It records
+// enough about the server response to decide whether a Range request can
+// safely continue the partial file. Source names the provider and track the
+// bytes came from; download URLs are signed per request, so they cannot tell
+// a retry of the same track from another provider's fallback that stages to
+// the same path.
+type partialDownloadInfo struct {
+	Source       string `json:"source"`
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	TotalSize    int64  `json:"total_size"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
+
+// retryableDownloadError marks failures where another attempt may succeed,
+// such as a dropped connection or a 5xx from the CDN.
+type retryableDownloadError struct {
+	err error
+}
+
+func (e *retryableDownloadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableDownloadError) Unwrap() error {
+	return e.err
+}
+
+func retryable(err error) error {
+	return &retryableDownloadError{err: err}
+}
+
+func canResumeOutput(outputPath string, outputFD int) bool {
+	if isFDOutput(outputFD) {
+		return false
+	}
+	path := strings.TrimSpace(outputPath)
+	return path != "" && !strings.HasPrefix(path, "/proc/self/fd/")
+}
+
+func loadPartialInfo(partPath string) *partialDownloadInfo {
+	data, err := os.ReadFile(partPath + ".json")
+	if err != nil {
+		return nil
+	}
+	var info partialDownloadInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil
+	}
+	return &info
+}
+
+func savePartialInfo(partPath string, info *partialDownloadInfo) {
+	info.UpdatedAt = time.Now().UnixMilli()
+	data, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(partPath+".json", data, 0644); err != nil {
+		GoLog("[Resume] Failed to write partial sidecar: %v\n", err)
+	}
+}
+
+func discardPartial(partPath string) {
+	os.Remove(partPath)
+	os.Remove(partPath + ".json")
+}
+
+// parseContentRange parses "bytes start-end/total". total is -1 when the
+// server reports "*".
+func parseContentRange(header string) (start, total int64, ok bool) {
+	value, found := strings.CutPrefix(strings.TrimSpace(header), "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	rangePart, totalPart, found := strings.Cut(value, "/")
+	if !found {
+		return 0, 0, false
+	}
+	startPart, _, found := strings.Cut(rangePart, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(startPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if totalPart == "*" {
+		return start, -1, true
+	}
+	total, err = strconv.ParseInt(totalPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+// downloadWithResume streams downloadURL to outputPath. Path outputs are
+// written to outputPath+".part" and renamed into place once complete; on a
+// network drop the transfer is retried with a Range request continuing from
+// the bytes already on disk. source identifies the provider and track, such
+// as "tidal:123"; a partial file left by another source is discarded. The
+// .part file and its sidecar are only kept when the download is cancelled, so
+// a later call for the same track can resume.
+//
+// SAF file descriptors cannot be renamed or reopened, so they fall back to a
+// single plain transfer.
+func downloadWithResume(ctx context.Context, client *http.Client, downloadURL, outputPath string, outputFD int, itemID, source string) (int64, error) {
+	if !canResumeOutput(outputPath, outputFD) {
+		return downloadToOutput(ctx, client, downloadURL, outputPath, outputFD, itemID)
+	}
+
+	partPath := outputPath + partialFileSuffix
+	var lastErr error
+	retryDelay := resumeRetryDelay
+
+	for attempt := 0; attempt < resumeMaxAttempts; attempt++ {
+		if attempt > 0 {
+			GoLog("[Resume] Retry %d/%d for %s after %v (%v)\n",
+				attempt, resumeMaxAttempts-1, filepath.Base(outputPath), retryDelay, lastErr)
+			select {
+			case <-ctx.Done():
+				return 0, ErrDownloadCancelled
+			case <-time.After(retryDelay):
+			}
+			retryDelay *= 2
+		}
+
+		if isDownloadCancelled(itemID) {
+			return 0, ErrDownloadCancelled
+		}
+
+		size, err := fetchIntoPartial(ctx, client, downloadURL, partPath, itemID, source)
+		if err == nil {
+			if renameErr := os.Rename(partPath, outputPath); renameErr != nil {
+				return 0, fmt.Errorf("failed to finalize download: %w", renameErr)
+			}
+			os.Remove(partPath + ".json")
+			return size, nil
+		}
+
+		if errors.Is(err, ErrDownloadCancelled) || isDownloadCancelled(itemID) {
+			return 0, ErrDownloadCancelled
+		}
+
+		var retryErr *retryableDownloadError
+		if !errors.As(err, &retryErr) {
+			discardPartial(partPath)
+			return 0, err
+		}
+		lastErr = retryErr.err
+	}
+
+	discardPartial(partPath)
+	return 0, lastErr
+}
+
+func fetchIntoPartial(ctx context.Context, client *http.Client, downloadURL, partPath, itemID, source string) (int64, error) {
+	info := loadPartialInfo(partPath)
+	var offset int64
+	if info != nil {
+		// Without a validator there is no way to tell that the server still
+		// has the same file, and bytes from another source never belong.
+		if info.Source != source || (info.ETag == "" && info.LastModified == "") {
+			GoLog("[Resume] Partial file for %s cannot be resumed safely, restarting\n", filepath.Base(partPath))
+			discardPartial(partPath)
+			info = nil
+		} else if stat, err := os.Stat(partPath); err == nil {
+			offset = stat.Size()
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if info.ETag != "" {
+			req.Header.Set("If-Range", info.ETag)
+		} else if info.LastModified != "" {
+			req.Header.Set("If-Range", info.LastModified)
+		}
+	}
+
+	resp, err := DoRequestWithUserAgent(client, req)
+	if err != nil {
+		if isDownloadCancelled(itemID) {
+			return 0, ErrDownloadCancelled
+		}
+		return 0, retryable(err)
+	}
+	defer resp.Body.Close()
+
+	var totalSize int64
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		etag := resp.Header.Get("ETag")
+		if !ok || start != offset ||
+			(total > 0 && info.TotalSize > 0 && total != info.TotalSize) ||
+			(etag != "" && info.ETag != "" && etag != info.ETag) {
+			GoLog("[Resume] Partial file for %s does not match server copy, restarting\n", filepath.Base(partPath))
+			discardPartial(partPath)
+			return 0, retryable(fmt.Errorf("range response did not match partial file"))
+		}
+		totalSize = total
+		if totalSize <= 0 {
+			totalSize = info.TotalSize
+		}
+		GoLog("[Resume] Resuming %s from %d/%d bytes\n", filepath.Base(partPath), offset, totalSize)
+
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			GoLog("[Resume] Server ignored Range request, restarting %s from zero\n", filepath.Base(partPath))
+		}
+		offset = 0
+		totalSize = resp.ContentLength
+		info = &partialDownloadInfo{
+			Source:       source,
+			URL:          downloadURL,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			TotalSize:    totalSize,
+		}
+		savePartialInfo(partPath, info)
+
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		if info.TotalSize > 0 && offset == info.TotalSize {
+			GoLog("[Resume] Partial file for %s is already complete\n", filepath.Base(partPath))
+			return offset, nil
+		}
+		discardPartial(partPath)
+		return 0, retryable(httpStatusError("", resp.StatusCode, "download failed"))
+
+	case resp.StatusCode >= 500:
+		return 0, retryable(httpStatusError("", resp.StatusCode, "download failed"))
+
+	default:
+		return 0, httpStatusError("", resp.StatusCode, "download failed")
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	if offset > 0 {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+	}
+	out, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	if itemID != "" {
+		if totalSize > 0 {
+			SetItemBytesTotal(itemID, totalSize)
+		}
+		SetItemBytesReceived(itemID, offset)
+	}
+
+	bufWriter := bufio.NewWriterSize(out, 256*1024)
+
+	var written int64
+	if itemID != "" {
+		progressWriter := NewItemProgressWriterAt(bufWriter, itemID, offset)
+		written, err = io.Copy(progressWriter, resp.Body)
+	} else {
+		written, err = io.Copy(bufWriter, resp.Body)
+	}
+
+	// Flush even after a read error so everything received stays in the .part file.
+	flushErr := bufWriter.Flush()
+	closeErr := out.Close()
+
+	if err != nil {
+		if isDownloadCancelled(itemID) {
+			return 0, ErrDownloadCancelled
+		}
+		if errors.Is(err, syscall.ENOSPC) {
+			return 0, newDownloadError(ErrKindDiskFull, "", err, "download interrupted")
+		}
+		return 0, retryable(fmt.Errorf("download interrupted: %w", err))
+	}
+	if flushErr != nil {
+		return 0, fmt.Errorf("failed to flush buffer: %w", flushErr)
+	}
+	if closeErr != nil {
+		return 0, fmt.Errorf("failed to close file: %w", closeErr)
+	}
+
+	received := offset + written
+	if totalSize > 0 && received != totalSize {
+		return 0, retryable(fmt.Errorf("incomplete download: expected %d bytes, got %d bytes", totalSize, received))
+	}
+
+	return received, nil
+}
+
+// downloadToOutput is the single-attempt transfer used for outputs that cannot
+// be resumed, such as SAF file descriptors.
+func downloadToOutput(ctx context.Context, client *http.Client, downloadURL, outputPath string, outputFD int, itemID string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := DoRequestWithUserAgent(client, req)
+	if err != nil {
+		if isDownloadCancelled(itemID) {
+			return 0, ErrDownloadCancelled
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return 0, httpStatusError("", resp.StatusCode, "download failed")
+	}
+
+	expectedSize := resp.ContentLength
+	if expectedSize > 0 && itemID != "" {
+		SetItemBytesTotal(itemID, expectedSize)
+	}
+
+	out, err := openOutputForWrite(outputPath, outputFD)
+	if err != nil {
+		return 0, err
+	}
+
+	bufWriter := bufio.NewWriterSize(out, 256*1024)
+
+	var written int64
+	if itemID != "" {
+		progressWriter := NewItemProgressWriter(bufWriter, itemID)
+		written, err = io.Copy(progressWriter, resp.Body)
+	} else {
+		written, err = io.Copy(bufWriter, resp.Body)
+	}
+
+	flushErr := bufWriter.Flush()
+	closeErr := out.Close()
+
+	if err != nil {
+		cleanupOutputOnError(outputPath, outputFD)
+		if isDownloadCancelled(itemID) {
+			return 0, ErrDownloadCancelled
+		}
+		return 0, fmt.Errorf("download interrupted: %w", err)
+	}
+	if flushErr != nil {
+		cleanupOutputOnError(outputPath, outputFD)
+		return 0, fmt.Errorf("failed to flush buffer: %w", flushErr)
+	}
+	if closeErr != nil {
+		cleanupOutputOnError(outputPath, outputFD)
+		return 0, fmt.Errorf("failed to close file: %w", closeErr)
+	}
+
+	if expectedSize > 0 && written != expectedSize {
+		cleanupOutputOnError(outputPath, outputFD)
+		return 0, fmt.Errorf("incomplete download: expected %d bytes, got %d bytes", expectedSize, written)
+	}
+
+	return written, nil
+}
@@ -0,0 +1,179 @@
+package gobackend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadWithResume_ContinuesPartialFileWithRange(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	modTime := time.Unix(1700000000, 0)
+
+	var mu sync.Mutex
+	var rangeHeaders []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		rangeHeaders = append(rangeHeaders, r.Header.Get("Range"))
+		mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "track.flac", modTime, bytes.NewReader(payload))
+	}))
+	defer server.Close()
+
+	outputPath := filepath.Join(t.TempDir(), "track.flac")
+	partPath := outputPath + partialFileSuffix
+
+	// Simulate an earlier attempt that dropped halfway through.
+	half := int64(len(payload) / 2)
+	if err := os.WriteFile(partPath, payload[:half], 0644); err != nil {
+		t.Fatalf("failed to seed partial file: %v", err)
+	}
+	savePartialInfo(partPath, &partialDownloadInfo{
+		Source:    "tidal:1",
+		URL:       server.URL,
+		ETag:      `"v1"`,
+		TotalSize: int64(len(payload)),
+	})
+
+	itemID := "resume-test"
+	StartItemProgress(itemID)
+	defer RemoveItemProgress(itemID)
+
+	written, err := downloadWithResume(context.Background(), server.Client(), server.URL, outputPath, 0, itemID, "tidal:1")
+	if err != nil {
+		t.Fatalf("downloadWithResume failed: %v", err)
+	}
+	if written != int64(len(payload)) {
+		t.Fatalf("expected %d bytes, got %d", len(payload), written)
+	}
+
+	got, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatal("output does not match payload")
+	}
+	if _, err := os.Stat(partPath); !os.IsNotExist(err) {
+		t.Fatal("expected .part file to be renamed away")
+	}
+	if _, err := os.Stat(partPath + ".json"); !os.IsNotExist(err) {
+		t.Fatal("expected sidecar to be removed")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(rangeHeaders) != 1 || !strings.HasPrefix(rangeHeaders[0], "bytes=") {
+		t.Fatalf("expected a single Range request, got %v", rangeHeaders)
+	}
+
+	var progress ItemProgress
+	if err := json.Unmarshal([]byte(GetItemProgress(itemID)), &progress); err != nil {
+		t.Fatalf("failed to parse progress: %v", err)
+	}
+	if progress.BytesTotal != int64(len(payload)) || progress.BytesReceived <= half {
+		t.Fatalf("expected progress to continue from the resumed offset, got %+v", progress)
+	}
+}
+
+func TestDownloadWithResume_RestartsWhenServerIgnoresRange(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 200*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	outputPath := filepath.Join(t.TempDir(), "track.flac")
+	partPath := outputPath + partialFileSuffix
+	if err := os.WriteFile(partPath, []byte("stale bytes"), 0644); err != nil {
+		t.Fatalf("failed to seed partial file: %v", err)
+	}
+	savePartialInfo(partPath, &partialDownloadInfo{Source: "tidal:1", URL: server.URL, ETag: `"v1"`, TotalSize: int64(len(payload))})
+
+	if _, err := downloadWithResume(context.Background(), server.Client(), server.URL, outputPath, 0, "", "tidal:1"); err != nil {
+		t.Fatalf("downloadWithResume failed: %v", err)
+	}
+
+	got, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("expected output to be rewritten from zero, got %d bytes", len(got))
+	}
+}
+
+func TestDownloadWithResume_DiscardsPartialFromOtherSource(t *testing.T) {
+	payload := bytes.Repeat([]byte("y"), 64*1024)
+	var rangeHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader = r.Header.Get("Range")
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "track.flac", time.Unix(1700000000, 0), bytes.NewReader(payload))
+	}))
+	defer server.Close()
+
+	outputPath := filepath.Join(t.TempDir(), "track.flac")
+	partPath := outputPath + partialFileSuffix
+	if err := os.WriteFile(partPath, []byte("qobuz bytes"), 0644); err != nil {
+		t.Fatalf("failed to seed partial file: %v", err)
+	}
+	savePartialInfo(partPath, &partialDownloadInfo{Source: "qobuz:2", URL: server.URL, ETag: `"v1"`, TotalSize: int64(len(payload))})
+
+	if _, err := downloadWithResume(context.Background(), server.Client(), server.URL, outputPath, 0, "", "tidal:1"); err != nil {
+		t.Fatalf("downloadWithResume failed: %v", err)
+	}
+	if rangeHeader != "" {
+		t.Fatalf("expected no Range request for another source's partial, got %q", rangeHeader)
+	}
+	if got, _ := os.ReadFile(outputPath); !bytes.Equal(got, payload) {
+		t.Fatalf("expected output to be downloaded from zero, got %d bytes", len(got))
+	}
+}
+
+func TestDownloadWithResume_DiscardsPartialOnFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	outputPath := filepath.Join(t.TempDir(), "track.flac")
+	partPath := outputPath + partialFileSuffix
+	if err := os.WriteFile(partPath, []byte("stale bytes"), 0644); err != nil {
+		t.Fatalf("failed to seed partial file: %v", err)
+	}
+	savePartialInfo(partPath, &partialDownloadInfo{Source: "tidal:1", URL: server.URL, ETag: `"v1"`})
+
+	if _, err := downloadWithResume(context.Background(), server.Client(), server.URL, outputPath, 0, "", "tidal:1"); err == nil {
+		t.Fatal("expected the download to fail")
+	}
+	if _, err := os.Stat(partPath); !os.IsNotExist(err) {
+		t.Fatal("expected .part file to be removed")
+	}
+	if _, err := os.Stat(partPath + ".json"); !os.IsNotExist(err) {
+		t.Fatal("expected sidecar to be removed")
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, total, ok := parseContentRange("bytes 100-199/1000")
+	if !ok || start != 100 || total != 1000 {
+		t.Fatalf("unexpected parse: %d %d %v", start, total, ok)
+	}
+	if _, total, ok := parseContentRange("bytes 5-9/*"); !ok || total != -1 {
+		t.Fatalf("expected unknown total, got %d %v", total, ok)
+	}
+	if _, _, ok := parseContentRange("items 0-1/2"); ok {
+		t.Fatal("expected non-bytes unit to be rejected")
+	}
+}
@@ -73,7 +73,7 @@ func buildISRCIndex(outputDir string) *ISRCIndex {
 		}
 
 		ext := strings.ToLower(filepath.Ext(path))
-		if ext != ".flac" {
+		if ext != ".flac" || isStagingFile(path) {
 			return nil
 		}
 
@@ -0,0 +1,252 @@
+package gobackend
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Duplicate modes for DownloadRequest.DuplicateMode. The default, skip,
+// treats any existing copy of the track as done.
+const (
+	DuplicateModeSkip            = "skip"
+	DuplicateModeReplaceIfBetter = "replace_if_better"
+)
+
+// errNotAnUpgrade is returned by a staged commit when the downloaded file is
+// not better than the one it was meant to replace. Providers report the
+// existing file as already downloaded.
+var errNotAnUpgrade = errors.New("downloaded file is not better than the existing one")
+
+// audioGrade is the part of a file's quality used to rank two versions of the
+// same track. Zero bit depth or sample rate means unknown.
+type audioGrade struct {
+	Known      bool
+	Lossless   bool
+	BitDepth   int
+	SampleRate int
+	Bitrate    int
+}
+
+func (g audioGrade) String() string {
+	switch {
+	case !g.Known:
+		return "unknown"
+	case !g.Lossless && g.Bitrate > 0:
+		return fmt.Sprintf("lossy %dkbps", g.Bitrate/1000)
+	case !g.Lossless:
+		return "lossy"
+	case g.BitDepth > 0 && g.SampleRate > 0:
+		return fmt.Sprintf("lossless %d-bit/%dHz", g.BitDepth, g.SampleRate)
+	}
+	return "lossless"
+}
+
+// betterThan reports whether g is certainly an improvement on other:
+// lossless over lossy, then higher bit depth, then higher sample rate.
+func (g audioGrade) betterThan(other audioGrade) bool {
+	if !g.Known || !other.Known || !g.Lossless {
+		return false
+	}
+	if !other.Lossless {
+		return true
+	}
+	if g.BitDepth > 0 && other.BitDepth > 0 && g.BitDepth != other.BitDepth {
+		return g.BitDepth > other.BitDepth
+	}
+	return g.SampleRate > 0 && other.SampleRate > 0 && g.SampleRate > other.SampleRate
+}
+
+// mayBeBetterThan is betterThan for an expected quality, where unknown values
+// give the download the benefit of the doubt. The delivered file is checked
+// with betterThan before it replaces anything.
+func (g audioGrade) mayBeBetterThan(other audioGrade) bool {
+	if g.Known && !g.Lossless {
+		return false
+	}
+	if !other.Lossless {
+		return true
+	}
+	if !g.Known {
+		return false
+	}
+	if g.BitDepth == 0 || other.BitDepth == 0 {
+		return true
+	}
+	if g.BitDepth != other.BitDepth {
+		return g.BitDepth > other.BitDepth
+	}
+	return g.SampleRate == 0 || other.SampleRate == 0 || g.SampleRate > other.SampleRate
+}
+
+// expectedAudioGrade converts a format name as used by download plans into
+// a grade.
+func expectedAudioGrade(format string, bitDepth, sampleRate int) audioGrade {
+	lossless, known := planFormatLossless(format)
+	return audioGrade{Known: known, Lossless: lossless, BitDepth: bitDepth, SampleRate: sampleRate}
+}
+
+// probeAudioGrade reads the grade of a file on disk.
+func probeAudioGrade(path string) audioGrade {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		if quality, err := GetAudioQuality(path); err == nil {
+			return audioGrade{Known: true, Lossless: true, BitDepth: quality.BitDepth, SampleRate: quality.SampleRate}
+		}
+	case ".m4a", ".mp4":
+		lossless, known := isLosslessM4A(path)
+		if !known {
+			break
+		}
+		grade := audioGrade{Known: true, Lossless: lossless}
+		if quality, err := GetM4AQuality(path); err == nil {
+			grade.SampleRate = quality.SampleRate
+			if lossless {
+				grade.BitDepth = quality.BitDepth
+			}
+		}
+		return grade
+	case ".mp3":
+		if quality, err := GetMP3Quality(path); err == nil {
+			return audioGrade{Known: true, SampleRate: quality.SampleRate, Bitrate: quality.Bitrate}
+		}
+	case ".ogg", ".opus":
+		if quality, err := GetOggQuality(path); err == nil {
+			return audioGrade{Known: true, SampleRate: quality.SampleRate, Bitrate: quality.Bitrate}
+		}
+	}
+	return audioGrade{}
+}
+
+// pendingUpgrade is an existing file a provider may replace with a better
+// download.
+type pendingUpgrade struct {
+	path         string
+	grade        audioGrade
+	preserveTags bool
+	replaced     bool
+}
+
+// keepExistingFile decides what to do about an existing copy of the track at
+// path. It returns true when the download should stop and report path as
+// already downloaded; otherwise *upgrade is set to the file to replace.
+func keepExistingFile(req DownloadRequest, path string, upgrade **pendingUpgrade) bool {
+	if *upgrade != nil && (*upgrade).path == path {
+		return false
+	}
+	if req.DuplicateMode != DuplicateModeReplaceIfBetter {
+		return true
+	}
+
+	grade := probeAudioGrade(path)
+	if !grade.Known {
+		GoLog("[Duplicate] Cannot read quality of %s, keeping it\n", filepath.Base(path))
+		return true
+	}
+	*upgrade = &pendingUpgrade{path: path, grade: grade, preserveTags: req.PreserveExistingTags}
+	return false
+}
+
+// findLegacyVersion looks for an existing copy of outputPath saved in another
+// format, such as an old MP3 next to where the FLAC would go. It only looks
+// in replace-if-better mode; a plain duplicate check ignores other formats.
+func findLegacyVersion(req DownloadRequest, outputPath string) string {
+	if req.DuplicateMode != DuplicateModeReplaceIfBetter {
+		return ""
+	}
+	stem := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+	for _, ext := range []string{".mp3", ".m4a", ".opus", ".ogg", ".flac"} {
+		candidate := stem + ext
+		if candidate != outputPath && CheckFileExists(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// worthDownloading reports whether a provider expected to deliver expected
+// could improve on the existing file.
+func (u *pendingUpgrade) worthDownloading(expected audioGrade) bool {
+	if expected.mayBeBetterThan(u.grade) {
+		GoLog("[Duplicate] Trying to replace %s (%s) with %s\n", filepath.Base(u.path), u.grade, expected)
+		return true
+	}
+	GoLog("[Duplicate] %s (%s) is at least as good as %s, keeping it\n", filepath.Base(u.path), u.grade, expected)
+	return false
+}
+
+// prepare checks the staged download against the existing file and, if asked,
+// carries the existing file's tags over to it.
+func (u *pendingUpgrade) prepare(workFile string) error {
+	delivered := probeAudioGrade(workFile)
+	if !delivered.betterThan(u.grade) {
+		GoLog("[Duplicate] Delivered %s does not improve on %s, keeping %s\n", delivered, u.grade, filepath.Base(u.path))
+		return errNotAnUpgrade
+	}
+	if u.preserveTags {
+		u.copyTags(workFile)
+	}
+	return nil
+}
+
+func (u *pendingUpgrade) copyTags(workFile string) {
+	tags := readExistingTags(u.path)
+	if tags == nil {
+		return
+	}
+	if err := EmbedMetadata(workFile, *tags, ""); err != nil {
+		GoLog("[Duplicate] Failed to carry tags over from %s: %v\n", filepath.Base(u.path), err)
+	}
+}
+
+// finish removes the replaced file once the new one is in place at dest.
+func (u *pendingUpgrade) finish(dest string) {
+	u.replaced = true
+	if u.path != dest {
+		if err := os.Remove(u.path); err != nil && !os.IsNotExist(err) {
+			GoLog("[Duplicate] Failed to remove replaced file %s: %v\n", u.path, err)
+		}
+	}
+	GoLog("[Duplicate] Replaced %s (%s) with %s\n", filepath.Base(u.path), u.grade, filepath.Base(dest))
+}
+
+// replacedFile returns the path of the file the download replaced, if any.
+func (u *pendingUpgrade) replacedFile() string {
+	if u == nil || !u.replaced {
+		return ""
+	}
+	return u.path
+}
+
+// readExistingTags reads the tags of a file in any supported format. Embedded
+// provenance is left out since it describes the old download.
+func readExistingTags(path string) *Metadata {
+	var audio *AudioMetadata
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		metadata, err := ReadMetadata(path)
+		if err != nil {
+			return nil
+		}
+		metadata.Provenance = nil
+		return metadata
+	case ".mp3":
+		audio, err = ReadID3Tags(path)
+	case ".ogg", ".opus":
+		audio, err = ReadOggVorbisComments(path)
+	case ".m4a", ".mp4", ".m4b":
+		audio, err = readM4ATags(path)
+	default:
+		return nil
+	}
+	if err != nil || audio == nil {
+		return nil
+	}
+
+	metadata := audioMetadataToMetadata(audio)
+	metadata.Provenance = nil
+	return metadata
+}
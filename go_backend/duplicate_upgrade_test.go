@@ -0,0 +1,195 @@
+package gobackend
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestMP3 writes an ID3v2.3 tag with the given text frames followed by
+// a single 128kbps/44.1kHz MPEG-1 Layer III frame header.
+func writeTestMP3(t *testing.T, dir, name string, frames map[string]string) string {
+	t.Helper()
+	var body []byte
+	for id, value := range frames {
+		payload := append([]byte{0}, value...)
+		body = append(body, id...)
+		body = append(body, testBE32(uint32(len(payload)))...)
+		body = append(body, 0, 0)
+		body = append(body, payload...)
+	}
+	size := len(body)
+	data := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+	data = append(data, body...)
+	data = append(data, 0xFF, 0xFB, 0x90, 0x00)
+	data = append(data, make([]byte, 413)...)
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write test MP3: %v", err)
+	}
+	return path
+}
+
+func TestAudioGradeBetterThan(t *testing.T) {
+	mp3 := audioGrade{Known: true, SampleRate: 44100, Bitrate: 320000}
+	cd := audioGrade{Known: true, Lossless: true, BitDepth: 16, SampleRate: 44100}
+	hiRes := audioGrade{Known: true, Lossless: true, BitDepth: 24, SampleRate: 96000}
+
+	cases := []struct {
+		name       string
+		new, old   audioGrade
+		wantBetter bool
+	}{
+		{"lossless over lossy", cd, mp3, true},
+		{"lossy over lossless", mp3, cd, false},
+		{"lossy over lossy", mp3, mp3, false},
+		{"higher bit depth", hiRes, cd, true},
+		{"same quality", cd, cd, false},
+		{"lower quality", cd, hiRes, false},
+		{"higher sample rate", audioGrade{Known: true, Lossless: true, BitDepth: 16, SampleRate: 48000}, cd, true},
+		{"unknown", audioGrade{}, mp3, false},
+	}
+	for _, c := range cases {
+		if got := c.new.betterThan(c.old); got != c.wantBetter {
+			t.Fatalf("%s: betterThan = %v, want %v", c.name, got, c.wantBetter)
+		}
+	}
+
+	if !expectedAudioGrade("flac", 0, 0).mayBeBetterThan(cd) {
+		t.Fatal("expected FLAC of unknown depth to be worth trying over 16-bit")
+	}
+	if expectedAudioGrade("aac", 0, 0).mayBeBetterThan(mp3) {
+		t.Fatal("expected AAC not to be worth trying over MP3")
+	}
+	if expectedAudioGrade("flac", 16, 44100).mayBeBetterThan(cd) {
+		t.Fatal("expected 16-bit FLAC not to be worth trying over 16-bit FLAC")
+	}
+}
+
+func TestStagedCommitReplacesLegacyMP3(t *testing.T) {
+	dir := t.TempDir()
+	old := writeTestMP3(t, dir, "Song.mp3", map[string]string{"TIT2": "My Edited Title", "TPE1": "Artist"})
+	outputPath := filepath.Join(dir, "Song.flac")
+	req := DownloadRequest{DuplicateMode: DuplicateModeReplaceIfBetter, PreserveExistingTags: true}
+
+	legacy := findLegacyVersion(req, outputPath)
+	if legacy != old {
+		t.Fatalf("expected legacy MP3 to be found, got %q", legacy)
+	}
+	var upgrade *pendingUpgrade
+	if keepExistingFile(req, legacy, &upgrade) {
+		t.Fatal("expected MP3 to be considered for replacement")
+	}
+	if !upgrade.worthDownloading(expectedAudioGrade("flac", 16, 44100)) {
+		t.Fatal("expected FLAC download to be worth trying over MP3")
+	}
+
+	stage := newStagedOutput(outputPath)
+	stage.upgrade = upgrade
+	writeTestFLAC(t, dir, filepath.Base(stage.workPath), 44100, 16)
+	if err := EmbedMetadata(stage.workPath, Metadata{Title: "Provider Title", Album: "Album"}, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+
+	dest, err := stage.commit(stage.workPath, true)
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if dest != outputPath {
+		t.Fatalf("expected %s, got %s", outputPath, dest)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatal("expected replaced MP3 to be removed")
+	}
+	if upgrade.replacedFile() != old {
+		t.Fatalf("expected replaced file to be recorded, got %q", upgrade.replacedFile())
+	}
+
+	metadata, err := ReadMetadata(dest)
+	if err != nil {
+		t.Fatalf("ReadMetadata: %v", err)
+	}
+	if metadata.Title != "My Edited Title" || metadata.Album != "Album" {
+		t.Fatalf("expected existing tags merged over provider tags, got %+v", metadata)
+	}
+}
+
+func TestStagedCommitKeepsExistingWhenNotBetter(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := writeTestFLAC(t, dir, "Song.flac", 96000, 24)
+	req := DownloadRequest{DuplicateMode: DuplicateModeReplaceIfBetter}
+
+	var upgrade *pendingUpgrade
+	if !keepExistingFile(DownloadRequest{}, outputPath, &upgrade) || upgrade != nil {
+		t.Fatal("expected skip mode to keep the existing file")
+	}
+	if keepExistingFile(req, outputPath, &upgrade) {
+		t.Fatal("expected hi-res FLAC to be considered in replace mode")
+	}
+
+	stage := newStagedOutput(outputPath)
+	stage.upgrade = upgrade
+	writeTestFLAC(t, dir, filepath.Base(stage.workPath), 44100, 16)
+
+	if _, err := stage.commit(stage.workPath, true); !errors.Is(err, errNotAnUpgrade) {
+		t.Fatalf("expected errNotAnUpgrade, got %v", err)
+	}
+	if _, err := os.Stat(stage.workPath); !os.IsNotExist(err) {
+		t.Fatal("expected staged download to be discarded")
+	}
+	quality, err := GetAudioQuality(outputPath)
+	if err != nil || quality.BitDepth != 24 {
+		t.Fatalf("expected existing hi-res file to be kept, got %+v, %v", quality, err)
+	}
+	if upgrade.replacedFile() != "" {
+		t.Fatal("expected no replaced file to be recorded")
+	}
+}
+
+func TestStagedCommitKeepsExistingWhenBelowQualityFloor(t *testing.T) {
+	dir := t.TempDir()
+	old := writeTestMP3(t, dir, "Song.mp3", map[string]string{"TIT2": "Song"})
+	outputPath := filepath.Join(dir, "Song.flac")
+	req := DownloadRequest{DuplicateMode: DuplicateModeReplaceIfBetter, MinBitDepth: 24}
+
+	var upgrade *pendingUpgrade
+	if keepExistingFile(req, findLegacyVersion(req, outputPath), &upgrade) {
+		t.Fatal("expected MP3 to be considered for replacement")
+	}
+	stage := newStagedOutput(outputPath)
+	stage.upgrade = upgrade
+	stage.policy = qualityPolicyFromRequest(req)
+	writeTestFLAC(t, dir, filepath.Base(stage.workPath), 44100, 16)
+
+	_, err := stage.commit(stage.workPath, true)
+	attempt := ProviderAttempt{Service: "tidal"}
+	if !attempt.recordRejection(err) || attempt.BitDepth != 16 {
+		t.Fatalf("expected a quality rejection, got %v (%+v)", err, attempt)
+	}
+	if _, err := os.Stat(old); err != nil {
+		t.Fatalf("expected the existing MP3 to be kept: %v", err)
+	}
+	if _, err := os.Stat(stage.workPath); !os.IsNotExist(err) {
+		t.Fatal("expected staged download to be discarded")
+	}
+	if upgrade.replacedFile() != "" {
+		t.Fatal("expected no replaced file to be recorded")
+	}
+}
+
+func TestCopyTagsIntoAnyFormat(t *testing.T) {
+	dir := t.TempDir()
+	old := writeTestFLAC(t, dir, "Song.flac", 44100, 16)
+	if err := EmbedMetadata(old, Metadata{Title: "My Edited Title", Artist: "Artist"}, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+	workFile := writeTestMP3(t, dir, ".Song.spotiflac-tmp.mp3", map[string]string{"TIT2": "Provider Title"})
+
+	(&pendingUpgrade{path: old}).copyTags(workFile)
+	if meta := readExistingTags(workFile); meta == nil || meta.Title != "My Edited Title" || meta.Artist != "Artist" {
+		t.Fatalf("expected tags carried over to the MP3, got %+v", meta)
+	}
+}
@@ -0,0 +1,322 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventListener receives pushed backend events. It is implemented on the app
+// side (gomobile generates the Kotlin/Java interface); eventJSON is a
+// StreamEvent. Calls come from a single Go goroutine, one at a time.
+type EventListener interface {
+	OnEvent(eventJSON string)
+}
+
+// Event types sent to the listener.
+const (
+	EventProgress         = "progress"
+	EventDownloadComplete = "download_complete"
+	EventDownloadFailed   = "download_failed"
+	EventLog              = "log"
+	EventScanProgress     = "scan_progress"
+)
+
+const (
+	defaultEventInterval = 250 * time.Millisecond
+	minEventInterval     = 50 * time.Millisecond
+	maxEventInterval     = 5 * time.Second
+	maxPendingLogEvents  = 200
+)
+
+// StreamEvent is one pushed update. Progress events carry only the items that
+// changed since the previous one; Removed lists items whose progress entry was
+// dropped.
+type StreamEvent struct {
+	Type      string               `json:"type"`
+	Seq       int64                `json:"seq"`
+	Timestamp int64                `json:"timestamp"`
+	Items     []ItemProgress       `json:"items,omitempty"`
+	Removed   []string             `json:"removed,omitempty"`
+	ItemID    string               `json:"item_id,omitempty"`
+	Result    *DownloadResponse    `json:"result,omitempty"`
+	Logs      []LogEntry           `json:"logs,omitempty"`
+	Scan      *LibraryScanProgress `json:"scan,omitempty"`
+}
+
+// EventStream coalesces progress, log and scan updates and delivers them to
+// the listener at most once per interval. Download results and the end of a
+// scan flush immediately, after any progress still pending, so the app never
+// sees a stale progress update arrive behind a completion.
+type EventStream struct {
+	mu       sync.Mutex
+	listener EventListener
+	active   atomic.Bool
+	interval time.Duration
+	seq      int64
+	stop     chan struct{}
+	wake     chan struct{}
+
+	progress map[string]ItemProgress
+	removed  map[string]bool
+	logs     []LogEntry
+	scan     *LibraryScanProgress
+	results  []StreamEvent
+}
+
+var (
+	globalEventStream     *EventStream
+	globalEventStreamOnce sync.Once
+)
+
+func GetEventStream() *EventStream {
+	globalEventStreamOnce.Do(func() {
+		globalEventStream = newEventStream()
+	})
+	return globalEventStream
+}
+
+func newEventStream() *EventStream {
+	s := &EventStream{interval: defaultEventInterval}
+	s.resetPendingLocked()
+	return s
+}
+
+func (s *EventStream) resetPendingLocked() {
+	s.progress = make(map[string]ItemProgress)
+	s.removed = make(map[string]bool)
+	s.logs = nil
+	s.scan = nil
+	s.results = nil
+}
+
+// SetListener installs listener and starts delivering events. Replacing an
+// existing listener keeps the pending updates for the new one.
+func (s *EventStream) SetListener(listener EventListener) {
+	if listener == nil {
+		s.ClearListener()
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listener = listener
+	if s.stop == nil {
+		s.resetPendingLocked()
+		s.stop = make(chan struct{})
+		s.wake = make(chan struct{}, 1)
+		go s.loop(s.stop, s.wake)
+	}
+	s.active.Store(true)
+}
+
+// ClearListener stops delivery and drops pending updates.
+func (s *EventStream) ClearListener() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active.Store(false)
+	s.listener = nil
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+		s.wake = nil
+	}
+	s.resetPendingLocked()
+}
+
+// SetInterval changes how often coalesced updates are delivered.
+func (s *EventStream) SetInterval(interval time.Duration) {
+	if interval < minEventInterval {
+		interval = minEventInterval
+	}
+	if interval > maxEventInterval {
+		interval = maxEventInterval
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interval = interval
+	s.wakeLocked()
+}
+
+func (s *EventStream) loop(stop, wake chan struct{}) {
+	s.mu.Lock()
+	interval := s.interval
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+		s.flush()
+
+		s.mu.Lock()
+		if s.interval != interval {
+			interval = s.interval
+			ticker.Reset(interval)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *EventStream) wakeLocked() {
+	if s.wake == nil {
+		return
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *EventStream) queueProgress(item ItemProgress) {
+	if !s.active.Load() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.removed, item.ItemID)
+	s.progress[item.ItemID] = item
+}
+
+func (s *EventStream) queueRemoved(itemID string) {
+	if !s.active.Load() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.progress, itemID)
+	s.removed[itemID] = true
+}
+
+func (s *EventStream) queueLog(entry LogEntry) {
+	if !s.active.Load() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.logs) >= maxPendingLogEvents {
+		s.logs = s.logs[1:]
+	}
+	s.logs = append(s.logs, entry)
+}
+
+func (s *EventStream) queueScan(progress LibraryScanProgress) {
+	if !s.active.Load() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scan = &progress
+	if progress.IsComplete {
+		s.wakeLocked()
+	}
+}
+
+func (s *EventStream) queueResult(itemID string, resp DownloadResponse) {
+	if !s.active.Load() {
+		return
+	}
+	eventType := EventDownloadComplete
+	if !resp.Success {
+		eventType = EventDownloadFailed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, StreamEvent{Type: eventType, ItemID: itemID, Result: &resp})
+	s.wakeLocked()
+}
+
+// takeLocked drains the pending updates into events in delivery order.
+func (s *EventStream) takeLocked() []StreamEvent {
+	var events []StreamEvent
+
+	if len(s.progress) > 0 || len(s.removed) > 0 {
+		event := StreamEvent{Type: EventProgress}
+		for _, item := range s.progress {
+			event.Items = append(event.Items, item)
+		}
+		sort.Slice(event.Items, func(i, j int) bool { return event.Items[i].ItemID < event.Items[j].ItemID })
+		for itemID := range s.removed {
+			event.Removed = append(event.Removed, itemID)
+		}
+		sort.Strings(event.Removed)
+		events = append(events, event)
+	}
+	if s.scan != nil {
+		events = append(events, StreamEvent{Type: EventScanProgress, Scan: s.scan})
+	}
+	if len(s.logs) > 0 {
+		events = append(events, StreamEvent{Type: EventLog, Logs: s.logs})
+	}
+	events = append(events, s.results...)
+
+	s.progress = make(map[string]ItemProgress)
+	s.removed = make(map[string]bool)
+	s.logs = nil
+	s.scan = nil
+	s.results = nil
+
+	now := time.Now().UnixMilli()
+	for i := range events {
+		s.seq++
+		events[i].Seq = s.seq
+		events[i].Timestamp = now
+	}
+	return events
+}
+
+// flush delivers everything pending. The listener is called without holding
+// the lock, so it may call back into the backend.
+func (s *EventStream) flush() {
+	s.mu.Lock()
+	listener := s.listener
+	if listener == nil {
+		s.mu.Unlock()
+		return
+	}
+	events := s.takeLocked()
+	s.mu.Unlock()
+
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		listener.OnEvent(string(data))
+	}
+}
+
+func emitItemProgress(item *ItemProgress) {
+	GetEventStream().queueProgress(*item)
+}
+
+func emitItemRemoved(itemID string) {
+	GetEventStream().queueRemoved(itemID)
+}
+
+func emitDownloadResult(itemID string, resp DownloadResponse) {
+	GetEventStream().queueResult(itemID, resp)
+}
+
+func emitLibraryScanProgress() {
+	stream := GetEventStream()
+	if !stream.active.Load() {
+		return
+	}
+	libraryScanProgressMu.RLock()
+	progress := libraryScanProgress
+	libraryScanProgressMu.RUnlock()
+	stream.queueScan(progress)
+}
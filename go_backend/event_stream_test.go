@@ -0,0 +1,142 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+type recordingListener struct {
+	mu     sync.Mutex
+	events []StreamEvent
+}
+
+func (l *recordingListener) OnEvent(eventJSON string) {
+	var event StreamEvent
+	if err := json.Unmarshal([]byte(eventJSON), &event); err != nil {
+		panic(err)
+	}
+	l.mu.Lock()
+	l.events = append(l.events, event)
+	l.mu.Unlock()
+}
+
+func (l *recordingListener) take() []StreamEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	events := l.events
+	l.events = nil
+	return events
+}
+
+func newTestEventStream(listener EventListener) *EventStream {
+	s := newEventStream()
+	s.listener = listener
+	s.active.Store(true)
+	return s
+}
+
+func TestEventStreamCoalescesProgress(t *testing.T) {
+	listener := &recordingListener{}
+	s := newTestEventStream(listener)
+
+	for i := 1; i <= 10; i++ {
+		s.queueProgress(ItemProgress{ItemID: "a", BytesReceived: int64(i)})
+	}
+	s.queueProgress(ItemProgress{ItemID: "b", BytesReceived: 5})
+	s.queueRemoved("b")
+	s.flush()
+
+	events := listener.take()
+	if len(events) != 1 || events[0].Type != EventProgress {
+		t.Fatalf("expected one progress event, got %+v", events)
+	}
+	if len(events[0].Items) != 1 || events[0].Items[0].BytesReceived != 10 {
+		t.Fatalf("expected latest progress for a only, got %+v", events[0].Items)
+	}
+	if len(events[0].Removed) != 1 || events[0].Removed[0] != "b" {
+		t.Fatalf("expected b removed, got %v", events[0].Removed)
+	}
+
+	s.flush()
+	if events := listener.take(); len(events) != 0 {
+		t.Fatalf("expected nothing after drain, got %+v", events)
+	}
+}
+
+func TestEventStreamResultAfterPendingProgress(t *testing.T) {
+	listener := &recordingListener{}
+	s := newTestEventStream(listener)
+
+	s.queueProgress(ItemProgress{ItemID: "a", Progress: 0.5})
+	s.queueLog(LogEntry{Tag: "Tidal", Message: "hello"})
+	s.queueResult("a", DownloadResponse{Success: false, Error: "nope", ErrorType: "not_found"})
+	s.flush()
+
+	events := listener.take()
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	wantTypes := []string{EventProgress, EventLog, EventDownloadFailed}
+	for i, want := range wantTypes {
+		if events[i].Type != want {
+			t.Fatalf("event %d: expected %s, got %s", i, want, events[i].Type)
+		}
+		if i > 0 && events[i].Seq <= events[i-1].Seq {
+			t.Fatalf("expected increasing seq, got %d after %d", events[i].Seq, events[i-1].Seq)
+		}
+	}
+	if events[2].ItemID != "a" || events[2].Result == nil || events[2].Result.ErrorType != "not_found" {
+		t.Fatalf("unexpected result event: %+v", events[2])
+	}
+}
+
+func TestEventStreamInactiveDropsUpdates(t *testing.T) {
+	listener := &recordingListener{}
+	s := newTestEventStream(listener)
+	s.active.Store(false)
+
+	s.queueProgress(ItemProgress{ItemID: "a"})
+	s.queueResult("a", DownloadResponse{Success: true})
+	s.active.Store(true)
+	s.flush()
+
+	if events := listener.take(); len(events) != 0 {
+		t.Fatalf("expected no events while inactive, got %+v", events)
+	}
+}
+
+func TestEventStreamProgressHooks(t *testing.T) {
+	stream := GetEventStream()
+	stream.SetInterval(maxEventInterval)
+	listener := &recordingListener{}
+	stream.SetListener(listener)
+	defer func() {
+		stream.ClearListener()
+		stream.SetInterval(defaultEventInterval)
+	}()
+
+	StartItemProgress("hook-item")
+	SetItemBytesTotal("hook-item", 100)
+	SetItemBytesReceived("hook-item", 40)
+	stream.flush()
+
+	var found *ItemProgress
+	for _, event := range listener.take() {
+		for i := range event.Items {
+			if event.Items[i].ItemID == "hook-item" {
+				found = &event.Items[i]
+			}
+		}
+	}
+	if found == nil || found.BytesReceived != 40 || found.Progress != 0.4 {
+		t.Fatalf("expected coalesced progress for hook-item, got %+v", found)
+	}
+
+	RemoveItemProgress("hook-item")
+	stream.flush()
+	events := listener.take()
+	if len(events) != 1 || len(events[0].Removed) != 1 || events[0].Removed[0] != "hook-item" {
+		t.Fatalf("expected removal event for hook-item, got %+v", events)
+	}
+}
@@ -173,6 +173,22 @@ type DownloadRequest struct {
 	LyricsMode           string `json:"lyrics_mode,omitempty"`
 	UseExtensions        bool   `json:"use_extensions,omitempty"`
 	UseFallback          bool   `json:"use_fallback,omitempty"`
+	MinBitDepth          int    `json:"min_bit_depth,omitempty"`
+	MinSampleRate        int    `json:"min_sample_rate,omitempty"`
+	LosslessOnly         bool   `json:"lossless_only,omitempty"`
+	MaxAttempts          int    `json:"max_attempts,omitempty"`
+	EmbedProvenance      bool   `json:"embed_provenance,omitempty"`
+	DuplicateMode        string `json:"duplicate_mode,omitempty"`
+	PreserveExistingTags bool   `json:"preserve_existing_tags,omitempty"`
+	ReplayGain           bool   `json:"replay_gain,omitempty"`
+	AlbumType            string `json:"album_type,omitempty"`
+	EmbedMusicBrainzIDs  bool   `json:"embed_musicbrainz_ids,omitempty"`
+
+	ArtistCredits []ArtistCredit `json:"artist_credits,omitempty"`
+
+	// tagRulesApplied is set once applyTagRulesToRequest has rewritten the
+	// request.
+	tagRulesApplied bool
 }
 
 type DownloadResponse struct {
@@ -181,6 +197,7 @@ type DownloadResponse struct {
 	FilePath               string `json:"file_path,omitempty"`
 	Error                  string `json:"error,omitempty"`
 	ErrorType              string `json:"error_type,omitempty"`
+	Retryable              bool   `json:"retryable,omitempty"`
 	AlreadyExists          bool   `json:"already_exists,omitempty"`
 	ActualBitDepth         int    `json:"actual_bit_depth,omitempty"`
 	ActualSampleRate       int    `json:"actual_sample_rate,omitempty"`
@@ -200,6 +217,15 @@ type DownloadResponse struct {
 	SkipMetadataEnrichment bool   `json:"skip_metadata_enrichment,omitempty"`
 	LyricsLRC              string `json:"lyrics_lrc,omitempty"`
 	DecryptionKey          string `json:"decryption_key,omitempty"`
+	// Provenance of the file: the provider's own track ID, the API mirror that
+	// served it and where the lyrics came from.
+	ProviderTrackID string `json:"provider_track_id,omitempty"`
+	Mirror          string `json:"mirror,omitempty"`
+	LyricsSource    string `json:"lyrics_source,omitempty"`
+	// ReplacedFile is the lower-quality file this download replaced.
+	ReplacedFile string `json:"replaced_file,omitempty"`
+	// Attempts lists every provider the fallback chain tried, in order.
+	Attempts []ProviderAttempt `json:"attempts,omitempty"`
 }
 
 type DownloadResult struct {
@@ -218,6 +244,58 @@ type DownloadResult struct {
 	Copyright     string
 	LyricsLRC     string
 	DecryptionKey string
+
+	ProviderTrackID string
+	Mirror          string
+	LyricsSource    string
+	ReplacedFile    string
+}
+
+// downloadResult converts a provider result to the shared DownloadResult used
+// to build responses. Qobuz results have the same fields as Tidal results.
+func (r TidalDownloadResult) downloadResult() DownloadResult {
+	return DownloadResult{
+		FilePath:        r.FilePath,
+		BitDepth:        r.BitDepth,
+		SampleRate:      r.SampleRate,
+		Title:           r.Title,
+		Artist:          r.Artist,
+		Album:           r.Album,
+		ReleaseDate:     r.ReleaseDate,
+		TrackNumber:     r.TrackNumber,
+		DiscNumber:      r.DiscNumber,
+		ISRC:            r.ISRC,
+		LyricsLRC:       r.LyricsLRC,
+		ProviderTrackID: r.ProviderTrackID,
+		Mirror:          r.Mirror,
+		LyricsSource:    r.LyricsSource,
+		ReplacedFile:    r.ReplacedFile,
+	}
+}
+
+func (r QobuzDownloadResult) downloadResult() DownloadResult {
+	return TidalDownloadResult(r).downloadResult()
+}
+
+func (r AmazonDownloadResult) downloadResult() DownloadResult {
+	return DownloadResult{
+		FilePath:        r.FilePath,
+		BitDepth:        r.BitDepth,
+		SampleRate:      r.SampleRate,
+		Title:           r.Title,
+		Artist:          r.Artist,
+		Album:           r.Album,
+		ReleaseDate:     r.ReleaseDate,
+		TrackNumber:     r.TrackNumber,
+		DiscNumber:      r.DiscNumber,
+		ISRC:            r.ISRC,
+		LyricsLRC:       r.LyricsLRC,
+		DecryptionKey:   r.DecryptionKey,
+		ProviderTrackID: r.ProviderTrackID,
+		Mirror:          r.Mirror,
+		LyricsSource:    r.LyricsSource,
+		ReplacedFile:    r.ReplacedFile,
+	}
 }
 
 func buildDownloadSuccessResponse(
@@ -300,6 +378,10 @@ func buildDownloadSuccessResponse(
 		Copyright:        copyright,
 		LyricsLRC:        result.LyricsLRC,
 		DecryptionKey:    result.DecryptionKey,
+		ProviderTrackID:  result.ProviderTrackID,
+		Mirror:           result.Mirror,
+		LyricsSource:     result.LyricsSource,
+		ReplacedFile:     result.ReplacedFile,
 	}
 }
 
@@ -401,56 +483,19 @@ func DownloadTrack(requestJSON string) (string, error) {
 	case "tidal":
 		tidalResult, tidalErr := downloadFromTidal(req)
 		if tidalErr == nil {
-			result = DownloadResult{
-				FilePath:    tidalResult.FilePath,
-				BitDepth:    tidalResult.BitDepth,
-				SampleRate:  tidalResult.SampleRate,
-				Title:       tidalResult.Title,
-				Artist:      tidalResult.Artist,
-				Album:       tidalResult.Album,
-				ReleaseDate: tidalResult.ReleaseDate,
-				TrackNumber: tidalResult.TrackNumber,
-				DiscNumber:  tidalResult.DiscNumber,
-				ISRC:        tidalResult.ISRC,
-				LyricsLRC:   tidalResult.LyricsLRC,
-			}
+			result = tidalResult.downloadResult()
 		}
 		err = tidalErr
 	case "qobuz":
 		qobuzResult, qobuzErr := downloadFromQobuz(req)
 		if qobuzErr == nil {
-			result = DownloadResult{
-				FilePath:    qobuzResult.FilePath,
-				BitDepth:    qobuzResult.BitDepth,
-				SampleRate:  qobuzResult.SampleRate,
-				Title:       qobuzResult.Title,
-				Artist:      qobuzResult.Artist,
-				Album:       qobuzResult.Album,
-				ReleaseDate: qobuzResult.ReleaseDate,
-				TrackNumber: qobuzResult.TrackNumber,
-				DiscNumber:  qobuzResult.DiscNumber,
-				ISRC:        qobuzResult.ISRC,
-				LyricsLRC:   qobuzResult.LyricsLRC,
-			}
+			result = qobuzResult.downloadResult()
 		}
 		err = qobuzErr
 	case "amazon":
 		amazonResult, amazonErr := downloadFromAmazon(req)
 		if amazonErr == nil {
-			result = DownloadResult{
-				FilePath:      amazonResult.FilePath,
-				BitDepth:      amazonResult.BitDepth,
-				SampleRate:    amazonResult.SampleRate,
-				Title:         amazonResult.Title,
-				Artist:        amazonResult.Artist,
-				Album:         amazonResult.Album,
-				ReleaseDate:   amazonResult.ReleaseDate,
-				TrackNumber:   amazonResult.TrackNumber,
-				DiscNumber:    amazonResult.DiscNumber,
-				ISRC:          amazonResult.ISRC,
-				LyricsLRC:     amazonResult.LyricsLRC,
-				DecryptionKey: amazonResult.DecryptionKey,
-			}
+			result = amazonResult.downloadResult()
 		}
 		err = amazonErr
 	case "youtube":
@@ -476,7 +521,8 @@ func DownloadTrack(requestJSON string) (string, error) {
 	}
 
 	if err != nil {
-		return errorResponse(err.Error())
+		jsonBytes, _ := json.Marshal(downloadErrorResponse(err))
+		return string(jsonBytes), nil
 	}
 
 	if len(result.FilePath) > 7 && result.FilePath[:7] == "EXISTS:" {
@@ -510,13 +556,42 @@ func DownloadTrack(requestJSON string) (string, error) {
 	return string(jsonBytes), nil
 }
 
-// DownloadByStrategy routes a unified download request to the appropriate flow.
-// Routing priority: YouTube service > extension fallback > built-in fallback > direct service.
+// DownloadByStrategy routes a unified download request to the appropriate flow,
+// records the outcome in the download history and reports it to the event
+// listener.
 func DownloadByStrategy(requestJSON string) (string, error) {
+	started := time.Now()
+	respJSON, err := downloadByStrategy(requestJSON)
+
+	var req DownloadRequest
+	if json.Unmarshal([]byte(requestJSON), &req) != nil {
+		return respJSON, err
+	}
+
+	var resp DownloadResponse
+	if err != nil {
+		resp = downloadErrorResponse(err)
+	} else if jsonErr := json.Unmarshal([]byte(respJSON), &resp); jsonErr != nil {
+		return respJSON, err
+	}
+
+	GetDownloadHistory().Record(newHistoryRecord(req, resp, time.Since(started)))
+	if req.ItemID != "" {
+		emitDownloadResult(req.ItemID, resp)
+	}
+	return respJSON, err
+}
+
+// downloadByStrategy does the routing for DownloadByStrategy.
+// Routing priority: YouTube service > extension fallback > built-in fallback > direct service.
+func downloadByStrategy(requestJSON string) (string, error) {
 	var req DownloadRequest
 	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
 		return errorResponse("Invalid request: " + err.Error())
 	}
+	// Whichever flow runs, and however many providers it tries, the SAF
+	// descriptor is done with once it returns.
+	defer releaseOutputFD(req.OutputFD)
 
 	serviceRaw := strings.TrimSpace(req.Service)
 	serviceNormalized := strings.ToLower(serviceRaw)
@@ -551,6 +626,23 @@ func DownloadByStrategy(requestJSON string) (string, error) {
 	return DownloadTrack(normalizedJSON)
 }
 
+// fallbackServiceOrder returns the built-in services DownloadWithFallback tries,
+// preferred service first.
+func fallbackServiceOrder(preferredService string) []string {
+	allServices := []string{"tidal", "qobuz", "amazon"}
+	if preferredService == "" {
+		preferredService = "tidal"
+	}
+
+	services := []string{preferredService}
+	for _, s := range allServices {
+		if s != preferredService {
+			services = append(services, s)
+		}
+	}
+	return services
+}
+
 func DownloadWithFallback(requestJSON string) (string, error) {
 	var req DownloadRequest
 	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
@@ -571,28 +663,26 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 
 	enrichRequestExtendedMetadata(&req)
 
-	allServices := []string{"tidal", "qobuz", "amazon"}
-	preferredService := req.Service
-	if preferredService == "" {
-		preferredService = "tidal"
-	}
-
 	GoLog("[DownloadWithFallback] Preferred service from request: '%s'\n", req.Service)
 
-	services := []string{preferredService}
-	for _, s := range allServices {
-		if s != preferredService {
-			services = append(services, s)
-		}
-	}
+	services := fallbackServiceOrder(req.Service)
 
 	GoLog("[DownloadWithFallback] Service order: %v\n", services)
 
+	policy := qualityPolicyFromRequest(req)
+	var attempts []ProviderAttempt
 	var lastErr error
+	rejectedCount := 0
 
 	for _, service := range services {
+		if policy.attemptsExhausted(len(attempts)) {
+			GoLog("[DownloadWithFallback] Max attempts (%d) reached, stopping\n", policy.MaxAttempts)
+			break
+		}
+
 		GoLog("[DownloadWithFallback] Trying service: %s\n", service)
 		req.Service = service
+		started := time.Now()
 
 		var result DownloadResult
 		var err error
@@ -601,19 +691,7 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 		case "tidal":
 			tidalResult, tidalErr := downloadFromTidal(req)
 			if tidalErr == nil {
-				result = DownloadResult{
-					FilePath:    tidalResult.FilePath,
-					BitDepth:    tidalResult.BitDepth,
-					SampleRate:  tidalResult.SampleRate,
-					Title:       tidalResult.Title,
-					Artist:      tidalResult.Artist,
-					Album:       tidalResult.Album,
-					ReleaseDate: tidalResult.ReleaseDate,
-					TrackNumber: tidalResult.TrackNumber,
-					DiscNumber:  tidalResult.DiscNumber,
-					ISRC:        tidalResult.ISRC,
-					LyricsLRC:   tidalResult.LyricsLRC,
-				}
+				result = tidalResult.downloadResult()
 			} else if !errors.Is(tidalErr, ErrDownloadCancelled) {
 				GoLog("[DownloadWithFallback] Tidal error: %v\n", tidalErr)
 			}
@@ -621,19 +699,7 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 		case "qobuz":
 			qobuzResult, qobuzErr := downloadFromQobuz(req)
 			if qobuzErr == nil {
-				result = DownloadResult{
-					FilePath:    qobuzResult.FilePath,
-					BitDepth:    qobuzResult.BitDepth,
-					SampleRate:  qobuzResult.SampleRate,
-					Title:       qobuzResult.Title,
-					Artist:      qobuzResult.Artist,
-					Album:       qobuzResult.Album,
-					ReleaseDate: qobuzResult.ReleaseDate,
-					TrackNumber: qobuzResult.TrackNumber,
-					DiscNumber:  qobuzResult.DiscNumber,
-					ISRC:        qobuzResult.ISRC,
-					LyricsLRC:   qobuzResult.LyricsLRC,
-				}
+				result = qobuzResult.downloadResult()
 			} else if !errors.Is(qobuzErr, ErrDownloadCancelled) {
 				GoLog("[DownloadWithFallback] Qobuz error: %v\n", qobuzErr)
 			}
@@ -641,20 +707,7 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 		case "amazon":
 			amazonResult, amazonErr := downloadFromAmazon(req)
 			if amazonErr == nil {
-				result = DownloadResult{
-					FilePath:      amazonResult.FilePath,
-					BitDepth:      amazonResult.BitDepth,
-					SampleRate:    amazonResult.SampleRate,
-					Title:         amazonResult.Title,
-					Artist:        amazonResult.Artist,
-					Album:         amazonResult.Album,
-					ReleaseDate:   amazonResult.ReleaseDate,
-					TrackNumber:   amazonResult.TrackNumber,
-					DiscNumber:    amazonResult.DiscNumber,
-					ISRC:          amazonResult.ISRC,
-					LyricsLRC:     amazonResult.LyricsLRC,
-					DecryptionKey: amazonResult.DecryptionKey,
-				}
+				result = amazonResult.downloadResult()
 			} else if !errors.Is(amazonErr, ErrDownloadCancelled) {
 				GoLog("[DownloadWithFallback] Amazon error: %v\n", amazonErr)
 			}
@@ -665,6 +718,8 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 			return errorResponse("Download cancelled")
 		}
 
+		attempt := newProviderAttempt(service, started)
+
 		if err == nil {
 			if len(result.FilePath) > 7 && result.FilePath[:7] == "EXISTS:" {
 				actualPath := result.FilePath[7:]
@@ -678,11 +733,20 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 					actualPath,
 					true,
 				)
+				acceptDeliveredQuality(policy, &attempt, "EXISTS:"+actualPath, result.BitDepth, result.SampleRate, false)
+				attempt.Success = true
+				resp.Attempts = append(attempts, attempt)
 				jsonBytes, _ := json.Marshal(resp)
 				return string(jsonBytes), nil
 			}
 
 			enrichResultQualityFromFile(&result)
+			if !acceptDeliveredQuality(policy, &attempt, result.FilePath, result.BitDepth, result.SampleRate, result.DecryptionKey != "") {
+				attempts = append(attempts, attempt)
+				lastErr = fmt.Errorf("%s: %s", service, attempt.Reason)
+				rejectedCount++
+				continue
+			}
 
 			resp := buildDownloadSuccessResponse(
 				req,
@@ -692,14 +756,25 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 				result.FilePath,
 				false,
 			)
+			attempt.Success = true
+			resp.Attempts = append(attempts, attempt)
 			jsonBytes, _ := json.Marshal(resp)
 			return string(jsonBytes), nil
 		}
 
-		lastErr = err
+		if attempt.recordRejection(err) {
+			rejectedCount++
+			lastErr = fmt.Errorf("%s: %s", service, attempt.Reason)
+		} else {
+			attempt.recordError(err)
+			lastErr = err
+		}
+		attempts = append(attempts, attempt)
 	}
 
-	return errorResponse("All services failed. Last error: " + lastErr.Error())
+	resp := fallbackFailureResponse("All services failed", lastErr, attempts, rejectedCount)
+	jsonBytes, _ := json.Marshal(resp)
+	return string(jsonBytes), nil
 }
 
 func GetDownloadProgress() string {
@@ -737,6 +812,7 @@ func ReadFileMetadata(filePath string) (string, error) {
 	isFlac := strings.HasSuffix(lower, ".flac")
 	isMp3 := strings.HasSuffix(lower, ".mp3")
 	isOgg := strings.HasSuffix(lower, ".opus") || strings.HasSuffix(lower, ".ogg")
+	isM4A := isM4AFile(filePath)
 
 	result := map[string]interface{}{
 		"title":        "",
@@ -775,6 +851,9 @@ func ReadFileMetadata(filePath string) (string, error) {
 		result["copyright"] = metadata.Copyright
 		result["composer"] = metadata.Composer
 		result["comment"] = metadata.Comment
+		if metadata.Provenance != nil {
+			result["provenance"] = metadata.Provenance
+		}
 
 		quality, qualityErr := GetAudioQuality(filePath)
 		if qualityErr == nil {
@@ -800,8 +879,13 @@ func ReadFileMetadata(filePath string) (string, error) {
 			result["isrc"] = meta.ISRC
 			result["lyrics"] = meta.Lyrics
 			result["genre"] = meta.Genre
+			result["label"] = meta.Label
+			result["copyright"] = meta.Copyright
 			result["composer"] = meta.Composer
 			result["comment"] = meta.Comment
+			if meta.Provenance != nil {
+				result["provenance"] = meta.Provenance
+			}
 		}
 		quality, qualityErr := GetMP3Quality(filePath)
 		if qualityErr == nil {
@@ -825,14 +909,46 @@ func ReadFileMetadata(filePath string) (string, error) {
 			result["isrc"] = meta.ISRC
 			result["lyrics"] = meta.Lyrics
 			result["genre"] = meta.Genre
+			result["label"] = meta.Label
+			result["copyright"] = meta.Copyright
 			result["composer"] = meta.Composer
 			result["comment"] = meta.Comment
+			if meta.Provenance != nil {
+				result["provenance"] = meta.Provenance
+			}
 		}
 		quality, qualityErr := GetOggQuality(filePath)
 		if qualityErr == nil {
 			result["sample_rate"] = quality.SampleRate
 			result["duration"] = quality.Duration
 		}
+	} else if isM4A {
+		meta, err := readM4ATags(filePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read metadata: %w", err)
+		}
+		result["title"] = meta.Title
+		result["artist"] = meta.Artist
+		result["album"] = meta.Album
+		result["album_artist"] = meta.AlbumArtist
+		result["date"] = meta.Date
+		result["track_number"] = meta.TrackNumber
+		result["disc_number"] = meta.DiscNumber
+		result["isrc"] = meta.ISRC
+		result["lyrics"] = meta.Lyrics
+		result["genre"] = meta.Genre
+		result["label"] = meta.Label
+		result["copyright"] = meta.Copyright
+		result["composer"] = meta.Composer
+		result["comment"] = meta.Comment
+		if meta.Provenance != nil {
+			result["provenance"] = meta.Provenance
+		}
+		quality, qualityErr := GetM4AQuality(filePath)
+		if qualityErr == nil {
+			result["bit_depth"] = quality.BitDepth
+			result["sample_rate"] = quality.SampleRate
+		}
 	} else {
 		return "", fmt.Errorf("unsupported file format: %s", filePath)
 	}
@@ -846,8 +962,8 @@ func ReadFileMetadata(filePath string) (string, error) {
 }
 
 // EditFileMetadata writes metadata to an audio file.
-// For FLAC files, uses native Go FLAC library.
-// For MP3/Opus, returns the metadata map so Dart can use FFmpeg.
+// FLAC, M4A, MP3 and Ogg Vorbis/Opus files are tagged natively; for anything
+// else the metadata map is returned so Dart can use FFmpeg.
 func EditFileMetadata(filePath, metadataJSON string) (string, error) {
 	var fields map[string]string
 	if err := json.Unmarshal([]byte(metadataJSON), &fields); err != nil {
@@ -858,7 +974,7 @@ func EditFileMetadata(filePath, metadataJSON string) (string, error) {
 	isFlac := strings.HasSuffix(lower, ".flac")
 	coverPath := strings.TrimSpace(fields["cover_path"])
 
-	if isFlac {
+	if isFlac || isM4AFile(filePath) || isMP3File(filePath) || isOggFile(filePath) {
 		trackNum := 0
 		discNum := 0
 		if v, ok := fields["track_number"]; ok && v != "" {
@@ -885,7 +1001,7 @@ func EditFileMetadata(filePath, metadataJSON string) (string, error) {
 		}
 
 		if err := EmbedMetadata(filePath, meta, coverPath); err != nil {
-			return "", fmt.Errorf("failed to write FLAC metadata: %w", err)
+			return "", fmt.Errorf("failed to write metadata: %w", err)
 		}
 
 		resp := map[string]any{
@@ -896,7 +1012,7 @@ func EditFileMetadata(filePath, metadataJSON string) (string, error) {
 		return string(jsonBytes), nil
 	}
 
-	// MP3/Opus: return metadata for Dart-side FFmpeg embedding
+	// Other formats: return metadata for Dart-side FFmpeg embedding
 	resp := map[string]any{
 		"success": true,
 		"method":  "ffmpeg",
@@ -952,6 +1068,7 @@ func BuildFilename(template string, metadataJSON string) (string, error) {
 		return "", err
 	}
 
+	applyTagRulesToMap(getCompiledTagRules(), metadata)
 	filename := buildFilenameFromTemplate(template, metadata)
 	return filename, nil
 }
@@ -1477,45 +1594,18 @@ func GetAmazonURLFromDeezerTrack(deezerTrackID string) (string, error) {
 }
 
 func errorResponse(msg string) (string, error) {
-	errorType := "unknown"
-	lowerMsg := strings.ToLower(msg)
-
-	if strings.Contains(lowerMsg, "isp blocking") ||
-		strings.Contains(lowerMsg, "try using vpn") ||
-		strings.Contains(lowerMsg, "change dns") {
-		errorType = "isp_blocked"
-	} else if strings.Contains(lowerMsg, "cancel") {
-		errorType = "cancelled"
-	} else if strings.Contains(lowerMsg, "permission") ||
-		strings.Contains(lowerMsg, "operation not permitted") ||
-		strings.Contains(lowerMsg, "access denied") ||
-		strings.Contains(lowerMsg, "failed to create file") ||
-		strings.Contains(lowerMsg, "failed to create directory") {
-		errorType = "permission"
-	} else if strings.Contains(lowerMsg, "not found") ||
-		strings.Contains(lowerMsg, "not available") ||
-		strings.Contains(lowerMsg, "no results") ||
-		strings.Contains(lowerMsg, "track not found") ||
-		strings.Contains(lowerMsg, "all services failed") {
-		errorType = "not_found"
-	} else if strings.Contains(lowerMsg, "rate limit") ||
-		strings.Contains(lowerMsg, "429") ||
-		strings.Contains(lowerMsg, "too many requests") {
-		errorType = "rate_limit"
-	} else if strings.Contains(lowerMsg, "network") ||
-		strings.Contains(lowerMsg, "connection") ||
-		strings.Contains(lowerMsg, "timeout") ||
-		strings.Contains(lowerMsg, "dial") {
-		errorType = "network"
-	}
+	jsonBytes, _ := json.Marshal(newErrorResponse(msg))
+	return string(jsonBytes), nil
+}
 
-	resp := DownloadResponse{
+func newErrorResponse(msg string) DownloadResponse {
+	kind := classifyErrorMessage(msg)
+	return DownloadResponse{
 		Success:   false,
 		Error:     msg,
-		ErrorType: errorType,
+		ErrorType: string(kind),
+		Retryable: kind.Retryable(),
 	}
-	jsonBytes, _ := json.Marshal(resp)
-	return string(jsonBytes), nil
 }
 
 // ==================== YOUTUBE PROVIDER (LOSSY ONLY) ====================
@@ -1736,6 +1826,11 @@ func ReEnrichFile(requestJSON string) (string, error) {
 		Copyright    string `json:"copyright"`
 		DurationMs   int64  `json:"duration_ms"`
 		SearchOnline bool   `json:"search_online"`
+		// EmbedMusicBrainzIDs resolves the MusicBrainz IDs from the ISRC and
+		// album and embeds them alongside the other tags.
+		EmbedMusicBrainzIDs bool `json:"embed_musicbrainz_ids"`
+
+		ArtistCredits []ArtistCredit `json:"artist_credits"`
 	}
 
 	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
@@ -1766,6 +1861,7 @@ func ReEnrichFile(requestJSON string) (string, error) {
 				track := deezerResults.Tracks[0]
 				GoLog("[ReEnrich] Deezer match: %s - %s (album: %s)\n", track.Name, track.Artists, track.AlbumName)
 				req.SpotifyID = "deezer:" + track.SpotifyID
+				req.ArtistCredits = track.ArtistCredits
 				req.AlbumName = track.AlbumName
 				req.AlbumArtist = track.AlbumArtist
 				req.TrackNumber = track.TrackNumber
@@ -1797,6 +1893,7 @@ func ReEnrichFile(requestJSON string) (string, error) {
 				} else {
 					req.SpotifyID = track.ID
 				}
+				req.ArtistCredits = track.ArtistCredits
 				req.AlbumName = track.AlbumName
 				req.AlbumArtist = track.AlbumArtist
 				req.TrackNumber = track.TrackNumber
@@ -1835,6 +1932,7 @@ func ReEnrichFile(requestJSON string) (string, error) {
 					track := results.Tracks[0]
 					GoLog("[ReEnrich] Spotify match: %s - %s (album: %s)\n", track.Name, track.Artists, track.AlbumName)
 					req.SpotifyID = track.SpotifyID
+					req.ArtistCredits = track.ArtistCredits
 					req.AlbumName = track.AlbumName
 					req.AlbumArtist = track.AlbumArtist
 					req.TrackNumber = track.TrackNumber
@@ -1875,14 +1973,41 @@ func ReEnrichFile(requestJSON string) (string, error) {
 		}
 	}
 
+	applied := tagRuleTargets{
+		Title:       &req.TrackName,
+		Artist:      &req.ArtistName,
+		Album:       &req.AlbumName,
+		AlbumArtist: &req.AlbumArtist,
+		Genre:       &req.Genre,
+		Label:       &req.Label,
+		Copyright:   &req.Copyright,
+		Date:        &req.ReleaseDate,
+	}.apply()
+	if len(applied) > 0 {
+		GoLog("[ReEnrich] Tag rules applied: %s\n", strings.Join(applied, ", "))
+	}
+
 	// Log metadata summary before embedding
 	GoLog("[ReEnrich] Metadata to embed: title=%s, artist=%s, album=%s, albumArtist=%s\n",
 		req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist)
 	GoLog("[ReEnrich] track=%d, disc=%d, date=%s, isrc=%s, genre=%s, label=%s\n",
 		req.TrackNumber, req.DiscNumber, req.ReleaseDate, req.ISRC, req.Genre, req.Label)
 
+	var musicBrainzIDs *MusicBrainzIDs
+	if req.EmbedMusicBrainzIDs && req.ISRC != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), musicBrainzLookupTimeout)
+		ids, err := GetMusicBrainzClient().ResolveByISRC(ctx, req.ISRC, req.AlbumName, req.ReleaseDate)
+		cancel()
+		if err != nil {
+			GoLog("[ReEnrich] MusicBrainz lookup failed: %v\n", err)
+		} else {
+			musicBrainzIDs = ids
+			GoLog("[ReEnrich] MusicBrainz recording=%s, release=%s\n", ids.RecordingID, ids.ReleaseID)
+		}
+	}
+
 	lower := strings.ToLower(req.FilePath)
-	isFlac := strings.HasSuffix(lower, ".flac")
+	isNative := strings.HasSuffix(lower, ".flac") || strings.HasSuffix(lower, ".mp3") || isOggFile(lower)
 
 	// Download cover art to temp file
 	var coverTempPath string
@@ -1894,9 +2019,9 @@ func ReEnrichFile(requestJSON string) (string, error) {
 		} else {
 			coverDataBytes = coverData
 			GoLog("[ReEnrich] Cover downloaded: %d KB\n", len(coverData)/1024)
-			// MP3/Opus requires a real image file path for Dart FFmpeg.
-			// FLAC uses in-memory embed and does not require temp files.
-			if !isFlac {
+			// FFmpeg-tagged formats need a real image file path on the Dart side.
+			// Natively tagged formats embed from memory and need no temp file.
+			if !isNative {
 				tmpFile, err := os.CreateTemp("", "reenrich_cover_*.jpg")
 				if err != nil {
 					fallbackDir := filepath.Dir(req.FilePath)
@@ -1925,8 +2050,8 @@ func ReEnrichFile(requestJSON string) (string, error) {
 			}
 		}
 	}
-	// Only cleanup cover temp for FLAC (native embed).
-	// For MP3/Opus, Dart needs the file for FFmpeg — Dart handles cleanup.
+	// Only cleanup cover temp for native embeds.
+	// For FFmpeg embeds, Dart needs the file — Dart handles cleanup.
 	cleanupCover := true
 
 	defer func() {
@@ -1968,9 +2093,15 @@ func ReEnrichFile(requestJSON string) (string, error) {
 		"spotify_id":   req.SpotifyID,
 		"duration_ms":  req.DurationMs,
 	}
+	if len(req.ArtistCredits) > 0 {
+		enrichedMeta["artist_credits"] = req.ArtistCredits
+	}
+	if musicBrainzIDs != nil {
+		enrichedMeta["musicbrainz"] = musicBrainzIDs
+	}
 
-	if isFlac {
-		// Native Go FLAC metadata embedding
+	if isNative {
+		// Native Go FLAC/ID3/Vorbis comment metadata embedding
 		metadata := Metadata{
 			Title:       req.TrackName,
 			Artist:      req.ArtistName,
@@ -1984,6 +2115,9 @@ func ReEnrichFile(requestJSON string) (string, error) {
 			Label:       req.Label,
 			Copyright:   req.Copyright,
 			Lyrics:      lyricsLRC,
+			MusicBrainz: musicBrainzIDs,
+
+			ArtistCredits: req.ArtistCredits,
 		}
 
 		if len(coverDataBytes) > 0 {
@@ -1996,7 +2130,7 @@ func ReEnrichFile(requestJSON string) (string, error) {
 			}
 		}
 		if len(coverDataBytes) > 0 {
-			embeddedCover, err := ExtractCoverArt(req.FilePath)
+			embeddedCover, _, err := extractAnyCoverArt(req.FilePath)
 			if err != nil || len(embeddedCover) == 0 {
 				if err != nil {
 					return "", fmt.Errorf("metadata embedded but cover verification failed: %w", err)
@@ -2006,7 +2140,7 @@ func ReEnrichFile(requestJSON string) (string, error) {
 			GoLog("[ReEnrich] Cover verified after embed (%d bytes)\n", len(embeddedCover))
 		}
 
-		GoLog("[ReEnrich] FLAC metadata embedded successfully\n")
+		GoLog("[ReEnrich] %s metadata embedded successfully\n", strings.ToUpper(strings.TrimPrefix(filepath.Ext(lower), ".")))
 
 		result := map[string]interface{}{
 			"method":            "native",
@@ -2017,7 +2151,7 @@ func ReEnrichFile(requestJSON string) (string, error) {
 		return string(jsonBytes), nil
 	}
 
-	// MP3/Opus: return metadata map for Dart to use FFmpeg
+	// Other formats: return metadata map for Dart to use FFmpeg
 	// Don't cleanup cover temp — Dart needs it for FFmpeg embed
 	cleanupCover = false
 	result := map[string]interface{}{
@@ -2051,6 +2185,12 @@ func ReEnrichFile(requestJSON string) (string, error) {
 		result["metadata"].(map[string]string)["LYRICS"] = lyricsLRC
 		result["metadata"].(map[string]string)["UNSYNCEDLYRICS"] = lyricsLRC
 	}
+	if artists := creditNames(req.ArtistCredits, ArtistRoleMain, ArtistRoleFeatured); len(artists) > 0 {
+		result["metadata"].(map[string]string)["ARTISTS"] = strings.Join(artists, ";")
+	}
+	for _, tag := range musicBrainzIDs.tags() {
+		result["metadata"].(map[string]string)[tag.vorbis] = strings.Join(tag.values, ";")
+	}
 
 	jsonBytes, _ := json.Marshal(result)
 	return string(jsonBytes), nil
@@ -3207,3 +3347,464 @@ func CancelLibraryScanJSON() {
 func ReadAudioMetadataJSON(filePath string) (string, error) {
 	return ReadAudioMetadata(filePath)
 }
+
+// ==================== DOWNLOAD QUEUE ====================
+
+// InitDownloadQueueJSON loads the persisted download queue from dataDir and
+// resumes any queued or interrupted downloads.
+func InitDownloadQueueJSON(dataDir string) error {
+	return GetDownloadQueue().SetDataDir(dataDir)
+}
+
+// EnqueueDownloadsJSON adds a JSON array of DownloadRequest objects to the queue.
+// Returns the queue item IDs as a JSON array.
+func EnqueueDownloadsJSON(requestsJSON string) (string, error) {
+	var requests []DownloadRequest
+	if err := json.Unmarshal([]byte(requestsJSON), &requests); err != nil {
+		return "", fmt.Errorf("invalid requests JSON: %w", err)
+	}
+
+	ids, err := GetDownloadQueue().Enqueue(requests)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(ids)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// ReorderDownloadQueueJSON moves the given JSON array of item IDs to the front
+// of the queue in that order.
+func ReorderDownloadQueueJSON(itemIDsJSON string) error {
+	var itemIDs []string
+	if err := json.Unmarshal([]byte(itemIDsJSON), &itemIDs); err != nil {
+		return fmt.Errorf("invalid item IDs JSON: %w", err)
+	}
+	return GetDownloadQueue().Reorder(itemIDs)
+}
+
+func PauseDownloadQueue() {
+	GetDownloadQueue().SetPaused(true)
+}
+
+func ResumeDownloadQueue() {
+	GetDownloadQueue().SetPaused(false)
+}
+
+func PauseQueueItem(itemID string) error {
+	return GetDownloadQueue().PauseItem(itemID)
+}
+
+func ResumeQueueItem(itemID string) error {
+	return GetDownloadQueue().ResumeItem(itemID)
+}
+
+func RemoveQueueItem(itemID string) error {
+	return GetDownloadQueue().Remove(itemID)
+}
+
+func ClearFinishedQueueItems() int {
+	return GetDownloadQueue().ClearFinished()
+}
+
+func SetDownloadQueueWorkers(count int) {
+	GetDownloadQueue().SetWorkers(count)
+}
+
+func GetDownloadQueueJSON() (string, error) {
+	jsonBytes, err := json.Marshal(GetDownloadQueue().snapshot())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// ==================== ALBUM DOWNLOAD ====================
+
+// DownloadAlbum downloads every track of an album into settings.output_dir.
+// The album metadata and cover are fetched once, cover.jpg is written next to
+// the tracks and multi-disc albums are split into "Disc N" folders. Each track
+// goes through DownloadByStrategy, so fallback and extension settings apply.
+func DownloadAlbum(requestJSON string) (string, error) {
+	var req AlbumDownloadRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return albumErrorResponse("Invalid request: " + err.Error())
+	}
+
+	resp, err := downloadAlbum(req, DownloadByStrategy)
+	if err != nil {
+		return albumErrorResponse(err.Error())
+	}
+
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func albumErrorResponse(msg string) (string, error) {
+	jsonBytes, _ := json.Marshal(AlbumDownloadResponse{
+		Success: false,
+		Tracks:  []AlbumTrackResult{},
+		Error:   msg,
+	})
+	return string(jsonBytes), nil
+}
+
+// ==================== PLAYLIST FILES ====================
+
+// WritePlaylistFileJSON writes M3U8/XSPF files for a downloaded playlist.
+// See PlaylistFileRequest for the request shape.
+func WritePlaylistFileJSON(requestJSON string) (string, error) {
+	var req PlaylistFileRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return "", fmt.Errorf("invalid request: %w", err)
+	}
+
+	resp, err := WritePlaylistFile(req)
+	if err != nil {
+		return "", err
+	}
+
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// ==================== DOWNLOAD PLAN ====================
+
+// ResolveDownloadPlanJSON returns the provider plan DownloadByStrategy would
+// follow for a DownloadRequest, without downloading. Resolved track IDs are
+// kept in the track ID cache for the download that follows.
+func ResolveDownloadPlanJSON(requestJSON string) (string, error) {
+	var req DownloadRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return "", fmt.Errorf("invalid request: %w", err)
+	}
+
+	jsonBytes, err := json.Marshal(ResolveDownloadPlan(req))
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// ResolveDownloadPlansJSON resolves plans for a JSON array of DownloadRequest
+// objects and returns them as a JSON array in the same order.
+func ResolveDownloadPlansJSON(requestsJSON string) (string, error) {
+	var requests []DownloadRequest
+	if err := json.Unmarshal([]byte(requestsJSON), &requests); err != nil {
+		return "", fmt.Errorf("invalid requests JSON: %w", err)
+	}
+
+	jsonBytes, err := json.Marshal(ResolveDownloadPlans(requests))
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// ==================== MIRROR HEALTH ====================
+
+// GetMirrorHealthJSON returns per-endpoint health and circuit state for the
+// Tidal and Qobuz mirrors.
+func GetMirrorHealthJSON() (string, error) {
+	jsonBytes, err := json.Marshal(GetMirrorHealthRegistry().Snapshot())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func ResetMirrorHealth() {
+	GetMirrorHealthRegistry().Reset()
+}
+
+// ==================== EVENT STREAM ====================
+
+// SetEventListener registers the app's listener for pushed progress, download
+// result, log and library scan events. The polling exports keep working.
+func SetEventListener(listener EventListener) {
+	GetEventStream().SetListener(listener)
+}
+
+func ClearEventListener() {
+	GetEventStream().ClearListener()
+}
+
+// SetEventThrottleMS sets how often coalesced progress, log and scan updates
+// are pushed (clamped to 50-5000 ms, default 250).
+func SetEventThrottleMS(ms int) {
+	GetEventStream().SetInterval(time.Duration(ms) * time.Millisecond)
+}
+
+// ==================== DOWNLOAD HISTORY ====================
+
+// InitDownloadHistoryJSON opens the download history in dataDir. Downloads
+// started through DownloadByStrategy are recorded from then on.
+func InitDownloadHistoryJSON(dataDir string) error {
+	return GetDownloadHistory().SetDataDir(dataDir)
+}
+
+// ListDownloadHistoryJSON returns history records newest first.
+func ListDownloadHistoryJSON(limit, offset int) (string, error) {
+	return SearchDownloadHistoryJSON(fmt.Sprintf(`{"limit":%d,"offset":%d}`, limit, offset))
+}
+
+// SearchDownloadHistoryJSON filters the history by a HistoryQuery JSON object
+// (isrc, path, service, text, from, to, status, limit, offset).
+func SearchDownloadHistoryJSON(queryJSON string) (string, error) {
+	var query HistoryQuery
+	if strings.TrimSpace(queryJSON) != "" {
+		if err := json.Unmarshal([]byte(queryJSON), &query); err != nil {
+			return "", fmt.Errorf("invalid history query: %w", err)
+		}
+	}
+
+	jsonBytes, err := json.Marshal(GetDownloadHistory().Search(query))
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// GetFileProvenanceJSON returns the history record of the download that
+// produced filePath.
+func GetFileProvenanceJSON(filePath string) (string, error) {
+	record, ok := GetDownloadHistory().Provenance(filePath)
+	if !ok {
+		return "", fmt.Errorf("no download history for %s", filePath)
+	}
+
+	jsonBytes, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// PruneDownloadHistoryJSON deletes records selected by a HistoryPruneRequest
+// JSON object and returns how many were removed.
+func PruneDownloadHistoryJSON(requestJSON string) (int, error) {
+	var req HistoryPruneRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return 0, fmt.Errorf("invalid prune request: %w", err)
+	}
+	if req.Before <= 0 && req.KeepLatest <= 0 {
+		return 0, fmt.Errorf("before or keep_latest is required")
+	}
+	return GetDownloadHistory().Prune(req)
+}
+
+// ==================== PLAYLIST SYNC ====================
+
+// SyncPlaylist fetches a Spotify, Deezer or extension playlist, matches its
+// tracks against output_dir by ISRC and then by title/artist, and queues only
+// the missing ones on the download queue. With dry_run nothing is queued; with
+// report_removed, tracks seen by the previous sync but gone upstream are
+// listed under "removed".
+func SyncPlaylist(requestJSON string) (string, error) {
+	var req PlaylistSyncRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return playlistSyncErrorResponse("Invalid request: " + err.Error())
+	}
+
+	resp, err := syncPlaylistFromURL(req)
+	if err != nil {
+		return playlistSyncErrorResponse(err.Error())
+	}
+
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func playlistSyncErrorResponse(msg string) (string, error) {
+	jsonBytes, _ := json.Marshal(PlaylistSyncResponse{
+		Success: false,
+		Tracks:  []PlaylistSyncTrack{},
+		Error:   msg,
+	})
+	return string(jsonBytes), nil
+}
+
+// ==================== REPLAYGAIN ====================
+
+// ApplyReplayGain measures FLAC files in the library and writes ReplayGain
+// track tags to them. With album set, the files are treated as one album and
+// also get album gain and peak, so pass a single album's tracks at a time.
+func ApplyReplayGain(requestJSON string) (string, error) {
+	var req struct {
+		FilePaths []string `json:"file_paths"`
+		Album     bool     `json:"album"`
+	}
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return "", fmt.Errorf("failed to parse request: %w", err)
+	}
+	if len(req.FilePaths) == 0 {
+		return "", fmt.Errorf("file_paths is required")
+	}
+
+	jsonBytes, err := json.Marshal(applyReplayGain(req.FilePaths, req.Album))
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// ==================== MUSICBRAINZ ====================
+
+// SetMusicBrainzBaseURL points MusicBrainz lookups at a mirror such as
+// "http://localhost:5000/ws/2". An empty URL restores musicbrainz.org.
+func SetMusicBrainzBaseURL(baseURL string) {
+	GetMusicBrainzClient().SetBaseURL(baseURL)
+}
+
+// ResolveMusicBrainzIDsJSON resolves the MusicBrainz IDs of a track from its
+// ISRC, using the album name and release date to pick the release.
+func ResolveMusicBrainzIDsJSON(isrc, albumName, releaseDate string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), musicBrainzLookupTimeout)
+	defer cancel()
+
+	ids, err := GetMusicBrainzClient().ResolveByISRC(ctx, isrc, albumName, releaseDate)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(ids)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// ==================== TAG RULES ====================
+
+// SetTagRulesJSON sets the tag rewriting rules from a JSON array of rules.
+// Downloads apply them before building the filename and embedding tags, as
+// do BuildFilename and ReEnrichFile. An empty array clears them.
+func SetTagRulesJSON(rulesJSON string) error {
+	var rules []TagRule
+	if strings.TrimSpace(rulesJSON) != "" {
+		if err := json.Unmarshal([]byte(rulesJSON), &rules); err != nil {
+			return fmt.Errorf("failed to parse rules: %w", err)
+		}
+	}
+	return SetTagRules(rules)
+}
+
+// GetTagRulesJSON returns the configured tag rules.
+func GetTagRulesJSON() (string, error) {
+	jsonBytes, err := json.Marshal(GetTagRules())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// PreviewTagRulesJSON applies rules to sample metadata, keyed like the
+// BuildFilename metadata, and returns it before and after along with the
+// rules that changed it. Empty rulesJSON previews the configured rules.
+func PreviewTagRulesJSON(rulesJSON, metadataJSON string) (string, error) {
+	rules := getCompiledTagRules()
+	if strings.TrimSpace(rulesJSON) != "" {
+		var parsed []TagRule
+		if err := json.Unmarshal([]byte(rulesJSON), &parsed); err != nil {
+			return "", fmt.Errorf("failed to parse rules: %w", err)
+		}
+		compiled, err := compileTagRules(parsed)
+		if err != nil {
+			return "", err
+		}
+		rules = compiled
+	}
+
+	var before map[string]interface{}
+	if err := json.Unmarshal([]byte(metadataJSON), &before); err != nil {
+		return "", fmt.Errorf("failed to parse metadata: %w", err)
+	}
+	after := make(map[string]interface{}, len(before))
+	for k, v := range before {
+		after[k] = v
+	}
+	applied := applyTagRulesToMap(rules, after)
+	if applied == nil {
+		applied = []string{}
+	}
+
+	jsonBytes, err := json.Marshal(map[string]interface{}{
+		"before":  before,
+		"after":   after,
+		"applied": applied,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// ==================== BATCH METADATA EDIT ====================
+
+// BatchEditMetadataJSON edits the tags of several files from a
+// BatchEditRequest JSON object (file_paths, operations, dry_run). It returns
+// the per-file diff and, when applied, the journal_id that undoes the edit.
+// Only dry runs work before SetMetadataJournalDir is called.
+func BatchEditMetadataJSON(requestJSON string) (string, error) {
+	var req BatchEditRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return "", fmt.Errorf("invalid batch edit request: %w", err)
+	}
+	result, err := BatchEditMetadata(req)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// UndoBatchEditJSON restores the old tags of a batch edit, the latest one
+// when journalID is empty, and returns the restored paths. It fails without
+// touching anything when a file changed since the edit.
+func UndoBatchEditJSON(journalID string) (string, error) {
+	restored, err := UndoBatchEdit(strings.TrimSpace(journalID))
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(map[string]interface{}{
+		"restored": restored,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// ==================== METADATA AUDIT ====================
+
+// AuditLibraryMetadataJSON audits files against the metadata providers.
+// requestJSON is a MetadataAuditRequest (file_paths and/or items from a
+// library scan); each entry of the report lists the discrepancies found and
+// a reenrich_request that can be passed to ReEnrichFile as is.
+func AuditLibraryMetadataJSON(requestJSON string) (string, error) {
+	var req MetadataAuditRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return "", fmt.Errorf("invalid audit request: %w", err)
+	}
+	if len(req.FilePaths) == 0 && len(req.Items) == 0 {
+		return "", fmt.Errorf("no files to audit")
+	}
+	jsonBytes, err := json.Marshal(AuditLibraryMetadata(req))
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -44,6 +44,8 @@ type ExtTrackMetadata struct {
 	Label     string `json:"label,omitempty"`
 	Copyright string `json:"copyright,omitempty"`
 	Genre     string `json:"genre,omitempty"`
+
+	ArtistCredits []ArtistCredit `json:"artist_credits,omitempty"`
 }
 
 func (t *ExtTrackMetadata) ResolvedCoverURL() string {
@@ -672,27 +674,11 @@ func isBuiltInProvider(providerID string) bool {
 	}
 }
 
-func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, error) {
-	priority := GetProviderPriority()
-	extManager := GetExtensionManager()
-
-	if req.Service != "" && isBuiltInProvider(req.Service) {
-		GoLog("[DownloadWithExtensionFallback] User selected service: %s, prioritizing it first\n", req.Service)
-		newPriority := []string{req.Service}
-		for _, p := range priority {
-			if p != req.Service {
-				newPriority = append(newPriority, p)
-			}
-		}
-		priority = newPriority
-		GoLog("[DownloadWithExtensionFallback] New priority order: %v\n", priority)
-	}
-
-	var lastErr error
-	var skipBuiltIn bool
-
+// enrichRequestFromSourceExtension lets the extension a track came from fill
+// in the ISRC, service IDs and extended metadata before providers are tried.
+func enrichRequestFromSourceExtension(req *DownloadRequest) {
 	if req.Source != "" && !isBuiltInProvider(req.Source) {
-		ext, err := extManager.GetExtension(req.Source)
+		ext, err := GetExtensionManager().GetExtension(req.Source)
 		if err == nil && ext.Enabled && ext.Error == "" && ext.Manifest.IsMetadataProvider() {
 			GoLog("[DownloadWithExtensionFallback] Enriching track from extension '%s'...\n", req.Source)
 
@@ -708,6 +694,8 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 				TrackNumber: req.TrackNumber,
 				DiscNumber:  req.DiscNumber,
 				ProviderID:  req.Source,
+
+				ArtistCredits: req.ArtistCredits,
 			}
 
 			enrichedTrack, err := provider.EnrichTrack(trackMeta)
@@ -734,6 +722,9 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 				if enrichedTrack.Artists != "" {
 					req.ArtistName = enrichedTrack.Artists
 				}
+				if len(enrichedTrack.ArtistCredits) > 0 {
+					req.ArtistCredits = enrichedTrack.ArtistCredits
+				}
 				if enrichedTrack.Label != "" && req.Label == "" {
 					GoLog("[DownloadWithExtensionFallback] Label from enrichment: %s\n", enrichedTrack.Label)
 					req.Label = enrichedTrack.Label
@@ -753,6 +744,47 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 			}
 		}
 	}
+}
+
+// extensionProviderOrder returns the download provider priority with a
+// user-selected built-in service moved to the front.
+func extensionProviderOrder(service string) []string {
+	priority := GetProviderPriority()
+	if service == "" || !isBuiltInProvider(service) {
+		return priority
+	}
+
+	newPriority := []string{service}
+	for _, p := range priority {
+		if p != service {
+			newPriority = append(newPriority, p)
+		}
+	}
+	return newPriority
+}
+
+func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, error) {
+	extManager := GetExtensionManager()
+
+	priority := extensionProviderOrder(req.Service)
+	if req.Service != "" && isBuiltInProvider(req.Service) {
+		GoLog("[DownloadWithExtensionFallback] User selected service: %s, prioritizing it first\n", req.Service)
+		GoLog("[DownloadWithExtensionFallback] New priority order: %v\n", priority)
+	}
+
+	policy := qualityPolicyFromRequest(req)
+	var attempts []ProviderAttempt
+	var lastErr error
+	var skipBuiltIn bool
+	var deezerEnriched bool
+	rejectedCount := 0
+
+	enrichRequestFromSourceExtension(&req)
+	// Matching uses req as given; the built-in providers rewrite their copy
+	// once the track is resolved. tagged carries the rewritten metadata for
+	// the extension filenames, the embedded genre/label and the responses.
+	tagged := req
+	applyTagRulesToRequest(&tagged)
 
 	if req.Source != "" && !isBuiltInProvider(req.Source) {
 		GoLog("[DownloadWithExtensionFallback] Track source is extension '%s', trying it first\n", req.Source)
@@ -767,15 +799,42 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 
 			GoLog("[DownloadWithExtensionFallback] Downloading from source extension with trackID: %s (skipBuiltInFallback: %v)\n", trackID, skipBuiltIn)
 
-			outputPath := buildOutputPath(req)
+			outputPath, stage := stageExtensionOutput(buildOutputPath(tagged))
+			if stage != nil {
+				stage.replayGain = req.ReplayGain
+			}
 
+			musicBrainzIDs := startMusicBrainzLookup(req, req.ISRC)
+			started := time.Now()
 			result, err := provider.Download(trackID, req.Quality, outputPath, func(percent int) {
 				if req.ItemID != "" {
 					SetItemProgress(req.ItemID, float64(percent), 0, 0)
 				}
 			})
 
+			attempt := newProviderAttempt(req.Source, started)
+			rejected := false
 			if err == nil && result.Success {
+				rejected = !acceptDeliveredQuality(policy, &attempt, result.FilePath, result.BitDepth, result.SampleRate, false)
+			}
+			if err == nil && result.Success && !rejected {
+				if tagged.Genre != "" || tagged.Label != "" {
+					if err := EmbedGenreLabel(result.FilePath, tagged.Genre, tagged.Label); err != nil {
+						GoLog("[DownloadWithExtensionFallback] Warning: failed to embed genre/label: %v\n", err)
+					} else {
+						GoLog("[DownloadWithExtensionFallback] Embedded genre=%q label=%q\n", tagged.Genre, tagged.Label)
+					}
+				}
+				if err := embedDownloadTags(result.FilePath, newDownloadProvenance(req, req.Source, trackID), musicBrainzIDs()); err != nil {
+					GoLog("[DownloadWithExtensionFallback] Warning: failed to embed download tags: %v\n", err)
+				}
+				result.FilePath, err = stage.commitIfStaged(result.FilePath)
+			}
+			if err != nil || !result.Success || rejected {
+				stage.discard()
+			}
+
+			if err == nil && result.Success && !rejected {
 				resp := &DownloadResponse{
 					Success:          true,
 					Message:          "Downloaded from " + req.Source,
@@ -783,17 +842,10 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 					ActualBitDepth:   result.BitDepth,
 					ActualSampleRate: result.SampleRate,
 					Service:          req.Source,
-					Genre:            req.Genre,
-					Label:            req.Label,
-					Copyright:        req.Copyright,
-				}
-
-				if req.Genre != "" || req.Label != "" {
-					if err := EmbedGenreLabel(result.FilePath, req.Genre, req.Label); err != nil {
-						GoLog("[DownloadWithExtensionFallback] Warning: failed to embed genre/label: %v\n", err)
-					} else {
-						GoLog("[DownloadWithExtensionFallback] Embedded genre=%q label=%q\n", req.Genre, req.Label)
-					}
+					Genre:            tagged.Genre,
+					Label:            tagged.Label,
+					Copyright:        tagged.Copyright,
+					ProviderTrackID:  trackID,
 				}
 
 				if ext.Manifest.SkipMetadataEnrichment {
@@ -827,22 +879,31 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 					}
 				}
 
+				attempt.Success = true
+				resp.Attempts = append(attempts, attempt)
 				return resp, nil
 			}
 
-			if err != nil {
+			if rejected {
+				rejectedCount++
+				lastErr = fmt.Errorf("%s: %s", attempt.Service, attempt.Reason)
+			} else if err != nil {
 				if errors.Is(err, ErrDownloadCancelled) {
 					return &DownloadResponse{
 						Success:   false,
 						Error:     "Download cancelled",
-						ErrorType: "cancelled",
+						ErrorType: string(ErrKindCancelled),
 						Service:   req.Source,
 					}, nil
 				}
 				lastErr = err
 			} else if result.ErrorMessage != "" {
-				lastErr = fmt.Errorf("%s", result.ErrorMessage)
+				lastErr = reportedDownloadError(req.Source, result.ErrorType, result.ErrorMessage)
+			}
+			if !rejected && lastErr != nil {
+				attempt.recordError(lastErr)
 			}
+			attempts = append(attempts, attempt)
 			GoLog("[DownloadWithExtensionFallback] Source extension %s failed: %v\n", req.Source, lastErr)
 
 			if skipBuiltIn {
@@ -852,6 +913,7 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 					Error:     "Download failed: " + lastErr.Error(),
 					ErrorType: "extension_error",
 					Service:   req.Source,
+					Attempts:  attempts,
 				}, nil
 			}
 		} else {
@@ -864,6 +926,11 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 			continue
 		}
 
+		if policy.attemptsExhausted(len(attempts)) {
+			GoLog("[DownloadWithExtensionFallback] Max attempts (%d) reached, stopping\n", policy.MaxAttempts)
+			break
+		}
+
 		if skipBuiltIn && isBuiltInProvider(providerID) {
 			GoLog("[DownloadWithExtensionFallback] Skipping built-in provider %s (skipBuiltInFallback)\n", providerID)
 			continue
@@ -872,41 +939,55 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 		GoLog("[DownloadWithExtensionFallback] Trying provider: %s\n", providerID)
 
 		if isBuiltInProvider(providerID) {
-			if (req.Genre == "" || req.Label == "") && req.ISRC != "" {
+			if !deezerEnriched && (req.Genre == "" || req.Label == "") && req.ISRC != "" {
+				deezerEnriched = true
 				GoLog("[DownloadWithExtensionFallback] Enriching extended metadata from Deezer for ISRC: %s\n", req.ISRC)
 				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 				deezerClient := GetDeezerClient()
 				extMeta, err := deezerClient.GetExtendedMetadataByISRC(ctx, req.ISRC)
 				cancel()
 				if err == nil && extMeta != nil {
+					var genre, label string
 					if req.Genre == "" && extMeta.Genre != "" {
-						req.Genre = extMeta.Genre
+						req.Genre, genre = extMeta.Genre, extMeta.Genre
 						GoLog("[DownloadWithExtensionFallback] Genre from Deezer: %s\n", req.Genre)
 					}
 					if req.Label == "" && extMeta.Label != "" {
-						req.Label = extMeta.Label
+						req.Label, label = extMeta.Label, extMeta.Label
 						GoLog("[DownloadWithExtensionFallback] Label from Deezer: %s\n", req.Label)
 					}
+					applyTagRulesToLateFields(&tagged, genre, label)
 				} else if err != nil {
 					GoLog("[DownloadWithExtensionFallback] Failed to get extended metadata from Deezer: %v\n", err)
 				}
 			}
 
+			started := time.Now()
 			result, err := tryBuiltInProvider(providerID, req)
+			attempt := newProviderAttempt(providerID, started)
+			if err == nil && result.Success &&
+				!acceptDeliveredQuality(policy, &attempt, result.FilePath, result.ActualBitDepth, result.ActualSampleRate, result.DecryptionKey != "") {
+				attempts = append(attempts, attempt)
+				rejectedCount++
+				lastErr = fmt.Errorf("%s: %s", providerID, attempt.Reason)
+				continue
+			}
 			if err == nil && result.Success {
 				result.Service = providerID
-				if req.Label != "" {
-					result.Label = req.Label
+				if tagged.Label != "" {
+					result.Label = tagged.Label
 				}
-				if req.Copyright != "" {
-					result.Copyright = req.Copyright
+				if tagged.Copyright != "" {
+					result.Copyright = tagged.Copyright
 				}
-				if req.Genre != "" {
-					result.Genre = req.Genre
+				if tagged.Genre != "" {
+					result.Genre = tagged.Genre
 				}
-				if req.ReleaseDate != "" && result.ReleaseDate == "" {
-					result.ReleaseDate = req.ReleaseDate
+				if tagged.ReleaseDate != "" && result.ReleaseDate == "" {
+					result.ReleaseDate = tagged.ReleaseDate
 				}
+				attempt.Success = true
+				result.Attempts = append(attempts, attempt)
 				return result, nil
 			}
 			if err != nil {
@@ -914,11 +995,18 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 					return &DownloadResponse{
 						Success:   false,
 						Error:     "Download cancelled",
-						ErrorType: "cancelled",
+						ErrorType: string(ErrKindCancelled),
 						Service:   providerID,
 					}, nil
 				}
-				lastErr = err
+				if attempt.recordRejection(err) {
+					rejectedCount++
+					lastErr = fmt.Errorf("%s: %s", providerID, attempt.Reason)
+				} else {
+					lastErr = err
+					attempt.recordError(err)
+				}
+				attempts = append(attempts, attempt)
 				GoLog("[DownloadWithExtensionFallback] %s failed: %v\n", providerID, err)
 			}
 		} else {
@@ -943,15 +1031,42 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 				continue
 			}
 
-			outputPath := buildOutputPath(req)
+			outputPath, stage := stageExtensionOutput(buildOutputPath(tagged))
+			if stage != nil {
+				stage.replayGain = req.ReplayGain
+			}
 
+			musicBrainzIDs := startMusicBrainzLookup(req, req.ISRC)
+			started := time.Now()
 			result, err := provider.Download(availability.TrackID, req.Quality, outputPath, func(percent int) {
 				if req.ItemID != "" {
 					SetItemProgress(req.ItemID, float64(percent), 0, 0)
 				}
 			})
 
+			attempt := newProviderAttempt(providerID, started)
+			rejected := false
 			if err == nil && result.Success {
+				rejected = !acceptDeliveredQuality(policy, &attempt, result.FilePath, result.BitDepth, result.SampleRate, false)
+			}
+			if err == nil && result.Success && !rejected {
+				if tagged.Genre != "" || tagged.Label != "" {
+					if err := EmbedGenreLabel(result.FilePath, tagged.Genre, tagged.Label); err != nil {
+						GoLog("[DownloadWithExtensionFallback] Warning: failed to embed genre/label: %v\n", err)
+					} else {
+						GoLog("[DownloadWithExtensionFallback] Embedded genre=%q label=%q\n", tagged.Genre, tagged.Label)
+					}
+				}
+				if err := embedDownloadTags(result.FilePath, newDownloadProvenance(req, providerID, availability.TrackID), musicBrainzIDs()); err != nil {
+					GoLog("[DownloadWithExtensionFallback] Warning: failed to embed download tags: %v\n", err)
+				}
+				result.FilePath, err = stage.commitIfStaged(result.FilePath)
+			}
+			if err != nil || !result.Success || rejected {
+				stage.discard()
+			}
+
+			if err == nil && result.Success && !rejected {
 				resp := &DownloadResponse{
 					Success:          true,
 					Message:          "Downloaded from " + providerID,
@@ -959,17 +1074,10 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 					ActualBitDepth:   result.BitDepth,
 					ActualSampleRate: result.SampleRate,
 					Service:          providerID,
-					Genre:            req.Genre,
-					Label:            req.Label,
-					Copyright:        req.Copyright,
-				}
-
-				if req.Genre != "" || req.Label != "" {
-					if err := EmbedGenreLabel(result.FilePath, req.Genre, req.Label); err != nil {
-						GoLog("[DownloadWithExtensionFallback] Warning: failed to embed genre/label: %v\n", err)
-					} else {
-						GoLog("[DownloadWithExtensionFallback] Embedded genre=%q label=%q\n", req.Genre, req.Label)
-					}
+					Genre:            tagged.Genre,
+					Label:            tagged.Label,
+					Copyright:        tagged.Copyright,
+					ProviderTrackID:  availability.TrackID,
 				}
 
 				if ext.Manifest.SkipMetadataEnrichment {
@@ -1003,38 +1111,44 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 					}
 				}
 
+				attempt.Success = true
+				resp.Attempts = append(attempts, attempt)
 				return resp, nil
 			}
 
-			if err != nil {
+			if rejected {
+				rejectedCount++
+				lastErr = fmt.Errorf("%s: %s", attempt.Service, attempt.Reason)
+			} else if err != nil {
 				if errors.Is(err, ErrDownloadCancelled) {
 					return &DownloadResponse{
 						Success:   false,
 						Error:     "Download cancelled",
-						ErrorType: "cancelled",
+						ErrorType: string(ErrKindCancelled),
 						Service:   providerID,
 					}, nil
 				}
 				lastErr = err
 			} else if result.ErrorMessage != "" {
-				lastErr = fmt.Errorf("%s", result.ErrorMessage)
+				lastErr = reportedDownloadError(providerID, result.ErrorType, result.ErrorMessage)
 			}
+			if !rejected && lastErr != nil {
+				attempt.recordError(lastErr)
+			}
+			attempts = append(attempts, attempt)
 			GoLog("[DownloadWithExtensionFallback] %s failed: %v\n", providerID, lastErr)
 		}
 	}
 
 	if lastErr != nil {
-		return &DownloadResponse{
-			Success:   false,
-			Error:     "All providers failed. Last error: " + lastErr.Error(),
-			ErrorType: "not_found",
-		}, nil
+		resp := fallbackFailureResponse("All providers failed", lastErr, attempts, rejectedCount)
+		return &resp, nil
 	}
 
 	return &DownloadResponse{
 		Success:   false,
 		Error:     "No providers available",
-		ErrorType: "not_found",
+		ErrorType: string(ErrKindNotFound),
 	}, nil
 }
 
@@ -1048,54 +1162,19 @@ func tryBuiltInProvider(providerID string, req DownloadRequest) (*DownloadRespon
 	case "tidal":
 		tidalResult, tidalErr := downloadFromTidal(req)
 		if tidalErr == nil {
-			result = DownloadResult{
-				FilePath:    tidalResult.FilePath,
-				BitDepth:    tidalResult.BitDepth,
-				SampleRate:  tidalResult.SampleRate,
-				Title:       tidalResult.Title,
-				Artist:      tidalResult.Artist,
-				Album:       tidalResult.Album,
-				ReleaseDate: tidalResult.ReleaseDate,
-				TrackNumber: tidalResult.TrackNumber,
-				DiscNumber:  tidalResult.DiscNumber,
-				ISRC:        tidalResult.ISRC,
-			}
+			result = tidalResult.downloadResult()
 		}
 		err = tidalErr
 	case "qobuz":
 		qobuzResult, qobuzErr := downloadFromQobuz(req)
 		if qobuzErr == nil {
-			result = DownloadResult{
-				FilePath:    qobuzResult.FilePath,
-				BitDepth:    qobuzResult.BitDepth,
-				SampleRate:  qobuzResult.SampleRate,
-				Title:       qobuzResult.Title,
-				Artist:      qobuzResult.Artist,
-				Album:       qobuzResult.Album,
-				ReleaseDate: qobuzResult.ReleaseDate,
-				TrackNumber: qobuzResult.TrackNumber,
-				DiscNumber:  qobuzResult.DiscNumber,
-				ISRC:        qobuzResult.ISRC,
-			}
+			result = qobuzResult.downloadResult()
 		}
 		err = qobuzErr
 	case "amazon":
 		amazonResult, amazonErr := downloadFromAmazon(req)
 		if amazonErr == nil {
-			result = DownloadResult{
-				FilePath:      amazonResult.FilePath,
-				BitDepth:      amazonResult.BitDepth,
-				SampleRate:    amazonResult.SampleRate,
-				Title:         amazonResult.Title,
-				Artist:        amazonResult.Artist,
-				Album:         amazonResult.Album,
-				ReleaseDate:   amazonResult.ReleaseDate,
-				TrackNumber:   amazonResult.TrackNumber,
-				DiscNumber:    amazonResult.DiscNumber,
-				ISRC:          amazonResult.ISRC,
-				LyricsLRC:     amazonResult.LyricsLRC,
-				DecryptionKey: amazonResult.DecryptionKey,
-			}
+			result = amazonResult.downloadResult()
 		}
 		err = amazonErr
 	default:
@@ -1124,6 +1203,10 @@ func tryBuiltInProvider(providerID string, req DownloadRequest) (*DownloadRespon
 		Copyright:        req.Copyright,
 		LyricsLRC:        result.LyricsLRC,
 		DecryptionKey:    result.DecryptionKey,
+		ProviderTrackID:  result.ProviderTrackID,
+		Mirror:           result.Mirror,
+		LyricsSource:     result.LyricsSource,
+		ReplacedFile:     result.ReplacedFile,
 	}, nil
 }
 
@@ -0,0 +1,293 @@
+package gobackend
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// stagingMarker is part of every staged file name, so scanners can tell an
+// unfinished download from a real track.
+const stagingMarker = ".spotiflac-tmp"
+
+var (
+	stagingDir   string
+	stagingDirMu sync.RWMutex
+)
+
+// SetStagingDir sets where SAF downloads are written and tagged before being
+// copied into their document. It should be app-private storage; the system
+// temp directory is used when unset.
+func SetStagingDir(dir string) {
+	stagingDirMu.Lock()
+	stagingDir = strings.TrimSpace(dir)
+	stagingDirMu.Unlock()
+}
+
+func getStagingDir() string {
+	stagingDirMu.RLock()
+	defer stagingDirMu.RUnlock()
+	if stagingDir != "" {
+		return stagingDir
+	}
+	return os.TempDir()
+}
+
+// isStagingFile reports whether path is an unfinished download.
+func isStagingFile(path string) bool {
+	return strings.Contains(filepath.Base(path), stagingMarker)
+}
+
+// stagedOutput is where a provider downloads and tags a track before it is
+// moved to its real destination. Files are staged as a hidden sibling of the
+// destination, or under the staging directory for SAF outputs, and only
+// committed once complete, so a crash never leaves a half-written or untagged
+// file under the final name.
+type stagedOutput struct {
+	finalPath string
+	outputFD  int
+	workPath  string
+
+	// upgrade is the existing file this download replaces, if any.
+	upgrade *pendingUpgrade
+	// replayGain tags FLAC downloads with their track gain before commit.
+	replayGain bool
+	// policy is the quality floor the download must meet to be committed.
+	policy QualityPolicy
+}
+
+// newStagedOutput stages a download for finalPath. Its staged name is stable
+// so an interrupted download can resume from the same partial file.
+func newStagedOutput(finalPath string) *stagedOutput {
+	ext := filepath.Ext(finalPath)
+	base := strings.TrimSuffix(filepath.Base(finalPath), ext)
+	s := &stagedOutput{
+		finalPath: finalPath,
+		workPath:  filepath.Join(filepath.Dir(finalPath), "."+base+stagingMarker+ext),
+	}
+	s.removeWorkFiles(false)
+	return s
+}
+
+// newSAFStagedOutput stages a download for a SAF target, given either as an
+// open descriptor or as a path such as /proc/self/fd/N. ext is the format
+// the provider is about to write, since the target has no usable name.
+func newSAFStagedOutput(target string, outputFD int, ext string) (*stagedOutput, error) {
+	dir := getStagingDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	f, err := os.CreateTemp(dir, "saf_*"+stagingMarker+ext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging file: %w", err)
+	}
+	f.Close()
+	return &stagedOutput{finalPath: target, outputFD: outputFD, workPath: f.Name()}, nil
+}
+
+func (s *stagedOutput) isSAF() bool {
+	return isFDOutput(s.outputFD) || strings.HasPrefix(s.finalPath, "/proc/self/fd/")
+}
+
+// destinationFor maps a staged file to its final path. Providers may change
+// the extension of the staged file (Tidal DASH streams land as .m4a), and
+// the final file keeps that extension.
+func (s *stagedOutput) destinationFor(workFile string) string {
+	if s.isSAF() {
+		return s.finalPath
+	}
+	return strings.TrimSuffix(s.finalPath, filepath.Ext(s.finalPath)) + filepath.Ext(workFile)
+}
+
+// commit verifies workFile and moves it into place, returning the final
+// path. probe also checks the audio headers and the quality floor; it is
+// skipped for encrypted files. On failure the staged files are removed, and
+// a file below the floor fails with a qualityRejection. When the stage
+// replaces an existing file, errNotAnUpgrade means the download was not
+// better and the existing file was kept.
+func (s *stagedOutput) commit(workFile string, probe bool) (string, error) {
+	if err := verifyStagedAudio(workFile, probe); err != nil {
+		s.discard()
+		return "", err
+	}
+	if probe {
+		if err := checkStagedQuality(s.policy, workFile); err != nil {
+			s.discard()
+			return "", err
+		}
+	}
+	if s.upgrade != nil {
+		if err := s.upgrade.prepare(workFile); err != nil {
+			s.discard()
+			return "", err
+		}
+	}
+	if s.replayGain && probe {
+		applyTrackReplayGain(workFile)
+	}
+
+	dest := s.destinationFor(workFile)
+	if s.isSAF() {
+		err := copyIntoSAF(workFile, s.finalPath, s.outputFD)
+		s.discard()
+		if err != nil {
+			return "", fmt.Errorf("failed to commit download: %w", err)
+		}
+		return dest, nil
+	}
+
+	if err := os.Rename(workFile, dest); err != nil {
+		s.discard()
+		return "", fmt.Errorf("failed to commit download: %w", err)
+	}
+	GoLog("[Finalize] Committed %s\n", filepath.Base(dest))
+	if s.upgrade != nil {
+		s.upgrade.finish(dest)
+	}
+	return dest, nil
+}
+
+// discard removes the staged files. Partial downloads next to a regular
+// destination are kept so a retry can resume them.
+func (s *stagedOutput) discard() {
+	if s == nil {
+		return
+	}
+	s.removeWorkFiles(s.isSAF())
+}
+
+// stageExtensionOutput returns the path an extension should download to and
+// the stage to commit afterwards. SAF descriptor paths are passed through
+// unstaged, with a nil stage.
+func stageExtensionOutput(outputPath string) (string, *stagedOutput) {
+	if strings.HasPrefix(outputPath, "/proc/self/fd/") {
+		return outputPath, nil
+	}
+	s := newStagedOutput(outputPath)
+	return s.workPath, s
+}
+
+// commitIfStaged commits an extension's download when it landed on the
+// staged path, possibly with another extension. Files the extension wrote
+// elsewhere are returned unchanged.
+func (s *stagedOutput) commitIfStaged(filePath string) (string, error) {
+	if s == nil || !isStagingFile(filePath) ||
+		filepath.Dir(filePath) != filepath.Dir(s.workPath) {
+		return filePath, nil
+	}
+	return s.commit(filePath, true)
+}
+
+func (s *stagedOutput) removeWorkFiles(includePartial bool) {
+	dir := filepath.Dir(s.workPath)
+	stem := strings.TrimSuffix(filepath.Base(s.workPath), filepath.Ext(s.workPath)) + "."
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, stem) {
+			continue
+		}
+		if !includePartial && (strings.HasSuffix(name, partialFileSuffix) || strings.HasSuffix(name, partialFileSuffix+".json")) {
+			continue
+		}
+		os.Remove(filepath.Join(dir, name))
+	}
+}
+
+// verifyStagedAudio rejects empty files and, when probe is set, files whose
+// header does not match their extension.
+func verifyStagedAudio(path string, probe bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("downloaded file is missing: %w", err)
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("downloaded file is empty")
+	}
+	if !probe {
+		return nil
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac", ".m4a":
+		quality, err := GetAudioQuality(path)
+		if err != nil {
+			return fmt.Errorf("downloaded file failed verification: %w", err)
+		}
+		if quality.SampleRate <= 0 {
+			return fmt.Errorf("downloaded file failed verification: no sample rate")
+		}
+	case ".mp3":
+		header, err := readFileHeader(path, 3)
+		if err != nil {
+			return err
+		}
+		if string(header) != "ID3" && !(header[0] == 0xFF && header[1]&0xE0 == 0xE0) {
+			return fmt.Errorf("downloaded file failed verification: not an MP3 stream")
+		}
+	case ".ogg", ".opus":
+		header, err := readFileHeader(path, 4)
+		if err != nil {
+			return err
+		}
+		if string(header) != "OggS" {
+			return fmt.Errorf("downloaded file failed verification: not an Ogg stream")
+		}
+	}
+	return nil
+}
+
+func readFileHeader(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open downloaded file: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, n)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, fmt.Errorf("downloaded file failed verification: %w", err)
+	}
+	return header, nil
+}
+
+// copyIntoSAF writes the finished file into the SAF target, replacing
+// whatever it held. A descriptor is left open for releaseOutputFD.
+func copyIntoSAF(workFile, target string, outputFD int) error {
+	in, err := os.Open(workFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if isFDOutput(outputFD) {
+		out := outputFDFile(outputFD)
+		// Not every descriptor supports these; a fresh document is empty anyway.
+		_ = out.Truncate(0)
+		_, _ = out.Seek(0, io.SeekStart)
+		if _, err := io.Copy(out, in); err != nil {
+			return err
+		}
+		_ = out.Sync()
+		return nil
+	}
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		_ = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package gobackend
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestStagedOutputCommitsOnlyVerifiedFiles(t *testing.T) {
+	dir := t.TempDir()
+	finalPath := filepath.Join(dir, "Artist - Song.flac")
+
+	stage := newStagedOutput(finalPath)
+	if !isStagingFile(stage.workPath) || filepath.Dir(stage.workPath) != dir {
+		t.Fatalf("unexpected staged path %s", stage.workPath)
+	}
+
+	if err := os.WriteFile(stage.workPath, []byte("<html>rate limited</html>"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := stage.commit(stage.workPath, true); err == nil {
+		t.Fatalf("expected garbage FLAC to fail verification")
+	}
+	if _, err := os.Stat(finalPath); !os.IsNotExist(err) {
+		t.Fatalf("final path must not exist after a failed commit")
+	}
+	if _, err := os.Stat(stage.workPath); !os.IsNotExist(err) {
+		t.Fatalf("staged file should be removed after a failed commit")
+	}
+
+	writeTestFLAC(t, dir, filepath.Base(stage.workPath), 44100, 16)
+	if err := EmbedMetadata(stage.workPath, Metadata{Title: "Song", ISRC: "USAAA0000009"}, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+	committed, err := stage.commit(stage.workPath, true)
+	if err != nil || committed != finalPath {
+		t.Fatalf("expected commit to %s, got %q (%v)", finalPath, committed, err)
+	}
+	if metadata, err := ReadMetadata(finalPath); err != nil || metadata.ISRC != "USAAA0000009" {
+		t.Fatalf("expected tagged final file, got %+v (%v)", metadata, err)
+	}
+}
+
+func TestStagedOutputKeepsProviderExtension(t *testing.T) {
+	stage := newStagedOutput(filepath.Join(t.TempDir(), "Song.flac"))
+	m4a := stage.workPath[:len(stage.workPath)-len(".flac")] + ".m4a"
+	if got := stage.destinationFor(m4a); filepath.Base(got) != "Song.m4a" {
+		t.Fatalf("expected Song.m4a, got %s", got)
+	}
+}
+
+func TestStagedOutputDiscardKeepsPartialDownload(t *testing.T) {
+	dir := t.TempDir()
+	stage := newStagedOutput(filepath.Join(dir, "Song.flac"))
+	partPath := stage.workPath + partialFileSuffix
+	for _, path := range []string{stage.workPath, partPath} {
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	stage.discard()
+	if _, err := os.Stat(stage.workPath); !os.IsNotExist(err) {
+		t.Fatalf("expected staged file removed")
+	}
+	if _, err := os.Stat(partPath); err != nil {
+		t.Fatalf("expected partial download kept for resume: %v", err)
+	}
+}
+
+func TestSAFStagedOutputCopiesIntoDescriptor(t *testing.T) {
+	SetStagingDir(t.TempDir())
+	defer SetStagingDir("")
+
+	target := filepath.Join(t.TempDir(), "document")
+	out, err := os.Create(target)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	fd, err := syscall.Dup(int(out.Fd()))
+	out.Close()
+	if err != nil {
+		t.Fatalf("dup: %v", err)
+	}
+
+	stage, err := newSAFStagedOutput("", fd, ".mp3")
+	if err != nil {
+		t.Fatalf("newSAFStagedOutput: %v", err)
+	}
+	payload := append([]byte("ID3"), bytes.Repeat([]byte{0}, 64)...)
+	if err := os.WriteFile(stage.workPath, payload, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := stage.commit(stage.workPath, true); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	got, err := os.ReadFile(target)
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Fatalf("expected payload in SAF target, got %d bytes (%v)", len(got), err)
+	}
+	if _, err := os.Stat(stage.workPath); !os.IsNotExist(err) {
+		t.Fatalf("expected staging file removed after commit")
+	}
+
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(fd, &stat); err != nil {
+		t.Fatalf("expected the descriptor to stay open until released: %v", err)
+	}
+	releaseOutputFD(fd)
+	if err := syscall.Fstat(fd, &stat); err == nil {
+		t.Fatal("expected the descriptor to be closed once released")
+	}
+}
+
+func TestDownloadByStrategyReleasesDescriptorOnFailure(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "document"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	fd, err := syscall.Dup(int(out.Fd()))
+	out.Close()
+	if err != nil {
+		t.Fatalf("dup: %v", err)
+	}
+
+	resp, _ := downloadByStrategy(fmt.Sprintf(`{"service": "nowhere", "output_fd": %d}`, fd))
+	if !strings.Contains(resp, "Unknown service") {
+		t.Fatalf("expected the download to fail, got %s", resp)
+	}
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(fd, &stat); err == nil {
+		t.Fatal("expected the descriptor of a failed download to be closed")
+	}
+}
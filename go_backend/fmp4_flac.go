@@ -0,0 +1,532 @@
+package gobackend
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// errFMP4NotFLAC is returned when the fragmented MP4 carries something other
+// than FLAC (AAC from a HIGH quality manifest, for example). Callers keep the
+// .m4a and fall back to the FFmpeg path.
+var errFMP4NotFLAC = errors.New("fragmented MP4 does not contain a FLAC stream")
+
+const (
+	tfhdBaseDataOffset        = 0x000001
+	tfhdSampleDescIndex       = 0x000002
+	tfhdDefaultSampleDuration = 0x000008
+	tfhdDefaultSampleSize     = 0x000010
+
+	trunDataOffset       = 0x000001
+	trunFirstSampleFlags = 0x000004
+	trunSampleDuration   = 0x000100
+	trunSampleSize       = 0x000200
+	trunSampleFlags      = 0x000400
+	trunSampleCTS        = 0x000800
+)
+
+type fmp4FLACTrack struct {
+	trackID         uint32
+	timescale       uint32
+	metadataBlocks  []byte
+	defaultDuration uint32
+	defaultSize     uint32
+}
+
+type fmp4Sample struct {
+	offset   int64
+	size     uint32
+	duration uint32
+}
+
+// demuxFMP4ToFLAC extracts the FLAC frames from a fragmented MP4 (a Tidal DASH
+// download) and writes them as a native FLAC file. The stream header comes
+// from the dfLa box; STREAMINFO's total sample count and frame size bounds are
+// filled in from the fragments because encoders usually leave them zero there.
+func demuxFMP4ToFLAC(inputPath, outputPath string) error {
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open fMP4 file: %w", err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat fMP4 file: %w", err)
+	}
+	fileSize := info.Size()
+
+	moovHeader, found, err := findAtomInRange(in, 0, fileSize, "moov", fileSize)
+	if err != nil {
+		return fmt.Errorf("failed to find moov atom: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("moov atom not found")
+	}
+	moov, err := readAtomBody(in, moovHeader)
+	if err != nil {
+		return err
+	}
+
+	track, err := parseFMP4FLACTrack(moov)
+	if err != nil {
+		return err
+	}
+
+	samples, err := collectFMP4Samples(in, fileSize, track)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("no audio fragments found")
+	}
+
+	header, err := buildFLACHeader(track, samples)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := outputPath + ".demux.tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create FLAC file: %w", err)
+	}
+
+	writeErr := writeFLACFrames(out, in, header, samples)
+	closeErr := out.Close()
+	if writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		os.Remove(tmpPath)
+		return writeErr
+	}
+
+	if err := os.Rename(tmpPath, outputPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to finalize FLAC file: %w", err)
+	}
+
+	GoLog("[fMP4] Demuxed %d FLAC frames to %s\n", len(samples), outputPath)
+	return nil
+}
+
+func readAtomBody(f *os.File, header atomHeader) ([]byte, error) {
+	bodySize := header.size - header.headerSize
+	if bodySize < 0 || bodySize > 64*1024*1024 {
+		return nil, fmt.Errorf("invalid %s atom size", header.typ)
+	}
+	body := make([]byte, bodySize)
+	if _, err := f.ReadAt(body, header.offset+header.headerSize); err != nil {
+		return nil, fmt.Errorf("failed to read %s atom: %w", header.typ, err)
+	}
+	return body, nil
+}
+
+// eachChildBox walks the boxes packed in data, stopping early if fn returns
+// errStopBoxWalk.
+func eachChildBox(data []byte, fn func(typ string, body []byte) error) error {
+	pos := 0
+	for pos+8 <= len(data) {
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		typ := string(data[pos+4 : pos+8])
+		headerSize := 8
+
+		switch size {
+		case 0:
+			size = len(data) - pos
+		case 1:
+			if pos+16 > len(data) {
+				return fmt.Errorf("truncated %s box", typ)
+			}
+			size64 := binary.BigEndian.Uint64(data[pos+8 : pos+16])
+			if size64 > uint64(len(data)-pos) {
+				return fmt.Errorf("truncated %s box", typ)
+			}
+			size = int(size64)
+			headerSize = 16
+		}
+
+		if size < headerSize || pos+size > len(data) {
+			return fmt.Errorf("invalid %s box size", typ)
+		}
+
+		if err := fn(typ, data[pos+headerSize:pos+size]); err != nil {
+			if errors.Is(err, errStopBoxWalk) {
+				return nil
+			}
+			return err
+		}
+		pos += size
+	}
+	return nil
+}
+
+var errStopBoxWalk = errors.New("stop box walk")
+
+func findChildBox(data []byte, path ...string) []byte {
+	current := data
+	for _, want := range path {
+		var next []byte
+		eachChildBox(current, func(typ string, body []byte) error {
+			if typ == want {
+				next = body
+				return errStopBoxWalk
+			}
+			return nil
+		})
+		if next == nil {
+			return nil
+		}
+		current = next
+	}
+	return current
+}
+
+func parseFMP4FLACTrack(moov []byte) (*fmp4FLACTrack, error) {
+	var track *fmp4FLACTrack
+
+	err := eachChildBox(moov, func(typ string, trak []byte) error {
+		if typ != "trak" {
+			return nil
+		}
+		stsd := findChildBox(trak, "mdia", "minf", "stbl", "stsd")
+		if len(stsd) < 16 {
+			return nil
+		}
+
+		// stsd: full box header + entry count, then the first sample entry.
+		entries := stsd[8:]
+		entryType := string(entries[4:8])
+		if entryType != "fLaC" {
+			return nil
+		}
+
+		entrySize := int(binary.BigEndian.Uint32(entries[0:4]))
+		if entrySize < 36 || entrySize > len(entries) {
+			return fmt.Errorf("invalid fLaC sample entry")
+		}
+		// Audio sample entry fields occupy 28 bytes before the child boxes.
+		dfla := findChildBox(entries[36:entrySize], "dfLa")
+		if len(dfla) < 4+4+34 {
+			return fmt.Errorf("fLaC sample entry is missing dfLa box")
+		}
+
+		t := &fmp4FLACTrack{metadataBlocks: dfla[4:]}
+
+		if tkhd := findChildBox(trak, "tkhd"); len(tkhd) >= 24 {
+			if tkhd[0] == 1 {
+				t.trackID = binary.BigEndian.Uint32(tkhd[20:24])
+			} else {
+				t.trackID = binary.BigEndian.Uint32(tkhd[12:16])
+			}
+		}
+
+		if mdhd := findChildBox(trak, "mdia", "mdhd"); len(mdhd) >= 24 {
+			if mdhd[0] == 1 {
+				t.timescale = binary.BigEndian.Uint32(mdhd[20:24])
+			} else {
+				t.timescale = binary.BigEndian.Uint32(mdhd[12:16])
+			}
+		}
+
+		track = t
+		return errStopBoxWalk
+	})
+	if err != nil {
+		return nil, err
+	}
+	if track == nil {
+		return nil, errFMP4NotFLAC
+	}
+
+	if mvex := findChildBox(moov, "mvex"); mvex != nil {
+		eachChildBox(mvex, func(typ string, trex []byte) error {
+			if typ != "trex" || len(trex) < 24 {
+				return nil
+			}
+			if binary.BigEndian.Uint32(trex[4:8]) != track.trackID && track.trackID != 0 {
+				return nil
+			}
+			track.defaultDuration = binary.BigEndian.Uint32(trex[12:16])
+			track.defaultSize = binary.BigEndian.Uint32(trex[16:20])
+			return errStopBoxWalk
+		})
+	}
+
+	return track, nil
+}
+
+// collectFMP4Samples walks the top-level moof/mdat pairs and returns the file
+// offset, size and duration of every sample of the FLAC track in order.
+func collectFMP4Samples(f *os.File, fileSize int64, track *fmp4FLACTrack) ([]fmp4Sample, error) {
+	var samples []fmp4Sample
+
+	pos := int64(0)
+	for pos+8 <= fileSize {
+		header, err := readAtomHeaderAt(f, pos, fileSize)
+		if err != nil {
+			return nil, err
+		}
+		if header.size == 0 {
+			header.size = fileSize - pos
+		}
+		if header.size < header.headerSize {
+			return nil, fmt.Errorf("invalid atom size for %s", header.typ)
+		}
+
+		if header.typ == "moof" {
+			moof, err := readAtomBody(f, header)
+			if err != nil {
+				return nil, err
+			}
+
+			// Samples without an explicit data offset start at the payload of
+			// the mdat that follows this moof.
+			mdatPayload := header.offset + header.size + 8
+			if next, err := readAtomHeaderAt(f, header.offset+header.size, fileSize); err == nil && next.typ == "mdat" {
+				mdatPayload = next.offset + next.headerSize
+			}
+
+			fragment, err := parseMoofSamples(moof, header.offset, mdatPayload, track)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, fragment...)
+		}
+
+		pos += header.size
+	}
+
+	for _, s := range samples {
+		if s.offset < 0 || s.offset+int64(s.size) > fileSize {
+			return nil, fmt.Errorf("sample data out of range (truncated download?)")
+		}
+	}
+	return samples, nil
+}
+
+func parseMoofSamples(moof []byte, moofOffset, mdatPayload int64, track *fmp4FLACTrack) ([]fmp4Sample, error) {
+	var samples []fmp4Sample
+
+	err := eachChildBox(moof, func(typ string, traf []byte) error {
+		if typ != "traf" {
+			return nil
+		}
+
+		tfhd := findChildBox(traf, "tfhd")
+		if len(tfhd) < 8 {
+			return fmt.Errorf("traf is missing tfhd")
+		}
+		flags := binary.BigEndian.Uint32(tfhd[0:4]) & 0xFFFFFF
+		trackID := binary.BigEndian.Uint32(tfhd[4:8])
+		if track.trackID != 0 && trackID != track.trackID {
+			return nil
+		}
+
+		base := moofOffset
+		explicitBase := false
+		defaultDuration := track.defaultDuration
+		defaultSize := track.defaultSize
+		p := 8
+		read32 := func() (uint32, error) {
+			if p+4 > len(tfhd) {
+				return 0, fmt.Errorf("truncated tfhd")
+			}
+			v := binary.BigEndian.Uint32(tfhd[p : p+4])
+			p += 4
+			return v, nil
+		}
+		if flags&tfhdBaseDataOffset != 0 {
+			if p+8 > len(tfhd) {
+				return fmt.Errorf("truncated tfhd")
+			}
+			base = int64(binary.BigEndian.Uint64(tfhd[p : p+8]))
+			explicitBase = true
+			p += 8
+		}
+		if flags&tfhdSampleDescIndex != 0 {
+			if _, err := read32(); err != nil {
+				return err
+			}
+		}
+		if flags&tfhdDefaultSampleDuration != 0 {
+			v, err := read32()
+			if err != nil {
+				return err
+			}
+			defaultDuration = v
+		}
+		if flags&tfhdDefaultSampleSize != 0 {
+			v, err := read32()
+			if err != nil {
+				return err
+			}
+			defaultSize = v
+		}
+
+		nextData := mdatPayload
+		if explicitBase {
+			nextData = base
+		}
+
+		return eachChildBox(traf, func(typ string, trun []byte) error {
+			if typ != "trun" {
+				return nil
+			}
+			fragment, end, err := parseTrun(trun, base, nextData, defaultDuration, defaultSize)
+			if err != nil {
+				return err
+			}
+			nextData = end
+			samples = append(samples, fragment...)
+			return nil
+		})
+	})
+
+	return samples, err
+}
+
+func parseTrun(trun []byte, base, nextData int64, defaultDuration, defaultSize uint32) ([]fmp4Sample, int64, error) {
+	if len(trun) < 8 {
+		return nil, 0, fmt.Errorf("truncated trun")
+	}
+	flags := binary.BigEndian.Uint32(trun[0:4]) & 0xFFFFFF
+	count := int(binary.BigEndian.Uint32(trun[4:8]))
+	p := 8
+
+	pos := nextData
+	if flags&trunDataOffset != 0 {
+		if p+4 > len(trun) {
+			return nil, 0, fmt.Errorf("truncated trun")
+		}
+		pos = base + int64(int32(binary.BigEndian.Uint32(trun[p:p+4])))
+		p += 4
+	}
+	if flags&trunFirstSampleFlags != 0 {
+		p += 4
+	}
+
+	perSample := 0
+	for _, bit := range []uint32{trunSampleDuration, trunSampleSize, trunSampleFlags, trunSampleCTS} {
+		if flags&bit != 0 {
+			perSample += 4
+		}
+	}
+	if count < 0 || p+count*perSample > len(trun) {
+		return nil, 0, fmt.Errorf("truncated trun sample table")
+	}
+
+	samples := make([]fmp4Sample, 0, count)
+	for i := 0; i < count; i++ {
+		duration, size := defaultDuration, defaultSize
+		if flags&trunSampleDuration != 0 {
+			duration = binary.BigEndian.Uint32(trun[p : p+4])
+			p += 4
+		}
+		if flags&trunSampleSize != 0 {
+			size = binary.BigEndian.Uint32(trun[p : p+4])
+			p += 4
+		}
+		if flags&trunSampleFlags != 0 {
+			p += 4
+		}
+		if flags&trunSampleCTS != 0 {
+			p += 4
+		}
+		if size == 0 {
+			return nil, 0, fmt.Errorf("trun sample %d has no size", i)
+		}
+
+		samples = append(samples, fmp4Sample{offset: pos, size: size, duration: duration})
+		pos += int64(size)
+	}
+
+	return samples, pos, nil
+}
+
+// buildFLACHeader returns "fLaC" plus the dfLa metadata blocks, with the
+// STREAMINFO frame size bounds and total sample count filled in and the
+// last-block flag set on the final block.
+func buildFLACHeader(track *fmp4FLACTrack, samples []fmp4Sample) ([]byte, error) {
+	blocks := append([]byte(nil), track.metadataBlocks...)
+
+	var blockStarts []int
+	pos := 0
+	for pos+4 <= len(blocks) {
+		blockStarts = append(blockStarts, pos)
+		length := int(blocks[pos+1])<<16 | int(blocks[pos+2])<<8 | int(blocks[pos+3])
+		pos += 4 + length
+	}
+	if pos != len(blocks) || len(blockStarts) == 0 {
+		return nil, fmt.Errorf("malformed dfLa metadata blocks")
+	}
+	if blocks[0]&0x7F != 0 || len(blocks) < 4+34 {
+		return nil, fmt.Errorf("dfLa does not start with STREAMINFO")
+	}
+
+	for i, start := range blockStarts {
+		blocks[start] &^= 0x80
+		if i == len(blockStarts)-1 {
+			blocks[start] |= 0x80
+		}
+	}
+
+	streamInfo := blocks[4 : 4+34]
+	sampleRate := uint32(streamInfo[10])<<12 | uint32(streamInfo[11])<<4 | uint32(streamInfo[12])>>4
+
+	var minFrame, maxFrame uint32
+	var totalDuration uint64
+	for i, s := range samples {
+		if i == 0 || s.size < minFrame {
+			minFrame = s.size
+		}
+		if s.size > maxFrame {
+			maxFrame = s.size
+		}
+		totalDuration += uint64(s.duration)
+	}
+
+	if maxFrame < 1<<24 {
+		putUint24(streamInfo[4:7], minFrame)
+		putUint24(streamInfo[7:10], maxFrame)
+	}
+
+	totalSamples := totalDuration
+	if track.timescale > 0 && sampleRate > 0 && track.timescale != sampleRate {
+		totalSamples = totalDuration * uint64(sampleRate) / uint64(track.timescale)
+	}
+	if totalSamples > 0 && totalSamples < 1<<36 {
+		streamInfo[13] = streamInfo[13]&0xF0 | byte(totalSamples>>32)&0x0F
+		binary.BigEndian.PutUint32(streamInfo[14:18], uint32(totalSamples))
+	}
+
+	return append([]byte("fLaC"), blocks...), nil
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v >> 16)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v)
+}
+
+func writeFLACFrames(out io.Writer, in io.ReaderAt, header []byte, samples []fmp4Sample) error {
+	bufWriter := bufio.NewWriterSize(out, 256*1024)
+	if _, err := bufWriter.Write(header); err != nil {
+		return fmt.Errorf("failed to write FLAC header: %w", err)
+	}
+
+	for i, s := range samples {
+		if _, err := io.Copy(bufWriter, io.NewSectionReader(in, s.offset, int64(s.size))); err != nil {
+			return fmt.Errorf("failed to copy FLAC frame %d: %w", i, err)
+		}
+	}
+
+	if err := bufWriter.Flush(); err != nil {
+		return fmt.Errorf("failed to flush FLAC file: %w", err)
+	}
+	return nil
+}
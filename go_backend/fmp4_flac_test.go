@@ -0,0 +1,143 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-flac/go-flac/v2"
+)
+
+func testMP4Box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(out[0:4], uint32(8+len(body)))
+	copy(out[4:8], typ)
+	return append(out, body...)
+}
+
+func testBE32(values ...uint32) []byte {
+	out := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(out[i*4:], v)
+	}
+	return out
+}
+
+func testStreamInfoBlock(sampleRate uint32, bitDepth, channels int) []byte {
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint16(info[0:2], 4096)
+	binary.BigEndian.PutUint16(info[2:4], 4096)
+	info[10] = byte(sampleRate >> 12)
+	info[11] = byte(sampleRate >> 4)
+	info[12] = byte(sampleRate<<4) | byte(channels-1)<<1 | byte((bitDepth-1)>>4)
+	info[13] = byte((bitDepth-1)&0x0F) << 4
+
+	header := []byte{0x80, 0, 0, 34}
+	return append(header, info...)
+}
+
+func buildTestFMP4(sampleEntryType string, fragments [][][]byte) []byte {
+	const trackID = 1
+	const timescale = 48000
+
+	audioEntryFields := make([]byte, 28)
+	binary.BigEndian.PutUint16(audioEntryFields[6:8], 1)
+	binary.BigEndian.PutUint16(audioEntryFields[16:18], 2)
+	binary.BigEndian.PutUint16(audioEntryFields[18:20], 24)
+	binary.BigEndian.PutUint32(audioEntryFields[24:28], timescale<<16)
+
+	dfla := testMP4Box("dfLa", testBE32(0), testStreamInfoBlock(timescale, 24, 2))
+	sampleEntry := testMP4Box(sampleEntryType, audioEntryFields, dfla)
+	stsd := testMP4Box("stsd", testBE32(0, 1), sampleEntry)
+
+	tkhd := testMP4Box("tkhd", testBE32(0, 0, 0, trackID, 0), make([]byte, 64))
+	mdhd := testMP4Box("mdhd", testBE32(0, 0, 0, timescale, 0), make([]byte, 4))
+	trak := testMP4Box("trak", tkhd, testMP4Box("mdia", mdhd, testMP4Box("minf", testMP4Box("stbl", stsd))))
+	trex := testMP4Box("trex", testBE32(0, trackID, 1, 4096, 0, 0))
+	moov := testMP4Box("moov", trak, testMP4Box("mvex", trex))
+
+	file := append(testMP4Box("ftyp", []byte("iso6"), testBE32(0)), moov...)
+
+	for seq, frames := range fragments {
+		// tfhd with default-base-is-moof; trun carries data offset and sizes.
+		tfhd := testMP4Box("tfhd", testBE32(0x020000, trackID))
+		trunBody := testBE32(trunDataOffset|trunSampleSize, uint32(len(frames)), 0)
+		for _, frame := range frames {
+			trunBody = append(trunBody, testBE32(uint32(len(frame)))...)
+		}
+		trun := testMP4Box("trun", trunBody)
+		moof := testMP4Box("moof", testMP4Box("mfhd", testBE32(0, uint32(seq+1))), testMP4Box("traf", tfhd, trun))
+
+		// Patch the data offset now that the moof size is known.
+		dataOffset := uint32(len(moof) + 8)
+		trunPos := bytes.Index(moof, []byte("trun"))
+		binary.BigEndian.PutUint32(moof[trunPos+4+8:], dataOffset)
+
+		file = append(file, moof...)
+		file = append(file, testMP4Box("mdat", frames...)...)
+	}
+	return file
+}
+
+func TestDemuxFMP4ToFLAC_WritesNativeFLAC(t *testing.T) {
+	frame := func(payload string) []byte {
+		return append([]byte{0xFF, 0xF8}, payload...)
+	}
+	fragments := [][][]byte{
+		{frame("one"), frame("two-longer")},
+		{frame("three")},
+	}
+
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "track.m4a")
+	outputPath := filepath.Join(dir, "track.flac")
+	if err := os.WriteFile(inputPath, buildTestFMP4("fLaC", fragments), 0644); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	if err := demuxFMP4ToFLAC(inputPath, outputPath); err != nil {
+		t.Fatalf("demuxFMP4ToFLAC failed: %v", err)
+	}
+
+	parsed, err := flac.ParseFile(outputPath)
+	if err != nil {
+		t.Fatalf("output is not a parseable FLAC file: %v", err)
+	}
+	if len(parsed.Meta) != 1 || parsed.Meta[0].Type != flac.StreamInfo {
+		t.Fatalf("expected a single STREAMINFO block, got %d blocks", len(parsed.Meta))
+	}
+
+	quality, err := GetAudioQuality(outputPath)
+	if err != nil {
+		t.Fatalf("GetAudioQuality failed: %v", err)
+	}
+	if quality.BitDepth != 24 || quality.SampleRate != 48000 {
+		t.Fatalf("unexpected quality: %+v", quality)
+	}
+	if quality.TotalSamples != 3*4096 {
+		t.Fatalf("expected total samples from trex durations, got %d", quality.TotalSamples)
+	}
+
+	data, _ := os.ReadFile(outputPath)
+	want := bytes.Join([][]byte{frame("one"), frame("two-longer"), frame("three")}, nil)
+	if !bytes.HasSuffix(data, want) {
+		t.Fatalf("frames were not copied in order")
+	}
+}
+
+func TestDemuxFMP4ToFLAC_RejectsNonFLAC(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "track.m4a")
+	if err := os.WriteFile(inputPath, buildTestFMP4("mp4a", [][][]byte{{[]byte("aac")}}), 0644); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	err := demuxFMP4ToFLAC(inputPath, filepath.Join(dir, "track.flac"))
+	if !errors.Is(err, errFMP4NotFLAC) {
+		t.Fatalf("expected errFMP4NotFLAC, got %v", err)
+	}
+}
@@ -155,7 +155,7 @@ func DoRequestWithRetry(client *http.Client, req *http.Request, config RetryConf
 		if err != nil {
 			lastErr = err
 
-			if CheckAndLogISPBlocking(err, requestURL, "HTTP") {
+			if IsISPBlocking(err, requestURL) != nil {
 				return nil, WrapErrorWithISPCheck(err, requestURL, "HTTP")
 			}
 
@@ -206,7 +206,11 @@ func DoRequestWithRetry(client *http.Client, req *http.Request, config RetryConf
 					LogError("HTTP", "Domain: %s", req.URL.Host)
 					LogError("HTTP", "Response contains: %s", indicator)
 					LogError("HTTP", "Suggestion: Try using a VPN or changing your DNS to 1.1.1.1 or 8.8.8.8")
-					return nil, fmt.Errorf("ISP blocking detected for %s (HTTP %d) - try using VPN or change DNS", req.URL.Host, resp.StatusCode)
+					return nil, fmt.Errorf("%w - try using VPN or change DNS", &ISPBlockingError{
+						Domain:      req.URL.Host,
+						Reason:      fmt.Sprintf("HTTP %d block page", resp.StatusCode),
+						OriginalErr: fmt.Errorf("HTTP %d: response contains %q", resp.StatusCode, indicator),
+					})
 				}
 			}
 		}
@@ -307,6 +311,10 @@ func (e *ISPBlockingError) Error() string {
 	return fmt.Sprintf("ISP blocking detected for %s: %s", e.Domain, e.Reason)
 }
 
+func (e *ISPBlockingError) Unwrap() error {
+	return e.OriginalErr
+}
+
 func IsISPBlocking(err error, requestURL string) *ISPBlockingError {
 	if err == nil {
 		return nil
@@ -441,15 +449,15 @@ func extractDomain(rawURL string) string {
 	return "unknown"
 }
 
-// If ISP blocking is detected, returns a more descriptive error
+// If ISP blocking is detected, returns a more descriptive error wrapping an
+// *ISPBlockingError
 func WrapErrorWithISPCheck(err error, requestURL string, tag string) error {
 	if err == nil {
 		return nil
 	}
 
 	if CheckAndLogISPBlocking(err, requestURL, tag) {
-		domain := extractDomain(requestURL)
-		return fmt.Errorf("ISP blocking detected for %s - try using VPN or change DNS to 1.1.1.1/8.8.8.8: %w", domain, err)
+		return fmt.Errorf("%w - try using VPN or change DNS to 1.1.1.1/8.8.8.8", IsISPBlocking(err, requestURL))
 	}
 
 	return err
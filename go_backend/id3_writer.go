@@ -0,0 +1,442 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// id3Padding is the free space left after the frames when a tag has to be
+// rewritten, so later edits can usually be made in place.
+const id3Padding = 2048
+
+// ID3v2.4 text encodings used by the writer.
+const (
+	id3EncodingLatin1 = 0
+	id3EncodingUTF8   = 3
+)
+
+// isMP3File reports whether path names an MP3 file by extension.
+func isMP3File(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".mp3")
+}
+
+// id3Frame is an ID3v2 frame with its body already decoded from any
+// unsynchronisation, ready to be written back as ID3v2.4.
+type id3Frame struct {
+	id   string
+	body []byte
+}
+
+// id3Tag holds the frames of an MP3 file's tag and how many bytes the
+// existing tag occupies at the start of the file.
+type id3Tag struct {
+	frames   []id3Frame
+	origSize int64
+}
+
+// ID3v2.3 frames that ID3v2.4 dropped. TYER is converted to TDRC instead.
+var id3v23OnlyFrames = map[string]bool{"TDAT": true, "TIME": true, "TRDA": true, "TSIZ": true, "TORY": true}
+
+// readID3TagForWrite reads the existing ID3v2 tag of f, if any. ID3v2.3 and
+// 2.4 frames are kept as they are; an ID3v2.2 tag is converted through its
+// parsed fields since its frame IDs cannot be carried over.
+func readID3TagForWrite(f *os.File) (*id3Tag, error) {
+	header := make([]byte, 10)
+	if _, err := f.ReadAt(header, 0); err != nil || string(header[0:3]) != "ID3" {
+		return &id3Tag{}, nil
+	}
+
+	version := header[3]
+	flags := header[5]
+	size := syncsafeToInt(header[6:10])
+	tag := &id3Tag{origSize: int64(10 + size)}
+	if flags&0x10 != 0 {
+		tag.origSize += 10
+	}
+
+	data := make([]byte, size)
+	if _, err := f.ReadAt(data, 10); err != nil {
+		return nil, fmt.Errorf("failed to read ID3 tag: %w", err)
+	}
+	if flags&0x40 != 0 {
+		if skip := extendedHeaderSize(data, version); skip > 0 && skip < len(data) {
+			data = data[skip:]
+		}
+	}
+	tagUnsync := flags&0x80 != 0
+
+	switch version {
+	case 2:
+		metadata := &AudioMetadata{}
+		parseID3v22Frames(data, metadata, tagUnsync)
+		tag.apply(*audioMetadataToMetadata(metadata), nil)
+	case 3, 4:
+		tag.frames = parseID3FramesForWrite(data, version, tagUnsync)
+	default:
+		return nil, fmt.Errorf("unsupported ID3v2.%d tag", version)
+	}
+	return tag, nil
+}
+
+func parseID3FramesForWrite(data []byte, version byte, tagUnsync bool) []id3Frame {
+	var frames []id3Frame
+	for pos := 0; pos+10 <= len(data); {
+		id := string(data[pos : pos+4])
+		if id[0] == 0 {
+			break
+		}
+		size := int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		if version == 4 {
+			size = syncsafeToInt(data[pos+4 : pos+8])
+		}
+		if size <= 0 || pos+10+size > len(data) {
+			break
+		}
+		formatFlags := data[pos+9]
+		body := data[pos+10 : pos+10+size]
+		pos += 10 + size
+
+		if version == 3 {
+			if formatFlags&0xC0 != 0 {
+				continue // compressed or encrypted
+			}
+			if formatFlags&0x20 != 0 && len(body) > 0 {
+				body = body[1:]
+			}
+			if tagUnsync {
+				body = removeUnsync(body)
+			}
+			if id3v23OnlyFrames[id] {
+				continue
+			}
+			if id == "TYER" {
+				id = "TDRC"
+			}
+		} else {
+			if formatFlags&0x0C != 0 {
+				continue // compressed or encrypted
+			}
+			if formatFlags&0x40 != 0 && len(body) > 0 {
+				body = body[1:]
+			}
+			if formatFlags&0x01 != 0 && len(body) >= 4 {
+				body = body[4:]
+			}
+			if formatFlags&0x02 != 0 || tagUnsync {
+				body = removeUnsync(body)
+			}
+		}
+		frames = append(frames, id3Frame{id: id, body: append([]byte(nil), body...)})
+	}
+	return frames
+}
+
+// remove drops the frames with the given ID for which match returns true,
+// or all of them when match is nil.
+func (t *id3Tag) remove(id string, match func(body []byte) bool) {
+	kept := t.frames[:0]
+	for _, frame := range t.frames {
+		if frame.id == id && (match == nil || match(frame.body)) {
+			continue
+		}
+		kept = append(kept, frame)
+	}
+	t.frames = kept
+}
+
+// setText replaces a text frame, leaving the existing one when value is
+// empty.
+func (t *id3Tag) setText(id, value string) {
+	if value == "" {
+		return
+	}
+	t.remove(id, nil)
+	t.frames = append(t.frames, id3Frame{id: id, body: append([]byte{id3EncodingUTF8}, value...)})
+}
+
+// setUserText replaces the TXXX frame with the given description.
+func (t *id3Tag) setUserText(description, value string) {
+	if value == "" {
+		return
+	}
+	t.remove("TXXX", func(body []byte) bool {
+		desc, _ := extractUserTextFrame(body)
+		return strings.EqualFold(desc, description)
+	})
+	body := append([]byte{id3EncodingUTF8}, description...)
+	body = append(body, 0)
+	t.frames = append(t.frames, id3Frame{id: "TXXX", body: append(body, value...)})
+}
+
+// setUniqueFileID replaces the UFID frame of the given owner.
+func (t *id3Tag) setUniqueFileID(owner, id string) {
+	if id == "" {
+		return
+	}
+	t.remove("UFID", func(body []byte) bool {
+		frameOwner, _, _ := bytes.Cut(body, []byte{0})
+		return string(frameOwner) == owner
+	})
+	body := append([]byte(owner), 0)
+	t.frames = append(t.frames, id3Frame{id: "UFID", body: append(body, id...)})
+}
+
+// setInvolvedPeople writes the producers and remixers as a TIPL frame of
+// role and name pairs.
+func (t *id3Tag) setInvolvedPeople(credits []ArtistCredit) {
+	var pairs []string
+	for _, name := range creditNames(credits, ArtistRoleProducer) {
+		pairs = append(pairs, "producer", name)
+	}
+	for _, name := range creditNames(credits, ArtistRoleRemixer) {
+		pairs = append(pairs, "mix", name)
+	}
+	t.setText("TIPL", strings.Join(pairs, "\x00"))
+}
+
+// setLanguageText replaces the COMM or USLT frame without a description,
+// keeping frames other tools store under their own descriptions.
+func (t *id3Tag) setLanguageText(id, value string) {
+	if value == "" {
+		return
+	}
+	t.remove(id, func(body []byte) bool { return id3LanguageFrameDescription(body) == "" })
+	body := append([]byte{id3EncodingUTF8}, "eng"...)
+	body = append(body, 0)
+	t.frames = append(t.frames, id3Frame{id: id, body: append(body, value...)})
+}
+
+// setLyrics writes lyrics as USLT and, when they carry LRC timestamps, as a
+// SYLT frame with millisecond timing.
+func (t *id3Tag) setLyrics(lyrics string) {
+	if lyrics == "" {
+		return
+	}
+	t.setLanguageText("USLT", lyrics)
+
+	lines := parseSyncedLyrics(lyrics)
+	if len(lines) == 0 {
+		return
+	}
+	t.remove("SYLT", nil)
+	body := append([]byte{id3EncodingUTF8}, "eng"...)
+	body = append(body, 2, 1, 0) // absolute milliseconds, lyrics, no description
+	for _, line := range lines {
+		body = append(body, line.Words...)
+		body = append(body, 0)
+		body = binary.BigEndian.AppendUint32(body, uint32(line.StartTimeMs))
+	}
+	t.frames = append(t.frames, id3Frame{id: "SYLT", body: body})
+}
+
+// setCover replaces all attached pictures with coverData as the front cover.
+func (t *id3Tag) setCover(coverData []byte) {
+	if len(coverData) == 0 {
+		return
+	}
+	t.remove("APIC", nil)
+	body := append([]byte{id3EncodingLatin1}, detectCoverMIME("", coverData)...)
+	body = append(body, 0, 3, 0) // front cover, empty description
+	t.frames = append(t.frames, id3Frame{id: "APIC", body: append(body, coverData...)})
+}
+
+// apply writes metadata into the tag. As with FLAC, only fields with a value
+// replace existing frames.
+func (t *id3Tag) apply(metadata Metadata, coverData []byte) {
+	t.setText("TIT2", metadata.Title)
+	t.setText("TPE1", metadata.Artist)
+	t.setText("TALB", metadata.Album)
+	t.setText("TPE2", metadata.AlbumArtist)
+	t.setText("TDRC", metadata.Date)
+	if metadata.TrackNumber > 0 {
+		track := strconv.Itoa(metadata.TrackNumber)
+		if metadata.TotalTracks > 0 {
+			track += "/" + strconv.Itoa(metadata.TotalTracks)
+		}
+		t.setText("TRCK", track)
+	}
+	if metadata.DiscNumber > 0 {
+		t.setText("TPOS", strconv.Itoa(metadata.DiscNumber))
+	}
+	t.setText("TSRC", metadata.ISRC)
+	t.setUserText("ISRC", metadata.ISRC)
+	t.setUserText("DESCRIPTION", metadata.Description)
+	t.setLyrics(metadata.Lyrics)
+	t.setText("TCON", metadata.Genre)
+	t.setText("TPUB", metadata.Label)
+	t.setText("TCOP", metadata.Copyright)
+	t.setText("TCOM", metadata.Composer)
+	t.setLanguageText("COMM", metadata.Comment)
+	for _, tag := range metadata.Provenance.tags() {
+		t.setUserText(tag[0], tag[1])
+	}
+	// ID3v2.4 separates multiple values with a null byte.
+	t.setUserText("ARTISTS", strings.Join(creditNames(metadata.ArtistCredits, ArtistRoleMain, ArtistRoleFeatured), "\x00"))
+	t.setText("TCOM", strings.Join(creditNames(metadata.ArtistCredits, ArtistRoleComposer), "\x00"))
+	t.setInvolvedPeople(metadata.ArtistCredits)
+	t.setMusicBrainzIDs(metadata.MusicBrainz)
+	t.setCover(coverData)
+}
+
+// setMusicBrainzIDs writes the recording ID as a UFID frame, as Picard does,
+// and the other IDs as TXXX frames.
+func (t *id3Tag) setMusicBrainzIDs(ids *MusicBrainzIDs) {
+	for _, tag := range ids.tags() {
+		if tag.vorbis == musicBrainzTagRecording {
+			t.setUniqueFileID(musicBrainzUFIDOwner, tag.values[0])
+			continue
+		}
+		t.setUserText(tag.name, strings.Join(tag.values, "\x00"))
+	}
+}
+
+func (t *id3Tag) marshalFrames() []byte {
+	var buf bytes.Buffer
+	for _, frame := range t.frames {
+		header := make([]byte, 10)
+		copy(header[0:4], frame.id)
+		putSyncsafe(header[4:8], len(frame.body))
+		buf.Write(header)
+		buf.Write(frame.body)
+	}
+	return buf.Bytes()
+}
+
+// marshal returns an ID3v2.4 tag of exactly size bytes, or of the frames
+// plus id3Padding when size is 0.
+func (t *id3Tag) marshal(size int) []byte {
+	frames := t.marshalFrames()
+	if size == 0 {
+		size = 10 + len(frames) + id3Padding
+	}
+	tag := make([]byte, size)
+	copy(tag[0:5], []byte{'I', 'D', '3', 4, 0})
+	putSyncsafe(tag[6:10], size-10)
+	copy(tag[10:], frames)
+	return tag
+}
+
+func putSyncsafe(b []byte, v int) {
+	b[0] = byte(v>>21) & 0x7F
+	b[1] = byte(v>>14) & 0x7F
+	b[2] = byte(v>>7) & 0x7F
+	b[3] = byte(v) & 0x7F
+}
+
+// id3LanguageFrameDescription returns the description of a COMM/USLT body.
+func id3LanguageFrameDescription(body []byte) string {
+	if len(body) < 5 {
+		return ""
+	}
+	encoding := body[0]
+	rest := body[4:]
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(rest); i += 2 {
+			if rest[i] == 0 && rest[i+1] == 0 {
+				return extractTextFrame(append([]byte{encoding}, rest[:i]...))
+			}
+		}
+		return ""
+	}
+	if idx := bytes.IndexByte(rest, 0); idx >= 0 {
+		return string(rest[:idx])
+	}
+	return ""
+}
+
+// updateID3Tags applies edit to the ID3 tag of an MP3 file and writes it
+// back as ID3v2.4. The tag is overwritten in place when it still fits in the
+// space of the old one; otherwise the file is rewritten next to the original
+// and renamed over it.
+func updateID3Tags(filePath string, edit func(tag *id3Tag)) error {
+	f, err := os.OpenFile(filePath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open MP3 file: %w", err)
+	}
+	defer f.Close()
+
+	tag, err := readID3TagForWrite(f)
+	if err != nil {
+		return err
+	}
+	edit(tag)
+
+	frames := tag.marshalFrames()
+	if tag.origSize > 0 && int64(10+len(frames)) <= tag.origSize {
+		if _, err := f.WriteAt(tag.marshal(int(tag.origSize)), 0); err != nil {
+			return fmt.Errorf("failed to write ID3 tag: %w", err)
+		}
+		return f.Sync()
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tags-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = tmp.Write(tag.marshal(0))
+	if err == nil {
+		_, err = io.Copy(tmp, io.NewSectionReader(f, tag.origSize, info.Size()-tag.origSize))
+	}
+	if err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write MP3 file: %w", err)
+	}
+	f.Close()
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("failed to replace MP3 file: %w", err)
+	}
+	return nil
+}
+
+// embedID3Metadata writes metadata to an MP3 file, keeping the existing
+// cover when coverData is empty.
+func embedID3Metadata(filePath string, metadata Metadata, coverData []byte) error {
+	if err := updateID3Tags(filePath, func(tag *id3Tag) { tag.apply(metadata, coverData) }); err != nil {
+		return err
+	}
+	if len(coverData) > 0 {
+		fmt.Printf("[Metadata] Cover art embedded successfully (%d bytes)\n", len(coverData))
+	}
+	return nil
+}
+
+// audioMetadataToMetadata converts tags read from MP3, Ogg or M4A files to
+// the form the writers take.
+func audioMetadataToMetadata(audio *AudioMetadata) *Metadata {
+	return &Metadata{
+		Title:       audio.Title,
+		Artist:      audio.Artist,
+		Album:       audio.Album,
+		AlbumArtist: audio.AlbumArtist,
+		Date:        firstNonEmpty(audio.Date, audio.Year),
+		TrackNumber: audio.TrackNumber,
+		DiscNumber:  audio.DiscNumber,
+		ISRC:        audio.ISRC,
+		Lyrics:      audio.Lyrics,
+		Genre:       audio.Genre,
+		Label:       audio.Label,
+		Copyright:   audio.Copyright,
+		Composer:    audio.Composer,
+		Comment:     audio.Comment,
+		Provenance:  audio.Provenance,
+	}
+}
@@ -0,0 +1,116 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEmbedID3MetadataRewritesLegacyTag(t *testing.T) {
+	path := writeTestMP3(t, t.TempDir(), "song.mp3", map[string]string{"TIT2": "Old Title", "TPE1": "Artist", "TYER": "1999"})
+	cover := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, make([]byte, 64)...)
+
+	metadata := Metadata{
+		Title:       "New Title",
+		Album:       "Album",
+		TrackNumber: 4,
+		TotalTracks: 10,
+		ISRC:        "USRC17607839",
+		Label:       "Label",
+		Lyrics:      "[00:01.50]First line\n[00:04.00]Second line",
+		Provenance:  &Provenance{Source: "youtube"},
+	}
+	if err := EmbedMetadataWithCoverData(path, metadata, cover); err != nil {
+		t.Fatalf("EmbedMetadataWithCoverData: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data[0:3]) != "ID3" || data[3] != 4 {
+		t.Fatalf("expected an ID3v2.4 tag, got % x", data[:5])
+	}
+	if !bytes.Contains(data, []byte("SYLT")) {
+		t.Fatal("expected a SYLT frame for timed lyrics")
+	}
+
+	read, err := ReadID3Tags(path)
+	if err != nil {
+		t.Fatalf("ReadID3Tags: %v", err)
+	}
+	if read.Title != "New Title" || read.Artist != "Artist" || read.Album != "Album" ||
+		read.Date != "1999" || read.TrackNumber != 4 || read.ISRC != "USRC17607839" ||
+		read.Label != "Label" || read.Lyrics != metadata.Lyrics {
+		t.Fatalf("unexpected tags: %+v", read)
+	}
+	if read.Provenance == nil || read.Provenance.Source != "youtube" {
+		t.Fatalf("unexpected provenance: %+v", read.Provenance)
+	}
+
+	embedded, mime, err := extractMP3CoverArt(path)
+	if err != nil || !bytes.Equal(embedded, cover) || mime != "image/jpeg" {
+		t.Fatalf("unexpected cover: %d bytes, %q, %v", len(embedded), mime, err)
+	}
+
+	quality, err := GetMP3Quality(path)
+	if err != nil || quality.Bitrate != 128000 || quality.SampleRate != 44100 {
+		t.Fatalf("expected audio stream to survive the rewrite, got %+v, %v", quality, err)
+	}
+}
+
+func TestEmbedID3MetadataUpdatesInPlaceWithinPadding(t *testing.T) {
+	path := writeTestMP3(t, t.TempDir(), "song.mp3", map[string]string{"TIT2": "Title"})
+	if err := EmbedMetadata(path, Metadata{Artist: "Artist"}, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+	before, _ := os.Stat(path)
+
+	if err := EmbedGenreLabel(path, "Rock", "Label"); err != nil {
+		t.Fatalf("EmbedGenreLabel: %v", err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() != before.Size() {
+		t.Fatalf("expected in-place update, size changed from %d to %d", before.Size(), after.Size())
+	}
+
+	read, err := ReadID3Tags(path)
+	if err != nil {
+		t.Fatalf("ReadID3Tags: %v", err)
+	}
+	if read.Title != "Title" || read.Artist != "Artist" || read.Genre != "Rock" || read.Label != "Label" {
+		t.Fatalf("unexpected tags: %+v", read)
+	}
+}
+
+func TestEditFileMetadataWritesMP3Natively(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "untagged.mp3")
+	audio := append([]byte{0xFF, 0xFB, 0x90, 0x00}, make([]byte, 413)...)
+	if err := os.WriteFile(path, audio, 0644); err != nil {
+		t.Fatalf("failed to write MP3: %v", err)
+	}
+
+	resultJSON, err := EditFileMetadata(path, `{"title":"Song","artist":"Artist","track_number":"2"}`)
+	if err != nil {
+		t.Fatalf("EditFileMetadata: %v", err)
+	}
+	var result struct {
+		Method string `json:"method"`
+	}
+	json.Unmarshal([]byte(resultJSON), &result)
+	if result.Method != "native" {
+		t.Fatalf("expected native method, got %s", resultJSON)
+	}
+
+	read, err := ReadID3Tags(path)
+	if err != nil {
+		t.Fatalf("ReadID3Tags: %v", err)
+	}
+	if read.Title != "Song" || read.Artist != "Artist" || read.TrackNumber != 2 {
+		t.Fatalf("unexpected tags: %+v", read)
+	}
+	data, _ := os.ReadFile(path)
+	if !bytes.HasSuffix(data, audio) {
+		t.Fatal("expected audio data to follow the new tag unchanged")
+	}
+}
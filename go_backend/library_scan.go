@@ -31,6 +31,12 @@ type LibraryScanResult struct {
 	Bitrate     int    `json:"bitrate,omitempty"` // kbps, for lossy formats (MP3, Opus, Vorbis)
 	Genre       string `json:"genre,omitempty"`
 	Format      string `json:"format,omitempty"`
+
+	// Provenance tags written at download time; empty for files the app did
+	// not download.
+	DownloadSource   string `json:"downloadSource,omitempty"`
+	DownloadSourceID string `json:"downloadSourceId,omitempty"`
+	DownloadedAt     string `json:"downloadedAt,omitempty"`
 }
 
 type LibraryScanProgress struct {
@@ -89,6 +95,7 @@ func ScanLibraryFolder(folderPath string) (string, error) {
 	libraryScanProgressMu.Lock()
 	libraryScanProgress = LibraryScanProgress{}
 	libraryScanProgressMu.Unlock()
+	emitLibraryScanProgress()
 
 	libraryScanCancelMu.Lock()
 	if libraryScanCancel != nil {
@@ -112,7 +119,7 @@ func ScanLibraryFolder(folderPath string) (string, error) {
 
 		if !info.IsDir() {
 			ext := strings.ToLower(filepath.Ext(path))
-			if supportedAudioFormats[ext] {
+			if supportedAudioFormats[ext] && !isStagingFile(path) {
 				audioFiles = append(audioFiles, path)
 			}
 		}
@@ -127,11 +134,13 @@ func ScanLibraryFolder(folderPath string) (string, error) {
 	libraryScanProgressMu.Lock()
 	libraryScanProgress.TotalFiles = totalFiles
 	libraryScanProgressMu.Unlock()
+	emitLibraryScanProgress()
 
 	if totalFiles == 0 {
 		libraryScanProgressMu.Lock()
 		libraryScanProgress.IsComplete = true
 		libraryScanProgressMu.Unlock()
+		emitLibraryScanProgress()
 		return "[]", nil
 	}
 
@@ -153,6 +162,7 @@ func ScanLibraryFolder(folderPath string) (string, error) {
 		libraryScanProgress.CurrentFile = filepath.Base(filePath)
 		libraryScanProgress.ProgressPct = float64(i+1) / float64(totalFiles) * 100
 		libraryScanProgressMu.Unlock()
+		emitLibraryScanProgress()
 
 		result, err := scanAudioFile(filePath, scanTime)
 		if err != nil {
@@ -168,6 +178,7 @@ func ScanLibraryFolder(folderPath string) (string, error) {
 	libraryScanProgress.ErrorCount = errorCount
 	libraryScanProgress.IsComplete = true
 	libraryScanProgressMu.Unlock()
+	emitLibraryScanProgress()
 
 	GoLog("[LibraryScan] Scan complete: %d tracks found, %d errors\n", len(results), errorCount)
 
@@ -233,6 +244,7 @@ func scanFLACFile(filePath string, result *LibraryScanResult) (*LibraryScanResul
 	result.DiscNumber = metadata.DiscNumber
 	result.ReleaseDate = metadata.Date
 	result.Genre = metadata.Genre
+	result.applyProvenance(metadata.Provenance)
 
 	quality, err := GetAudioQuality(filePath)
 	if err == nil {
@@ -256,6 +268,15 @@ func scanFLACFile(filePath string, result *LibraryScanResult) (*LibraryScanResul
 	return result, nil
 }
 
+func (r *LibraryScanResult) applyProvenance(p *Provenance) {
+	if p == nil {
+		return
+	}
+	r.DownloadSource = p.Source
+	r.DownloadSourceID = p.SourceTrackID
+	r.DownloadedAt = p.DownloadedAt
+}
+
 func scanM4AFile(filePath string, result *LibraryScanResult) (*LibraryScanResult, error) {
 	quality, err := GetM4AQuality(filePath)
 	if err == nil {
@@ -286,6 +307,7 @@ func scanMP3File(filePath string, result *LibraryScanResult) (*LibraryScanResult
 		result.ReleaseDate = metadata.Year
 	}
 	result.ISRC = metadata.ISRC
+	result.applyProvenance(metadata.Provenance)
 
 	quality, err := GetMP3Quality(filePath)
 	if err == nil {
@@ -326,6 +348,7 @@ func scanOggFile(filePath string, result *LibraryScanResult) (*LibraryScanResult
 	result.DiscNumber = metadata.DiscNumber
 	result.Genre = metadata.Genre
 	result.ReleaseDate = metadata.Date
+	result.applyProvenance(metadata.Provenance)
 
 	quality, err := GetOggQuality(filePath)
 	if err == nil {
@@ -465,6 +488,7 @@ func ScanLibraryFolderIncremental(folderPath, existingFilesJSON string) (string,
 	libraryScanProgressMu.Lock()
 	libraryScanProgress = LibraryScanProgress{}
 	libraryScanProgressMu.Unlock()
+	emitLibraryScanProgress()
 
 	// Setup cancellation
 	libraryScanCancelMu.Lock()
@@ -496,7 +520,7 @@ func ScanLibraryFolderIncremental(folderPath, existingFilesJSON string) (string,
 
 		if !info.IsDir() {
 			ext := strings.ToLower(filepath.Ext(path))
-			if supportedAudioFormats[ext] {
+			if supportedAudioFormats[ext] && !isStagingFile(path) {
 				currentFiles = append(currentFiles, fileInfo{
 					path:    path,
 					modTime: info.ModTime().UnixMilli(),
@@ -515,6 +539,7 @@ func ScanLibraryFolderIncremental(folderPath, existingFilesJSON string) (string,
 	libraryScanProgressMu.Lock()
 	libraryScanProgress.TotalFiles = totalFiles
 	libraryScanProgressMu.Unlock()
+	emitLibraryScanProgress()
 
 	// Find files to scan (new or modified)
 	var filesToScan []fileInfo
@@ -551,6 +576,7 @@ func ScanLibraryFolderIncremental(folderPath, existingFilesJSON string) (string,
 		libraryScanProgress.IsComplete = true
 		libraryScanProgress.ProgressPct = 100
 		libraryScanProgressMu.Unlock()
+		emitLibraryScanProgress()
 
 		result := IncrementalScanResult{
 			Scanned:      []LibraryScanResult{},
@@ -579,6 +605,7 @@ func ScanLibraryFolderIncremental(folderPath, existingFilesJSON string) (string,
 		libraryScanProgress.CurrentFile = filepath.Base(f.path)
 		libraryScanProgress.ProgressPct = float64(skippedCount+i+1) / float64(totalFiles) * 100
 		libraryScanProgressMu.Unlock()
+		emitLibraryScanProgress()
 
 		result, err := scanAudioFile(f.path, scanTime)
 		if err != nil {
@@ -596,6 +623,7 @@ func ScanLibraryFolderIncremental(folderPath, existingFilesJSON string) (string,
 	libraryScanProgress.ScannedFiles = totalFiles
 	libraryScanProgress.ProgressPct = 100
 	libraryScanProgressMu.Unlock()
+	emitLibraryScanProgress()
 
 	GoLog("[LibraryScan] Incremental scan complete: %d scanned, %d skipped, %d deleted, %d errors\n",
 		len(results), skippedCount, len(deletedPaths), errorCount)
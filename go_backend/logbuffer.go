@@ -100,6 +100,7 @@ func (lb *LogBuffer) Add(level, tag, message string) {
 		lb.entries = lb.entries[1:]
 	}
 	lb.entries = append(lb.entries, entry)
+	GetEventStream().queueLog(entry)
 
 	fmt.Printf("[%s] %s\n", tag, message)
 }
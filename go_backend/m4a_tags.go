@@ -0,0 +1,618 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// iTunes-style item atoms in moov/udta/meta/ilst. Names starting with © use
+// the single byte 0xA9, not its UTF-8 encoding.
+const (
+	m4aAtomTitle       = "\xa9nam"
+	m4aAtomArtist      = "\xa9ART"
+	m4aAtomAlbum       = "\xa9alb"
+	m4aAtomAlbumArtist = "aART"
+	m4aAtomDate        = "\xa9day"
+	m4aAtomGenre       = "\xa9gen"
+	m4aAtomComposer    = "\xa9wrt"
+	m4aAtomComment     = "\xa9cmt"
+	m4aAtomLyrics      = "\xa9lyr"
+	m4aAtomCopyright   = "cprt"
+	m4aAtomDescription = "desc"
+	m4aAtomTrack       = "trkn"
+	m4aAtomDisc        = "disk"
+	m4aAtomCover       = "covr"
+	m4aAtomFreeform    = "----"
+)
+
+// Freeform (----) items have no standard atom; they are stored under the
+// iTunes namespace with these names, matching what FFmpeg and taggers use.
+const (
+	m4aFreeformMean  = "com.apple.iTunes"
+	m4aFreeformISRC  = "ISRC"
+	m4aFreeformLabel = "LABEL"
+)
+
+// Well-known types of the data atom inside an item.
+const (
+	m4aDataImplicit = 0
+	m4aDataUTF8     = 1
+	m4aDataJPEG     = 13
+	m4aDataPNG      = 14
+)
+
+// isM4AFile reports whether path names an MP4 audio container by extension.
+func isM4AFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".m4a", ".mp4", ".m4b":
+		return true
+	}
+	return false
+}
+
+// m4aItem is one entry of an ilst atom, kept as its raw bytes so items the
+// writer does not know about survive a rewrite unchanged.
+type m4aItem struct {
+	key string
+	box []byte
+}
+
+type m4aItemList struct {
+	items []m4aItem
+}
+
+// set replaces the item with the same key, or appends it.
+func (l *m4aItemList) set(key string, box []byte) {
+	for i := range l.items {
+		if l.items[i].key == key {
+			l.items[i].box = box
+			return
+		}
+	}
+	l.items = append(l.items, m4aItem{key: key, box: box})
+}
+
+// remove drops the item with the given key.
+func (l *m4aItemList) remove(key string) {
+	kept := l.items[:0]
+	for _, item := range l.items {
+		if item.key != key {
+			kept = append(kept, item)
+		}
+	}
+	l.items = kept
+}
+
+func (l *m4aItemList) get(key string) []byte {
+	for _, item := range l.items {
+		if item.key == key {
+			return item.box
+		}
+	}
+	return nil
+}
+
+// setText sets a UTF-8 item, leaving the existing one when value is empty.
+func (l *m4aItemList) setText(atom, value string) {
+	if value == "" {
+		return
+	}
+	l.set(atom, buildMP4Box(atom, m4aDataAtom(m4aDataUTF8, []byte(value))))
+}
+
+// setFreeform sets a freeform item holding one data atom per value.
+func (l *m4aItemList) setFreeform(name string, values ...string) {
+	if len(values) == 0 || values[0] == "" {
+		return
+	}
+	children := [][]byte{
+		buildMP4Box("mean", make([]byte, 4), []byte(m4aFreeformMean)),
+		buildMP4Box("name", make([]byte, 4), []byte(name)),
+	}
+	for _, value := range values {
+		children = append(children, m4aDataAtom(m4aDataUTF8, []byte(value)))
+	}
+	box := buildMP4Box(m4aAtomFreeform, children...)
+	l.set(m4aFreeformKey(m4aFreeformMean, name), box)
+}
+
+// setNumberPair writes trkn/disk, which hold a number and a total.
+func (l *m4aItemList) setNumberPair(atom string, number, total int) {
+	if number <= 0 {
+		return
+	}
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint16(payload[2:4], uint16(number))
+	binary.BigEndian.PutUint16(payload[4:6], uint16(total))
+	if atom == m4aAtomDisc {
+		payload = payload[:6]
+	}
+	l.set(atom, buildMP4Box(atom, m4aDataAtom(m4aDataImplicit, payload)))
+}
+
+func (l *m4aItemList) setCover(coverData []byte) {
+	if len(coverData) == 0 {
+		return
+	}
+	dataType := uint32(m4aDataJPEG)
+	if detectCoverMIME("", coverData) == "image/png" {
+		dataType = m4aDataPNG
+	}
+	l.set(m4aAtomCover, buildMP4Box(m4aAtomCover, m4aDataAtom(dataType, coverData)))
+}
+
+func (l *m4aItemList) marshal() []byte {
+	var buf bytes.Buffer
+	for _, item := range l.items {
+		buf.Write(item.box)
+	}
+	return buf.Bytes()
+}
+
+// text returns the value of a UTF-8 item, or "".
+func (l *m4aItemList) text(key string) string {
+	box := l.get(key)
+	if box == nil {
+		return ""
+	}
+	return string(m4aItemData(box[8:]))
+}
+
+func (l *m4aItemList) numberPair(key string) (int, int) {
+	box := l.get(key)
+	if box == nil {
+		return 0, 0
+	}
+	data := m4aItemData(box[8:])
+	if len(data) < 6 {
+		return 0, 0
+	}
+	return int(binary.BigEndian.Uint16(data[2:4])), int(binary.BigEndian.Uint16(data[4:6]))
+}
+
+func m4aDataAtom(dataType uint32, payload []byte) []byte {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[0:4], dataType)
+	return buildMP4Box("data", header, payload)
+}
+
+// m4aItemData returns the payload of the first data atom in an item body.
+func m4aItemData(itemBody []byte) []byte {
+	data := findChildBox(itemBody, "data")
+	if len(data) < 8 {
+		return nil
+	}
+	return data[8:]
+}
+
+func m4aFreeformKey(mean, name string) string {
+	return m4aAtomFreeform + ":" + mean + ":" + strings.ToUpper(name)
+}
+
+func parseM4AItems(ilst []byte) (*m4aItemList, error) {
+	list := &m4aItemList{}
+	err := eachChildBox(ilst, func(typ string, body []byte) error {
+		key := typ
+		if typ == m4aAtomFreeform {
+			mean := findChildBox(body, "mean")
+			name := findChildBox(body, "name")
+			if len(mean) >= 4 && len(name) >= 4 {
+				key = m4aFreeformKey(string(mean[4:]), string(name[4:]))
+			}
+		}
+		list.items = append(list.items, m4aItem{key: key, box: buildMP4Box(typ, body)})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ilst atom: %w", err)
+	}
+	return list, nil
+}
+
+// buildMP4Box serializes a box from its type and body parts.
+func buildMP4Box(typ string, parts ...[]byte) []byte {
+	size := 8
+	for _, part := range parts {
+		size += len(part)
+	}
+	if uint64(size) > 0xFFFFFFFF {
+		size += 8
+		box := make([]byte, 16, size)
+		binary.BigEndian.PutUint32(box[0:4], 1)
+		copy(box[4:8], typ)
+		binary.BigEndian.PutUint64(box[8:16], uint64(size))
+		for _, part := range parts {
+			box = append(box, part...)
+		}
+		return box
+	}
+	box := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(box[0:4], uint32(size))
+	copy(box[4:8], typ)
+	for _, part := range parts {
+		box = append(box, part...)
+	}
+	return box
+}
+
+// replaceChildBox returns data with the first box of type typ replaced by one
+// with the given body, or with such a box appended if there was none.
+func replaceChildBox(data []byte, typ string, body []byte) ([]byte, error) {
+	var out []byte
+	replaced := false
+	err := eachChildBox(data, func(childType string, childBody []byte) error {
+		if childType == typ && !replaced {
+			out = append(out, buildMP4Box(typ, body)...)
+			replaced = true
+			return nil
+		}
+		out = append(out, buildMP4Box(childType, childBody)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !replaced {
+		out = append(out, buildMP4Box(typ, body)...)
+	}
+	return out, nil
+}
+
+// splitMetaBody separates the version/flags prefix of a meta atom from its
+// children. QuickTime files omit the prefix, which shows as a child atom
+// starting at offset 0.
+func splitMetaBody(meta []byte) (prefix, children []byte) {
+	if len(meta) >= 8 && string(meta[4:8]) == "hdlr" {
+		return nil, meta
+	}
+	if len(meta) < 4 {
+		return make([]byte, 4), nil
+	}
+	return meta[:4], meta[4:]
+}
+
+// m4aHandlerBox returns the hdlr atom that marks a meta atom as iTunes
+// metadata.
+func m4aHandlerBox() []byte {
+	hdlr := make([]byte, 25)
+	copy(hdlr[8:12], "mdir")
+	copy(hdlr[12:16], "appl")
+	return buildMP4Box("hdlr", hdlr)
+}
+
+// readM4AItems returns the ilst items in a moov atom body.
+func readM4AItems(moov []byte) (*m4aItemList, error) {
+	meta := findChildBox(moov, "udta", "meta")
+	if meta == nil {
+		return &m4aItemList{}, nil
+	}
+	_, children := splitMetaBody(meta)
+	ilst := findChildBox(children, "ilst")
+	if ilst == nil {
+		return &m4aItemList{}, nil
+	}
+	return parseM4AItems(ilst)
+}
+
+// withM4AItems returns moov with its ilst replaced by items.
+func withM4AItems(moov []byte, items *m4aItemList) ([]byte, error) {
+	udta := findChildBox(moov, "udta")
+	meta := findChildBox(udta, "meta")
+	if meta == nil {
+		meta = make([]byte, 4)
+	}
+	prefix, children := splitMetaBody(meta)
+	if findChildBox(children, "hdlr") == nil {
+		children = append(m4aHandlerBox(), children...)
+	}
+
+	children, err := replaceChildBox(children, "ilst", items.marshal())
+	if err != nil {
+		return nil, fmt.Errorf("invalid meta atom: %w", err)
+	}
+	udta, err = replaceChildBox(udta, "meta", append(append([]byte{}, prefix...), children...))
+	if err != nil {
+		return nil, fmt.Errorf("invalid udta atom: %w", err)
+	}
+	moov, err = replaceChildBox(moov, "udta", udta)
+	if err != nil {
+		return nil, fmt.Errorf("invalid moov atom: %w", err)
+	}
+	return moov, nil
+}
+
+// shiftChunkOffsets adds delta to every stco/co64 entry pointing at or past
+// from, for when the moov atom in front of the media data changes size. It
+// edits moov in place.
+func shiftChunkOffsets(moov []byte, from, delta int64) error {
+	return eachChildBox(moov, func(typ string, trak []byte) error {
+		if typ != "trak" {
+			return nil
+		}
+		stbl := findChildBox(trak, "mdia", "minf", "stbl")
+		if stbl == nil {
+			return nil
+		}
+		return eachChildBox(stbl, func(typ string, body []byte) error {
+			if typ != "stco" && typ != "co64" {
+				return nil
+			}
+			if len(body) < 8 {
+				return fmt.Errorf("truncated %s atom", typ)
+			}
+			count := int(binary.BigEndian.Uint32(body[4:8]))
+			entrySize := 4
+			if typ == "co64" {
+				entrySize = 8
+			}
+			if count < 0 || 8+count*entrySize > len(body) {
+				return fmt.Errorf("truncated %s atom", typ)
+			}
+			for i := 0; i < count; i++ {
+				entry := body[8+i*entrySize : 8+(i+1)*entrySize]
+				if typ == "co64" {
+					if offset := int64(binary.BigEndian.Uint64(entry)); offset >= from {
+						binary.BigEndian.PutUint64(entry, uint64(offset+delta))
+					}
+					continue
+				}
+				offset := int64(binary.BigEndian.Uint32(entry))
+				if offset < from {
+					continue
+				}
+				if offset+delta > 0xFFFFFFFF {
+					return fmt.Errorf("chunk offset overflows stco")
+				}
+				binary.BigEndian.PutUint32(entry, uint32(offset+delta))
+			}
+			return nil
+		})
+	})
+}
+
+// checkFragmentOffsets rejects fragmented files whose fragments use absolute
+// file offsets after moov, since moving them would break playback.
+func checkFragmentOffsets(f *os.File, from, fileSize int64) error {
+	for pos := from; pos+8 <= fileSize; {
+		header, err := readAtomHeaderAt(f, pos, fileSize)
+		if err != nil {
+			return err
+		}
+		if header.size == 0 {
+			header.size = fileSize - pos
+		}
+		if header.size < header.headerSize {
+			return fmt.Errorf("invalid atom size for %s", header.typ)
+		}
+
+		switch header.typ {
+		case "mfra":
+			return fmt.Errorf("fragment index (mfra) would be invalidated")
+		case "moof":
+			moof, err := readAtomBody(f, header)
+			if err != nil {
+				return err
+			}
+			err = eachChildBox(moof, func(typ string, traf []byte) error {
+				if typ != "traf" {
+					return nil
+				}
+				if tfhd := findChildBox(traf, "tfhd"); len(tfhd) >= 4 && tfhd[3]&0x01 != 0 {
+					return fmt.Errorf("fragment uses an absolute base data offset")
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		pos += header.size
+	}
+	return nil
+}
+
+// updateM4ATags rewrites the ilst atom of an MP4 file with edit applied to
+// its items. The file is written next to the original and renamed over it,
+// so a failure leaves the original untouched.
+func updateM4ATags(filePath string, edit func(items *m4aItemList)) error {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open M4A file: %w", err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := info.Size()
+
+	moovHeader, found, err := findAtomInRange(in, 0, fileSize, "moov", fileSize)
+	if err != nil {
+		return fmt.Errorf("failed to find moov atom: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("moov atom not found")
+	}
+	moov, err := readAtomBody(in, moovHeader)
+	if err != nil {
+		return err
+	}
+
+	items, err := readM4AItems(moov)
+	if err != nil {
+		return err
+	}
+	edit(items)
+
+	newMoov, err := withM4AItems(moov, items)
+	if err != nil {
+		return err
+	}
+	moovEnd := moovHeader.offset + moovHeader.size
+	delta := int64(len(newMoov)+8) - moovHeader.size
+	if delta != 0 && moovEnd < fileSize {
+		if err := checkFragmentOffsets(in, moovEnd, fileSize); err != nil {
+			return fmt.Errorf("cannot move media data: %w", err)
+		}
+		if err := shiftChunkOffsets(newMoov, moovEnd, delta); err != nil {
+			return err
+		}
+	}
+	moovBox := buildMP4Box("moov", newMoov)
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tags-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = io.Copy(tmp, io.NewSectionReader(in, 0, moovHeader.offset))
+	if err == nil {
+		_, err = tmp.Write(moovBox)
+	}
+	if err == nil {
+		_, err = io.Copy(tmp, io.NewSectionReader(in, moovEnd, fileSize-moovEnd))
+	}
+	if err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write M4A file: %w", err)
+	}
+	in.Close()
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("failed to replace M4A file: %w", err)
+	}
+	return nil
+}
+
+// embedM4AMetadata writes metadata to an MP4 file. Like the FLAC writer it
+// only replaces tags for which metadata has a value, and keeps the existing
+// cover when coverData is empty.
+func embedM4AMetadata(filePath string, metadata Metadata, coverData []byte) error {
+	err := updateM4ATags(filePath, func(items *m4aItemList) {
+		items.setText(m4aAtomTitle, metadata.Title)
+		items.setText(m4aAtomArtist, metadata.Artist)
+		items.setText(m4aAtomAlbum, metadata.Album)
+		items.setText(m4aAtomAlbumArtist, metadata.AlbumArtist)
+		items.setText(m4aAtomDate, metadata.Date)
+		items.setNumberPair(m4aAtomTrack, metadata.TrackNumber, metadata.TotalTracks)
+		items.setNumberPair(m4aAtomDisc, metadata.DiscNumber, 0)
+		items.setFreeform(m4aFreeformISRC, metadata.ISRC)
+		items.setText(m4aAtomDescription, metadata.Description)
+		items.setText(m4aAtomLyrics, metadata.Lyrics)
+		items.setText(m4aAtomGenre, metadata.Genre)
+		items.setFreeform(m4aFreeformLabel, metadata.Label)
+		items.setText(m4aAtomCopyright, metadata.Copyright)
+		items.setText(m4aAtomComposer, metadata.Composer)
+		items.setText(m4aAtomComment, metadata.Comment)
+		for _, tag := range metadata.Provenance.tags() {
+			items.setFreeform(tag[0], tag[1])
+		}
+		items.setFreeform("ARTISTS", creditNames(metadata.ArtistCredits, ArtistRoleMain, ArtistRoleFeatured)...)
+		items.setText(m4aAtomComposer, strings.Join(creditNames(metadata.ArtistCredits, ArtistRoleComposer), ", "))
+		for _, tag := range metadata.MusicBrainz.tags() {
+			items.setFreeform(tag.name, tag.values...)
+		}
+		items.setCover(coverData)
+	})
+	if err != nil {
+		return err
+	}
+	if len(coverData) > 0 {
+		fmt.Printf("[Metadata] Cover art embedded successfully (%d bytes)\n", len(coverData))
+	}
+	return nil
+}
+
+// readM4ATags reads the iTunes-style tags of an MP4 file.
+func readM4ATags(filePath string) (*AudioMetadata, error) {
+	items, err := readM4AFileItems(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &AudioMetadata{
+		Title:       items.text(m4aAtomTitle),
+		Artist:      items.text(m4aAtomArtist),
+		Album:       items.text(m4aAtomAlbum),
+		AlbumArtist: items.text(m4aAtomAlbumArtist),
+		Genre:       items.text(m4aAtomGenre),
+		Date:        items.text(m4aAtomDate),
+		ISRC:        items.text(m4aFreeformKey(m4aFreeformMean, m4aFreeformISRC)),
+		Lyrics:      items.text(m4aAtomLyrics),
+		Label:       items.text(m4aFreeformKey(m4aFreeformMean, m4aFreeformLabel)),
+		Copyright:   items.text(m4aAtomCopyright),
+		Composer:    items.text(m4aAtomComposer),
+		Comment:     items.text(m4aAtomComment),
+	}
+	metadata.TrackNumber, _ = items.numberPair(m4aAtomTrack)
+	metadata.DiscNumber, _ = items.numberPair(m4aAtomDisc)
+	if len(metadata.Date) >= 4 {
+		if _, err := strconv.Atoi(metadata.Date[:4]); err == nil {
+			metadata.Year = metadata.Date[:4]
+		}
+	}
+	for _, item := range items.items {
+		prefix := m4aAtomFreeform + ":" + m4aFreeformMean + ":"
+		if name, ok := strings.CutPrefix(item.key, prefix); ok {
+			setProvenanceTag(&metadata.Provenance, name, items.text(item.key))
+		}
+	}
+	return metadata, nil
+}
+
+// readM4AFileItems returns the ilst items of an MP4 file.
+func readM4AFileItems(filePath string) (*m4aItemList, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	moovHeader, found, err := findAtomInRange(f, 0, info.Size(), "moov", info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to find moov atom: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("moov atom not found")
+	}
+	moov, err := readAtomBody(f, moovHeader)
+	if err != nil {
+		return nil, err
+	}
+	return readM4AItems(moov)
+}
+
+// extractM4ACoverArt returns the covr image of an MP4 file and its MIME type.
+func extractM4ACoverArt(filePath string) ([]byte, string, error) {
+	items, err := readM4AFileItems(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	box := items.get(m4aAtomCover)
+	if box == nil {
+		return nil, "", fmt.Errorf("no cover art found")
+	}
+	data := m4aItemData(box[8:])
+	if len(data) == 0 {
+		return nil, "", fmt.Errorf("no cover art found")
+	}
+	return data, detectCoverMIME("", data), nil
+}
@@ -0,0 +1,162 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testM4APayload = []byte("AUDIO-SAMPLES")
+
+// writeTestM4A writes ftyp, a moov whose stco points at the payload, and the
+// mdat holding it. extra is appended to moov, e.g. an existing udta.
+func writeTestM4A(t *testing.T, dir string, extra ...[]byte) string {
+	t.Helper()
+	ftyp := testMP4Box("ftyp", []byte("M4A "), testBE32(0), []byte("M4A isom"))
+
+	build := func(chunkOffset uint32) []byte {
+		stco := testMP4Box("stco", testBE32(0, 1, chunkOffset))
+		trak := testMP4Box("trak", testMP4Box("mdia", testMP4Box("minf", testMP4Box("stbl", stco))))
+		return testMP4Box("moov", append([][]byte{trak}, extra...)...)
+	}
+	moov := build(0)
+	offset := uint32(len(ftyp) + len(moov) + 8)
+	data := bytes.Join([][]byte{ftyp, build(offset), testMP4Box("mdat", testM4APayload)}, nil)
+
+	path := filepath.Join(dir, "song.m4a")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write test M4A: %v", err)
+	}
+	return path
+}
+
+// readTestChunkOffset returns the first stco entry and the bytes it points at.
+func readTestChunkOffset(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read M4A: %v", err)
+	}
+	var moov []byte
+	eachChildBox(data, func(typ string, body []byte) error {
+		if typ == "moov" {
+			moov = body
+		}
+		return nil
+	})
+	stco := findChildBox(moov, "trak", "mdia", "minf", "stbl", "stco")
+	if len(stco) < 12 {
+		t.Fatalf("stco not found")
+	}
+	offset := int(binary.BigEndian.Uint32(stco[8:12]))
+	if offset+len(testM4APayload) > len(data) {
+		t.Fatalf("chunk offset %d out of range", offset)
+	}
+	return data[offset : offset+len(testM4APayload)]
+}
+
+func TestEmbedM4AMetadataRoundTrip(t *testing.T) {
+	path := writeTestM4A(t, t.TempDir())
+	cover := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, make([]byte, 32)...)
+
+	metadata := Metadata{
+		Title:       "Song",
+		Artist:      "Artist",
+		Album:       "Album",
+		AlbumArtist: "Album Artist",
+		Date:        "2021-05-04",
+		TrackNumber: 3,
+		TotalTracks: 12,
+		DiscNumber:  2,
+		ISRC:        "USRC17607839",
+		Genre:       "Pop",
+		Label:       "Label",
+		Lyrics:      "[00:01.00]Hello",
+		Provenance:  &Provenance{Source: "tidal", SourceTrackID: "42"},
+	}
+	if err := EmbedMetadataWithCoverData(path, metadata, cover); err != nil {
+		t.Fatalf("EmbedMetadataWithCoverData: %v", err)
+	}
+
+	if got := readTestChunkOffset(t, path); !bytes.Equal(got, testM4APayload) {
+		t.Fatalf("chunk offset no longer points at audio data: %q", got)
+	}
+
+	read, err := readM4ATags(path)
+	if err != nil {
+		t.Fatalf("readM4ATags: %v", err)
+	}
+	if read.Title != "Song" || read.Artist != "Artist" || read.Album != "Album" ||
+		read.AlbumArtist != "Album Artist" || read.Date != "2021-05-04" || read.Year != "2021" ||
+		read.TrackNumber != 3 || read.DiscNumber != 2 || read.ISRC != "USRC17607839" ||
+		read.Genre != "Pop" || read.Label != "Label" || read.Lyrics != "[00:01.00]Hello" {
+		t.Fatalf("unexpected tags: %+v", read)
+	}
+	if read.Provenance == nil || read.Provenance.Source != "tidal" || read.Provenance.SourceTrackID != "42" {
+		t.Fatalf("unexpected provenance: %+v", read.Provenance)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !bytes.Contains(data, cover) {
+		t.Fatal("expected cover to be embedded")
+	}
+}
+
+func TestEmbedM4AMetadataMergesWithExistingTags(t *testing.T) {
+	custom := testMP4Box("tmpo", testMP4Box("data", testBE32(21, 0), []byte{0, 120}))
+	existing := testMP4Box("udta", testMP4Box("meta", testBE32(0),
+		testMP4Box("hdlr", make([]byte, 25)),
+		testMP4Box("ilst",
+			testMP4Box(m4aAtomTitle, testMP4Box("data", testBE32(1, 0), []byte("Old Title"))),
+			custom,
+		)))
+	path := writeTestM4A(t, t.TempDir(), existing)
+
+	if err := EmbedGenreLabel(path, "Jazz", ""); err != nil {
+		t.Fatalf("EmbedGenreLabel: %v", err)
+	}
+	if err := EmbedLyrics(path, "plain lyrics"); err != nil {
+		t.Fatalf("EmbedLyrics: %v", err)
+	}
+
+	read, err := readM4ATags(path)
+	if err != nil {
+		t.Fatalf("readM4ATags: %v", err)
+	}
+	if read.Title != "Old Title" || read.Genre != "Jazz" || read.Lyrics != "plain lyrics" {
+		t.Fatalf("unexpected tags: %+v", read)
+	}
+	data, _ := os.ReadFile(path)
+	if !bytes.Contains(data, custom) {
+		t.Fatal("expected unknown ilst item to be kept")
+	}
+	if got := readTestChunkOffset(t, path); !bytes.Equal(got, testM4APayload) {
+		t.Fatalf("chunk offset no longer points at audio data: %q", got)
+	}
+}
+
+func TestEmbedM4AMetadataRejectsAbsoluteFragmentOffsets(t *testing.T) {
+	dir := t.TempDir()
+	tfhd := testMP4Box("tfhd", testBE32(0x000001, 1), make([]byte, 8))
+	moof := testMP4Box("moof", testMP4Box("traf", tfhd))
+	data := bytes.Join([][]byte{
+		testMP4Box("ftyp", []byte("iso6")),
+		testMP4Box("moov", testMP4Box("mvex")),
+		moof,
+		testMP4Box("mdat", testM4APayload),
+	}, nil)
+	path := filepath.Join(dir, "frag.m4a")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write test M4A: %v", err)
+	}
+
+	if err := EmbedMetadata(path, Metadata{Title: "Song"}, ""); err == nil {
+		t.Fatal("expected fragmented file with absolute offsets to be rejected")
+	}
+	after, _ := os.ReadFile(path)
+	if !bytes.Equal(after, data) {
+		t.Fatal("expected rejected file to be left untouched")
+	}
+}
@@ -112,9 +112,31 @@ type Metadata struct {
 	Copyright   string
 	Composer    string
 	Comment     string
+	Provenance  *Provenance
+	MusicBrainz *MusicBrainzIDs
+
+	ArtistCredits []ArtistCredit
 }
 
 func EmbedMetadata(filePath string, metadata Metadata, coverPath string) error {
+	if isM4AFile(filePath) || isMP3File(filePath) || isOggFile(filePath) {
+		var coverData []byte
+		if coverPath != "" {
+			data, err := os.ReadFile(coverPath)
+			if err != nil {
+				fmt.Printf("[Metadata] Warning: Failed to read cover file %s: %v\n", coverPath, err)
+			}
+			coverData = data
+		}
+		if isMP3File(filePath) {
+			return embedID3Metadata(filePath, metadata, coverData)
+		}
+		if isOggFile(filePath) {
+			return embedOggMetadata(filePath, metadata, coverData)
+		}
+		return embedM4AMetadata(filePath, metadata, coverData)
+	}
+
 	f, err := flac.ParseFile(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to parse FLAC file: %w", err)
@@ -138,56 +160,7 @@ func EmbedMetadata(filePath string, metadata Metadata, coverPath string) error {
 		cmt = flacvorbis.New()
 	}
 
-	setComment(cmt, "TITLE", metadata.Title)
-	setComment(cmt, "ARTIST", metadata.Artist)
-	setComment(cmt, "ALBUM", metadata.Album)
-	setComment(cmt, "ALBUMARTIST", metadata.AlbumArtist)
-	setComment(cmt, "DATE", metadata.Date)
-
-	if metadata.TrackNumber > 0 {
-		if metadata.TotalTracks > 0 {
-			setComment(cmt, "TRACKNUMBER", fmt.Sprintf("%d/%d", metadata.TrackNumber, metadata.TotalTracks))
-		} else {
-			setComment(cmt, "TRACKNUMBER", strconv.Itoa(metadata.TrackNumber))
-		}
-	}
-
-	if metadata.DiscNumber > 0 {
-		setComment(cmt, "DISCNUMBER", strconv.Itoa(metadata.DiscNumber))
-	}
-
-	if metadata.ISRC != "" {
-		setComment(cmt, "ISRC", metadata.ISRC)
-	}
-
-	if metadata.Description != "" {
-		setComment(cmt, "DESCRIPTION", metadata.Description)
-	}
-
-	if metadata.Lyrics != "" {
-		setComment(cmt, "LYRICS", metadata.Lyrics)
-		setComment(cmt, "UNSYNCEDLYRICS", metadata.Lyrics)
-	}
-
-	if metadata.Genre != "" {
-		setComment(cmt, "GENRE", metadata.Genre)
-	}
-
-	if metadata.Label != "" {
-		setComment(cmt, "ORGANIZATION", metadata.Label)
-	}
-
-	if metadata.Copyright != "" {
-		setComment(cmt, "COPYRIGHT", metadata.Copyright)
-	}
-
-	if metadata.Composer != "" {
-		setComment(cmt, "COMPOSER", metadata.Composer)
-	}
-
-	if metadata.Comment != "" {
-		setComment(cmt, "COMMENT", metadata.Comment)
-	}
+	applyVorbisMetadata(cmt, metadata)
 
 	cmtBlock := cmt.Marshal()
 	if cmtIdx >= 0 {
@@ -224,6 +197,16 @@ func EmbedMetadata(filePath string, metadata Metadata, coverPath string) error {
 }
 
 func EmbedMetadataWithCoverData(filePath string, metadata Metadata, coverData []byte) error {
+	if isM4AFile(filePath) {
+		return embedM4AMetadata(filePath, metadata, coverData)
+	}
+	if isMP3File(filePath) {
+		return embedID3Metadata(filePath, metadata, coverData)
+	}
+	if isOggFile(filePath) {
+		return embedOggMetadata(filePath, metadata, coverData)
+	}
+
 	f, err := flac.ParseFile(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to parse FLAC file: %w", err)
@@ -247,56 +230,7 @@ func EmbedMetadataWithCoverData(filePath string, metadata Metadata, coverData []
 		cmt = flacvorbis.New()
 	}
 
-	setComment(cmt, "TITLE", metadata.Title)
-	setComment(cmt, "ARTIST", metadata.Artist)
-	setComment(cmt, "ALBUM", metadata.Album)
-	setComment(cmt, "ALBUMARTIST", metadata.AlbumArtist)
-	setComment(cmt, "DATE", metadata.Date)
-
-	if metadata.TrackNumber > 0 {
-		if metadata.TotalTracks > 0 {
-			setComment(cmt, "TRACKNUMBER", fmt.Sprintf("%d/%d", metadata.TrackNumber, metadata.TotalTracks))
-		} else {
-			setComment(cmt, "TRACKNUMBER", strconv.Itoa(metadata.TrackNumber))
-		}
-	}
-
-	if metadata.DiscNumber > 0 {
-		setComment(cmt, "DISCNUMBER", strconv.Itoa(metadata.DiscNumber))
-	}
-
-	if metadata.ISRC != "" {
-		setComment(cmt, "ISRC", metadata.ISRC)
-	}
-
-	if metadata.Description != "" {
-		setComment(cmt, "DESCRIPTION", metadata.Description)
-	}
-
-	if metadata.Lyrics != "" {
-		setComment(cmt, "LYRICS", metadata.Lyrics)
-		setComment(cmt, "UNSYNCEDLYRICS", metadata.Lyrics)
-	}
-
-	if metadata.Genre != "" {
-		setComment(cmt, "GENRE", metadata.Genre)
-	}
-
-	if metadata.Label != "" {
-		setComment(cmt, "ORGANIZATION", metadata.Label)
-	}
-
-	if metadata.Copyright != "" {
-		setComment(cmt, "COPYRIGHT", metadata.Copyright)
-	}
-
-	if metadata.Composer != "" {
-		setComment(cmt, "COMPOSER", metadata.Composer)
-	}
-
-	if metadata.Comment != "" {
-		setComment(cmt, "COMMENT", metadata.Comment)
-	}
+	applyVorbisMetadata(cmt, metadata)
 
 	cmtBlock := cmt.Marshal()
 	if cmtIdx >= 0 {
@@ -383,6 +317,12 @@ func ReadMetadata(filePath string) (*Metadata, error) {
 			metadata.Composer = getComment(cmt, "COMPOSER")
 			metadata.Comment = getComment(cmt, "COMMENT")
 
+			for _, comment := range cmt.Comments {
+				if key, value, ok := strings.Cut(comment, "="); ok {
+					setProvenanceTag(&metadata.Provenance, key, value)
+				}
+			}
+
 			break
 		}
 	}
@@ -390,6 +330,76 @@ func ReadMetadata(filePath string) (*Metadata, error) {
 	return metadata, nil
 }
 
+// applyVorbisMetadata sets the Vorbis comments for metadata, leaving
+// comments alone where metadata has no value. It is shared by the FLAC and
+// Ogg writers.
+func applyVorbisMetadata(cmt *flacvorbis.MetaDataBlockVorbisComment, metadata Metadata) {
+	setComment(cmt, "TITLE", metadata.Title)
+	setComment(cmt, "ARTIST", metadata.Artist)
+	setComment(cmt, "ALBUM", metadata.Album)
+	setComment(cmt, "ALBUMARTIST", metadata.AlbumArtist)
+	setComment(cmt, "DATE", metadata.Date)
+
+	if metadata.TrackNumber > 0 {
+		if metadata.TotalTracks > 0 {
+			setComment(cmt, "TRACKNUMBER", fmt.Sprintf("%d/%d", metadata.TrackNumber, metadata.TotalTracks))
+		} else {
+			setComment(cmt, "TRACKNUMBER", strconv.Itoa(metadata.TrackNumber))
+		}
+	}
+
+	if metadata.DiscNumber > 0 {
+		setComment(cmt, "DISCNUMBER", strconv.Itoa(metadata.DiscNumber))
+	}
+
+	if metadata.ISRC != "" {
+		setComment(cmt, "ISRC", metadata.ISRC)
+	}
+
+	if metadata.Description != "" {
+		setComment(cmt, "DESCRIPTION", metadata.Description)
+	}
+
+	if metadata.Lyrics != "" {
+		setComment(cmt, "LYRICS", metadata.Lyrics)
+		setComment(cmt, "UNSYNCEDLYRICS", metadata.Lyrics)
+	}
+
+	if metadata.Genre != "" {
+		setComment(cmt, "GENRE", metadata.Genre)
+	}
+
+	if metadata.Label != "" {
+		setComment(cmt, "ORGANIZATION", metadata.Label)
+	}
+
+	if metadata.Copyright != "" {
+		setComment(cmt, "COPYRIGHT", metadata.Copyright)
+	}
+
+	if metadata.Composer != "" {
+		setComment(cmt, "COMPOSER", metadata.Composer)
+	}
+
+	if metadata.Comment != "" {
+		setComment(cmt, "COMMENT", metadata.Comment)
+	}
+
+	for _, tag := range metadata.Provenance.tags() {
+		setComment(cmt, tag[0], tag[1])
+	}
+
+	setCommentValues(cmt, "ARTISTS", creditNames(metadata.ArtistCredits, ArtistRoleMain, ArtistRoleFeatured))
+	setCommentValues(cmt, "COMPOSER", creditNames(metadata.ArtistCredits, ArtistRoleComposer))
+	setCommentValues(cmt, "PERFORMER", performerCredits(metadata.ArtistCredits))
+	setCommentValues(cmt, "PRODUCER", creditNames(metadata.ArtistCredits, ArtistRoleProducer))
+	setCommentValues(cmt, "REMIXER", creditNames(metadata.ArtistCredits, ArtistRoleRemixer))
+
+	for _, tag := range metadata.MusicBrainz.tags() {
+		setCommentValues(cmt, tag.vorbis, tag.values)
+	}
+}
+
 func setComment(cmt *flacvorbis.MetaDataBlockVorbisComment, key, value string) {
 	if value == "" {
 		return
@@ -460,6 +470,23 @@ func ExtractCoverArt(filePath string) ([]byte, error) {
 }
 
 func EmbedLyrics(filePath string, lyrics string) error {
+	if isM4AFile(filePath) {
+		return updateM4ATags(filePath, func(items *m4aItemList) {
+			items.setText(m4aAtomLyrics, lyrics)
+		})
+	}
+	if isMP3File(filePath) {
+		return updateID3Tags(filePath, func(tag *id3Tag) {
+			tag.setLyrics(lyrics)
+		})
+	}
+	if isOggFile(filePath) {
+		return updateOggTags(filePath, func(cmt *flacvorbis.MetaDataBlockVorbisComment) {
+			setComment(cmt, "LYRICS", lyrics)
+			setComment(cmt, "UNSYNCEDLYRICS", lyrics)
+		})
+	}
+
 	f, err := flac.ParseFile(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to parse FLAC file: %w", err)
@@ -501,6 +528,25 @@ func EmbedGenreLabel(filePath string, genre, label string) error {
 		return nil
 	}
 
+	if isM4AFile(filePath) {
+		return updateM4ATags(filePath, func(items *m4aItemList) {
+			items.setText(m4aAtomGenre, genre)
+			items.setFreeform(m4aFreeformLabel, label)
+		})
+	}
+	if isMP3File(filePath) {
+		return updateID3Tags(filePath, func(tag *id3Tag) {
+			tag.setText("TCON", genre)
+			tag.setText("TPUB", label)
+		})
+	}
+	if isOggFile(filePath) {
+		return updateOggTags(filePath, func(cmt *flacvorbis.MetaDataBlockVorbisComment) {
+			setComment(cmt, "GENRE", genre)
+			setComment(cmt, "ORGANIZATION", label)
+		})
+	}
+
 	f, err := flac.ParseFile(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to parse FLAC file: %w", err)
@@ -541,6 +587,50 @@ func EmbedGenreLabel(filePath string, genre, label string) error {
 	return f.Save(filePath)
 }
 
+// embedDownloadTags adds provenance and MusicBrainz IDs to a file that was
+// downloaded without going through EmbedMetadata, such as extension and
+// YouTube downloads. Other tags are left as they are.
+func embedDownloadTags(filePath string, provenance *Provenance, musicBrainz *MusicBrainzIDs) error {
+	provenanceTags := provenance.tags()
+	musicBrainzTags := musicBrainz.tags()
+	if (len(provenanceTags) == 0 && len(musicBrainzTags) == 0) || shouldSkipQualityProbe(filePath) {
+		return nil
+	}
+
+	editVorbis := func(cmt *flacvorbis.MetaDataBlockVorbisComment) {
+		for _, tag := range provenanceTags {
+			setComment(cmt, tag[0], tag[1])
+		}
+		for _, tag := range musicBrainzTags {
+			setCommentValues(cmt, tag.vorbis, tag.values)
+		}
+	}
+
+	switch {
+	case isM4AFile(filePath):
+		return updateM4ATags(filePath, func(items *m4aItemList) {
+			for _, tag := range provenanceTags {
+				items.setFreeform(tag[0], tag[1])
+			}
+			for _, tag := range musicBrainzTags {
+				items.setFreeform(tag.name, tag.values...)
+			}
+		})
+	case isMP3File(filePath):
+		return updateID3Tags(filePath, func(t *id3Tag) {
+			for _, tag := range provenanceTags {
+				t.setUserText(tag[0], tag[1])
+			}
+			t.setMusicBrainzIDs(musicBrainz)
+		})
+	case isOggFile(filePath):
+		return updateOggTags(filePath, editVorbis)
+	case strings.EqualFold(filepath.Ext(filePath), ".flac"):
+		return updateFLACComments(filePath, editVorbis)
+	}
+	return nil
+}
+
 func ExtractLyrics(filePath string) (string, error) {
 	lower := strings.ToLower(filePath)
 
@@ -576,6 +666,14 @@ func ExtractLyrics(filePath string) (string, error) {
 		return "", fmt.Errorf("no lyrics found in file")
 	}
 
+	if isM4AFile(filePath) {
+		meta, err := readM4ATags(filePath)
+		if err != nil || meta == nil || strings.TrimSpace(meta.Lyrics) == "" {
+			return "", fmt.Errorf("no lyrics found in file")
+		}
+		return meta.Lyrics, nil
+	}
+
 	return "", fmt.Errorf("unsupported file format for lyrics extraction")
 }
 
@@ -0,0 +1,459 @@
+package gobackend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metadataAuditWorkers       = 4
+	metadataAuditLookupTimeout = 15 * time.Second
+)
+
+// Audit entry statuses.
+const (
+	AuditStatusOK            = "ok"
+	AuditStatusDiscrepancies = "discrepancies"
+	AuditStatusNoISRC        = "no_isrc"
+	AuditStatusNotFound      = "not_found"
+	AuditStatusError         = "error"
+)
+
+// MetadataAuditRequest lists the files to audit, either as paths whose tags
+// are read or as results of a library scan.
+type MetadataAuditRequest struct {
+	FilePaths []string            `json:"file_paths,omitempty"`
+	Items     []LibraryScanResult `json:"items,omitempty"`
+}
+
+// MetadataAuditDiscrepancy is a field on which a file and the provider
+// disagree. Missing values are empty.
+type MetadataAuditDiscrepancy struct {
+	Field    string `json:"field"`
+	File     string `json:"file"`
+	Provider string `json:"provider"`
+}
+
+// ReEnrichSuggestion is a ReEnrichFile request that fixes the discrepancies
+// of a file, keeping its tags where they agree with the provider.
+type ReEnrichSuggestion struct {
+	FilePath    string `json:"file_path"`
+	SpotifyID   string `json:"spotify_id,omitempty"`
+	TrackName   string `json:"track_name"`
+	ArtistName  string `json:"artist_name"`
+	AlbumName   string `json:"album_name"`
+	AlbumArtist string `json:"album_artist,omitempty"`
+	TrackNumber int    `json:"track_number,omitempty"`
+	DiscNumber  int    `json:"disc_number,omitempty"`
+	ReleaseDate string `json:"release_date,omitempty"`
+	ISRC        string `json:"isrc"`
+	Genre       string `json:"genre,omitempty"`
+	DurationMs  int64  `json:"duration_ms,omitempty"`
+	CoverURL    string `json:"cover_url,omitempty"`
+	EmbedLyrics bool   `json:"embed_lyrics,omitempty"`
+
+	ArtistCredits []ArtistCredit `json:"artist_credits,omitempty"`
+}
+
+type MetadataAuditEntry struct {
+	FilePath      string                     `json:"file_path"`
+	ISRC          string                     `json:"isrc,omitempty"`
+	Status        string                     `json:"status"`
+	Source        string                     `json:"source,omitempty"`
+	Error         string                     `json:"error,omitempty"`
+	Discrepancies []MetadataAuditDiscrepancy `json:"discrepancies,omitempty"`
+	Suggestion    *ReEnrichSuggestion        `json:"reenrich_request,omitempty"`
+
+	// MissingLyrics reports a file without embedded lyrics. Providers do not
+	// say whether a track has lyrics, so it is not a discrepancy.
+	MissingLyrics bool `json:"missing_lyrics,omitempty"`
+}
+
+type MetadataAuditSummary struct {
+	Total         int `json:"total"`
+	OK            int `json:"ok"`
+	Discrepancies int `json:"discrepancies"`
+	NoISRC        int `json:"no_isrc"`
+	NotFound      int `json:"not_found"`
+	Errors        int `json:"errors"`
+}
+
+type MetadataAuditReport struct {
+	Entries []MetadataAuditEntry `json:"entries"`
+	Summary MetadataAuditSummary `json:"summary"`
+}
+
+// auditLocalTrack is what a file says about itself.
+type auditLocalTrack struct {
+	path        string
+	title       string
+	artist      string
+	album       string
+	albumArtist string
+	date        string
+	isrc        string
+	genre       string
+	trackNumber int
+	discNumber  int
+	hasLyrics   bool
+	// hasCover is only meaningful when coverKnown; embedded covers cannot
+	// be read from every format.
+	hasCover   bool
+	coverKnown bool
+}
+
+func auditLocalFromFile(path string) (*auditLocalTrack, error) {
+	metadata := readExistingTags(path)
+	if metadata == nil {
+		return nil, fmt.Errorf("unsupported or unreadable file")
+	}
+	local := &auditLocalTrack{
+		path:        path,
+		title:       metadata.Title,
+		artist:      metadata.Artist,
+		album:       metadata.Album,
+		albumArtist: metadata.AlbumArtist,
+		date:        metadata.Date,
+		isrc:        metadata.ISRC,
+		genre:       metadata.Genre,
+		trackNumber: metadata.TrackNumber,
+		discNumber:  metadata.DiscNumber,
+		hasLyrics:   strings.TrimSpace(metadata.Lyrics) != "",
+	}
+	local.probeCover()
+	return local, nil
+}
+
+// auditLocalFromScan takes the tags from a scan result, which lacks lyrics
+// and cover, so those are still read from the file.
+func auditLocalFromScan(item LibraryScanResult) *auditLocalTrack {
+	local := &auditLocalTrack{
+		path:        item.FilePath,
+		title:       item.TrackName,
+		artist:      item.ArtistName,
+		album:       item.AlbumName,
+		albumArtist: item.AlbumArtist,
+		date:        item.ReleaseDate,
+		isrc:        item.ISRC,
+		genre:       item.Genre,
+		trackNumber: item.TrackNumber,
+		discNumber:  item.DiscNumber,
+	}
+	if metadata := readExistingTags(item.FilePath); metadata != nil {
+		local.hasLyrics = strings.TrimSpace(metadata.Lyrics) != ""
+	}
+	local.probeCover()
+	return local
+}
+
+func (l *auditLocalTrack) probeCover() {
+	if isM4AFile(l.path) {
+		return
+	}
+	data, _, err := extractAnyCoverArt(l.path)
+	l.coverKnown = true
+	l.hasCover = err == nil && len(data) > 0
+}
+
+// lookupAuditTrack is swapped out in tests.
+var lookupAuditTrack = lookupTrackByISRC
+
+// lookupTrackByISRC finds a track on the metadata providers in the order
+// ReEnrichFile searches them: Deezer, extensions, then Spotify. SpotifyID
+// of the result is the ID ReEnrichFile takes, and the source names the
+// provider.
+func lookupTrackByISRC(isrc string) (*TrackMetadata, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), metadataAuditLookupTimeout)
+	track, err := GetDeezerClient().SearchByISRC(ctx, isrc)
+	cancel()
+	if err == nil && track != nil {
+		found := *track
+		found.SpotifyID = "deezer:" + track.SpotifyID
+		return &found, "deezer", nil
+	}
+
+	extTracks, _ := GetExtensionManager().SearchTracksWithExtensions("isrc:"+isrc, 5)
+	for _, ext := range extTracks {
+		if !strings.EqualFold(ext.ISRC, isrc) {
+			continue
+		}
+		id := ext.ID
+		if ext.SpotifyID != "" {
+			id = ext.SpotifyID
+		} else if ext.DeezerID != "" {
+			id = "deezer:" + ext.DeezerID
+		}
+		return &TrackMetadata{
+			SpotifyID:     id,
+			Artists:       ext.Artists,
+			Name:          ext.Name,
+			AlbumName:     ext.AlbumName,
+			AlbumArtist:   ext.AlbumArtist,
+			DurationMS:    ext.DurationMS,
+			Images:        ext.ResolvedCoverURL(),
+			ReleaseDate:   ext.ReleaseDate,
+			TrackNumber:   ext.TrackNumber,
+			DiscNumber:    ext.DiscNumber,
+			ISRC:          ext.ISRC,
+			ArtistCredits: ext.ArtistCredits,
+		}, ext.ProviderID, nil
+	}
+
+	spotifyClient, spotifyErr := NewSpotifyMetadataClient()
+	if spotifyErr == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), metadataAuditLookupTimeout)
+		results, err := spotifyClient.SearchTracks(ctx, "isrc:"+isrc, 1)
+		cancel()
+		if err == nil && len(results.Tracks) > 0 {
+			return &results.Tracks[0], "spotify", nil
+		}
+	}
+	return nil, "", fmt.Errorf("no provider has ISRC %s", isrc)
+}
+
+// auditText folds case and whitespace, which tagging tools disagree on.
+func auditText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// auditArtistsMatch compares the sets of artists, ignoring their order and
+// how they are joined. With credits, the file's artists must be exactly the
+// credited names, so that commas inside names do not split them.
+func auditArtistsMatch(local, provider string, credits []ArtistCredit) bool {
+	local = auditText(local)
+	if local == auditText(provider) {
+		return true
+	}
+
+	if names := creditNames(credits, ArtistRoleMain, ArtistRoleFeatured); len(names) > 0 {
+		for _, name := range names {
+			name = auditText(name)
+			if !strings.Contains(local, name) {
+				return false
+			}
+			local = strings.Replace(local, name, "", 1)
+		}
+		for _, word := range strings.Fields(local) {
+			if !auditArtistSeparators[strings.Trim(word, ",;&/")] {
+				return false
+			}
+		}
+		return true
+	}
+
+	localArtists := splitArtists(strings.ReplaceAll(local, ";", ","))
+	providerArtists := splitArtists(auditText(provider))
+	if len(localArtists) != len(providerArtists) {
+		return false
+	}
+	seen := make(map[string]bool, len(localArtists))
+	for _, artist := range localArtists {
+		seen[artist] = true
+	}
+	for _, artist := range providerArtists {
+		if !seen[artist] {
+			return false
+		}
+	}
+	return true
+}
+
+// auditArtistSeparators are the words left between artist names once the
+// names are taken out, with punctuation trimmed.
+var auditArtistSeparators = map[string]bool{
+	"": true, "feat.": true, "feat": true, "ft.": true, "ft": true, "featuring": true, "with": true, "and": true, "x": true,
+}
+
+// auditDatesMatch treats a year as matching a full date within it.
+func auditDatesMatch(local, provider string) bool {
+	local, provider = strings.TrimSpace(local), strings.TrimSpace(provider)
+	return local != "" && (strings.HasPrefix(provider, local) || strings.HasPrefix(local, provider))
+}
+
+// compareAuditTrack lists where the file disagrees with the provider's
+// track and builds the ReEnrichFile request fixing it. The provider's
+// values go through the configured tag rules first, as ReEnrichFile would
+// rewrite them anyway.
+func compareAuditTrack(local *auditLocalTrack, provider TrackMetadata) ([]MetadataAuditDiscrepancy, *ReEnrichSuggestion) {
+	tagRuleTargets{
+		Title:       &provider.Name,
+		Artist:      &provider.Artists,
+		Album:       &provider.AlbumName,
+		AlbumArtist: &provider.AlbumArtist,
+		Date:        &provider.ReleaseDate,
+	}.apply()
+
+	suggestion := &ReEnrichSuggestion{
+		FilePath:      local.path,
+		SpotifyID:     provider.SpotifyID,
+		TrackName:     local.title,
+		ArtistName:    local.artist,
+		AlbumName:     local.album,
+		AlbumArtist:   local.albumArtist,
+		TrackNumber:   local.trackNumber,
+		DiscNumber:    local.discNumber,
+		ReleaseDate:   local.date,
+		ISRC:          firstNonEmpty(local.isrc, provider.ISRC),
+		Genre:         local.genre,
+		DurationMs:    int64(provider.DurationMS),
+		ArtistCredits: provider.ArtistCredits,
+	}
+
+	var discrepancies []MetadataAuditDiscrepancy
+	report := func(field, file, fromProvider string) {
+		discrepancies = append(discrepancies, MetadataAuditDiscrepancy{Field: field, File: file, Provider: fromProvider})
+	}
+	if provider.Name != "" && auditText(local.title) != auditText(provider.Name) {
+		report("title", local.title, provider.Name)
+		suggestion.TrackName = provider.Name
+	}
+	if provider.Artists != "" && !auditArtistsMatch(local.artist, provider.Artists, provider.ArtistCredits) {
+		report("artist", local.artist, provider.Artists)
+		suggestion.ArtistName = provider.Artists
+	}
+	if provider.AlbumName != "" && auditText(local.album) != auditText(provider.AlbumName) {
+		report("album", local.album, provider.AlbumName)
+		suggestion.AlbumName = provider.AlbumName
+		suggestion.AlbumArtist = firstNonEmpty(provider.AlbumArtist, local.albumArtist)
+	}
+	if provider.TrackNumber > 0 && local.trackNumber != provider.TrackNumber {
+		file := ""
+		if local.trackNumber > 0 {
+			file = fmt.Sprintf("%d", local.trackNumber)
+		}
+		report("track_number", file, fmt.Sprintf("%d", provider.TrackNumber))
+		suggestion.TrackNumber = provider.TrackNumber
+		if provider.DiscNumber > 0 {
+			suggestion.DiscNumber = provider.DiscNumber
+		}
+	}
+	if provider.ReleaseDate != "" && !auditDatesMatch(local.date, provider.ReleaseDate) {
+		report("release_date", local.date, provider.ReleaseDate)
+		suggestion.ReleaseDate = provider.ReleaseDate
+	}
+	if local.coverKnown && !local.hasCover && provider.Images != "" {
+		report("cover", "", "available")
+		suggestion.CoverURL = provider.Images
+	}
+
+	if len(discrepancies) == 0 {
+		return nil, nil
+	}
+	// Re-enriching the file anyway is a chance to fetch its lyrics.
+	suggestion.EmbedLyrics = !local.hasLyrics
+	return discrepancies, suggestion
+}
+
+// auditTrack audits one file, sharing provider lookups through cache so
+// that files with the same ISRC are only looked up once.
+func auditTrack(local *auditLocalTrack, cache *auditLookupCache) MetadataAuditEntry {
+	entry := MetadataAuditEntry{
+		FilePath:      local.path,
+		ISRC:          strings.ToUpper(strings.TrimSpace(local.isrc)),
+		MissingLyrics: !local.hasLyrics,
+	}
+	if entry.ISRC == "" {
+		entry.Status = AuditStatusNoISRC
+		return entry
+	}
+
+	result := cache.lookup(entry.ISRC)
+	if result.err != nil {
+		entry.Status = AuditStatusNotFound
+		entry.Error = result.err.Error()
+		return entry
+	}
+	entry.Source = result.source
+	entry.Discrepancies, entry.Suggestion = compareAuditTrack(local, *result.track)
+	entry.Status = AuditStatusOK
+	if len(entry.Discrepancies) > 0 {
+		entry.Status = AuditStatusDiscrepancies
+	}
+	return entry
+}
+
+type auditLookupResult struct {
+	track  *TrackMetadata
+	source string
+	err    error
+}
+
+type auditLookupCache struct {
+	mu      sync.Mutex
+	results map[string]func() auditLookupResult
+}
+
+func (c *auditLookupCache) lookup(isrc string) auditLookupResult {
+	c.mu.Lock()
+	get, ok := c.results[isrc]
+	if !ok {
+		get = sync.OnceValue(func() auditLookupResult {
+			track, source, err := lookupAuditTrack(isrc)
+			return auditLookupResult{track: track, source: source, err: err}
+		})
+		c.results[isrc] = get
+	}
+	c.mu.Unlock()
+	return get()
+}
+
+// AuditLibraryMetadata looks up every file of the request by ISRC on the
+// metadata providers and reports where its tags disagree with them, with a
+// ReEnrichFile request fixing each file that does.
+func AuditLibraryMetadata(req MetadataAuditRequest) *MetadataAuditReport {
+	type auditInput struct {
+		path string
+		read func() (*auditLocalTrack, error)
+	}
+	var inputs []auditInput
+	for _, path := range req.FilePaths {
+		inputs = append(inputs, auditInput{path, func() (*auditLocalTrack, error) { return auditLocalFromFile(path) }})
+	}
+	for _, item := range req.Items {
+		inputs = append(inputs, auditInput{item.FilePath, func() (*auditLocalTrack, error) { return auditLocalFromScan(item), nil }})
+	}
+
+	entries := make([]MetadataAuditEntry, len(inputs))
+	cache := &auditLookupCache{results: make(map[string]func() auditLookupResult)}
+	sem := make(chan struct{}, metadataAuditWorkers)
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			local, err := input.read()
+			if err != nil {
+				entries[i] = MetadataAuditEntry{FilePath: input.path, Status: AuditStatusError, Error: err.Error()}
+				return
+			}
+			entries[i] = auditTrack(local, cache)
+		}()
+	}
+	wg.Wait()
+
+	report := &MetadataAuditReport{Entries: entries}
+	report.Summary.Total = len(entries)
+	for _, entry := range entries {
+		switch entry.Status {
+		case AuditStatusOK:
+			report.Summary.OK++
+		case AuditStatusDiscrepancies:
+			report.Summary.Discrepancies++
+		case AuditStatusNoISRC:
+			report.Summary.NoISRC++
+		case AuditStatusNotFound:
+			report.Summary.NotFound++
+		case AuditStatusError:
+			report.Summary.Errors++
+		}
+	}
+	GoLog("[Audit] Audited %d files: %d ok, %d with discrepancies, %d without ISRC, %d not found, %d errors\n",
+		report.Summary.Total, report.Summary.OK, report.Summary.Discrepancies,
+		report.Summary.NoISRC, report.Summary.NotFound, report.Summary.Errors)
+	return report
+}
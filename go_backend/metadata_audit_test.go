@@ -0,0 +1,103 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAuditLibraryMetadata(t *testing.T) {
+	var lookups atomic.Int32
+	lookupAuditTrack = func(isrc string) (*TrackMetadata, string, error) {
+		lookups.Add(1)
+		if isrc != "USRC17607839" {
+			return nil, "", fmt.Errorf("no provider has ISRC %s", isrc)
+		}
+		return &TrackMetadata{
+			SpotifyID:   "deezer:123",
+			Name:        "Song",
+			Artists:     "Tyler, The Creator, Kali Uchis",
+			AlbumName:   "The Album",
+			AlbumArtist: "Tyler, The Creator",
+			ReleaseDate: "2019-05-01",
+			TrackNumber: 4,
+			DiscNumber:  1,
+			Images:      "https://example.com/cover.jpg",
+			ISRC:        "USRC17607839",
+			DurationMS:  180000,
+			ArtistCredits: []ArtistCredit{
+				{Name: "Tyler, The Creator", Role: ArtistRoleMain},
+				{Name: "Kali Uchis", Role: ArtistRoleFeatured},
+			},
+		}, "deezer", nil
+	}
+	t.Cleanup(func() { lookupAuditTrack = lookupTrackByISRC })
+
+	dir := t.TempDir()
+	good := writeTestFLAC(t, dir, "good.flac", 44100, 16)
+	if err := EmbedMetadata(good, Metadata{
+		Title: "song", Artist: "Kali Uchis; Tyler, The Creator", Album: "The Album",
+		Date: "2019", TrackNumber: 4, ISRC: "usrc17607839", Lyrics: "[00:01.00]la",
+	}, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+	if err := EmbedMetadataWithCoverData(good, Metadata{}, []byte("\xff\xd8\xff\xe0cover")); err != nil {
+		t.Fatalf("EmbedMetadataWithCoverData: %v", err)
+	}
+	// Lyrics are only reported, as the provider cannot say there are any.
+	noLyrics := writeTestFLAC(t, dir, "no_lyrics.flac", 44100, 16)
+	if err := EmbedMetadata(noLyrics, Metadata{
+		Title: "Song", Artist: "Tyler, The Creator; Kali Uchis", Album: "The Album",
+		Date: "2019-05-01", TrackNumber: 4, ISRC: "USRC17607839",
+	}, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+	if err := EmbedMetadataWithCoverData(noLyrics, Metadata{}, []byte("\xff\xd8\xff\xe0cover")); err != nil {
+		t.Fatalf("EmbedMetadataWithCoverData: %v", err)
+	}
+	bad := writeTestFLAC(t, dir, "bad.flac", 44100, 16)
+	if err := EmbedMetadata(bad, Metadata{Title: "Song (Live)", Artist: "Tyler", Album: "The Album", Date: "2018", TrackNumber: 2, ISRC: "USRC17607839", Genre: "Hip-Hop"}, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+
+	report := AuditLibraryMetadata(MetadataAuditRequest{
+		FilePaths: []string{good, noLyrics, bad},
+		Items: []LibraryScanResult{
+			{FilePath: bad, TrackName: "Untagged"},
+			{FilePath: bad, TrackName: "Song", ISRC: "GBAAA0000001"},
+		},
+	})
+	if lookups.Load() != 2 {
+		t.Fatalf("expected one lookup per ISRC, got %d", lookups.Load())
+	}
+	want := MetadataAuditSummary{Total: 5, OK: 2, Discrepancies: 1, NoISRC: 1, NotFound: 1}
+	if report.Summary != want {
+		t.Fatalf("unexpected summary: %+v", report.Summary)
+	}
+	if entry := report.Entries[0]; entry.Status != AuditStatusOK || entry.Suggestion != nil || entry.MissingLyrics {
+		t.Fatalf("expected the good file to pass: %+v", entry)
+	}
+	if entry := report.Entries[1]; entry.Status != AuditStatusOK || entry.Suggestion != nil || !entry.MissingLyrics {
+		t.Fatalf("expected the file without lyrics to pass and be flagged: %+v", entry)
+	}
+
+	entry := report.Entries[2]
+	var fields []string
+	for _, d := range entry.Discrepancies {
+		fields = append(fields, d.Field)
+	}
+	if fmt.Sprint(fields) != "[title artist track_number release_date cover]" || !entry.MissingLyrics || entry.Source != "deezer" {
+		t.Fatalf("unexpected discrepancies: %+v", entry)
+	}
+
+	// The suggestion feeds ReEnrichFile's request as is.
+	data, _ := json.Marshal(entry.Suggestion)
+	var request map[string]interface{}
+	json.Unmarshal(data, &request)
+	if request["file_path"] != bad || request["track_name"] != "Song" || request["album_name"] != "The Album" ||
+		request["track_number"] != float64(4) || request["release_date"] != "2019-05-01" || request["genre"] != "Hip-Hop" ||
+		request["cover_url"] != "https://example.com/cover.jpg" || request["embed_lyrics"] != true || request["spotify_id"] != "deezer:123" {
+		t.Fatalf("unexpected suggestion: %s", data)
+	}
+}
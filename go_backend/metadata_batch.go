@@ -0,0 +1,797 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-flac/flacvorbis/v2"
+	"github.com/go-flac/go-flac/v2"
+)
+
+// Batch edit operations.
+const (
+	// BatchEditSet sets the field to value.
+	BatchEditSet = "set"
+	// BatchEditClear removes the field from the file.
+	BatchEditClear = "clear"
+	// BatchEditReplace replaces find in the field with value, or matches of
+	// find when regex is set.
+	BatchEditReplace = "replace"
+	// BatchEditRenumber numbers the files from start in the order given.
+	BatchEditRenumber = "renumber"
+	// BatchEditCopyCover embeds the cover of source_file, an audio or image
+	// file, in every file.
+	BatchEditCopyCover = "copy_cover"
+)
+
+const (
+	metadataJournalFileName = "journal.json"
+	// metadataJournalKeep is how many batch edits can be undone.
+	metadataJournalKeep = 5
+)
+
+// batchEditField maps an editable field to the tags that hold it in each
+// format. ID3 entries of the form "TXXX:NAME" are user text frames.
+type batchEditField struct {
+	name   string
+	vorbis []string
+	id3    []string
+	m4a    []string
+}
+
+var batchEditFields = []batchEditField{
+	{"title", []string{"TITLE"}, []string{"TIT2"}, []string{m4aAtomTitle}},
+	{"artist", []string{"ARTIST"}, []string{"TPE1"}, []string{m4aAtomArtist}},
+	{"album", []string{"ALBUM"}, []string{"TALB"}, []string{m4aAtomAlbum}},
+	{"album_artist", []string{"ALBUMARTIST"}, []string{"TPE2"}, []string{m4aAtomAlbumArtist}},
+	{"date", []string{"DATE", "YEAR"}, []string{"TDRC", "TYER"}, []string{m4aAtomDate}},
+	{"track_number", []string{"TRACKNUMBER", "TRACK"}, []string{"TRCK"}, []string{m4aAtomTrack}},
+	{"disc_number", []string{"DISCNUMBER", "DISC"}, []string{"TPOS"}, []string{m4aAtomDisc}},
+	{"isrc", []string{"ISRC"}, []string{"TSRC", "TXXX:ISRC"}, []string{m4aFreeformKey(m4aFreeformMean, m4aFreeformISRC)}},
+	{"genre", []string{"GENRE"}, []string{"TCON"}, []string{m4aAtomGenre}},
+	{"label", []string{"ORGANIZATION"}, []string{"TPUB"}, []string{m4aFreeformKey(m4aFreeformMean, m4aFreeformLabel)}},
+	{"copyright", []string{"COPYRIGHT"}, []string{"TCOP"}, []string{m4aAtomCopyright}},
+	{"composer", []string{"COMPOSER"}, []string{"TCOM"}, []string{m4aAtomComposer}},
+	{"comment", []string{"COMMENT"}, []string{"COMM"}, []string{m4aAtomComment}},
+}
+
+func findBatchEditField(name string) *batchEditField {
+	for i := range batchEditFields {
+		if batchEditFields[i].name == name {
+			return &batchEditFields[i]
+		}
+	}
+	return nil
+}
+
+// BatchEditOperation is one edit applied to every file of a batch.
+type BatchEditOperation struct {
+	Op         string `json:"op"`
+	Field      string `json:"field,omitempty"`
+	Value      string `json:"value,omitempty"`
+	Find       string `json:"find,omitempty"`
+	Regex      bool   `json:"regex,omitempty"`
+	Start      int    `json:"start,omitempty"`
+	SourceFile string `json:"source_file,omitempty"`
+}
+
+// BatchEditRequest applies operations, in order, to each of FilePaths.
+type BatchEditRequest struct {
+	FilePaths  []string             `json:"file_paths"`
+	Operations []BatchEditOperation `json:"operations"`
+	DryRun     bool                 `json:"dry_run,omitempty"`
+}
+
+// BatchEditChange is a field whose value an edit changes. Cleared fields
+// have an empty New; the cover is shown by its size.
+type BatchEditChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type BatchEditFileResult struct {
+	Path    string            `json:"path"`
+	Changes []BatchEditChange `json:"changes"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// BatchEditResult is the diff of a batch edit. JournalID is set once the
+// edit is applied and undoes it.
+type BatchEditResult struct {
+	DryRun    bool                  `json:"dry_run"`
+	JournalID string                `json:"journal_id,omitempty"`
+	Files     []BatchEditFileResult `json:"files"`
+}
+
+// metadataEditJournal records what a batch edit changes, so it can be
+// undone by writing the old values back. It is written before the first
+// file is edited and committed once every file is; a journal left
+// uncommitted belongs to an edit that was interrupted and is rolled back.
+type metadataEditJournal struct {
+	ID        string                    `json:"id"`
+	CreatedAt time.Time                 `json:"created_at"`
+	Committed bool                      `json:"committed"`
+	Files     []metadataEditJournalFile `json:"files"`
+}
+
+// metadataEditJournalFile is the edit of one file. Fields holds the old
+// values of the fields the edit changed, empty for fields that were unset.
+// Cover names the saved old cover, empty when the file had none. Size and
+// ModTime are those of the file after the edit, set on commit.
+type metadataEditJournalFile struct {
+	Path         string            `json:"path"`
+	Fields       map[string]string `json:"fields,omitempty"`
+	CoverChanged bool              `json:"cover_changed,omitempty"`
+	Cover        string            `json:"cover,omitempty"`
+	Size         int64             `json:"size"`
+	ModTime      time.Time         `json:"mod_time"`
+}
+
+var (
+	metadataJournalMu  sync.Mutex
+	metadataJournalDir string
+)
+
+// SetMetadataJournalDir sets where batch edits keep the journals that undo
+// them, and rolls back any edit found there that was interrupted. Batch
+// edits cannot be applied until it is called; the directory must persist
+// across restarts.
+func SetMetadataJournalDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	metadataJournalMu.Lock()
+	defer metadataJournalMu.Unlock()
+	metadataJournalDir = dir
+	recoverMetadataJournals()
+	return nil
+}
+
+// metadataJournalRoot returns the journal directory, or "" when none is
+// set. Callers hold metadataJournalMu.
+func metadataJournalRoot() string {
+	return metadataJournalDir
+}
+
+var errNoMetadataJournalDir = fmt.Errorf("metadata journal directory not set")
+
+// compiledBatchEdit is a validated batch, with its patterns compiled and
+// the cover to copy loaded.
+type compiledBatchEdit struct {
+	ops      []BatchEditOperation
+	patterns []*regexp.Regexp
+	cover    []byte
+}
+
+func compileBatchEdit(req BatchEditRequest) (*compiledBatchEdit, error) {
+	if len(req.FilePaths) == 0 {
+		return nil, fmt.Errorf("no files to edit")
+	}
+	if len(req.Operations) == 0 {
+		return nil, fmt.Errorf("no operations given")
+	}
+
+	c := &compiledBatchEdit{ops: req.Operations, patterns: make([]*regexp.Regexp, len(req.Operations))}
+	for i, op := range req.Operations {
+		switch op.Op {
+		case BatchEditSet, BatchEditClear, BatchEditReplace:
+			if findBatchEditField(op.Field) == nil {
+				return nil, fmt.Errorf("operation %d: unknown field %q", i+1, op.Field)
+			}
+			if op.Op == BatchEditSet && (op.Field == "track_number" || op.Field == "disc_number") {
+				if n, err := strconv.Atoi(op.Value); err != nil || n <= 0 {
+					return nil, fmt.Errorf("operation %d: %s must be a positive number", i+1, op.Field)
+				}
+			}
+			if op.Op == BatchEditReplace {
+				if op.Find == "" {
+					return nil, fmt.Errorf("operation %d: find is required", i+1)
+				}
+				pattern := regexp.QuoteMeta(op.Find)
+				if op.Regex {
+					pattern = op.Find
+				}
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("operation %d: invalid pattern: %w", i+1, err)
+				}
+				c.patterns[i] = re
+			}
+		case BatchEditRenumber:
+			if op.Start < 0 {
+				return nil, fmt.Errorf("operation %d: start must not be negative", i+1)
+			}
+		case BatchEditCopyCover:
+			cover, err := readBatchCover(op.SourceFile)
+			if err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i+1, err)
+			}
+			c.cover = cover
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", i+1, op.Op)
+		}
+	}
+	return c, nil
+}
+
+// readBatchCover reads the cover embedded in an audio file, or an image
+// file as is.
+func readBatchCover(source string) ([]byte, error) {
+	if source == "" {
+		return nil, fmt.Errorf("source_file is required")
+	}
+	switch strings.ToLower(filepath.Ext(source)) {
+	case ".jpg", ".jpeg", ".png":
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cover: %w", err)
+		}
+		return data, nil
+	}
+	data, _, err := extractAnyCoverArt(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cover from %s: %w", filepath.Base(source), err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s has no cover", filepath.Base(source))
+	}
+	return data, nil
+}
+
+// metadataFieldValues returns the editable fields of metadata as strings.
+// Unset numbers are empty.
+func metadataFieldValues(m *Metadata) map[string]string {
+	number := func(n int) string {
+		if n <= 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	return map[string]string{
+		"title":        m.Title,
+		"artist":       m.Artist,
+		"album":        m.Album,
+		"album_artist": m.AlbumArtist,
+		"date":         m.Date,
+		"track_number": number(m.TrackNumber),
+		"disc_number":  number(m.DiscNumber),
+		"isrc":         m.ISRC,
+		"genre":        m.Genre,
+		"label":        m.Label,
+		"copyright":    m.Copyright,
+		"composer":     m.Composer,
+		"comment":      m.Comment,
+	}
+}
+
+// metadataFromFieldValues is the inverse of metadataFieldValues, for the
+// fields present in values.
+func metadataFromFieldValues(values map[string]string) Metadata {
+	trackNumber, _ := strconv.Atoi(values["track_number"])
+	discNumber, _ := strconv.Atoi(values["disc_number"])
+	return Metadata{
+		Title:       values["title"],
+		Artist:      values["artist"],
+		Album:       values["album"],
+		AlbumArtist: values["album_artist"],
+		Date:        values["date"],
+		TrackNumber: trackNumber,
+		DiscNumber:  discNumber,
+		ISRC:        values["isrc"],
+		Genre:       values["genre"],
+		Label:       values["label"],
+		Copyright:   values["copyright"],
+		Composer:    values["composer"],
+		Comment:     values["comment"],
+	}
+}
+
+// plannedBatchEdit is the edit of one file: the fields to write, the fields
+// to remove and the cover to embed or remove. previous and previousCover
+// are what the edit replaces.
+type plannedBatchEdit struct {
+	path          string
+	written       map[string]string
+	cleared       []string
+	cover         []byte
+	removeCover   bool
+	previous      map[string]string
+	previousCover []byte
+}
+
+// plan works out the edit of the file at index of the batch and its diff.
+func (c *compiledBatchEdit) plan(path string, index int) (*plannedBatchEdit, []BatchEditChange, error) {
+	current := readExistingTags(path)
+	if current == nil {
+		return nil, nil, fmt.Errorf("unsupported or unreadable file")
+	}
+	before := metadataFieldValues(current)
+	after := make(map[string]string, len(before))
+	for k, v := range before {
+		after[k] = v
+	}
+
+	for i, op := range c.ops {
+		switch op.Op {
+		case BatchEditSet:
+			after[op.Field] = strings.TrimSpace(op.Value)
+		case BatchEditClear:
+			after[op.Field] = ""
+		case BatchEditReplace:
+			after[op.Field] = strings.TrimSpace(c.patterns[i].ReplaceAllString(after[op.Field], op.Value))
+		case BatchEditRenumber:
+			start := op.Start
+			if start == 0 {
+				start = 1
+			}
+			after["track_number"] = strconv.Itoa(start + index)
+		}
+	}
+
+	p := &plannedBatchEdit{path: path, written: make(map[string]string), previous: make(map[string]string)}
+	var changes []BatchEditChange
+	for _, field := range batchEditFields {
+		old, value := before[field.name], after[field.name]
+		if old == value {
+			continue
+		}
+		if (field.name == "track_number" || field.name == "disc_number") && value != "" {
+			if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+				return nil, nil, fmt.Errorf("%s would become %q, which is not a positive number", field.name, value)
+			}
+		}
+		if value == "" {
+			p.cleared = append(p.cleared, field.name)
+		} else {
+			p.written[field.name] = value
+		}
+		p.previous[field.name] = old
+		changes = append(changes, BatchEditChange{Field: field.name, Old: old, New: value})
+	}
+
+	if len(c.cover) > 0 {
+		existing, _, _ := extractAnyCoverArt(path)
+		if !bytes.Equal(existing, c.cover) {
+			p.cover = c.cover
+			p.previousCover = existing
+			changes = append(changes, BatchEditChange{Field: "cover", Old: describeCover(existing), New: describeCover(c.cover)})
+		}
+	}
+	return p, changes, nil
+}
+
+func describeCover(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d bytes", len(data))
+}
+
+// apply writes the planned edit to the file.
+func (p *plannedBatchEdit) apply() error {
+	if len(p.cleared) > 0 {
+		if err := clearMetadataFields(p.path, p.cleared); err != nil {
+			return err
+		}
+	}
+	if p.removeCover {
+		if err := removeEmbeddedCover(p.path); err != nil {
+			return err
+		}
+	}
+	if len(p.written) == 0 && len(p.cover) == 0 {
+		return nil
+	}
+	return EmbedMetadataWithCoverData(p.path, metadataFromFieldValues(p.written), p.cover)
+}
+
+// undoBatchEdit plans writing back the old values of fields and, when
+// coverChanged, the old cover of the file at path.
+func undoBatchEdit(path string, fields map[string]string, coverChanged bool, cover []byte) *plannedBatchEdit {
+	p := &plannedBatchEdit{path: path, written: make(map[string]string)}
+	for _, field := range batchEditFields {
+		old, ok := fields[field.name]
+		switch {
+		case !ok:
+		case old == "":
+			p.cleared = append(p.cleared, field.name)
+		default:
+			p.written[field.name] = old
+		}
+	}
+	if coverChanged {
+		p.cover = cover
+		p.removeCover = len(cover) == 0
+	}
+	return p
+}
+
+// undo plans reverting the edit.
+func (p *plannedBatchEdit) undo() *plannedBatchEdit {
+	return undoBatchEdit(p.path, p.previous, len(p.cover) > 0, p.previousCover)
+}
+
+// removeEmbeddedCover removes the cover embedded in the file.
+func removeEmbeddedCover(path string) error {
+	switch {
+	case isMP3File(path):
+		return updateID3Tags(path, func(tag *id3Tag) { tag.remove("APIC", nil) })
+	case isM4AFile(path):
+		return updateM4ATags(path, func(items *m4aItemList) { items.remove(m4aAtomCover) })
+	case isOggFile(path):
+		return updateOggTags(path, func(cmt *flacvorbis.MetaDataBlockVorbisComment) {
+			removeComments(cmt, vorbisPictureKey)
+		})
+	}
+	f, err := flac.ParseFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to parse FLAC file: %w", err)
+	}
+	for i := len(f.Meta) - 1; i >= 0; i-- {
+		if f.Meta[i].Type == flac.Picture {
+			f.Meta = append(f.Meta[:i], f.Meta[i+1:]...)
+		}
+	}
+	return f.Save(path)
+}
+
+// clearMetadataFields removes the tags holding the named fields.
+func clearMetadataFields(path string, names []string) error {
+	var fields []*batchEditField
+	for _, name := range names {
+		fields = append(fields, findBatchEditField(name))
+	}
+
+	clearVorbis := func(cmt *flacvorbis.MetaDataBlockVorbisComment) {
+		for _, field := range fields {
+			for _, key := range field.vorbis {
+				removeComments(cmt, key)
+			}
+		}
+	}
+	switch {
+	case isMP3File(path):
+		return updateID3Tags(path, func(tag *id3Tag) {
+			for _, field := range fields {
+				for _, id := range field.id3 {
+					if frame, description, ok := strings.Cut(id, ":"); ok {
+						tag.remove(frame, func(body []byte) bool {
+							desc, _ := extractUserTextFrame(body)
+							return strings.EqualFold(desc, description)
+						})
+						continue
+					}
+					tag.remove(id, nil)
+				}
+			}
+		})
+	case isM4AFile(path):
+		return updateM4ATags(path, func(items *m4aItemList) {
+			for _, field := range fields {
+				for _, key := range field.m4a {
+					items.remove(key)
+				}
+			}
+		})
+	case isOggFile(path):
+		return updateOggTags(path, clearVorbis)
+	default:
+		return updateFLACComments(path, clearVorbis)
+	}
+}
+
+// BatchEditMetadata diffs a batch edit and, unless it is a dry run, journals
+// the old values and applies it. If any file fails to write, the files
+// already edited get their old values back and the edit is dropped.
+func BatchEditMetadata(req BatchEditRequest) (*BatchEditResult, error) {
+	batch, err := compileBatchEdit(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BatchEditResult{DryRun: req.DryRun, Files: make([]BatchEditFileResult, 0, len(req.FilePaths))}
+	var planned []*plannedBatchEdit
+	failed := 0
+	for i, path := range req.FilePaths {
+		file := BatchEditFileResult{Path: path, Changes: []BatchEditChange{}}
+		p, changes, err := batch.plan(path, i)
+		if err != nil {
+			file.Error = err.Error()
+			failed++
+		} else if len(changes) > 0 {
+			file.Changes = changes
+			planned = append(planned, p)
+		}
+		result.Files = append(result.Files, file)
+	}
+
+	if req.DryRun || len(planned) == 0 {
+		return result, nil
+	}
+	if failed > 0 {
+		return nil, fmt.Errorf("cannot apply edit: %d of %d files could not be read", failed, len(req.FilePaths))
+	}
+
+	metadataJournalMu.Lock()
+	defer metadataJournalMu.Unlock()
+	if metadataJournalRoot() == "" {
+		return nil, errNoMetadataJournalDir
+	}
+
+	// The journal is written first, so an edit interrupted part way is
+	// rolled back on the next start.
+	journal, err := writeMetadataJournal(planned)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(metadataJournalRoot(), journal.ID)
+
+	for i, p := range planned {
+		before, _ := os.Stat(p.path)
+		if err := p.apply(); err != nil {
+			GoLog("[BatchEdit] Failed to edit %s, rolling back: %v\n", filepath.Base(p.path), err)
+			edited := planned[:i]
+			// A failed write may still have changed the file.
+			if after, statErr := os.Stat(p.path); statErr == nil && !fileUnchanged(before, after) {
+				edited = planned[:i+1]
+			}
+			if rollbackErr := rollbackBatchEdit(edited); rollbackErr != nil {
+				// The uncommitted journal is kept, so the rollback is
+				// retried on the next start.
+				return nil, fmt.Errorf("failed to edit %s: %w (rollback failed: %v)", p.path, err, rollbackErr)
+			}
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to edit %s: %w", p.path, err)
+		}
+	}
+
+	if err := commitMetadataJournal(journal); err != nil {
+		if rollbackErr := rollbackBatchEdit(planned); rollbackErr != nil {
+			return nil, fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	pruneMetadataJournals()
+	result.JournalID = journal.ID
+	GoLog("[BatchEdit] Edited %d files (journal %s)\n", len(planned), journal.ID)
+	return result, nil
+}
+
+func fileUnchanged(before, after os.FileInfo) bool {
+	return before != nil && after != nil && before.Size() == after.Size() && before.ModTime().Equal(after.ModTime())
+}
+
+// rollbackBatchEdit writes the old values back to the edited files,
+// carrying on past failures so that as many files as possible are restored.
+func rollbackBatchEdit(edited []*plannedBatchEdit) error {
+	var failed []string
+	for _, p := range edited {
+		if err := p.undo().apply(); err != nil {
+			GoLog("[BatchEdit] Failed to restore %s: %v\n", p.path, err)
+			failed = append(failed, p.path)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to restore %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// writeMetadataJournal records the old values of a batch edit about to be
+// applied in a new, uncommitted journal. Callers hold metadataJournalMu.
+func writeMetadataJournal(planned []*plannedBatchEdit) (*metadataEditJournal, error) {
+	now := time.Now()
+	journal := &metadataEditJournal{ID: strconv.FormatInt(now.UnixNano(), 10), CreatedAt: now.UTC()}
+	dir := filepath.Join(metadataJournalRoot(), journal.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create journal: %w", err)
+	}
+
+	for i, p := range planned {
+		file := metadataEditJournalFile{
+			Path:         p.path,
+			Fields:       p.previous,
+			CoverChanged: len(p.cover) > 0,
+		}
+		if len(p.previousCover) > 0 {
+			file.Cover = fmt.Sprintf("%03d.cover", i)
+			if err := writeFileAtomic(filepath.Join(dir, file.Cover), p.previousCover); err != nil {
+				os.RemoveAll(dir)
+				return nil, fmt.Errorf("failed to save the cover of %s: %w", p.path, err)
+			}
+		}
+		journal.Files = append(journal.Files, file)
+	}
+
+	if err := saveMetadataJournal(journal); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return journal, nil
+}
+
+// commitMetadataJournal marks the journal of an applied batch edit as
+// committed, recording the size and modification time of each edited file.
+// Callers hold metadataJournalMu.
+func commitMetadataJournal(journal *metadataEditJournal) error {
+	for i := range journal.Files {
+		file := &journal.Files[i]
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			return fmt.Errorf("failed to journal %s: %w", file.Path, err)
+		}
+		file.Size, file.ModTime = info.Size(), info.ModTime()
+	}
+	journal.Committed = true
+	return saveMetadataJournal(journal)
+}
+
+func saveMetadataJournal(journal *metadataEditJournal) error {
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(metadataJournalRoot(), journal.ID, metadataJournalFileName), data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+func readMetadataJournal(id string) (*metadataEditJournal, error) {
+	data, err := os.ReadFile(filepath.Join(metadataJournalRoot(), id, metadataJournalFileName))
+	if err != nil {
+		return nil, fmt.Errorf("batch edit %s not found", id)
+	}
+	var journal metadataEditJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return nil, fmt.Errorf("corrupt journal %s: %w", id, err)
+	}
+	return &journal, nil
+}
+
+// recoverMetadataJournals rolls back the batch edits whose journal was never
+// committed, because the app was killed part way or their rollback failed.
+// Journals that cannot be fully restored are kept and retried on the next
+// start. Callers hold metadataJournalMu.
+func recoverMetadataJournals() {
+	for _, id := range listMetadataJournals() {
+		journal, err := readMetadataJournal(id)
+		if err != nil || journal.Committed {
+			continue
+		}
+		if _, err := restoreMetadataJournal(journal); err != nil {
+			GoLog("[BatchEdit] Failed to roll back interrupted edit %s: %v\n", id, err)
+			continue
+		}
+		os.RemoveAll(filepath.Join(metadataJournalRoot(), id))
+		GoLog("[BatchEdit] Rolled back interrupted edit %s (%d files)\n", id, len(journal.Files))
+	}
+}
+
+// restoreMetadataJournal writes the old values in the journal back to its
+// files, carrying on past failures, and returns the restored paths.
+func restoreMetadataJournal(journal *metadataEditJournal) ([]string, error) {
+	dir := filepath.Join(metadataJournalRoot(), journal.ID)
+	var failed []string
+	restored := make([]string, 0, len(journal.Files))
+	for _, file := range journal.Files {
+		var cover []byte
+		if file.Cover != "" {
+			var err error
+			if cover, err = os.ReadFile(filepath.Join(dir, filepath.Base(file.Cover))); err != nil {
+				GoLog("[BatchEdit] Failed to read the old cover of %s: %v\n", file.Path, err)
+				failed = append(failed, file.Path)
+				continue
+			}
+		}
+		if err := undoBatchEdit(file.Path, file.Fields, file.CoverChanged, cover).apply(); err != nil {
+			GoLog("[BatchEdit] Failed to restore %s: %v\n", file.Path, err)
+			failed = append(failed, file.Path)
+			continue
+		}
+		restored = append(restored, file.Path)
+	}
+	if len(failed) > 0 {
+		return restored, fmt.Errorf("failed to restore %s", strings.Join(failed, ", "))
+	}
+	return restored, nil
+}
+
+// listMetadataJournals returns the IDs of the stored journals, oldest first.
+func listMetadataJournals() []string {
+	if metadataJournalRoot() == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(metadataJournalRoot())
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// pruneMetadataJournals drops the oldest committed journals beyond
+// metadataJournalKeep. Uncommitted ones are kept until they are rolled back.
+func pruneMetadataJournals() {
+	var ids []string
+	for _, id := range listMetadataJournals() {
+		if journal, err := readMetadataJournal(id); err != nil || journal.Committed {
+			ids = append(ids, id)
+		}
+	}
+	for len(ids) > metadataJournalKeep {
+		os.RemoveAll(filepath.Join(metadataJournalRoot(), ids[0]))
+		ids = ids[1:]
+	}
+}
+
+// UndoBatchEdit writes back the old values of a batch edit from its
+// journal, or of the latest edit when journalID is empty, and returns the
+// restored paths. It refuses when any of the files changed since the edit,
+// as writing the old values would lose those changes. The journal is
+// removed once every file is restored.
+func UndoBatchEdit(journalID string) ([]string, error) {
+	metadataJournalMu.Lock()
+	defer metadataJournalMu.Unlock()
+	if metadataJournalRoot() == "" {
+		return nil, errNoMetadataJournalDir
+	}
+
+	if journalID == "" {
+		ids := listMetadataJournals()
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("no batch edit to undo")
+		}
+		journalID = ids[len(ids)-1]
+	}
+	if filepath.Base(journalID) != journalID {
+		return nil, fmt.Errorf("invalid journal ID: %s", journalID)
+	}
+
+	journal, err := readMetadataJournal(journalID)
+	if err != nil {
+		return nil, err
+	}
+
+	// An uncommitted edit was interrupted part way, so its files have no
+	// recorded state to check; rolling it back is what recovery does anyway.
+	var changed []string
+	if journal.Committed {
+		for _, file := range journal.Files {
+			info, err := os.Stat(file.Path)
+			if err != nil || info.Size() != file.Size || !info.ModTime().Equal(file.ModTime) {
+				changed = append(changed, file.Path)
+			}
+		}
+	}
+	if len(changed) > 0 {
+		return nil, fmt.Errorf("cannot undo edit %s: changed since the edit: %s", journalID, strings.Join(changed, ", "))
+	}
+
+	restored, err := restoreMetadataJournal(journal)
+	if err != nil {
+		return nil, err
+	}
+	os.RemoveAll(filepath.Join(metadataJournalRoot(), journalID))
+
+	GoLog("[BatchEdit] Undid edit %s (%d files)\n", journalID, len(restored))
+	return restored, nil
+}
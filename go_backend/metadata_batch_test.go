@@ -0,0 +1,283 @@
+package gobackend
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-flac/go-flac/v2"
+)
+
+func setTestMetadataJournalDir(t *testing.T) {
+	t.Helper()
+	if err := SetMetadataJournalDir(t.TempDir()); err != nil {
+		t.Fatalf("SetMetadataJournalDir: %v", err)
+	}
+	t.Cleanup(func() { metadataJournalDir = "" })
+}
+
+func TestBatchEditMetadataDryRunAndUndo(t *testing.T) {
+	setTestMetadataJournalDir(t)
+	dir := t.TempDir()
+	flacPath := writeTestFLAC(t, dir, "a.flac", 44100, 16)
+	if err := EmbedMetadata(flacPath, Metadata{Title: "Song (Remastered)", Artist: "Artist", Genre: "Rock", TrackNumber: 7}, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+	mp3Path := writeTestMP3(t, dir, "b.mp3", map[string]string{"TIT2": "Other (Remastered)", "TPE1": "Artist", "TCON": "Rock"})
+	original, _ := os.ReadFile(mp3Path)
+	originalTags := readExistingTags(mp3Path)
+
+	req := BatchEditRequest{
+		FilePaths: []string{flacPath, mp3Path},
+		Operations: []BatchEditOperation{
+			{Op: BatchEditReplace, Field: "title", Find: `\s*\(Remastered\)`, Regex: true},
+			{Op: BatchEditSet, Field: "album", Value: "The Album"},
+			{Op: BatchEditClear, Field: "genre"},
+			{Op: BatchEditRenumber},
+		},
+		DryRun: true,
+	}
+	preview, err := BatchEditMetadata(req)
+	if err != nil {
+		t.Fatalf("BatchEditMetadata dry run: %v", err)
+	}
+	want := []BatchEditChange{
+		{Field: "title", Old: "Song (Remastered)", New: "Song"},
+		{Field: "album", Old: "", New: "The Album"},
+		{Field: "track_number", Old: "7", New: "1"},
+		{Field: "genre", Old: "Rock", New: ""},
+	}
+	if preview.JournalID != "" || !reflect.DeepEqual(preview.Files[0].Changes, want) {
+		t.Fatalf("unexpected preview: %+v", preview)
+	}
+	if preview.Files[1].Changes[2] != (BatchEditChange{Field: "track_number", Old: "", New: "2"}) {
+		t.Fatalf("unexpected MP3 preview: %+v", preview.Files[1])
+	}
+	if data, _ := os.ReadFile(mp3Path); !bytes.Equal(data, original) {
+		t.Fatal("dry run modified the file")
+	}
+
+	req.DryRun = false
+	result, err := BatchEditMetadata(req)
+	if err != nil {
+		t.Fatalf("BatchEditMetadata: %v", err)
+	}
+	if result.JournalID == "" {
+		t.Fatal("expected a journal ID")
+	}
+	flacMeta := readExistingTags(flacPath)
+	mp3Meta := readExistingTags(mp3Path)
+	if flacMeta.Title != "Song" || flacMeta.Album != "The Album" || flacMeta.Genre != "" || flacMeta.TrackNumber != 1 ||
+		mp3Meta.Title != "Other" || mp3Meta.Genre != "" || mp3Meta.TrackNumber != 2 || mp3Meta.Artist != "Artist" {
+		t.Fatalf("unexpected tags after edit: %+v / %+v", flacMeta, mp3Meta)
+	}
+
+	restored, err := UndoBatchEdit("")
+	if err != nil {
+		t.Fatalf("UndoBatchEdit: %v", err)
+	}
+	if len(restored) != 2 {
+		t.Fatalf("unexpected restored files: %v", restored)
+	}
+	if meta := readExistingTags(mp3Path); !reflect.DeepEqual(meta, originalTags) {
+		t.Fatalf("expected the MP3 tags to be restored: %+v", meta)
+	}
+	if meta := readExistingTags(flacPath); meta.Title != "Song (Remastered)" || meta.Genre != "Rock" {
+		t.Fatalf("expected the FLAC to be restored: %+v", meta)
+	}
+	if _, err := UndoBatchEdit(result.JournalID); err == nil {
+		t.Fatal("expected an undone edit to be gone")
+	}
+}
+
+func TestBatchEditMetadataRollsBack(t *testing.T) {
+	setTestMetadataJournalDir(t)
+	dir := t.TempDir()
+	first := writeTestMP3(t, dir, "a.mp3", map[string]string{"TIT2": "One"})
+	// The tags of the second file read as empty, but writing them fails on
+	// its corrupt comment block.
+	second := writeTestFLAC(t, dir, "b.flac", 44100, 16)
+	f, err := flac.ParseFile(second)
+	if err != nil {
+		t.Fatalf("failed to parse FLAC: %v", err)
+	}
+	f.Meta = append(f.Meta, &flac.MetaDataBlock{Type: flac.VorbisComment, Data: []byte{0x10, 0x00, 0x00, 0x00}})
+	if err := f.Save(second); err != nil {
+		t.Fatalf("failed to save FLAC: %v", err)
+	}
+
+	_, err = BatchEditMetadata(BatchEditRequest{
+		FilePaths:  []string{first, second},
+		Operations: []BatchEditOperation{{Op: BatchEditSet, Field: "album", Value: "New"}},
+	})
+	if err == nil {
+		t.Fatal("expected the edit to fail")
+	}
+	if meta := readExistingTags(first); meta.Title != "One" || meta.Album != "" {
+		t.Fatalf("expected the first file to be rolled back: %+v", meta)
+	}
+	if ids := listMetadataJournals(); len(ids) != 0 {
+		t.Fatalf("expected no journal after rollback, got %v", ids)
+	}
+}
+
+func TestUndoBatchEditRestoresCoverAndRefusesChangedFiles(t *testing.T) {
+	setTestMetadataJournalDir(t)
+	dir := t.TempDir()
+	cover := filepath.Join(dir, "cover.jpg")
+	if err := os.WriteFile(cover, append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, make([]byte, 64)...), 0644); err != nil {
+		t.Fatalf("failed to write cover: %v", err)
+	}
+	first := writeTestFLAC(t, dir, "a.flac", 44100, 16)
+	second := writeTestMP3(t, dir, "b.mp3", map[string]string{"TIT2": "Two"})
+
+	edit := BatchEditRequest{
+		FilePaths:  []string{first, second},
+		Operations: []BatchEditOperation{{Op: BatchEditCopyCover, SourceFile: cover}},
+	}
+	result, err := BatchEditMetadata(edit)
+	if err != nil {
+		t.Fatalf("BatchEditMetadata: %v", err)
+	}
+	if _, err := UndoBatchEdit(result.JournalID); err != nil {
+		t.Fatalf("UndoBatchEdit: %v", err)
+	}
+	for _, path := range []string{first, second} {
+		if data, _, _ := extractAnyCoverArt(path); len(data) > 0 {
+			t.Fatalf("expected the cover of %s to be removed", filepath.Base(path))
+		}
+	}
+
+	edit.Operations = []BatchEditOperation{{Op: BatchEditSet, Field: "album", Value: "New"}}
+	result, err = BatchEditMetadata(edit)
+	if err != nil {
+		t.Fatalf("BatchEditMetadata: %v", err)
+	}
+	if err := EmbedMetadataWithCoverData(second, Metadata{Genre: "Jazz"}, nil); err != nil {
+		t.Fatalf("EmbedMetadataWithCoverData: %v", err)
+	}
+	if _, err := UndoBatchEdit(result.JournalID); err == nil || !strings.Contains(err.Error(), second) {
+		t.Fatalf("expected the changed file to block the undo, got %v", err)
+	}
+	if meta := readExistingTags(first); meta.Album != "New" {
+		t.Fatalf("expected a refused undo to leave the files alone: %+v", meta)
+	}
+	if meta := readExistingTags(second); meta.Album != "New" || meta.Genre != "Jazz" {
+		t.Fatalf("expected the later change to be kept: %+v", meta)
+	}
+}
+
+func TestUndoBatchEditRestoresM4ACover(t *testing.T) {
+	setTestMetadataJournalDir(t)
+	dir := t.TempDir()
+	oldCover := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{1}, 32)...)
+	newCover := filepath.Join(dir, "cover.jpg")
+	if err := os.WriteFile(newCover, append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{2}, 64)...), 0644); err != nil {
+		t.Fatalf("failed to write cover: %v", err)
+	}
+	path := writeTestM4A(t, dir)
+	if err := embedM4AMetadata(path, Metadata{Title: "Song"}, oldCover); err != nil {
+		t.Fatalf("embedM4AMetadata: %v", err)
+	}
+
+	result, err := BatchEditMetadata(BatchEditRequest{
+		FilePaths:  []string{path},
+		Operations: []BatchEditOperation{{Op: BatchEditCopyCover, SourceFile: newCover}},
+	})
+	if err != nil {
+		t.Fatalf("BatchEditMetadata: %v", err)
+	}
+	if got := result.Files[0].Changes; len(got) != 1 || got[0].Old != describeCover(oldCover) {
+		t.Fatalf("expected the old cover in the diff, got %+v", got)
+	}
+	if _, err := UndoBatchEdit(result.JournalID); err != nil {
+		t.Fatalf("UndoBatchEdit: %v", err)
+	}
+	if data, _, err := extractAnyCoverArt(path); err != nil || !bytes.Equal(data, oldCover) {
+		t.Fatalf("expected the old cover back, got %d bytes, %v", len(data), err)
+	}
+}
+
+func TestSetMetadataJournalDirRollsBackInterruptedEdit(t *testing.T) {
+	setTestMetadataJournalDir(t)
+	journalDir := metadataJournalDir
+	dir := t.TempDir()
+	first := writeTestMP3(t, dir, "a.mp3", map[string]string{"TIT2": "One", "TALB": "Old"})
+	second := writeTestMP3(t, dir, "b.mp3", map[string]string{"TIT2": "Two"})
+
+	// Journal the edit and apply it to the first file only, as if the app
+	// was killed part way.
+	batch, err := compileBatchEdit(BatchEditRequest{
+		FilePaths:  []string{first, second},
+		Operations: []BatchEditOperation{{Op: BatchEditSet, Field: "album", Value: "New"}},
+	})
+	if err != nil {
+		t.Fatalf("compileBatchEdit: %v", err)
+	}
+	var planned []*plannedBatchEdit
+	for i, path := range []string{first, second} {
+		p, _, err := batch.plan(path, i)
+		if err != nil {
+			t.Fatalf("plan: %v", err)
+		}
+		planned = append(planned, p)
+	}
+	if _, err := writeMetadataJournal(planned); err != nil {
+		t.Fatalf("writeMetadataJournal: %v", err)
+	}
+	if err := planned[0].apply(); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	if err := SetMetadataJournalDir(journalDir); err != nil {
+		t.Fatalf("SetMetadataJournalDir: %v", err)
+	}
+	if meta := readExistingTags(first); meta.Album != "Old" {
+		t.Fatalf("expected the interrupted edit to be rolled back: %+v", meta)
+	}
+	if meta := readExistingTags(second); meta.Title != "Two" || meta.Album != "" {
+		t.Fatalf("expected the unedited file to be left as it was: %+v", meta)
+	}
+	if ids := listMetadataJournals(); len(ids) != 0 {
+		t.Fatalf("expected the rolled back journal to be removed, got %v", ids)
+	}
+}
+
+func TestBatchEditMetadataRequiresJournalDir(t *testing.T) {
+	path := writeTestMP3(t, t.TempDir(), "a.mp3", map[string]string{"TIT2": "One"})
+	edit := BatchEditRequest{
+		FilePaths:  []string{path},
+		Operations: []BatchEditOperation{{Op: BatchEditSet, Field: "album", Value: "New"}},
+		DryRun:     true,
+	}
+	if _, err := BatchEditMetadata(edit); err != nil {
+		t.Fatalf("expected a dry run without a journal directory, got %v", err)
+	}
+	edit.DryRun = false
+	if _, err := BatchEditMetadata(edit); err == nil {
+		t.Fatal("expected the edit to need a journal directory")
+	}
+	if meta := readExistingTags(path); meta.Album != "" {
+		t.Fatalf("expected the file to be left alone: %+v", meta)
+	}
+	if _, err := UndoBatchEdit(""); err == nil {
+		t.Fatal("expected undo to need a journal directory")
+	}
+}
+
+func TestBatchEditMetadataValidation(t *testing.T) {
+	for _, op := range []BatchEditOperation{
+		{Op: "rename", Field: "title"},
+		{Op: BatchEditSet, Field: "lyrics", Value: "x"},
+		{Op: BatchEditSet, Field: "track_number", Value: "two"},
+		{Op: BatchEditReplace, Field: "title", Find: "(", Regex: true},
+		{Op: BatchEditCopyCover},
+	} {
+		if _, err := BatchEditMetadata(BatchEditRequest{FilePaths: []string{"a.flac"}, Operations: []BatchEditOperation{op}}); err == nil {
+			t.Fatalf("expected %+v to be rejected", op)
+		}
+	}
+}
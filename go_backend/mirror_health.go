@@ -0,0 +1,253 @@
+package gobackend
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states for a mirror endpoint.
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+const (
+	mirrorFailureThreshold = 3
+	mirrorOpenBase         = 30 * time.Second
+	mirrorOpenMax          = 10 * time.Minute
+	mirrorLatencyWeight    = 0.3
+)
+
+// MirrorHealth is the exported state of one provider endpoint.
+type MirrorHealth struct {
+	Provider            string `json:"provider"`
+	Endpoint            string `json:"endpoint"`
+	State               string `json:"state"`
+	Successes           int64  `json:"successes"`
+	Failures            int64  `json:"failures"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	AvgLatencyMS        int64  `json:"avg_latency_ms"`
+	LastErrorType       string `json:"last_error_type,omitempty"`
+	LastError           string `json:"last_error,omitempty"`
+	LastSuccessAt       int64  `json:"last_success_at,omitempty"`
+	LastFailureAt       int64  `json:"last_failure_at,omitempty"`
+	RetryAt             int64  `json:"retry_at,omitempty"`
+}
+
+type mirrorEndpoint struct {
+	MirrorHealth
+	avgLatency    float64
+	openedTimes   int
+	retryAt       time.Time
+	probeInFlight bool
+}
+
+// MirrorHealthRegistry tracks success, latency and errors per provider mirror
+// and trips a circuit after repeated failures, so a dead mirror stops being
+// queried for every track. After a cooldown one request is let through as a
+// probe; its result closes the circuit or reopens it with a longer cooldown.
+type MirrorHealthRegistry struct {
+	mu        sync.Mutex
+	endpoints map[string]*mirrorEndpoint
+	now       func() time.Time
+}
+
+var (
+	globalMirrorHealth     *MirrorHealthRegistry
+	globalMirrorHealthOnce sync.Once
+)
+
+func GetMirrorHealthRegistry() *MirrorHealthRegistry {
+	globalMirrorHealthOnce.Do(func() {
+		globalMirrorHealth = newMirrorHealthRegistry()
+	})
+	return globalMirrorHealth
+}
+
+func newMirrorHealthRegistry() *MirrorHealthRegistry {
+	return &MirrorHealthRegistry{
+		endpoints: make(map[string]*mirrorEndpoint),
+		now:       time.Now,
+	}
+}
+
+func (r *MirrorHealthRegistry) endpointLocked(provider, endpoint string) *mirrorEndpoint {
+	key := provider + "|" + endpoint
+	e, ok := r.endpoints[key]
+	if !ok {
+		e = &mirrorEndpoint{MirrorHealth: MirrorHealth{
+			Provider: provider,
+			Endpoint: endpoint,
+			State:    circuitClosed,
+		}}
+		r.endpoints[key] = e
+	}
+	return e
+}
+
+// Order returns the endpoints that may be queried now, healthiest first.
+// Open circuits are left out until their cooldown ends, then one probe is
+// allowed. If every circuit is open, the one due soonest is probed so the
+// provider is never cut off completely.
+func (r *MirrorHealthRegistry) Order(provider string, endpoints []string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	allowed := make([]*mirrorEndpoint, 0, len(endpoints))
+	var soonest *mirrorEndpoint
+
+	for _, endpoint := range endpoints {
+		e := r.endpointLocked(provider, endpoint)
+		switch e.State {
+		case circuitOpen:
+			if now.Before(e.retryAt) {
+				if soonest == nil || e.retryAt.Before(soonest.retryAt) {
+					soonest = e
+				}
+				continue
+			}
+			e.State = circuitHalfOpen
+			e.probeInFlight = true
+			GoLog("[MirrorHealth] %s %s: cooldown over, probing\n", provider, endpoint)
+		case circuitHalfOpen:
+			if e.probeInFlight {
+				continue
+			}
+			e.probeInFlight = true
+		}
+		allowed = append(allowed, e)
+	}
+
+	if len(allowed) == 0 && soonest != nil {
+		soonest.State = circuitHalfOpen
+		soonest.probeInFlight = true
+		allowed = append(allowed, soonest)
+	}
+
+	sort.SliceStable(allowed, func(i, j int) bool {
+		a, b := allowed[i], allowed[j]
+		if a.ConsecutiveFailures != b.ConsecutiveFailures {
+			return a.ConsecutiveFailures < b.ConsecutiveFailures
+		}
+		// Endpoints without latency samples keep their configured position
+		// relative to each other but rank after measured fast ones.
+		if a.avgLatency > 0 && b.avgLatency > 0 {
+			return a.avgLatency < b.avgLatency
+		}
+		return a.avgLatency > 0 && b.avgLatency == 0
+	})
+
+	ordered := make([]string, len(allowed))
+	for i, e := range allowed {
+		ordered[i] = e.Endpoint
+	}
+	return ordered
+}
+
+// RecordSuccess records a successful request and closes the circuit.
+func (r *MirrorHealthRegistry) RecordSuccess(provider, endpoint string, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := r.endpointLocked(provider, endpoint)
+	now := r.now()
+	if e.State != circuitClosed {
+		GoLog("[MirrorHealth] %s %s: recovered, closing circuit\n", provider, endpoint)
+	}
+	e.Successes++
+	e.ConsecutiveFailures = 0
+	e.State = circuitClosed
+	e.openedTimes = 0
+	e.probeInFlight = false
+	e.LastSuccessAt = now.Unix()
+	e.recordLatency(latency)
+}
+
+// RecordFailure records a failed request. Errors about the track rather than
+// the mirror (not found, region locked, cancelled) show the mirror answered
+// properly and do not count towards opening the circuit.
+func (r *MirrorHealthRegistry) RecordFailure(provider, endpoint string, err error, latency time.Duration) {
+	kind := ClassifyDownloadError(err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := r.endpointLocked(provider, endpoint)
+	now := r.now()
+	e.Failures++
+	e.LastFailureAt = now.Unix()
+	e.LastErrorType = string(kind)
+	if err != nil {
+		e.LastError = err.Error()
+	}
+	e.probeInFlight = false
+
+	switch kind {
+	case ErrKindNotFound, ErrKindRegionLocked, ErrKindCancelled, ErrKindQualityUnavailable:
+		e.ConsecutiveFailures = 0
+		if e.State == circuitHalfOpen {
+			e.State = circuitClosed
+			e.openedTimes = 0
+		}
+		e.recordLatency(latency)
+		return
+	}
+
+	e.ConsecutiveFailures++
+	if e.State == circuitHalfOpen || e.ConsecutiveFailures >= mirrorFailureThreshold {
+		cooldown := mirrorOpenBase << e.openedTimes
+		if cooldown > mirrorOpenMax || cooldown <= 0 {
+			cooldown = mirrorOpenMax
+		}
+		e.openedTimes++
+		e.State = circuitOpen
+		e.retryAt = now.Add(cooldown)
+		GoLog("[MirrorHealth] %s %s: circuit open for %v after %d failures (%s)\n",
+			provider, endpoint, cooldown, e.ConsecutiveFailures, kind)
+	}
+}
+
+func (e *mirrorEndpoint) recordLatency(latency time.Duration) {
+	if latency <= 0 {
+		return
+	}
+	ms := float64(latency.Milliseconds())
+	if e.avgLatency == 0 {
+		e.avgLatency = ms
+	} else {
+		e.avgLatency = mirrorLatencyWeight*ms + (1-mirrorLatencyWeight)*e.avgLatency
+	}
+	e.AvgLatencyMS = int64(e.avgLatency)
+}
+
+// Snapshot returns the state of every known endpoint, grouped by provider.
+func (r *MirrorHealthRegistry) Snapshot() []MirrorHealth {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]MirrorHealth, 0, len(r.endpoints))
+	for _, e := range r.endpoints {
+		h := e.MirrorHealth
+		if e.State == circuitOpen {
+			h.RetryAt = e.retryAt.Unix()
+		}
+		result = append(result, h)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Provider != result[j].Provider {
+			return result[i].Provider < result[j].Provider
+		}
+		return result[i].Endpoint < result[j].Endpoint
+	})
+	return result
+}
+
+// Reset forgets all recorded health, closing every circuit.
+func (r *MirrorHealthRegistry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endpoints = make(map[string]*mirrorEndpoint)
+}
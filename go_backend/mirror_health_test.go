@@ -0,0 +1,71 @@
+package gobackend
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMirrorHealthRegistry_CircuitOpensAndProbes(t *testing.T) {
+	now := time.Unix(1000, 0)
+	r := newMirrorHealthRegistry()
+	r.now = func() time.Time { return now }
+
+	mirrors := []string{"a", "b", "c"}
+	broken := httpStatusError("tidal", 502, "")
+	for i := 0; i < mirrorFailureThreshold; i++ {
+		r.RecordFailure("tidal", "a", broken, time.Second)
+	}
+	r.RecordSuccess("tidal", "b", 800*time.Millisecond)
+	r.RecordSuccess("tidal", "c", 200*time.Millisecond)
+
+	if got := r.Order("tidal", mirrors); !reflect.DeepEqual(got, []string{"c", "b"}) {
+		t.Fatalf("expected open mirror to be skipped and fastest first, got %v", got)
+	}
+
+	now = now.Add(mirrorOpenBase + time.Second)
+	if got := r.Order("tidal", mirrors); len(got) != 3 {
+		t.Fatalf("expected half-open probe after cooldown, got %v", got)
+	}
+	// Only one probe at a time while half-open.
+	if got := r.Order("tidal", mirrors); len(got) != 2 {
+		t.Fatalf("expected probe in flight to be excluded, got %v", got)
+	}
+
+	r.RecordFailure("tidal", "a", broken, time.Second)
+	now = now.Add(mirrorOpenBase + time.Second)
+	if got := r.Order("tidal", mirrors); len(got) != 2 {
+		t.Fatalf("expected doubled cooldown after failed probe, got %v", got)
+	}
+
+	now = now.Add(mirrorOpenBase)
+	r.Order("tidal", mirrors)
+	r.RecordSuccess("tidal", "a", 100*time.Millisecond)
+	if got := r.Order("tidal", mirrors); got[0] != "a" {
+		t.Fatalf("expected recovered fast mirror first, got %v", got)
+	}
+}
+
+func TestMirrorHealthRegistry_TrackErrorsDoNotTrip(t *testing.T) {
+	r := newMirrorHealthRegistry()
+	for i := 0; i < mirrorFailureThreshold+2; i++ {
+		r.RecordFailure("qobuz", "x", httpStatusError("qobuz", 404, ""), 0)
+	}
+	if got := r.Order("qobuz", []string{"x"}); len(got) != 1 {
+		t.Fatalf("expected not-found errors to keep circuit closed, got %v", got)
+	}
+
+	for i := 0; i < mirrorFailureThreshold; i++ {
+		r.RecordFailure("qobuz", "x", errors.New("connection refused"), 0)
+	}
+	// Every circuit open: the one due soonest is still probed.
+	if got := r.Order("qobuz", []string{"x"}); len(got) != 1 {
+		t.Fatalf("expected last-resort probe, got %v", got)
+	}
+
+	snapshot := r.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].State != circuitHalfOpen || snapshot[0].LastErrorType != string(ErrKindNetwork) {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+}
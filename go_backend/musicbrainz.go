@@ -0,0 +1,329 @@
+package gobackend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	musicBrainzDefaultBaseURL = "https://musicbrainz.org/ws/2"
+	musicBrainzAPITimeout     = 15 * time.Second
+	musicBrainzLookupTimeout  = 30 * time.Second
+	musicBrainzMaxCacheSize   = 500
+
+	// musicBrainzUFIDOwner is the owner identifier of the ID3 UFID frame
+	// that holds the recording ID.
+	musicBrainzUFIDOwner = "http://musicbrainz.org"
+)
+
+// MusicBrainz tag names, as Vorbis comments and as the ID3 TXXX description
+// and MP4 freeform name used by Picard.
+const (
+	musicBrainzTagRecording    = "MUSICBRAINZ_TRACKID"
+	musicBrainzTagRelease      = "MUSICBRAINZ_ALBUMID"
+	musicBrainzTagReleaseGroup = "MUSICBRAINZ_RELEASEGROUPID"
+	musicBrainzTagReleaseTrack = "MUSICBRAINZ_RELEASETRACKID"
+	musicBrainzTagArtist       = "MUSICBRAINZ_ARTISTID"
+	musicBrainzTagAlbumArtist  = "MUSICBRAINZ_ALBUMARTISTID"
+)
+
+var musicBrainzTagNames = map[string]string{
+	musicBrainzTagRecording:    "MusicBrainz Track Id",
+	musicBrainzTagRelease:      "MusicBrainz Album Id",
+	musicBrainzTagReleaseGroup: "MusicBrainz Release Group Id",
+	musicBrainzTagReleaseTrack: "MusicBrainz Release Track Id",
+	musicBrainzTagArtist:       "MusicBrainz Artist Id",
+	musicBrainzTagAlbumArtist:  "MusicBrainz Album Artist Id",
+}
+
+var (
+	musicBrainzClient     *MusicBrainzClient
+	musicBrainzClientOnce sync.Once
+	// MusicBrainz allows one request per second per client.
+	musicBrainzRateLimiter = NewRateLimiter(1, time.Second)
+)
+
+// MusicBrainzIDs are the MusicBrainz identifiers of a track. The release
+// level IDs are only set when a release matching the album was found.
+type MusicBrainzIDs struct {
+	RecordingID    string   `json:"recording_id"`
+	ReleaseID      string   `json:"release_id,omitempty"`
+	ReleaseGroupID string   `json:"release_group_id,omitempty"`
+	ReleaseTrackID string   `json:"release_track_id,omitempty"`
+	ArtistIDs      []string `json:"artist_ids,omitempty"`
+	AlbumArtistIDs []string `json:"album_artist_ids,omitempty"`
+}
+
+// musicBrainzTag is one MusicBrainz tag with its Vorbis comment name, its
+// ID3/MP4 name and its values. Only the artist tags have several values.
+type musicBrainzTag struct {
+	vorbis string
+	name   string
+	values []string
+}
+
+// tags returns the IDs as tags in a fixed order, leaving out empty ones.
+func (ids *MusicBrainzIDs) tags() []musicBrainzTag {
+	if ids == nil {
+		return nil
+	}
+	all := []struct {
+		key    string
+		values []string
+	}{
+		{musicBrainzTagRecording, []string{ids.RecordingID}},
+		{musicBrainzTagRelease, []string{ids.ReleaseID}},
+		{musicBrainzTagReleaseGroup, []string{ids.ReleaseGroupID}},
+		{musicBrainzTagReleaseTrack, []string{ids.ReleaseTrackID}},
+		{musicBrainzTagArtist, ids.ArtistIDs},
+		{musicBrainzTagAlbumArtist, ids.AlbumArtistIDs},
+	}
+	var tags []musicBrainzTag
+	for _, tag := range all {
+		if len(tag.values) > 0 && tag.values[0] != "" {
+			tags = append(tags, musicBrainzTag{vorbis: tag.key, name: musicBrainzTagNames[tag.key], values: tag.values})
+		}
+	}
+	return tags
+}
+
+// errMusicBrainzNotFound is returned for lookups MusicBrainz has no entry for.
+var errMusicBrainzNotFound = errors.New("not found on MusicBrainz")
+
+// MusicBrainzClient resolves MusicBrainz IDs through the MusicBrainz web
+// service or a mirror of it.
+type MusicBrainzClient struct {
+	httpClient *http.Client
+	mu         sync.RWMutex
+	baseURL    string
+	// cache holds resolved IDs, and nil for ISRCs with no recording so
+	// they are not looked up again.
+	cache map[string]*MusicBrainzIDs
+}
+
+func GetMusicBrainzClient() *MusicBrainzClient {
+	musicBrainzClientOnce.Do(func() {
+		musicBrainzClient = &MusicBrainzClient{
+			httpClient: NewMetadataHTTPClient(musicBrainzAPITimeout),
+			baseURL:    musicBrainzDefaultBaseURL,
+			cache:      make(map[string]*MusicBrainzIDs),
+		}
+	})
+	return musicBrainzClient
+}
+
+// SetBaseURL points the client at a MusicBrainz mirror. An empty URL
+// restores the public server.
+func (c *MusicBrainzClient) SetBaseURL(baseURL string) {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if baseURL == "" {
+		baseURL = musicBrainzDefaultBaseURL
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.baseURL != baseURL {
+		c.baseURL = baseURL
+		c.cache = make(map[string]*MusicBrainzIDs)
+	}
+}
+
+type musicBrainzArtistCredit []struct {
+	Artist struct {
+		ID string `json:"id"`
+	} `json:"artist"`
+}
+
+func (credit musicBrainzArtistCredit) ids() []string {
+	var ids []string
+	for _, c := range credit {
+		if c.Artist.ID != "" {
+			ids = append(ids, c.Artist.ID)
+		}
+	}
+	return ids
+}
+
+type musicBrainzISRCResponse struct {
+	Recordings []struct {
+		ID           string                  `json:"id"`
+		ArtistCredit musicBrainzArtistCredit `json:"artist-credit"`
+		Releases     []struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+			Date  string `json:"date"`
+		} `json:"releases"`
+	} `json:"recordings"`
+}
+
+type musicBrainzRelease struct {
+	ID           string                  `json:"id"`
+	ArtistCredit musicBrainzArtistCredit `json:"artist-credit"`
+	ReleaseGroup struct {
+		ID string `json:"id"`
+	} `json:"release-group"`
+	Media []struct {
+		Tracks []struct {
+			ID        string `json:"id"`
+			Recording struct {
+				ID string `json:"id"`
+			} `json:"recording"`
+		} `json:"tracks"`
+	} `json:"media"`
+}
+
+// ResolveByISRC looks up the recording for isrc and, among the releases it
+// appears on, the one titled albumName, preferring one from the year of
+// releaseDate. Without a matching release only the recording and its
+// artists are returned.
+func (c *MusicBrainzClient) ResolveByISRC(ctx context.Context, isrc, albumName, releaseDate string) (*MusicBrainzIDs, error) {
+	isrc = strings.ToUpper(strings.TrimSpace(isrc))
+	if isrc == "" {
+		return nil, fmt.Errorf("ISRC is required")
+	}
+	album := normalizeStringForMatching(albumName)
+	cacheKey := isrc + "|" + album
+
+	c.mu.RLock()
+	cached, ok := c.cache[cacheKey]
+	if !ok {
+		cached, ok = c.cache[isrc]
+	}
+	c.mu.RUnlock()
+	if ok {
+		if cached == nil {
+			return nil, fmt.Errorf("no MusicBrainz recording found for ISRC: %s", isrc)
+		}
+		return cached, nil
+	}
+
+	var lookup musicBrainzISRCResponse
+	err := c.getJSON(ctx, "/isrc/"+url.PathEscape(isrc), "artists+releases", &lookup)
+	if err != nil && !errors.Is(err, errMusicBrainzNotFound) {
+		return nil, err
+	}
+	if len(lookup.Recordings) == 0 {
+		// Whatever the album, the ISRC has no recording.
+		c.store(isrc, nil)
+		return nil, fmt.Errorf("no MusicBrainz recording found for ISRC: %s", isrc)
+	}
+
+	year := ""
+	if len(releaseDate) >= 4 {
+		year = releaseDate[:4]
+	}
+	recording, releaseID, bestScore := 0, "", 0
+	for i, rec := range lookup.Recordings {
+		for _, rel := range rec.Releases {
+			if album == "" || normalizeStringForMatching(rel.Title) != album {
+				continue
+			}
+			score := 1
+			if year != "" && strings.HasPrefix(rel.Date, year) {
+				score++
+			}
+			if score > bestScore {
+				recording, releaseID, bestScore = i, rel.ID, score
+			}
+		}
+	}
+
+	rec := lookup.Recordings[recording]
+	ids := &MusicBrainzIDs{RecordingID: rec.ID, ArtistIDs: rec.ArtistCredit.ids()}
+	if releaseID != "" {
+		var release musicBrainzRelease
+		if err := c.getJSON(ctx, "/release/"+url.PathEscape(releaseID), "artists+recordings+release-groups", &release); err != nil {
+			GoLog("[MusicBrainz] Release lookup failed, keeping recording IDs only: %v\n", err)
+		} else {
+			ids.ReleaseID = release.ID
+			ids.ReleaseGroupID = release.ReleaseGroup.ID
+			ids.AlbumArtistIDs = release.ArtistCredit.ids()
+			for _, medium := range release.Media {
+				for _, track := range medium.Tracks {
+					if track.Recording.ID == ids.RecordingID {
+						ids.ReleaseTrackID = track.ID
+					}
+				}
+			}
+		}
+	} else if album != "" {
+		GoLog("[MusicBrainz] No release titled %q for ISRC %s\n", albumName, isrc)
+	}
+
+	c.store(cacheKey, ids)
+	return ids, nil
+}
+
+func (c *MusicBrainzClient) store(key string, ids *MusicBrainzIDs) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= musicBrainzMaxCacheSize {
+		c.cache = make(map[string]*MusicBrainzIDs)
+	}
+	c.cache[key] = ids
+}
+
+func (c *MusicBrainzClient) getJSON(ctx context.Context, path, inc string, dst interface{}) error {
+	c.mu.RLock()
+	endpoint := c.baseURL + path + "?inc=" + inc + "&fmt=json"
+	c.mu.RUnlock()
+
+	// Lookups run alongside a download with a short timeout; a lookup that
+	// cannot get a slot in time is skipped rather than delaying the file.
+	if err := musicBrainzRateLimiter.WaitForSlotContext(ctx); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	// MusicBrainz asks clients to identify themselves with a contact URL.
+	req.Header.Set("User-Agent", fmt.Sprintf("SpotiFLAC/%s ( https://github.com/zarzet/SpotiFLAC-Mobile )", getBackendVersion()))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", errMusicBrainzNotFound, path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("MusicBrainz API returned status %d", resp.StatusCode)
+	}
+	return json.Unmarshal(body, dst)
+}
+
+// startMusicBrainzLookup resolves the MusicBrainz IDs of a download in the
+// background when the request asks for them. The returned function waits for
+// the lookup and yields nil when it was skipped or found nothing.
+func startMusicBrainzLookup(req DownloadRequest, isrc string) func() *MusicBrainzIDs {
+	if !req.EmbedMusicBrainzIDs || isrc == "" {
+		return func() *MusicBrainzIDs { return nil }
+	}
+	done := make(chan *MusicBrainzIDs, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), musicBrainzLookupTimeout)
+		defer cancel()
+		ids, err := GetMusicBrainzClient().ResolveByISRC(ctx, isrc, req.AlbumName, req.ReleaseDate)
+		if err != nil {
+			GoLog("[MusicBrainz] Lookup failed for ISRC %s: %v\n", isrc, err)
+		}
+		done <- ids
+	}()
+	return sync.OnceValue(func() *MusicBrainzIDs { return <-done })
+}
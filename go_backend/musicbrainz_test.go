@@ -0,0 +1,185 @@
+package gobackend
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-flac/flacvorbis/v2"
+	"github.com/go-flac/go-flac/v2"
+)
+
+const (
+	testMBRecording    = "rec-2"
+	testMBRelease      = "rel-b"
+	testMBReleaseGroup = "rg-b"
+	testMBReleaseTrack = "track-b5"
+)
+
+// newTestMusicBrainzServer serves an ISRC with two recordings, one of which
+// appears on two releases of the album, and the release lookup for the
+// edition from 2004. The returned function counts the requests for a path.
+func newTestMusicBrainzServer(t *testing.T) func(path string) int {
+	t.Helper()
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Query().Get("fmt") != "json" || !strings.HasPrefix(r.Header.Get("User-Agent"), "SpotiFLAC/") {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/ws/2/isrc/USRC17607839":
+			w.Write([]byte(`{"recordings":[
+				{"id":"rec-1","artist-credit":[{"artist":{"id":"artist-1"}}],
+				 "releases":[{"id":"rel-x","title":"Greatest Hits","date":"2010"}]},
+				{"id":"rec-2","artist-credit":[{"artist":{"id":"artist-1"}},{"artist":{"id":"artist-2"}}],
+				 "releases":[{"id":"rel-a","title":"The Album","date":"2019-05-01"},
+				             {"id":"rel-b","title":"The Album!","date":"2004-03-02"}]}]}`))
+		case "/ws/2/release/rel-b":
+			w.Write([]byte(`{"id":"rel-b","artist-credit":[{"artist":{"id":"artist-1"}}],
+				"release-group":{"id":"rg-b"},
+				"media":[{"tracks":[{"id":"track-b4","recording":{"id":"rec-9"}},
+				                    {"id":"track-b5","recording":{"id":"rec-2"}}]}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	GetMusicBrainzClient().SetBaseURL(server.URL + "/ws/2/")
+	t.Cleanup(func() {
+		GetMusicBrainzClient().SetBaseURL("")
+		server.Close()
+	})
+	return func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[path]
+	}
+}
+
+func TestMusicBrainzResolveByISRC(t *testing.T) {
+	requests := newTestMusicBrainzServer(t)
+	client := GetMusicBrainzClient()
+
+	ids, err := client.ResolveByISRC(context.Background(), "usrc17607839", "The Album", "2004-03-02")
+	if err != nil {
+		t.Fatalf("ResolveByISRC: %v", err)
+	}
+	if ids.RecordingID != testMBRecording || ids.ReleaseID != testMBRelease ||
+		ids.ReleaseGroupID != testMBReleaseGroup || ids.ReleaseTrackID != testMBReleaseTrack ||
+		strings.Join(ids.ArtistIDs, ",") != "artist-1,artist-2" || strings.Join(ids.AlbumArtistIDs, ",") != "artist-1" {
+		t.Fatalf("unexpected IDs: %+v", ids)
+	}
+
+	// Without a release of that title only the recording is known.
+	ids, err = client.ResolveByISRC(context.Background(), "USRC17607839", "Another Album", "")
+	if err != nil {
+		t.Fatalf("ResolveByISRC: %v", err)
+	}
+	if ids.RecordingID != "rec-1" || ids.ReleaseID != "" || len(ids.ArtistIDs) != 1 {
+		t.Fatalf("unexpected IDs without album match: %+v", ids)
+	}
+
+	// Unknown ISRCs are remembered, whatever the album.
+	for _, album := range []string{"The Album", "Another Album"} {
+		if _, err := client.ResolveByISRC(context.Background(), "GBAAA0000001", album, ""); err == nil {
+			t.Fatal("expected an error for an unknown ISRC")
+		}
+	}
+	if got := requests("/ws/2/isrc/GBAAA0000001"); got != 1 {
+		t.Fatalf("expected one lookup of the unknown ISRC, got %d", got)
+	}
+}
+
+func TestMusicBrainzIDsEmbedded(t *testing.T) {
+	newTestMusicBrainzServer(t)
+	lookup := startMusicBrainzLookup(DownloadRequest{EmbedMusicBrainzIDs: true, AlbumName: "the album", ReleaseDate: "2004"}, "USRC17607839")
+	ids := lookup()
+	if ids == nil || ids.ReleaseTrackID != testMBReleaseTrack {
+		t.Fatalf("unexpected lookup result: %+v", ids)
+	}
+	if startMusicBrainzLookup(DownloadRequest{}, "USRC17607839")() != nil {
+		t.Fatal("expected no lookup unless the request asks for it")
+	}
+
+	dir := t.TempDir()
+	flacPath := writeTestFLAC(t, dir, "song.flac", 44100, 16)
+	if err := EmbedMetadata(flacPath, Metadata{Title: "Song", MusicBrainz: ids}, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+	f, err := flac.ParseFile(flacPath)
+	if err != nil {
+		t.Fatalf("failed to parse FLAC: %v", err)
+	}
+	var comments []string
+	for _, block := range f.Meta {
+		if block.Type == flac.VorbisComment {
+			cmt, _ := flacvorbis.ParseFromMetaDataBlock(*block)
+			comments = cmt.Comments
+		}
+	}
+	for _, want := range []string{
+		"MUSICBRAINZ_TRACKID=" + testMBRecording,
+		"MUSICBRAINZ_ALBUMID=" + testMBRelease,
+		"MUSICBRAINZ_RELEASEGROUPID=" + testMBReleaseGroup,
+		"MUSICBRAINZ_RELEASETRACKID=" + testMBReleaseTrack,
+		"MUSICBRAINZ_ARTISTID=artist-1",
+		"MUSICBRAINZ_ARTISTID=artist-2",
+		"MUSICBRAINZ_ALBUMARTISTID=artist-1",
+	} {
+		if !strings.Contains(strings.Join(comments, "\n")+"\n", want+"\n") {
+			t.Fatalf("missing %s in %v", want, comments)
+		}
+	}
+
+	mp3Path := writeTestMP3(t, dir, "song.mp3", map[string]string{"TIT2": "Song"})
+	if err := EmbedMetadata(mp3Path, Metadata{MusicBrainz: ids}, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+	data, _ := os.ReadFile(mp3Path)
+	if !bytes.Contains(data, []byte("UFID")) || !bytes.Contains(data, []byte(musicBrainzUFIDOwner+"\x00"+testMBRecording)) {
+		t.Fatal("expected the recording ID in a UFID frame")
+	}
+	if !bytes.Contains(data, []byte("MusicBrainz Artist Id\x00artist-1\x00artist-2")) ||
+		!bytes.Contains(data, []byte("MusicBrainz Release Group Id\x00"+testMBReleaseGroup)) {
+		t.Fatal("expected MusicBrainz TXXX frames")
+	}
+}
+
+func TestMusicBrainzIDsEmbeddedIntoDownloadedFile(t *testing.T) {
+	ids := &MusicBrainzIDs{RecordingID: testMBRecording, ReleaseID: testMBRelease}
+	mp3Path := writeTestMP3(t, t.TempDir(), "song.mp3", map[string]string{"TIT2": "Song"})
+	if err := embedDownloadTags(mp3Path, nil, ids); err != nil {
+		t.Fatalf("embedDownloadTags: %v", err)
+	}
+	data, _ := os.ReadFile(mp3Path)
+	if !bytes.Contains(data, []byte(musicBrainzUFIDOwner+"\x00"+testMBRecording)) ||
+		!bytes.Contains(data, []byte("MusicBrainz Album Id\x00"+testMBRelease)) ||
+		!bytes.Contains(data, []byte("Song")) {
+		t.Fatal("expected MusicBrainz frames next to the existing tags")
+	}
+}
+
+func TestRateLimiterWaitForSlotContextGivesUp(t *testing.T) {
+	limiter := NewRateLimiter(1, time.Hour)
+	if err := limiter.WaitForSlotContext(context.Background()); err != nil {
+		t.Fatalf("expected a free slot, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.WaitForSlotContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected the wait to end with the context, got %v", err)
+	}
+	if len(limiter.timestamps) != 1 {
+		t.Fatal("expected the abandoned wait not to take a slot")
+	}
+}
@@ -0,0 +1,345 @@
+package gobackend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-flac/flacvorbis/v2"
+	"github.com/go-flac/go-flac/v2"
+)
+
+// Ogg page header type flags.
+const (
+	oggFlagContinued = 0x01
+	oggFlagBOS       = 0x02
+	oggFlagEOS       = 0x04
+)
+
+const vorbisPictureKey = "METADATA_BLOCK_PICTURE"
+
+// isOggFile reports whether path names an Ogg Vorbis or Opus file by extension.
+func isOggFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ogg", ".opus":
+		return true
+	}
+	return false
+}
+
+// oggCRCTable is the table for the Ogg page checksum: CRC-32 with polynomial
+// 0x04c11db7, unreflected, with a zero initial value and no final xor.
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 24
+		for range 8 {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// setOggChecksum computes the checksum of a complete page and stores it in
+// the page header.
+func setOggChecksum(page []byte) {
+	binary.LittleEndian.PutUint32(page[22:26], 0)
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	binary.LittleEndian.PutUint32(page[22:26], crc)
+}
+
+// buildOggPage assembles a page from its lacing values and body.
+func buildOggPage(headerType byte, granule uint64, serial, seq uint32, lacing, body []byte) []byte {
+	page := make([]byte, 27, 27+len(lacing)+len(body))
+	copy(page, "OggS")
+	page[5] = headerType
+	binary.LittleEndian.PutUint64(page[6:14], granule)
+	binary.LittleEndian.PutUint32(page[14:18], serial)
+	binary.LittleEndian.PutUint32(page[18:22], seq)
+	page[26] = byte(len(lacing))
+	page = append(append(page, lacing...), body...)
+	setOggChecksum(page)
+	return page
+}
+
+// writeOggHeaderPages lays packets out as pages of the given stream starting
+// at sequence number seq, and returns the next sequence number. Each packet
+// list starts on a fresh page and the last page ends with the last packet.
+// Header pages all carry granule position 0.
+func writeOggHeaderPages(w io.Writer, serial, seq uint32, headerType byte, packets ...[]byte) (uint32, error) {
+	var lacing, body []byte
+	flush := func(continued bool) error {
+		if _, err := w.Write(buildOggPage(headerType, 0, serial, seq, lacing, body)); err != nil {
+			return err
+		}
+		seq++
+		lacing, body = nil, nil
+		headerType = 0
+		if continued {
+			headerType = oggFlagContinued
+		}
+		return nil
+	}
+
+	for _, pkt := range packets {
+		for off := 0; ; {
+			if len(lacing) == 255 {
+				if err := flush(off > 0); err != nil {
+					return seq, err
+				}
+			}
+			n := min(len(pkt)-off, 255)
+			lacing = append(lacing, byte(n))
+			body = append(body, pkt[off:off+n]...)
+			off += n
+			if n < 255 {
+				break
+			}
+		}
+	}
+	return seq, flush(false)
+}
+
+// oggHeaderPacketCount returns how many header packets the codec whose
+// identification header is id uses, or 0 for codecs we cannot tag.
+func oggHeaderPacketCount(id []byte) int {
+	switch {
+	case bytes.HasPrefix(id, []byte("OpusHead")):
+		return 2
+	case len(id) > 7 && id[0] == 0x01 && string(id[1:7]) == "vorbis":
+		return 3
+	}
+	return 0
+}
+
+// oggHeaders are the header packets at the start of an Ogg stream.
+type oggHeaders struct {
+	serial  uint32
+	packets [][]byte
+	nextSeq uint32
+}
+
+// readOggHeaders reads the header packets of the first logical stream in r,
+// leaving r at the first audio page. Both Vorbis and Opus require the audio
+// to start on a fresh page, which is what lets the headers be re-paged
+// without touching the audio pages' contents.
+func readOggHeaders(r io.Reader) (*oggHeaders, error) {
+	var headers oggHeaders
+	var cur []byte
+	want := 0
+
+	for first := true; ; first = false {
+		page, err := readOggPageWithHeader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Ogg headers: %w", err)
+		}
+		serial := binary.LittleEndian.Uint32(page.header[14:18])
+		if first {
+			if page.headerType&oggFlagBOS == 0 {
+				return nil, fmt.Errorf("Ogg stream does not start with a BOS page")
+			}
+			headers.serial = serial
+		} else if serial != headers.serial {
+			return nil, fmt.Errorf("multiplexed Ogg streams are not supported")
+		}
+
+		off := 0
+		for _, seg := range page.segmentTable {
+			if want > 0 && len(headers.packets) == want {
+				return nil, fmt.Errorf("Ogg header page also carries audio data")
+			}
+			cur = append(cur, page.data[off:off+int(seg)]...)
+			off += int(seg)
+			if seg == 255 {
+				continue
+			}
+			headers.packets = append(headers.packets, cur)
+			cur = nil
+			if len(headers.packets) == 1 {
+				if want = oggHeaderPacketCount(headers.packets[0]); want == 0 {
+					return nil, fmt.Errorf("unsupported Ogg codec")
+				}
+			}
+		}
+
+		if want > 0 && len(headers.packets) == want {
+			headers.nextSeq = binary.LittleEndian.Uint32(page.header[18:22]) + 1
+			return &headers, nil
+		}
+	}
+}
+
+// commentPacket splits the comment header packet into its codec-specific
+// prefix and the Vorbis comment block. Opus padding after the comments and
+// the Vorbis framing bit are not part of the block.
+func (h *oggHeaders) commentPacket() (prefix []byte, cmt *flacvorbis.MetaDataBlockVorbisComment, err error) {
+	pkt := h.packets[1]
+	switch {
+	case bytes.HasPrefix(pkt, []byte("OpusTags")):
+		prefix = pkt[:8]
+	case len(pkt) > 7 && pkt[0] == 0x03 && string(pkt[1:7]) == "vorbis":
+		prefix = pkt[:7]
+	default:
+		return nil, nil, fmt.Errorf("Ogg comment header not found")
+	}
+	cmt, err = flacvorbis.ParseFromMetaDataBlock(flac.MetaDataBlock{Type: flac.VorbisComment, Data: pkt[len(prefix):]})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse Vorbis comments: %w", err)
+	}
+	return prefix, cmt, nil
+}
+
+// updateOggTags rewrites the comment header of an Ogg Vorbis or Opus file.
+// The header packets are re-paged, and the audio pages that follow keep their
+// data and granule positions but are renumbered and re-checksummed when the
+// number of header pages changes. The new file replaces the original only
+// once fully written.
+func updateOggTags(filePath string, edit func(cmt *flacvorbis.MetaDataBlockVorbisComment)) error {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open Ogg file: %w", err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(in)
+
+	headers, err := readOggHeaders(r)
+	if err != nil {
+		return err
+	}
+	prefix, cmt, err := headers.commentPacket()
+	if err != nil {
+		return err
+	}
+	edit(cmt)
+
+	packet := append(append([]byte{}, prefix...), cmt.Marshal().Data...)
+	if prefix[0] == 0x03 {
+		packet = append(packet, 0x01)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tags-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	w := bufio.NewWriter(tmp)
+	seq, err := writeOggHeaderPages(w, headers.serial, 0, oggFlagBOS, headers.packets[0])
+	if err == nil {
+		seq, err = writeOggHeaderPages(w, headers.serial, seq, 0, append([][]byte{packet}, headers.packets[2:]...)...)
+	}
+	if err == nil {
+		err = copyOggAudioPages(w, r, headers.serial, seq-headers.nextSeq)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write Ogg file: %w", err)
+	}
+	in.Close()
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("failed to replace Ogg file: %w", err)
+	}
+	return nil
+}
+
+// copyOggAudioPages copies the pages after the headers, shifting the sequence
+// numbers of the tagged stream by delta up to its EOS page.
+func copyOggAudioPages(w io.Writer, r io.Reader, serial, delta uint32) error {
+	if delta == 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	for {
+		page, err := readOggPageWithHeader(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		raw := bytes.Join([][]byte{page.header, page.segmentTable, page.data}, nil)
+		if binary.LittleEndian.Uint32(raw[14:18]) == serial {
+			binary.LittleEndian.PutUint32(raw[18:22], binary.LittleEndian.Uint32(raw[18:22])+delta)
+			setOggChecksum(raw)
+			if page.headerType&oggFlagEOS != 0 {
+				delta = 0
+			}
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+		if delta == 0 {
+			_, err := io.Copy(w, r)
+			return err
+		}
+	}
+}
+
+// removeComments drops every comment named key.
+func removeComments(cmt *flacvorbis.MetaDataBlockVorbisComment, key string) {
+	kept := cmt.Comments[:0]
+	for _, comment := range cmt.Comments {
+		if name, _, ok := strings.Cut(comment, "="); !ok || !strings.EqualFold(name, key) {
+			kept = append(kept, comment)
+		}
+	}
+	cmt.Comments = kept
+}
+
+// setVorbisPicture replaces the embedded cover with coverData, stored as a
+// base64 FLAC picture block the way Ogg files carry pictures.
+func setVorbisPicture(cmt *flacvorbis.MetaDataBlockVorbisComment, coverData []byte) {
+	block, err := buildPictureBlock("", coverData)
+	if err != nil {
+		return
+	}
+	removeComments(cmt, vorbisPictureKey)
+	removeComments(cmt, "COVERART")
+	cmt.Comments = append(cmt.Comments, vorbisPictureKey+"="+base64.StdEncoding.EncodeToString(block.Data))
+}
+
+// embedOggMetadata writes metadata to an Ogg Vorbis or Opus file, keeping
+// the existing cover when coverData is empty.
+func embedOggMetadata(filePath string, metadata Metadata, coverData []byte) error {
+	err := updateOggTags(filePath, func(cmt *flacvorbis.MetaDataBlockVorbisComment) {
+		applyVorbisMetadata(cmt, metadata)
+		if len(coverData) > 0 {
+			setVorbisPicture(cmt, coverData)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if len(coverData) > 0 {
+		fmt.Printf("[Metadata] Cover art embedded successfully (%d bytes)\n", len(coverData))
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-flac/flacvorbis/v2"
+)
+
+var testOggAudio = [][]byte{[]byte("AUDIO-PACKET-1"), []byte("AUDIO-PACKET-2"), []byte("AUDIO-PACKET-3")}
+
+// writeTestOgg writes a stream with the header packets on their own pages,
+// followed by one page per audio packet, the last of them marked EOS.
+func writeTestOgg(t *testing.T, dir, name string, headers ...[]byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	seq, err := writeOggHeaderPages(&buf, 1234, 0, oggFlagBOS, headers[0])
+	if err == nil {
+		seq, err = writeOggHeaderPages(&buf, 1234, seq, 0, headers[1:]...)
+	}
+	if err != nil {
+		t.Fatalf("failed to build Ogg headers: %v", err)
+	}
+	for i, pkt := range testOggAudio {
+		var flags byte
+		if i == len(testOggAudio)-1 {
+			flags = oggFlagEOS
+		}
+		buf.Write(buildOggPage(flags, uint64(960*(i+1)), 1234, seq, []byte{byte(len(pkt))}, pkt))
+		seq++
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write test Ogg: %v", err)
+	}
+	return path
+}
+
+func testVorbisCommentBlock(comments ...string) []byte {
+	return flacvorbis.MetaDataBlockVorbisComment{Vendor: "test", Comments: comments}.Marshal().Data
+}
+
+// checkTestOggPages verifies page checksums bit by bit, sequence numbering
+// and that the audio pages came through unchanged.
+func checkTestOggPages(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open Ogg: %v", err)
+	}
+	defer f.Close()
+
+	var audio []*oggPage
+	for seq := uint32(0); ; seq++ {
+		page, err := readOggPageWithHeader(f)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("page %d: %v", seq, err)
+		}
+		raw := bytes.Join([][]byte{page.header, page.segmentTable, page.data}, nil)
+		want := binary.LittleEndian.Uint32(raw[22:26])
+		binary.LittleEndian.PutUint32(raw[22:26], 0)
+		var crc uint32
+		for _, b := range raw {
+			crc ^= uint32(b) << 24
+			for range 8 {
+				if crc&0x80000000 != 0 {
+					crc = crc<<1 ^ 0x04c11db7
+				} else {
+					crc <<= 1
+				}
+			}
+		}
+		if crc != want {
+			t.Fatalf("page %d: checksum %08x, want %08x", seq, want, crc)
+		}
+		if got := binary.LittleEndian.Uint32(raw[18:22]); got != seq {
+			t.Fatalf("page %d has sequence number %d", seq, got)
+		}
+		if binary.LittleEndian.Uint64(raw[6:14]) != 0 {
+			audio = append(audio, page)
+		}
+	}
+
+	if len(audio) != len(testOggAudio) {
+		t.Fatalf("expected %d audio pages, got %d", len(testOggAudio), len(audio))
+	}
+	for i, page := range audio {
+		if !bytes.Equal(page.data, testOggAudio[i]) || binary.LittleEndian.Uint64(page.header[6:14]) != uint64(960*(i+1)) {
+			t.Fatalf("audio page %d changed: %q", i, page.data)
+		}
+	}
+	if audio[len(audio)-1].headerType&oggFlagEOS == 0 {
+		t.Fatal("expected last page to keep its EOS flag")
+	}
+}
+
+func TestEmbedOggMetadataOpusRoundTrip(t *testing.T) {
+	head := append([]byte("OpusHead"), 1, 2, 0x38, 0x01, 0x80, 0xBB, 0, 0, 0, 0, 0)
+	tags := append([]byte("OpusTags"), testVorbisCommentBlock("TITLE=Old Title", "CUSTOM=kept")...)
+	path := writeTestOgg(t, t.TempDir(), "song.opus", head, tags)
+	// Large enough for the comment packet to span several pages.
+	cover := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{0x42}, 100*1024)...)
+
+	metadata := Metadata{
+		Artist:      "Artist",
+		Album:       "Album",
+		TrackNumber: 5,
+		ISRC:        "USRC17607839",
+		Label:       "Label",
+		Lyrics:      "[00:01.00]Hello",
+		Provenance:  &Provenance{Source: "youtube", SourceTrackID: "abc"},
+	}
+	if err := EmbedMetadataWithCoverData(path, metadata, cover); err != nil {
+		t.Fatalf("EmbedMetadataWithCoverData: %v", err)
+	}
+	checkTestOggPages(t, path)
+
+	read, err := ReadOggVorbisComments(path)
+	if err != nil {
+		t.Fatalf("ReadOggVorbisComments: %v", err)
+	}
+	if read.Title != "Old Title" || read.Artist != "Artist" || read.Album != "Album" ||
+		read.TrackNumber != 5 || read.ISRC != "USRC17607839" || read.Label != "Label" ||
+		read.Lyrics != "[00:01.00]Hello" {
+		t.Fatalf("unexpected tags: %+v", read)
+	}
+	if read.Provenance == nil || read.Provenance.Source != "youtube" || read.Provenance.SourceTrackID != "abc" {
+		t.Fatalf("unexpected provenance: %+v", read.Provenance)
+	}
+	embedded, mime, err := extractOggCoverArt(path)
+	if err != nil || !bytes.Equal(embedded, cover) || mime != "image/jpeg" {
+		t.Fatalf("unexpected cover: %d bytes, %q, %v", len(embedded), mime, err)
+	}
+
+	// Dropping back to a small comment header renumbers the audio pages again.
+	if err := updateOggTags(path, func(cmt *flacvorbis.MetaDataBlockVorbisComment) {
+		removeComments(cmt, vorbisPictureKey)
+	}); err != nil {
+		t.Fatalf("updateOggTags: %v", err)
+	}
+	checkTestOggPages(t, path)
+	data, _ := os.ReadFile(path)
+	if !bytes.Contains(data, []byte("CUSTOM=kept")) {
+		t.Fatal("expected unrelated comments to be kept")
+	}
+}
+
+func TestEditFileMetadataWritesVorbisNatively(t *testing.T) {
+	id := append([]byte("\x01vorbis"), make([]byte, 23)...)
+	comments := append(append([]byte("\x03vorbis"), testVorbisCommentBlock("ARTIST=Old")...), 0x01)
+	setup := append([]byte("\x05vorbis"), bytes.Repeat([]byte{0x07}, 300)...)
+	path := writeTestOgg(t, t.TempDir(), "song.ogg", id, comments, setup)
+
+	resultJSON, err := EditFileMetadata(path, `{"title":"Song","artist":"Artist","genre":"Jazz"}`)
+	if err != nil {
+		t.Fatalf("EditFileMetadata: %v", err)
+	}
+	var result struct {
+		Method string `json:"method"`
+	}
+	json.Unmarshal([]byte(resultJSON), &result)
+	if result.Method != "native" {
+		t.Fatalf("expected native method, got %s", resultJSON)
+	}
+	checkTestOggPages(t, path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open Ogg: %v", err)
+	}
+	defer f.Close()
+	packets, err := collectOggPackets(f, 3, 10)
+	if err != nil || len(packets) != 3 {
+		t.Fatalf("failed to read header packets: %d, %v", len(packets), err)
+	}
+	if packets[1][len(packets[1])-1] != 0x01 {
+		t.Fatal("expected Vorbis comment header to end with the framing bit")
+	}
+	if !bytes.Equal(packets[2], setup) {
+		t.Fatal("expected setup header to be kept")
+	}
+
+	read, err := ReadOggVorbisComments(path)
+	if err != nil {
+		t.Fatalf("ReadOggVorbisComments: %v", err)
+	}
+	if read.Title != "Song" || read.Artist != "Artist" || read.Genre != "Jazz" {
+		t.Fatalf("unexpected tags: %+v", read)
+	}
+}
@@ -4,12 +4,52 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 )
 
 func isFDOutput(outputFD int) bool {
 	return outputFD > 0
 }
 
+var (
+	outputFDFiles   = make(map[int]*os.File)
+	outputFDFilesMu sync.Mutex
+)
+
+// outputFDFile returns the file for a SAF descriptor handed over by the app.
+// Every provider trying the download shares it, and only releaseOutputFD
+// closes it, so the descriptor number cannot be reused by another file while
+// a fallback provider may still write to it.
+func outputFDFile(outputFD int) *os.File {
+	outputFDFilesMu.Lock()
+	defer outputFDFilesMu.Unlock()
+	f := outputFDFiles[outputFD]
+	if f == nil {
+		f = os.NewFile(uintptr(outputFD), fmt.Sprintf("saf_fd_%d", outputFD))
+		outputFDFiles[outputFD] = f
+	}
+	return f
+}
+
+// releaseOutputFD closes a SAF descriptor once its download has finished,
+// whether it succeeded or not. The app hands ownership of the descriptor to
+// the backend and never closes it itself.
+func releaseOutputFD(outputFD int) {
+	if !isFDOutput(outputFD) {
+		return
+	}
+	outputFDFilesMu.Lock()
+	f := outputFDFiles[outputFD]
+	delete(outputFDFiles, outputFD)
+	outputFDFilesMu.Unlock()
+	if f == nil {
+		f = os.NewFile(uintptr(outputFD), fmt.Sprintf("saf_fd_%d", outputFD))
+	}
+	if err := f.Close(); err != nil {
+		GoLog("[Output] Failed to close output descriptor %d: %v\n", outputFD, err)
+	}
+}
+
 func openOutputForWrite(outputPath string, outputFD int) (*os.File, error) {
 	if isFDOutput(outputFD) {
 		return os.NewFile(uintptr(outputFD), fmt.Sprintf("saf_fd_%d", outputFD)), nil
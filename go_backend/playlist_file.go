@@ -0,0 +1,386 @@
+package gobackend
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PlaylistFileRequest describes a playlist file to write next to downloaded
+// tracks. Playlist accepts either the Spotify/Deezer payload
+// (playlist_info/track_list) or the extension playlist payload
+// (name/owner/tracks). Results map tracks to their downloaded files, either by
+// track_id or, when track_id is empty, by position.
+type PlaylistFileRequest struct {
+	Playlist  json.RawMessage       `json:"playlist"`
+	Results   []PlaylistTrackResult `json:"results"`
+	OutputDir string                `json:"output_dir"`
+	Name      string                `json:"name,omitempty"`
+	Formats   []string              `json:"formats,omitempty"`
+	// Update keeps entries from a previously written M3U8 or XSPF for tracks
+	// that have no result in this run, so a re-sync only needs the newly
+	// downloaded files.
+	Update bool `json:"update,omitempty"`
+}
+
+type PlaylistTrackResult struct {
+	TrackID  string `json:"track_id,omitempty"`
+	FilePath string `json:"file_path"`
+}
+
+type PlaylistFileResponse struct {
+	M3U8Path string `json:"m3u8_path,omitempty"`
+	XSPFPath string `json:"xspf_path,omitempty"`
+	Tracks   int    `json:"tracks"`
+	Written  int    `json:"written"`
+	Missing  int    `json:"missing"`
+}
+
+type playlistFileTrack struct {
+	ID         string
+	Title      string
+	Artist     string
+	Album      string
+	DurationMS int
+	RelPath    string
+}
+
+type playlistFileSource struct {
+	Name  string
+	Owner string
+	Items []playlistFileTrack
+}
+
+const (
+	playlistFormatM3U8 = "m3u8"
+	playlistFormatXSPF = "xspf"
+)
+
+func parsePlaylistFileSource(data json.RawMessage) (*playlistFileSource, error) {
+	var raw struct {
+		PlaylistInfo *PlaylistInfoMetadata `json:"playlist_info"`
+		TrackList    []AlbumTrackMetadata  `json:"track_list"`
+		Name         string                `json:"name"`
+		Owner        string                `json:"owner"`
+		Tracks       []struct {
+			ID         string `json:"id"`
+			Name       string `json:"name"`
+			Artists    string `json:"artists"`
+			AlbumName  string `json:"album_name"`
+			DurationMS int    `json:"duration_ms"`
+		} `json:"tracks"`
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("playlist is required")
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid playlist: %w", err)
+	}
+
+	source := &playlistFileSource{}
+	if raw.PlaylistInfo != nil || len(raw.TrackList) > 0 {
+		if raw.PlaylistInfo != nil {
+			// Spotify stores the playlist name in owner.name.
+			source.Name = raw.PlaylistInfo.Owner.Name
+			source.Owner = raw.PlaylistInfo.Owner.DisplayName
+		}
+		for _, track := range raw.TrackList {
+			source.Items = append(source.Items, playlistFileTrack{
+				ID:         track.SpotifyID,
+				Title:      track.Name,
+				Artist:     track.Artists,
+				Album:      track.AlbumName,
+				DurationMS: track.DurationMS,
+			})
+		}
+		return source, nil
+	}
+
+	source.Name = raw.Name
+	source.Owner = raw.Owner
+	for _, track := range raw.Tracks {
+		source.Items = append(source.Items, playlistFileTrack{
+			ID:         track.ID,
+			Title:      track.Name,
+			Artist:     track.Artists,
+			Album:      track.AlbumName,
+			DurationMS: track.DurationMS,
+		})
+	}
+	return source, nil
+}
+
+// playlistRelativePath converts a download result path into a path relative to
+// the playlist directory. SAF results have no filesystem path and are skipped.
+func playlistRelativePath(outputDir, filePath string) string {
+	filePath = strings.TrimPrefix(strings.TrimSpace(filePath), "EXISTS:")
+	if filePath == "" || strings.Contains(filePath, "://") || strings.HasPrefix(filePath, "/proc/self/fd/") {
+		return ""
+	}
+	if !filepath.IsAbs(filePath) {
+		return filepath.ToSlash(filePath)
+	}
+	rel, err := filepath.Rel(outputDir, filePath)
+	if err != nil {
+		return filepath.ToSlash(filePath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// playlistEntryKey is the "artist - title" text of an #EXTINF line. Entries
+// are matched on the whole text rather than splitting it again, as artists
+// and titles may themselves contain " - ".
+func playlistEntryKey(artist, title string) string {
+	return m3uEntryKey(m3uEntryTitle(artist, title))
+}
+
+func m3uEntryTitle(artist, title string) string {
+	return m3uSafe(artist) + " - " + m3uSafe(title)
+}
+
+func m3uEntryKey(text string) string {
+	return strings.ToLower(strings.TrimSpace(text))
+}
+
+// readExistingM3U8 returns the paths of a previously written playlist keyed by
+// the text of each #EXTINF line.
+func readExistingM3U8(path string) map[string]string {
+	entries := make(map[string]string)
+	f, err := os.Open(path)
+	if err != nil {
+		return entries
+	}
+	defer f.Close()
+
+	pendingKey := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXTINF:"):
+			pendingKey = ""
+			info := strings.TrimPrefix(line, "#EXTINF:")
+			if _, text, ok := strings.Cut(info, ","); ok {
+				pendingKey = m3uEntryKey(text)
+			}
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			if pendingKey != "" {
+				entries[pendingKey] = line
+			}
+			pendingKey = ""
+		}
+	}
+	return entries
+}
+
+// readExistingXSPF returns the paths of a previously written XSPF playlist
+// keyed by the artist/title of each track.
+func readExistingXSPF(path string) map[string]string {
+	entries := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return entries
+	}
+	var playlist xspfPlaylist
+	if err := xml.Unmarshal(data, &playlist); err != nil {
+		return entries
+	}
+	for _, track := range playlist.Tracks {
+		location, err := url.Parse(track.Location)
+		if err != nil || location.Path == "" || track.Title == "" {
+			continue
+		}
+		entries[playlistEntryKey(track.Creator, track.Title)] = location.Path
+	}
+	return entries
+}
+
+func renderM3U8(source *playlistFileSource) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	if source.Name != "" {
+		fmt.Fprintf(&b, "#PLAYLIST:%s\n", source.Name)
+	}
+	for _, item := range source.Items {
+		if item.RelPath == "" {
+			continue
+		}
+		seconds := -1
+		if item.DurationMS > 0 {
+			seconds = (item.DurationMS + 500) / 1000
+		}
+		fmt.Fprintf(&b, "#EXTINF:%d,%s\n", seconds, m3uEntryTitle(item.Artist, item.Title))
+		b.WriteString(item.RelPath)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func m3uSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+type xspfPlaylist struct {
+	XMLName   xml.Name    `xml:"playlist"`
+	Version   string      `xml:"version,attr"`
+	Namespace string      `xml:"xmlns,attr"`
+	Title     string      `xml:"title,omitempty"`
+	Creator   string      `xml:"creator,omitempty"`
+	Tracks    []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Album    string `xml:"album,omitempty"`
+	Duration int    `xml:"duration,omitempty"`
+}
+
+func renderXSPF(source *playlistFileSource) ([]byte, error) {
+	playlist := xspfPlaylist{
+		Version:   "1",
+		Namespace: "http://xspf.org/ns/0/",
+		Title:     source.Name,
+		Creator:   source.Owner,
+		Tracks:    []xspfTrack{},
+	}
+	for _, item := range source.Items {
+		if item.RelPath == "" {
+			continue
+		}
+		location := (&url.URL{Path: item.RelPath}).String()
+		playlist.Tracks = append(playlist.Tracks, xspfTrack{
+			Location: location,
+			Title:    item.Title,
+			Creator:  item.Artist,
+			Album:    item.Album,
+			Duration: item.DurationMS,
+		})
+	}
+
+	data, err := xml.MarshalIndent(playlist, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// WritePlaylistFile writes M3U8 and/or XSPF files for a downloaded playlist.
+// Paths inside the files are relative to OutputDir so the folder can be moved
+// or copied to another device as a whole.
+func WritePlaylistFile(req PlaylistFileRequest) (*PlaylistFileResponse, error) {
+	outputDir := strings.TrimSpace(req.OutputDir)
+	if outputDir == "" {
+		return nil, fmt.Errorf("output_dir is required")
+	}
+
+	source, err := parsePlaylistFileSource(req.Playlist)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.Name) != "" {
+		source.Name = strings.TrimSpace(req.Name)
+	}
+	if source.Name == "" {
+		source.Name = "Playlist"
+	}
+
+	formats := make([]string, 0, len(req.Formats))
+	for _, format := range req.Formats {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format == "m3u" {
+			format = playlistFormatM3U8
+		}
+		if format != playlistFormatM3U8 && format != playlistFormatXSPF {
+			return nil, fmt.Errorf("unsupported playlist format: %s", format)
+		}
+		formats = append(formats, format)
+	}
+	if len(formats) == 0 {
+		formats = []string{playlistFormatM3U8}
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	baseName := sanitizeFilename(source.Name)
+	m3u8Path := filepath.Join(outputDir, baseName+".m3u8")
+
+	byID := make(map[string]string)
+	for _, result := range req.Results {
+		if result.TrackID != "" {
+			byID[result.TrackID] = result.FilePath
+		}
+	}
+
+	var previous map[string]string
+	if req.Update {
+		previous = readExistingM3U8(m3u8Path)
+		for key, relPath := range readExistingXSPF(filepath.Join(outputDir, baseName+".xspf")) {
+			if _, ok := previous[key]; !ok {
+				previous[key] = relPath
+			}
+		}
+	}
+
+	resp := &PlaylistFileResponse{Tracks: len(source.Items)}
+	for i := range source.Items {
+		item := &source.Items[i]
+		filePath, ok := byID[item.ID]
+		if !ok && i < len(req.Results) && req.Results[i].TrackID == "" {
+			filePath = req.Results[i].FilePath
+		}
+		item.RelPath = playlistRelativePath(outputDir, filePath)
+		if item.RelPath == "" && previous != nil {
+			item.RelPath = previous[playlistEntryKey(item.Artist, item.Title)]
+		}
+		if item.RelPath == "" {
+			resp.Missing++
+		} else {
+			resp.Written++
+		}
+	}
+
+	for _, format := range formats {
+		switch format {
+		case playlistFormatM3U8:
+			if err := writeFileAtomic(m3u8Path, []byte(renderM3U8(source))); err != nil {
+				return nil, fmt.Errorf("failed to write m3u8: %w", err)
+			}
+			resp.M3U8Path = m3u8Path
+		case playlistFormatXSPF:
+			data, err := renderXSPF(source)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build xspf: %w", err)
+			}
+			xspfPath := filepath.Join(outputDir, baseName+".xspf")
+			if err := writeFileAtomic(xspfPath, data); err != nil {
+				return nil, fmt.Errorf("failed to write xspf: %w", err)
+			}
+			resp.XSPFPath = xspfPath
+		}
+	}
+
+	GoLog("[Playlist] Wrote %q: %d/%d tracks\n", source.Name, resp.Written, resp.Tracks)
+	return resp, nil
+}
@@ -0,0 +1,127 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWritePlaylistFile_M3U8AndXSPF(t *testing.T) {
+	dir := t.TempDir()
+	playlist := PlaylistResponsePayload{
+		TrackList: []AlbumTrackMetadata{
+			{SpotifyID: "a", Name: "First Song", Artists: "Artist A", DurationMS: 180400},
+			{SpotifyID: "b", Name: "Second & Co", Artists: "Artist B", DurationMS: 200000},
+			{SpotifyID: "c", Name: "Missing", Artists: "Artist C"},
+		},
+	}
+	playlist.PlaylistInfo.Owner.Name = "Road/Trip"
+	playlist.PlaylistInfo.Owner.DisplayName = "someone"
+	payload, _ := json.Marshal(playlist)
+
+	resp, err := WritePlaylistFile(PlaylistFileRequest{
+		Playlist:  payload,
+		OutputDir: dir,
+		Formats:   []string{"m3u8", "xspf"},
+		Results: []PlaylistTrackResult{
+			{TrackID: "b", FilePath: "EXISTS:" + filepath.Join(dir, "Artist B", "Second & Co.flac")},
+			{TrackID: "a", FilePath: filepath.Join(dir, "First Song.flac")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("WritePlaylistFile failed: %v", err)
+	}
+	if resp.Written != 2 || resp.Missing != 1 {
+		t.Fatalf("unexpected counts: %+v", resp)
+	}
+	if filepath.Base(resp.M3U8Path) != "Road_Trip.m3u8" {
+		t.Fatalf("unexpected m3u8 path: %s", resp.M3U8Path)
+	}
+
+	m3u, err := os.ReadFile(resp.M3U8Path)
+	if err != nil {
+		t.Fatalf("failed to read m3u8: %v", err)
+	}
+	want := "#EXTM3U\n#PLAYLIST:Road/Trip\n" +
+		"#EXTINF:180,Artist A - First Song\nFirst Song.flac\n" +
+		"#EXTINF:200,Artist B - Second & Co\nArtist B/Second & Co.flac\n"
+	if string(m3u) != want {
+		t.Fatalf("unexpected m3u8:\n%s", m3u)
+	}
+
+	xspf, err := os.ReadFile(resp.XSPFPath)
+	if err != nil {
+		t.Fatalf("failed to read xspf: %v", err)
+	}
+	if !strings.Contains(string(xspf), "<location>Artist%20B/Second%20&amp;%20Co.flac</location>") {
+		t.Fatalf("unexpected xspf location:\n%s", xspf)
+	}
+}
+
+func TestWritePlaylistFile_UpdateKeepsPreviousEntries(t *testing.T) {
+	dir := t.TempDir()
+	// Both the artist and the title contain the " - " separator.
+	payload := []byte(`{"name":"Mix","tracks":[
+		{"id":"1","name":"Old - Live","artists":"X - Y","duration_ms":1000},
+		{"id":"2","name":"New","artists":"Y","duration_ms":2000}]}`)
+
+	if _, err := WritePlaylistFile(PlaylistFileRequest{
+		Playlist:  []byte(`{"name":"Mix","tracks":[{"id":"1","name":"Old - Live","artists":"X - Y"}]}`),
+		OutputDir: dir,
+		Results:   []PlaylistTrackResult{{FilePath: filepath.Join(dir, "old.flac")}},
+	}); err != nil {
+		t.Fatalf("initial write failed: %v", err)
+	}
+
+	resp, err := WritePlaylistFile(PlaylistFileRequest{
+		Playlist:  payload,
+		OutputDir: dir,
+		Update:    true,
+		Results:   []PlaylistTrackResult{{TrackID: "2", FilePath: filepath.Join(dir, "new.flac")}},
+	})
+	if err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if resp.Written != 2 {
+		t.Fatalf("expected previous entry to be kept, got %+v", resp)
+	}
+
+	m3u, _ := os.ReadFile(resp.M3U8Path)
+	if !strings.Contains(string(m3u), "#EXTINF:1,X - Y - Old - Live\nold.flac\n#EXTINF:2,Y - New\nnew.flac\n") {
+		t.Fatalf("unexpected updated m3u8:\n%s", m3u)
+	}
+}
+
+func TestWritePlaylistFile_UpdateReadsPreviousXSPF(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := WritePlaylistFile(PlaylistFileRequest{
+		Playlist:  []byte(`{"name":"Mix","tracks":[{"id":"1","name":"Old","artists":"X"}]}`),
+		OutputDir: dir,
+		Formats:   []string{"xspf"},
+		Results:   []PlaylistTrackResult{{FilePath: filepath.Join(dir, "old song.flac")}},
+	}); err != nil {
+		t.Fatalf("initial write failed: %v", err)
+	}
+
+	resp, err := WritePlaylistFile(PlaylistFileRequest{
+		Playlist: []byte(`{"name":"Mix","tracks":[
+			{"id":"1","name":"Old","artists":"X"},
+			{"id":"2","name":"New","artists":"Y"}]}`),
+		OutputDir: dir,
+		Formats:   []string{"xspf"},
+		Update:    true,
+		Results:   []PlaylistTrackResult{{TrackID: "2", FilePath: filepath.Join(dir, "new.flac")}},
+	})
+	if err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if resp.Written != 2 {
+		t.Fatalf("expected the XSPF entry to be kept, got %+v", resp)
+	}
+	xspf, _ := os.ReadFile(resp.XSPFPath)
+	if !strings.Contains(string(xspf), "<location>old%20song.flac</location>") {
+		t.Fatalf("unexpected updated xspf:\n%s", xspf)
+	}
+}
@@ -0,0 +1,486 @@
+package gobackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PlaylistSyncRequest keeps OutputDir in step with a Spotify, Deezer or
+// extension playlist: tracks already on disk are left alone and only the
+// missing ones are queued. Settings carries the per-track download options,
+// as in AlbumDownloadRequest.
+type PlaylistSyncRequest struct {
+	URL           string          `json:"url"`
+	OutputDir     string          `json:"output_dir"`
+	Settings      DownloadRequest `json:"settings"`
+	DryRun        bool            `json:"dry_run,omitempty"`
+	ReportRemoved bool            `json:"report_removed,omitempty"`
+}
+
+const (
+	PlaylistTrackPresent = "present"
+	PlaylistTrackMissing = "missing"
+	PlaylistTrackQueued  = "queued"
+	PlaylistTrackRemoved = "removed"
+)
+
+type PlaylistSyncTrack struct {
+	Index      int    `json:"index"`
+	TrackName  string `json:"track_name"`
+	ArtistName string `json:"artist_name"`
+	AlbumName  string `json:"album_name,omitempty"`
+	ISRC       string `json:"isrc,omitempty"`
+	SpotifyID  string `json:"spotify_id,omitempty"`
+	Status     string `json:"status,omitempty"`
+	MatchedBy  string `json:"matched_by,omitempty"` // "isrc" or "title_artist"
+	FilePath   string `json:"file_path,omitempty"`
+	ItemID     string `json:"item_id,omitempty"`
+}
+
+type PlaylistSyncResponse struct {
+	Success   bool                `json:"success"`
+	Name      string              `json:"name"`
+	OutputDir string              `json:"output_dir"`
+	DryRun    bool                `json:"dry_run,omitempty"`
+	Total     int                 `json:"total"`
+	Present   int                 `json:"present"`
+	Missing   int                 `json:"missing"`
+	Queued    int                 `json:"queued"`
+	Tracks    []PlaylistSyncTrack `json:"tracks"`
+	Removed   []PlaylistSyncTrack `json:"removed,omitempty"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// syncPlaylist is a fetched playlist in the shape shared by all sources.
+// Source is the extension ID for extension playlists and empty otherwise.
+type syncPlaylist struct {
+	Name   string
+	Source string
+	Tracks []AlbumTrackMetadata
+}
+
+// playlistSyncState is what the previous sync saw upstream. It lives in the
+// output directory so removals can be reported on the next sync.
+type playlistSyncState struct {
+	URL      string              `json:"url"`
+	Name     string              `json:"name"`
+	SyncedAt int64               `json:"synced_at"`
+	Tracks   []PlaylistSyncTrack `json:"tracks"`
+}
+
+// fetchPlaylistForSync is swapped out in tests.
+var fetchPlaylistForSync = fetchSyncPlaylist
+
+func fetchSyncPlaylist(playlistURL string) (*syncPlaylist, error) {
+	if resourceType, id, err := parseDeezerURL(playlistURL); err == nil {
+		if resourceType != "playlist" {
+			return nil, fmt.Errorf("URL is a Deezer %s, not a playlist", resourceType)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		payload, err := GetDeezerClient().GetPlaylist(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch playlist: %w", err)
+		}
+		return &syncPlaylist{Name: payload.PlaylistInfo.Owner.Name, Tracks: payload.TrackList}, nil
+	}
+
+	if _, err := ParseSpotifyURL(playlistURL); err == nil {
+		data, err := GetSpotifyMetadataWithDeezerFallback(playlistURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch playlist: %w", err)
+		}
+		var payload PlaylistResponsePayload
+		if err := json.Unmarshal([]byte(data), &payload); err != nil {
+			return nil, fmt.Errorf("failed to parse playlist metadata: %w", err)
+		}
+		return &syncPlaylist{Name: payload.PlaylistInfo.Owner.Name, Tracks: payload.TrackList}, nil
+	}
+
+	handled, err := GetExtensionManager().HandleURLWithExtension(playlistURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch playlist: %w", err)
+	}
+	if handled.Result == nil || handled.Result.Type != "playlist" {
+		return nil, fmt.Errorf("URL did not resolve to a playlist")
+	}
+
+	playlist := &syncPlaylist{Name: handled.Result.Name, Source: handled.ExtensionID}
+	for _, track := range handled.Result.Tracks {
+		playlist.Tracks = append(playlist.Tracks, AlbumTrackMetadata{
+			SpotifyID:   track.ID,
+			Artists:     track.Artists,
+			Name:        track.Name,
+			AlbumName:   track.AlbumName,
+			AlbumArtist: track.AlbumArtist,
+			DurationMS:  track.DurationMS,
+			Images:      track.ResolvedCoverURL(),
+			ReleaseDate: track.ReleaseDate,
+			TrackNumber: track.TrackNumber,
+			DiscNumber:  track.DiscNumber,
+			ISRC:        track.ISRC,
+		})
+	}
+	return playlist, nil
+}
+
+type localTrack struct {
+	path   string
+	isrc   string
+	title  string
+	artist string
+}
+
+// localTrackIndex covers every audio file under a directory, not just the
+// FLAC files in ISRCIndex, so tracks without an ISRC can still be matched on
+// title and artist.
+type localTrackIndex struct {
+	byISRC map[string]string
+	tracks []localTrack
+}
+
+func buildLocalTrackIndex(outputDir string) *localTrackIndex {
+	idx := &localTrackIndex{byISRC: make(map[string]string)}
+	if outputDir == "" {
+		return idx
+	}
+
+	filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if !supportedAudioFormats[strings.ToLower(filepath.Ext(path))] || isStagingFile(path) {
+			return nil
+		}
+
+		track := readLocalTrack(path)
+		if track.isrc != "" {
+			idx.byISRC[track.isrc] = path
+		}
+		idx.tracks = append(idx.tracks, track)
+		return nil
+	})
+	return idx
+}
+
+func readLocalTrack(path string) localTrack {
+	track := localTrack{path: path}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		if metadata, err := ReadMetadata(path); err == nil {
+			track.isrc, track.title, track.artist = metadata.ISRC, metadata.Title, metadata.Artist
+		}
+	case ".mp3":
+		if metadata, err := ReadID3Tags(path); err == nil {
+			track.isrc, track.title, track.artist = metadata.ISRC, metadata.Title, metadata.Artist
+		}
+	case ".ogg", ".opus":
+		if metadata, err := ReadOggVorbisComments(path); err == nil {
+			track.isrc, track.title, track.artist = metadata.ISRC, metadata.Title, metadata.Artist
+		}
+	case ".m4a", ".mp4":
+		if metadata, err := readM4ATags(path); err == nil {
+			track.isrc, track.title, track.artist = metadata.ISRC, metadata.Title, metadata.Artist
+		}
+	}
+
+	if track.title == "" {
+		fromName, _ := scanFromFilename(path, &LibraryScanResult{})
+		track.title = fromName.TrackName
+		if fromName.ArtistName != "Unknown Artist" {
+			track.artist = fromName.ArtistName
+		}
+	}
+	track.isrc = strings.ToUpper(strings.TrimSpace(track.isrc))
+	return track
+}
+
+// matchKey normalizes a title or artist for comparison, keeping non-Latin
+// text that normalizeStringForMatching would strip entirely.
+func matchKey(s string) string {
+	if key := normalizeStringForMatching(s); key != "" {
+		return key
+	}
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// playlistArtistsOverlap reports whether any artist credited upstream also
+// appears in the local artist tag.
+func playlistArtistsOverlap(upstream, local string) bool {
+	localArtists := make(map[string]bool)
+	for _, artist := range splitArtists(strings.ToLower(local)) {
+		localArtists[matchKey(artist)] = true
+	}
+	for _, artist := range splitArtists(strings.ToLower(upstream)) {
+		if localArtists[matchKey(artist)] {
+			return true
+		}
+	}
+	return false
+}
+
+// findTitleArtist returns the file whose title and artist match track. Files
+// whose artist is unknown match on title alone only when the title is unique.
+func (idx *localTrackIndex) findTitleArtist(track AlbumTrackMetadata) (string, bool) {
+	title := matchKey(track.Name)
+	if title == "" {
+		return "", false
+	}
+
+	titleOnly := ""
+	titleOnlyCount := 0
+	for _, local := range idx.tracks {
+		if matchKey(local.title) != title {
+			continue
+		}
+		if local.artist == "" {
+			titleOnly = local.path
+			titleOnlyCount++
+			continue
+		}
+		if playlistArtistsOverlap(track.Artists, local.artist) {
+			return local.path, true
+		}
+	}
+	if titleOnlyCount == 1 {
+		return titleOnly, true
+	}
+	return "", false
+}
+
+// matchPlaylistTrack looks track up by ISRC in the shared ISRC index and the
+// local index, then falls back to title and artist.
+func matchPlaylistTrack(track AlbumTrackMetadata, isrcIndex *ISRCIndex, local *localTrackIndex) (string, string) {
+	if isrc := strings.ToUpper(strings.TrimSpace(track.ISRC)); isrc != "" {
+		if path, ok := isrcIndex.lookup(isrc); ok {
+			return path, "isrc"
+		}
+		if path, ok := local.byISRC[isrc]; ok {
+			return path, "isrc"
+		}
+	}
+	if path, ok := local.findTitleArtist(track); ok {
+		return path, "title_artist"
+	}
+	return "", ""
+}
+
+// playlistTrackKeys identifies a track across syncs by ID, ISRC and
+// title/artist, so a track whose ID changed upstream is not reported removed.
+func playlistTrackKeys(spotifyID, isrc, name, artists string) []string {
+	var keys []string
+	if spotifyID != "" {
+		keys = append(keys, "id:"+spotifyID)
+	}
+	if isrc != "" {
+		keys = append(keys, "isrc:"+strings.ToUpper(isrc))
+	}
+	if title := matchKey(name); title != "" {
+		keys = append(keys, "name:"+title+"|"+matchKey(artists))
+	}
+	return keys
+}
+
+func playlistSyncStatePath(outputDir, playlistURL string) string {
+	return filepath.Join(outputDir, fmt.Sprintf(".spotiflac_sync_%08x.json", hashString(playlistURL)))
+}
+
+func loadPlaylistSyncState(path string) *playlistSyncState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var state playlistSyncState
+	if err := json.Unmarshal(data, &state); err != nil {
+		GoLog("[PlaylistSync] Ignoring unreadable sync state %s: %v\n", path, err)
+		return nil
+	}
+	return &state
+}
+
+// playlistSyncItemID is the queue ID of a playlist track. It is the same on
+// every sync, so a track that is still queued from an earlier sync is not
+// queued twice.
+func playlistSyncItemID(playlistURL string, track AlbumTrackMetadata) string {
+	key := track.Name + "|" + track.Artists
+	if keys := playlistTrackKeys(track.SpotifyID, track.ISRC, track.Name, track.Artists); len(keys) > 0 {
+		key = keys[0]
+	}
+	return fmt.Sprintf("sync_%08x_%08x", hashString(playlistURL), hashString(key))
+}
+
+// buildPlaylistTrackRequest fills a per-track DownloadRequest from the
+// shared settings and the playlist track.
+func buildPlaylistTrackRequest(settings DownloadRequest, playlist *syncPlaylist, playlistURL string, track AlbumTrackMetadata, outputDir string) DownloadRequest {
+	req := settings
+
+	req.TrackName = track.Name
+	req.ArtistName = track.Artists
+	req.AlbumName = track.AlbumName
+	req.AlbumArtist = track.AlbumArtist
+	req.SpotifyID = track.SpotifyID
+	req.ISRC = track.ISRC
+	req.CoverURL = track.Images
+	req.ReleaseDate = track.ReleaseDate
+	req.TrackNumber = track.TrackNumber
+	req.DiscNumber = track.DiscNumber
+	req.TotalTracks = track.TotalTracks
+	req.DurationMS = track.DurationMS
+	req.OutputDir = outputDir
+	req.OutputPath = ""
+	req.OutputFD = 0
+	req.ItemID = playlistSyncItemID(playlistURL, track)
+
+	if playlist.Source != "" {
+		req.Source = playlist.Source
+	}
+	if deezerID, ok := strings.CutPrefix(track.SpotifyID, "deezer:"); ok {
+		req.DeezerID = deezerID
+	}
+	return req
+}
+
+// syncPlaylistTracks diffs playlist against the files in req.OutputDir and
+// hands the missing tracks to enqueue. enqueue is not called on a dry run.
+func syncPlaylistTracks(req PlaylistSyncRequest, playlist *syncPlaylist, enqueue func([]DownloadRequest) ([]string, error)) (*PlaylistSyncResponse, error) {
+	outputDir := firstNonEmpty(req.OutputDir, req.Settings.OutputDir)
+	if outputDir == "" {
+		return nil, fmt.Errorf("output_dir is required")
+	}
+
+	isrcIndex := GetISRCIndex(outputDir)
+	local := buildLocalTrackIndex(outputDir)
+
+	resp := &PlaylistSyncResponse{
+		Success:   true,
+		Name:      playlist.Name,
+		OutputDir: outputDir,
+		DryRun:    req.DryRun,
+		Total:     len(playlist.Tracks),
+		Tracks:    make([]PlaylistSyncTrack, 0, len(playlist.Tracks)),
+	}
+
+	var missing []DownloadRequest
+	var missingIdx []int
+	upstreamKeys := make(map[string]bool)
+	for i, track := range playlist.Tracks {
+		for _, key := range playlistTrackKeys(track.SpotifyID, track.ISRC, track.Name, track.Artists) {
+			upstreamKeys[key] = true
+		}
+
+		entry := PlaylistSyncTrack{
+			Index:      i,
+			TrackName:  track.Name,
+			ArtistName: track.Artists,
+			AlbumName:  track.AlbumName,
+			ISRC:       track.ISRC,
+			SpotifyID:  track.SpotifyID,
+		}
+		if path, matchedBy := matchPlaylistTrack(track, isrcIndex, local); path != "" {
+			entry.Status = PlaylistTrackPresent
+			entry.MatchedBy = matchedBy
+			entry.FilePath = path
+			resp.Present++
+		} else {
+			entry.Status = PlaylistTrackMissing
+			missing = append(missing, buildPlaylistTrackRequest(req.Settings, playlist, req.URL, track, outputDir))
+			missingIdx = append(missingIdx, i)
+			resp.Missing++
+		}
+		resp.Tracks = append(resp.Tracks, entry)
+	}
+
+	statePath := playlistSyncStatePath(outputDir, req.URL)
+	if req.ReportRemoved {
+		if previous := loadPlaylistSyncState(statePath); previous != nil {
+			for _, old := range previous.Tracks {
+				stillThere := false
+				for _, key := range playlistTrackKeys(old.SpotifyID, old.ISRC, old.TrackName, old.ArtistName) {
+					if upstreamKeys[key] {
+						stillThere = true
+						break
+					}
+				}
+				if stillThere {
+					continue
+				}
+				removed := PlaylistSyncTrack{
+					Index:      old.Index,
+					TrackName:  old.TrackName,
+					ArtistName: old.ArtistName,
+					AlbumName:  old.AlbumName,
+					ISRC:       old.ISRC,
+					SpotifyID:  old.SpotifyID,
+					Status:     PlaylistTrackRemoved,
+				}
+				removed.FilePath, removed.MatchedBy = matchPlaylistTrack(AlbumTrackMetadata{
+					Name:    old.TrackName,
+					Artists: old.ArtistName,
+					ISRC:    old.ISRC,
+				}, isrcIndex, local)
+				resp.Removed = append(resp.Removed, removed)
+			}
+		}
+	}
+
+	if req.DryRun {
+		return resp, nil
+	}
+
+	if len(missing) > 0 {
+		// The queue skips tracks still queued by an earlier sync, so every
+		// missing track is in the queue once this returns.
+		if _, err := enqueue(missing); err != nil {
+			return nil, err
+		}
+		for i, idx := range missingIdx {
+			entry := &resp.Tracks[idx]
+			entry.Status = PlaylistTrackQueued
+			entry.ItemID = missing[i].ItemID
+		}
+		resp.Queued = len(missing)
+	}
+
+	state := playlistSyncState{
+		URL:      req.URL,
+		Name:     playlist.Name,
+		SyncedAt: time.Now().UnixMilli(),
+		Tracks:   make([]PlaylistSyncTrack, 0, len(resp.Tracks)),
+	}
+	for _, entry := range resp.Tracks {
+		state.Tracks = append(state.Tracks, PlaylistSyncTrack{
+			Index:      entry.Index,
+			TrackName:  entry.TrackName,
+			ArtistName: entry.ArtistName,
+			AlbumName:  entry.AlbumName,
+			ISRC:       entry.ISRC,
+			SpotifyID:  entry.SpotifyID,
+		})
+	}
+	if data, err := json.Marshal(state); err == nil {
+		if err := writeFileAtomic(statePath, data); err != nil {
+			GoLog("[PlaylistSync] Failed to save sync state: %v\n", err)
+		}
+	}
+
+	GoLog("[PlaylistSync] %s: %d tracks, %d present, %d queued, %d removed upstream\n",
+		playlist.Name, resp.Total, resp.Present, resp.Queued, len(resp.Removed))
+	return resp, nil
+}
+
+func syncPlaylistFromURL(req PlaylistSyncRequest) (*PlaylistSyncResponse, error) {
+	if strings.TrimSpace(req.URL) == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	playlist, err := fetchPlaylistForSync(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	return syncPlaylistTracks(req, playlist, GetDownloadQueue().Enqueue)
+}
@@ -0,0 +1,126 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncPlaylistQueuesOnlyMissing(t *testing.T) {
+	dir := t.TempDir()
+	flacPath := writeTestFLAC(t, dir, "tagged.flac", 44100, 16)
+	if err := EmbedMetadata(flacPath, Metadata{Title: "Tagged", Artist: "Band", ISRC: "USAAA0000001"}, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+	namedPath := filepath.Join(dir, "Band - Second Song.mp3")
+	if err := os.WriteFile(namedPath, []byte("not really audio"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	playlist := &syncPlaylist{
+		Name: "Mix",
+		Tracks: []AlbumTrackMetadata{
+			{SpotifyID: "sp1", Name: "Renamed Upstream", Artists: "Someone", ISRC: "usaaa0000001"},
+			{SpotifyID: "sp2", Name: "Second Song (Remastered)", Artists: "Band, Guest"},
+			{SpotifyID: "deezer:3", Name: "Third", Artists: "Band", ISRC: "USAAA0000003"},
+		},
+	}
+
+	var queued []DownloadRequest
+	enqueue := func(reqs []DownloadRequest) ([]string, error) {
+		queued = append(queued, reqs...)
+		ids := make([]string, len(reqs))
+		for i := range reqs {
+			ids[i] = "q" + reqs[i].SpotifyID
+		}
+		return ids, nil
+	}
+
+	req := PlaylistSyncRequest{URL: "https://example.com/playlist/1", OutputDir: dir, Settings: DownloadRequest{Service: "tidal"}}
+	resp, err := syncPlaylistTracks(req, playlist, enqueue)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if resp.Present != 2 || resp.Missing != 1 || resp.Queued != 1 {
+		t.Fatalf("unexpected counts: %+v", resp)
+	}
+	if resp.Tracks[0].MatchedBy != "isrc" || resp.Tracks[0].FilePath != flacPath {
+		t.Fatalf("expected ISRC match, got %+v", resp.Tracks[0])
+	}
+	if resp.Tracks[1].MatchedBy != "title_artist" || resp.Tracks[1].FilePath != namedPath {
+		t.Fatalf("expected title/artist match, got %+v", resp.Tracks[1])
+	}
+	if resp.Tracks[2].Status != PlaylistTrackQueued || resp.Tracks[2].ItemID != playlistSyncItemID(req.URL, playlist.Tracks[2]) {
+		t.Fatalf("expected third track queued, got %+v", resp.Tracks[2])
+	}
+	if len(queued) != 1 || queued[0].OutputDir != dir || queued[0].Service != "tidal" || queued[0].DeezerID != "3" {
+		t.Fatalf("unexpected queued requests: %+v", queued)
+	}
+
+	// The first track disappears upstream; it is still on disk.
+	playlist.Tracks = playlist.Tracks[1:]
+	req.ReportRemoved = true
+	req.DryRun = true
+	queued = nil
+	resp, err = syncPlaylistTracks(req, playlist, enqueue)
+	if err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if len(queued) != 0 || resp.Queued != 0 {
+		t.Fatalf("dry run must not queue, got %+v", queued)
+	}
+	if len(resp.Removed) != 1 || resp.Removed[0].SpotifyID != "sp1" || resp.Removed[0].FilePath != flacPath {
+		t.Fatalf("expected sp1 reported removed with its file, got %+v", resp.Removed)
+	}
+}
+
+func TestSyncPlaylistDoesNotQueueTwice(t *testing.T) {
+	dir := t.TempDir()
+	playlist := &syncPlaylist{Name: "Mix", Tracks: []AlbumTrackMetadata{{SpotifyID: "sp1", Name: "One", Artists: "Band"}}}
+	req := PlaylistSyncRequest{URL: "https://example.com/playlist/1", OutputDir: dir}
+
+	if _, err := syncPlaylistTracks(req, playlist, newDownloadQueue().Enqueue); err == nil {
+		t.Fatal("expected an error while the queue is not initialized")
+	}
+
+	q := newDownloadQueue()
+	if err := q.SetDataDir(t.TempDir()); err != nil {
+		t.Fatalf("SetDataDir failed: %v", err)
+	}
+	q.SetPaused(true)
+	for i := 0; i < 2; i++ {
+		resp, err := syncPlaylistTracks(req, playlist, q.Enqueue)
+		if err != nil {
+			t.Fatalf("sync %d: %v", i, err)
+		}
+		if resp.Queued != 1 || resp.Tracks[0].ItemID == "" {
+			t.Fatalf("sync %d: expected the track reported queued, got %+v", i, resp)
+		}
+	}
+	if items := q.snapshot().Items; len(items) != 1 {
+		t.Fatalf("expected the track queued once, got %d items", len(items))
+	}
+}
+
+func TestFindTitleArtistRequiresArtistOverlap(t *testing.T) {
+	idx := &localTrackIndex{tracks: []localTrack{
+		{path: "/a.flac", title: "Intro", artist: "Other Band"},
+		{path: "/b.flac", title: "Intro", artist: "Band"},
+	}}
+	if path, ok := idx.findTitleArtist(AlbumTrackMetadata{Name: "Intro", Artists: "Band"}); !ok || path != "/b.flac" {
+		t.Fatalf("expected /b.flac, got %q", path)
+	}
+	if _, ok := idx.findTitleArtist(AlbumTrackMetadata{Name: "Intro", Artists: "Nobody"}); ok {
+		t.Fatalf("expected no match for unrelated artist")
+	}
+}
+
+func TestReadLocalTrackReadsM4ATags(t *testing.T) {
+	path := writeTestM4A(t, t.TempDir())
+	if err := embedM4AMetadata(path, Metadata{Title: "Song", Artist: "Band", ISRC: "usaaa0000009"}, nil); err != nil {
+		t.Fatalf("embedM4AMetadata: %v", err)
+	}
+	if track := readLocalTrack(path); track.isrc != "USAAA0000009" || track.title != "Song" || track.artist != "Band" {
+		t.Fatalf("unexpected local track: %+v", track)
+	}
+}
@@ -90,6 +90,7 @@ func StartItemProgress(itemID string) {
 		IsDownloading: true,
 		Status:        "downloading",
 	}
+	emitItemProgress(multiProgress.Items[itemID])
 }
 
 func SetItemBytesTotal(itemID string, total int64) {
@@ -98,6 +99,7 @@ func SetItemBytesTotal(itemID string, total int64) {
 
 	if item, ok := multiProgress.Items[itemID]; ok {
 		item.BytesTotal = total
+		emitItemProgress(item)
 	}
 }
 
@@ -110,6 +112,7 @@ func SetItemBytesReceived(itemID string, received int64) {
 		if item.BytesTotal > 0 {
 			item.Progress = float64(received) / float64(item.BytesTotal)
 		}
+		emitItemProgress(item)
 	}
 }
 
@@ -123,6 +126,7 @@ func SetItemBytesReceivedWithSpeed(itemID string, received int64, speedMBps floa
 		if item.BytesTotal > 0 {
 			item.Progress = float64(received) / float64(item.BytesTotal)
 		}
+		emitItemProgress(item)
 	}
 }
 
@@ -134,6 +138,7 @@ func CompleteItemProgress(itemID string) {
 		item.Progress = 1.0
 		item.IsDownloading = false
 		item.Status = "completed"
+		emitItemProgress(item)
 	}
 }
 
@@ -149,6 +154,7 @@ func SetItemProgress(itemID string, progress float64, bytesReceived, bytesTotal
 		if bytesTotal > 0 {
 			item.BytesTotal = bytesTotal
 		}
+		emitItemProgress(item)
 	}
 }
 
@@ -159,6 +165,7 @@ func SetItemFinalizing(itemID string) {
 	if item, ok := multiProgress.Items[itemID]; ok {
 		item.Progress = 1.0
 		item.Status = "finalizing"
+		emitItemProgress(item)
 	}
 }
 
@@ -166,13 +173,19 @@ func RemoveItemProgress(itemID string) {
 	multiMu.Lock()
 	defer multiMu.Unlock()
 
-	delete(multiProgress.Items, itemID)
+	if _, ok := multiProgress.Items[itemID]; ok {
+		delete(multiProgress.Items, itemID)
+		emitItemRemoved(itemID)
+	}
 }
 
 func ClearAllItemProgress() {
 	multiMu.Lock()
 	defer multiMu.Unlock()
 
+	for itemID := range multiProgress.Items {
+		emitItemRemoved(itemID)
+	}
 	multiProgress.Items = make(map[string]*ItemProgress)
 }
 
@@ -208,6 +221,16 @@ func NewItemProgressWriter(w interface{ Write([]byte) (int, error) }, itemID str
 	}
 }
 
+// NewItemProgressWriterAt is NewItemProgressWriter for a transfer that resumes
+// at offset, so reported bytes continue from what is already on disk.
+func NewItemProgressWriterAt(w interface{ Write([]byte) (int, error) }, itemID string, offset int64) *ItemProgressWriter {
+	pw := NewItemProgressWriter(w, itemID)
+	pw.current = offset
+	pw.lastReported = offset
+	pw.lastBytes = offset
+	return pw
+}
+
 func (pw *ItemProgressWriter) Write(p []byte) (int, error) {
 	if pw.itemID != "" && isDownloadCancelled(pw.itemID) {
 		return 0, ErrDownloadCancelled
@@ -0,0 +1,122 @@
+package gobackend
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provenance tag names. They are written as Vorbis comments in FLAC/Ogg and
+// as TXXX frames (description = tag name) in ID3.
+const (
+	provenanceTagSource         = "SPOTIFLAC_SOURCE"
+	provenanceTagSourceTrackID  = "SPOTIFLAC_SOURCE_ID"
+	provenanceTagSpotifyID      = "SPOTIFLAC_SPOTIFY_ID"
+	provenanceTagDeezerID       = "SPOTIFLAC_DEEZER_ID"
+	provenanceTagDownloadedAt   = "SPOTIFLAC_DOWNLOADED"
+	provenanceTagBackendVersion = "SPOTIFLAC_VERSION"
+)
+
+// Provenance records where a downloaded file came from. It is only embedded
+// when DownloadRequest.EmbedProvenance is set.
+type Provenance struct {
+	Source         string `json:"source"`
+	SourceTrackID  string `json:"source_track_id,omitempty"`
+	SpotifyID      string `json:"spotify_id,omitempty"`
+	DeezerID       string `json:"deezer_id,omitempty"`
+	DownloadedAt   string `json:"downloaded_at,omitempty"`
+	BackendVersion string `json:"backend_version,omitempty"`
+}
+
+var (
+	backendVersion   = "dev"
+	backendVersionMu sync.RWMutex
+)
+
+// SetBackendVersion sets the version string written to provenance tags. The
+// app passes its own version since the backend is built as part of it.
+func SetBackendVersion(version string) {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return
+	}
+	backendVersionMu.Lock()
+	backendVersion = version
+	backendVersionMu.Unlock()
+}
+
+func getBackendVersion() string {
+	backendVersionMu.RLock()
+	defer backendVersionMu.RUnlock()
+	return backendVersion
+}
+
+// newDownloadProvenance returns the provenance for a file downloaded from
+// source, or nil when the request did not ask for provenance tags.
+func newDownloadProvenance(req DownloadRequest, source, sourceTrackID string) *Provenance {
+	if !req.EmbedProvenance {
+		return nil
+	}
+	return &Provenance{
+		Source:         source,
+		SourceTrackID:  sourceTrackID,
+		SpotifyID:      req.SpotifyID,
+		DeezerID:       req.DeezerID,
+		DownloadedAt:   time.Now().UTC().Format(time.RFC3339),
+		BackendVersion: getBackendVersion(),
+	}
+}
+
+// tags returns the provenance as tag name/value pairs in a fixed order,
+// leaving out empty values.
+func (p *Provenance) tags() [][2]string {
+	if p == nil {
+		return nil
+	}
+	all := [][2]string{
+		{provenanceTagSource, p.Source},
+		{provenanceTagSourceTrackID, p.SourceTrackID},
+		{provenanceTagSpotifyID, p.SpotifyID},
+		{provenanceTagDeezerID, p.DeezerID},
+		{provenanceTagDownloadedAt, p.DownloadedAt},
+		{provenanceTagBackendVersion, p.BackendVersion},
+	}
+	tags := all[:0]
+	for _, tag := range all {
+		if tag[1] != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func (p *Provenance) field(key string) *string {
+	switch strings.ToUpper(strings.TrimSpace(key)) {
+	case provenanceTagSource:
+		return &p.Source
+	case provenanceTagSourceTrackID:
+		return &p.SourceTrackID
+	case provenanceTagSpotifyID:
+		return &p.SpotifyID
+	case provenanceTagDeezerID:
+		return &p.DeezerID
+	case provenanceTagDownloadedAt:
+		return &p.DownloadedAt
+	case provenanceTagBackendVersion:
+		return &p.BackendVersion
+	}
+	return nil
+}
+
+// setProvenanceTag stores value in *p if key is a provenance tag name,
+// allocating *p on first use, and reports whether it was one.
+func setProvenanceTag(p **Provenance, key, value string) bool {
+	if (&Provenance{}).field(key) == nil {
+		return false
+	}
+	if *p == nil {
+		*p = &Provenance{}
+	}
+	*(*p).field(key) = value
+	return true
+}
@@ -0,0 +1,120 @@
+package gobackend
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+func TestProvenanceRoundTripFLAC(t *testing.T) {
+	path := writeTestFLAC(t, t.TempDir(), "song.flac", 44100, 16)
+
+	SetBackendVersion("1.2.3")
+	defer SetBackendVersion("dev")
+
+	req := DownloadRequest{SpotifyID: "sp123", DeezerID: "dz456", EmbedProvenance: true}
+	metadata := Metadata{
+		Title:      "Song",
+		Artist:     "Artist",
+		Provenance: newDownloadProvenance(req, "qobuz", "98765"),
+	}
+	if err := EmbedMetadata(path, metadata, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+
+	read, err := ReadMetadata(path)
+	if err != nil {
+		t.Fatalf("ReadMetadata: %v", err)
+	}
+	p := read.Provenance
+	if p == nil {
+		t.Fatalf("expected provenance to be read back")
+	}
+	if p.Source != "qobuz" || p.SourceTrackID != "98765" || p.SpotifyID != "sp123" ||
+		p.DeezerID != "dz456" || p.BackendVersion != "1.2.3" || p.DownloadedAt == "" {
+		t.Fatalf("unexpected provenance: %+v", p)
+	}
+
+	resultJSON, err := ReadFileMetadata(path)
+	if err != nil {
+		t.Fatalf("ReadFileMetadata: %v", err)
+	}
+	var result struct {
+		Provenance *Provenance `json:"provenance"`
+	}
+	if err := json.Unmarshal([]byte(resultJSON), &result); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if result.Provenance == nil || result.Provenance.Source != "qobuz" {
+		t.Fatalf("expected provenance in ReadFileMetadata, got %s", resultJSON)
+	}
+}
+
+func TestProvenanceOnlyWhenRequested(t *testing.T) {
+	if p := newDownloadProvenance(DownloadRequest{SpotifyID: "sp"}, "tidal", "1"); p != nil {
+		t.Fatalf("expected no provenance without embed_provenance, got %+v", p)
+	}
+
+	path := writeTestFLAC(t, t.TempDir(), "plain.flac", 44100, 16)
+	if err := EmbedMetadata(path, Metadata{Title: "Song"}, ""); err != nil {
+		t.Fatalf("EmbedMetadata: %v", err)
+	}
+	read, err := ReadMetadata(path)
+	if err != nil {
+		t.Fatalf("ReadMetadata: %v", err)
+	}
+	if read.Provenance != nil {
+		t.Fatalf("expected untagged file to have no provenance, got %+v", read.Provenance)
+	}
+}
+
+func TestParseVorbisCommentsReadsProvenance(t *testing.T) {
+	comments := []string{"TITLE=Song", "spotiflac_source=tidal", "SPOTIFLAC_SOURCE_ID=42", "SPOTIFLAC_UNKNOWN=x"}
+
+	var data []byte
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(comments)))
+	for _, c := range comments {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(c)))
+		data = append(data, c...)
+	}
+
+	var metadata AudioMetadata
+	parseVorbisComments(data, &metadata)
+	if metadata.Title != "Song" {
+		t.Fatalf("expected title, got %q", metadata.Title)
+	}
+	if metadata.Provenance == nil || metadata.Provenance.Source != "tidal" || metadata.Provenance.SourceTrackID != "42" {
+		t.Fatalf("unexpected provenance: %+v", metadata.Provenance)
+	}
+}
+
+func TestEmbedProvenanceIntoDownloadedFile(t *testing.T) {
+	dir := t.TempDir()
+	req := DownloadRequest{SpotifyID: "sp123", EmbedProvenance: true}
+	flacPath := writeTestFLAC(t, dir, "song.flac", 44100, 16)
+	mp3Path := writeTestMP3(t, dir, "song.mp3", map[string]string{"TIT2": "Song"})
+
+	for _, path := range []string{flacPath, mp3Path} {
+		if err := embedDownloadTags(path, newDownloadProvenance(req, "my-extension", "ext-1"), nil); err != nil {
+			t.Fatalf("embedDownloadTags(%s): %v", path, err)
+		}
+	}
+
+	flacMeta, err := ReadMetadata(flacPath)
+	if err != nil {
+		t.Fatalf("ReadMetadata: %v", err)
+	}
+	mp3Meta, err := ReadID3Tags(mp3Path)
+	if err != nil {
+		t.Fatalf("ReadID3Tags: %v", err)
+	}
+	for _, p := range []*Provenance{flacMeta.Provenance, mp3Meta.Provenance} {
+		if p == nil || p.Source != "my-extension" || p.SourceTrackID != "ext-1" || p.SpotifyID != "sp123" {
+			t.Fatalf("unexpected provenance: %+v", p)
+		}
+	}
+	if mp3Meta.Title != "Song" {
+		t.Fatalf("expected other tags to be kept, got %+v", mp3Meta)
+	}
+}
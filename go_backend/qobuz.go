@@ -1,7 +1,6 @@
 package gobackend
 
 import (
-	"bufio"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -12,6 +11,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -46,9 +46,29 @@ type QobuzTrack struct {
 	Performer struct {
 		Name string `json:"name"`
 	} `json:"performer"`
+	Performers string `json:"performers"`
+	Composer   struct {
+		Name string `json:"name"`
+	} `json:"composer"`
+}
+
+// artistCredits returns the credits in the track's performers string, or
+// the performer and composer when it has none.
+func (t *QobuzTrack) artistCredits() []ArtistCredit {
+	if credits := parseQobuzPerformers(t.Performers); len(credits) > 0 {
+		return credits
+	}
+	var credits []ArtistCredit
+	if t.Performer.Name != "" {
+		credits = append(credits, ArtistCredit{Name: t.Performer.Name, Role: ArtistRoleMain})
+	}
+	if t.Composer.Name != "" {
+		credits = append(credits, ArtistCredit{Name: t.Composer.Name, Role: ArtistRoleComposer})
+	}
+	return credits
 }
 
-func qobuzArtistsMatch(expectedArtist, foundArtist string) bool {
+func qobuzArtistsMatch(expectedArtist, foundArtist string, credits []ArtistCredit) bool {
 	normExpected := strings.ToLower(strings.TrimSpace(expectedArtist))
 	normFound := strings.ToLower(strings.TrimSpace(foundArtist))
 
@@ -61,6 +81,9 @@ func qobuzArtistsMatch(expectedArtist, foundArtist string) bool {
 	}
 
 	expectedArtists := qobuzSplitArtists(normExpected)
+	if len(credits) > 0 {
+		expectedArtists = splitArtistsWithCredits(normExpected, credits)
+	}
 	foundArtists := qobuzSplitArtists(normFound)
 
 	for _, exp := range expectedArtists {
@@ -416,6 +439,8 @@ func extractQobuzDownloadURLFromBody(body []byte) (string, error) {
 	return "", fmt.Errorf("no download URL in response")
 }
 
+const qobuzJumoMirror = "https://jumo-dl.pages.dev"
+
 func (q *QobuzDownloader) downloadFromJumo(trackID int64, quality string) (string, error) {
 	formatID := mapJumoQuality(quality)
 	region := "US"
@@ -490,7 +515,7 @@ func (q *QobuzDownloader) SearchTrackByISRC(isrc string) (*QobuzTrack, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("search failed: HTTP %d", resp.StatusCode)
+		return nil, httpStatusError("qobuz", resp.StatusCode, "search failed")
 	}
 
 	var result struct {
@@ -509,10 +534,10 @@ func (q *QobuzDownloader) SearchTrackByISRC(isrc string) (*QobuzTrack, error) {
 	}
 
 	if len(result.Tracks.Items) == 0 {
-		return nil, fmt.Errorf("no tracks found for ISRC: %s", isrc)
+		return nil, newDownloadError(ErrKindNotFound, "qobuz", nil, "no tracks found for ISRC: %s", isrc)
 	}
 
-	return nil, fmt.Errorf("no exact ISRC match found for: %s", isrc)
+	return nil, newDownloadError(ErrKindNotFound, "qobuz", nil, "no exact ISRC match found for: %s", isrc)
 }
 
 func (q *QobuzDownloader) SearchTrackByISRCWithDuration(isrc string, expectedDurationSec int) (*QobuzTrack, error) {
@@ -533,7 +558,7 @@ func (q *QobuzDownloader) SearchTrackByISRCWithDuration(isrc string, expectedDur
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("search failed: HTTP %d", resp.StatusCode)
+		return nil, httpStatusError("qobuz", resp.StatusCode, "search failed")
 	}
 
 	var result struct {
@@ -586,10 +611,10 @@ func (q *QobuzDownloader) SearchTrackByISRCWithDuration(isrc string, expectedDur
 	}
 
 	if len(result.Tracks.Items) == 0 {
-		return nil, fmt.Errorf("no tracks found for ISRC: %s", isrc)
+		return nil, newDownloadError(ErrKindNotFound, "qobuz", nil, "no tracks found for ISRC: %s", isrc)
 	}
 
-	return nil, fmt.Errorf("no exact ISRC match found for: %s", isrc)
+	return nil, newDownloadError(ErrKindNotFound, "qobuz", nil, "no exact ISRC match found for: %s", isrc)
 }
 
 func (q *QobuzDownloader) SearchTrackByISRCWithTitle(isrc, expectedTitle string) (*QobuzTrack, error) {
@@ -690,7 +715,7 @@ func (q *QobuzDownloader) SearchTrackByMetadataWithDuration(trackName, artistNam
 	}
 
 	if len(allTracks) == 0 {
-		return nil, fmt.Errorf("no tracks found for: %s - %s", artistName, trackName)
+		return nil, newDownloadError(ErrKindNotFound, "qobuz", nil, "no tracks found for: %s - %s", artistName, trackName)
 	}
 
 	var titleMatches []*QobuzTrack
@@ -736,7 +761,7 @@ func (q *QobuzDownloader) SearchTrackByMetadataWithDuration(trackName, artistNam
 			return durationMatches[0], nil
 		}
 
-		return nil, fmt.Errorf("no tracks found with matching title and duration (expected '%s', %ds)", trackName, expectedDurationSec)
+		return nil, newDownloadError(ErrKindNotFound, "qobuz", nil, "no tracks found with matching title and duration (expected '%s', %ds)", trackName, expectedDurationSec)
 	}
 
 	for _, track := range tracksToCheck {
@@ -829,12 +854,7 @@ func fetchQobuzURLSingleAttempt(api string, trackID int64, quality string, timeo
 		resp, err := client.Do(req)
 		if err != nil {
 			lastErr = err
-			// Check for retryable errors (timeout, connection reset)
-			errStr := strings.ToLower(err.Error())
-			if strings.Contains(errStr, "timeout") ||
-				strings.Contains(errStr, "reset") ||
-				strings.Contains(errStr, "connection refused") ||
-				strings.Contains(errStr, "eof") {
+			if isTransientNetworkError(err) {
 				continue // Retry
 			}
 			break // Non-retryable error
@@ -843,7 +863,7 @@ func fetchQobuzURLSingleAttempt(api string, trackID int64, quality string, timeo
 		if resp.StatusCode >= 500 {
 			io.Copy(io.Discard, resp.Body)
 			resp.Body.Close()
-			lastErr = fmt.Errorf("HTTP %d", resp.StatusCode)
+			lastErr = httpStatusError("qobuz", resp.StatusCode, "")
 			continue
 		}
 
@@ -851,7 +871,7 @@ func fetchQobuzURLSingleAttempt(api string, trackID int64, quality string, timeo
 		if resp.StatusCode == 429 {
 			io.Copy(io.Discard, resp.Body)
 			resp.Body.Close()
-			lastErr = fmt.Errorf("rate limited")
+			lastErr = newDownloadError(ErrKindRateLimited, "qobuz", nil, "rate limited")
 			retryDelay = 2 * time.Second // Wait longer for rate limit
 			continue
 		}
@@ -859,7 +879,7 @@ func fetchQobuzURLSingleAttempt(api string, trackID int64, quality string, timeo
 		if resp.StatusCode != 200 {
 			io.Copy(io.Discard, resp.Body)
 			resp.Body.Close()
-			return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+			return "", httpStatusError("qobuz", resp.StatusCode, "")
 		}
 
 		body, err := io.ReadAll(resp.Body)
@@ -888,6 +908,8 @@ func fetchQobuzURLSingleAttempt(api string, trackID int64, quality string, timeo
 }
 
 func getQobuzDownloadURLParallel(apis []string, trackID int64, quality string) (string, string, error) {
+	health := GetMirrorHealthRegistry()
+	apis = health.Order("qobuz", apis)
 	if len(apis) == 0 {
 		return "", "", fmt.Errorf("no APIs available")
 	}
@@ -902,6 +924,11 @@ func getQobuzDownloadURLParallel(apis []string, trackID int64, quality string) (
 		go func(api string) {
 			reqStart := time.Now()
 			downloadURL, err := fetchQobuzURLWithRetry(api, trackID, quality, timeout)
+			if err != nil {
+				health.RecordFailure("qobuz", api, err, time.Since(reqStart))
+			} else {
+				health.RecordSuccess("qobuz", api, time.Since(reqStart))
+			}
 			resultChan <- qobuzAPIResult{
 				apiURL:      api,
 				downloadURL: downloadURL,
@@ -939,27 +966,34 @@ func getQobuzDownloadURLParallel(apis []string, trackID int64, quality string) (
 }
 
 func (q *QobuzDownloader) GetDownloadURL(trackID int64, quality string) (string, error) {
+	downloadURL, _, err := q.getDownloadURLWithMirror(trackID, quality)
+	return downloadURL, err
+}
+
+// getDownloadURLWithMirror is GetDownloadURL that also reports which API
+// returned the URL.
+func (q *QobuzDownloader) getDownloadURLWithMirror(trackID int64, quality string) (string, string, error) {
 	apis := q.GetAvailableAPIs()
 	if len(apis) == 0 {
-		return "", fmt.Errorf("no Qobuz API available")
+		return "", "", fmt.Errorf("no Qobuz API available")
 	}
 
-	_, downloadURL, err := getQobuzDownloadURLParallel(apis, trackID, quality)
+	apiURL, downloadURL, err := getQobuzDownloadURLParallel(apis, trackID, quality)
 	if err == nil {
-		return downloadURL, nil
+		return downloadURL, apiURL, nil
 	}
 
 	GoLog("[Qobuz] Standard APIs failed, trying Jumo fallback...\n")
 	jumoURL, jumoErr := q.downloadFromJumo(trackID, quality)
 	if jumoErr == nil {
-		return jumoURL, nil
+		return jumoURL, qobuzJumoMirror, nil
 	}
 
 	if quality == "27" {
 		GoLog("[Qobuz] Hi-res (27) failed, trying 24-bit (7)...\n")
 		jumoURL, jumoErr = q.downloadFromJumo(trackID, "7")
 		if jumoErr == nil {
-			return jumoURL, nil
+			return jumoURL, qobuzJumoMirror, nil
 		}
 	}
 
@@ -967,14 +1001,16 @@ func (q *QobuzDownloader) GetDownloadURL(trackID int64, quality string) (string,
 		GoLog("[Qobuz] 24-bit failed, trying 16-bit (6)...\n")
 		jumoURL, jumoErr = q.downloadFromJumo(trackID, "6")
 		if jumoErr == nil {
-			return jumoURL, nil
+			return jumoURL, qobuzJumoMirror, nil
 		}
 	}
 
-	return "", fmt.Errorf("all Qobuz APIs and Jumo fallback failed: %w", err)
+	return "", "", fmt.Errorf("all Qobuz APIs and Jumo fallback failed: %w", err)
 }
 
-func (q *QobuzDownloader) DownloadFile(downloadURL, outputPath string, outputFD int, itemID string) error {
+// DownloadFile downloads a track URL. source identifies the track, such as
+// "qobuz:123", so a partial file is only resumed for it.
+func (q *QobuzDownloader) DownloadFile(downloadURL, outputPath string, outputFD int, itemID, source string) error {
 	ctx := context.Background()
 
 	if itemID != "" {
@@ -988,69 +1024,8 @@ func (q *QobuzDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 		return ErrDownloadCancelled
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := DoRequestWithUserAgent(q.client, req)
-	if err != nil {
-		if isDownloadCancelled(itemID) {
-			return ErrDownloadCancelled
-		}
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("download failed: HTTP %d", resp.StatusCode)
-	}
-
-	expectedSize := resp.ContentLength
-	if expectedSize > 0 && itemID != "" {
-		SetItemBytesTotal(itemID, expectedSize)
-	}
-
-	out, err := openOutputForWrite(outputPath, outputFD)
-	if err != nil {
-		return err
-	}
-
-	bufWriter := bufio.NewWriterSize(out, 256*1024)
-
-	var written int64
-	if itemID != "" {
-		progressWriter := NewItemProgressWriter(bufWriter, itemID)
-		written, err = io.Copy(progressWriter, resp.Body)
-	} else {
-		written, err = io.Copy(bufWriter, resp.Body)
-	}
-
-	flushErr := bufWriter.Flush()
-	closeErr := out.Close()
-
-	if err != nil {
-		cleanupOutputOnError(outputPath, outputFD)
-		if isDownloadCancelled(itemID) {
-			return ErrDownloadCancelled
-		}
-		return fmt.Errorf("download interrupted: %w", err)
-	}
-	if flushErr != nil {
-		cleanupOutputOnError(outputPath, outputFD)
-		return fmt.Errorf("failed to flush buffer: %w", flushErr)
-	}
-	if closeErr != nil {
-		cleanupOutputOnError(outputPath, outputFD)
-		return fmt.Errorf("failed to close file: %w", closeErr)
-	}
-
-	if expectedSize > 0 && written != expectedSize {
-		cleanupOutputOnError(outputPath, outputFD)
-		return fmt.Errorf("incomplete download: expected %d bytes, got %d bytes", expectedSize, written)
-	}
-
-	return nil
+	_, err := downloadWithResume(ctx, q.client, downloadURL, outputPath, outputFD, itemID, source)
+	return err
 }
 
 type QobuzDownloadResult struct {
@@ -1065,18 +1040,16 @@ type QobuzDownloadResult struct {
 	DiscNumber  int
 	ISRC        string
 	LyricsLRC   string
-}
-
-func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
-	downloader := NewQobuzDownloader()
 
-	isSafOutput := isFDOutput(req.OutputFD) || strings.TrimSpace(req.OutputPath) != ""
-	if !isSafOutput {
-		if existingFile, exists := checkISRCExistsInternal(req.OutputDir, req.ISRC); exists {
-			return QobuzDownloadResult{FilePath: "EXISTS:" + existingFile}, nil
-		}
-	}
+	ProviderTrackID string
+	Mirror          string
+	LyricsSource    string
+	ReplacedFile    string
+}
 
+// resolveQobuzTrack finds the Qobuz track for req, trying the Odesli ID, the
+// track ID cache, SongLink, ISRC search and finally a metadata search.
+func resolveQobuzTrack(downloader *QobuzDownloader, req DownloadRequest) (*QobuzTrack, error) {
 	expectedDurationSec := req.DurationMS / 1000
 
 	var track *QobuzTrack
@@ -1138,7 +1111,7 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 		GoLog("[Qobuz] Trying ISRC search: %s\n", req.ISRC)
 		track, err = downloader.SearchTrackByISRCWithDuration(req.ISRC, expectedDurationSec)
 		if track != nil {
-			if !qobuzArtistsMatch(req.ArtistName, track.Performer.Name) {
+			if !qobuzArtistsMatch(req.ArtistName, track.Performer.Name, req.ArtistCredits) {
 				GoLog("[Qobuz] Artist mismatch from ISRC search: expected '%s', got '%s'. Rejecting.\n",
 					req.ArtistName, track.Performer.Name)
 				track = nil
@@ -1154,7 +1127,7 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 	if track == nil {
 		GoLog("[Qobuz] Trying metadata search: '%s' by '%s'\n", req.TrackName, req.ArtistName)
 		track, err = downloader.SearchTrackByMetadataWithDuration(req.TrackName, req.ArtistName, expectedDurationSec)
-		if track != nil && !qobuzArtistsMatch(req.ArtistName, track.Performer.Name) {
+		if track != nil && !qobuzArtistsMatch(req.ArtistName, track.Performer.Name, req.ArtistCredits) {
 			GoLog("[Qobuz] Artist mismatch from metadata search: expected '%s', got '%s'. Rejecting.\n",
 				req.ArtistName, track.Performer.Name)
 			track = nil
@@ -1162,11 +1135,11 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 	}
 
 	if track == nil {
-		errMsg := "could not find matching track on Qobuz (artist/duration mismatch)"
 		if err != nil {
-			errMsg = err.Error()
+			return nil, fmt.Errorf("qobuz search failed: %w", err)
 		}
-		return QobuzDownloadResult{}, fmt.Errorf("qobuz search failed: %s", errMsg)
+		return nil, newDownloadError(ErrKindNotFound, "qobuz", nil,
+			"qobuz search failed: could not find matching track on Qobuz (artist/duration mismatch)")
 	}
 
 	GoLog("[Qobuz] Match found: '%s' by '%s' (duration: %ds)\n", track.Title, track.Performer.Name, track.Duration)
@@ -1174,6 +1147,26 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 		GetTrackIDCache().SetQobuz(req.ISRC, track.ID)
 	}
 
+	return track, nil
+}
+
+func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
+	downloader := NewQobuzDownloader()
+
+	isSafOutput := isFDOutput(req.OutputFD) || strings.TrimSpace(req.OutputPath) != ""
+	var upgrade *pendingUpgrade
+	if !isSafOutput {
+		if existingFile, exists := checkISRCExistsInternal(req.OutputDir, req.ISRC); exists && keepExistingFile(req, existingFile, &upgrade) {
+			return QobuzDownloadResult{FilePath: "EXISTS:" + existingFile}, nil
+		}
+	}
+
+	track, err := resolveQobuzTrack(downloader, req)
+	if err != nil {
+		return QobuzDownloadResult{}, err
+	}
+	applyTagRulesToRequest(&req)
+
 	filename := buildFilenameFromTemplate(req.FilenameFormat, map[string]interface{}{
 		"title":  req.TrackName,
 		"artist": req.ArtistName,
@@ -1192,9 +1185,20 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 	} else {
 		filename = sanitizeFilename(filename) + ".flac"
 		outputPath = filepath.Join(req.OutputDir, filename)
-		if fileInfo, statErr := os.Stat(outputPath); statErr == nil && fileInfo.Size() > 0 {
+		if fileInfo, statErr := os.Stat(outputPath); statErr == nil && fileInfo.Size() > 0 && keepExistingFile(req, outputPath, &upgrade) {
 			return QobuzDownloadResult{FilePath: "EXISTS:" + outputPath}, nil
 		}
+		if upgrade == nil {
+			if legacy := findLegacyVersion(req, outputPath); legacy != "" && keepExistingFile(req, legacy, &upgrade) {
+				return QobuzDownloadResult{FilePath: "EXISTS:" + legacy}, nil
+			}
+		}
+		if upgrade != nil {
+			bitDepth, sampleRate := expectedQobuzQuality(track, req.Quality)
+			if !upgrade.worthDownloading(expectedAudioGrade("flac", bitDepth, sampleRate)) {
+				return QobuzDownloadResult{FilePath: "EXISTS:" + upgrade.path}, nil
+			}
+		}
 	}
 
 	qobuzQuality := "27"
@@ -1212,11 +1216,12 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 	actualSampleRate := int(track.MaximumSamplingRate * 1000)
 	GoLog("[Qobuz] Actual quality: %d-bit/%.1fkHz\n", actualBitDepth, track.MaximumSamplingRate)
 
-	downloadURL, err := downloader.GetDownloadURL(track.ID, qobuzQuality)
+	downloadURL, mirror, err := downloader.getDownloadURLWithMirror(track.ID, qobuzQuality)
 	if err != nil {
 		return QobuzDownloadResult{}, fmt.Errorf("failed to get download URL: %w", err)
 	}
 
+	musicBrainzIDs := startMusicBrainzLookup(req, track.ISRC)
 	var parallelResult *ParallelDownloadResult
 	parallelDone := make(chan struct{})
 	go func() {
@@ -1232,7 +1237,23 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 		)
 	}()
 
-	if err := downloader.DownloadFile(downloadURL, outputPath, req.OutputFD, req.ItemID); err != nil {
+	var stage *stagedOutput
+	if isSafOutput {
+		stage, err = newSAFStagedOutput(outputPath, req.OutputFD, ".flac")
+		if err != nil {
+			<-parallelDone
+			return QobuzDownloadResult{}, err
+		}
+	} else {
+		stage = newStagedOutput(outputPath)
+		stage.upgrade = upgrade
+	}
+	stage.replayGain = req.ReplayGain
+	stage.policy = qualityPolicyFromRequest(req)
+	workPath := stage.workPath
+
+	if err := downloader.DownloadFile(downloadURL, workPath, 0, req.ItemID, fmt.Sprintf("qobuz:%d", track.ID)); err != nil {
+		stage.discard()
 		if errors.Is(err, ErrDownloadCancelled) {
 			return QobuzDownloadResult{}, ErrDownloadCancelled
 		}
@@ -1269,6 +1290,10 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 		Genre:       req.Genre,
 		Label:       req.Label,
 		Copyright:   req.Copyright,
+		Provenance:  newDownloadProvenance(req, "qobuz", strconv.FormatInt(track.ID, 10)),
+		MusicBrainz: musicBrainzIDs(),
+
+		ArtistCredits: mergeArtistCredits(req.ArtistCredits, track.artistCredits()),
 	}
 
 	var coverData []byte
@@ -1280,7 +1305,7 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 	if isSafOutput {
 		GoLog("[Qobuz] SAF output detected - skipping in-backend metadata/lyrics embedding (handled in Flutter)\n")
 	} else {
-		if err := EmbedMetadataWithCoverData(outputPath, metadata, coverData); err != nil {
+		if err := EmbedMetadataWithCoverData(workPath, metadata, coverData); err != nil {
 			fmt.Printf("Warning: failed to embed metadata: %v\n", err)
 		}
 
@@ -1301,7 +1326,7 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 
 			if lyricsMode == "embed" || lyricsMode == "both" {
 				GoLog("[Qobuz] Embedding parallel-fetched lyrics (%d lines)...\n", len(parallelResult.LyricsData.Lines))
-				if embedErr := EmbedLyrics(outputPath, parallelResult.LyricsLRC); embedErr != nil {
+				if embedErr := EmbedLyrics(workPath, parallelResult.LyricsLRC); embedErr != nil {
 					GoLog("[Qobuz] Warning: failed to embed lyrics: %v\n", embedErr)
 				} else {
 					fmt.Println("[Qobuz] Lyrics embedded successfully")
@@ -1312,6 +1337,14 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 		}
 	}
 
+	outputPath, err = stage.commit(workPath, true)
+	if errors.Is(err, errNotAnUpgrade) {
+		return QobuzDownloadResult{FilePath: "EXISTS:" + upgrade.path}, nil
+	}
+	if err != nil {
+		return QobuzDownloadResult{}, err
+	}
+
 	if !isSafOutput {
 		AddToISRCIndex(req.OutputDir, req.ISRC, outputPath)
 	}
@@ -1333,5 +1366,10 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 		DiscNumber:  req.DiscNumber,
 		ISRC:        track.ISRC,
 		LyricsLRC:   lyricsLRC,
+
+		ProviderTrackID: strconv.FormatInt(track.ID, 10),
+		Mirror:          mirror,
+		LyricsSource:    parallelLyricsSource(parallelResult, lyricsLRC),
+		ReplacedFile:    upgrade.replacedFile(),
 	}, nil
 }
@@ -0,0 +1,252 @@
+package gobackend
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// QualityPolicy is the request-level quality floor applied to every file the
+// fallback chain delivers. A file below the floor is discarded and the next
+// provider is tried. Zero values disable the corresponding check.
+type QualityPolicy struct {
+	MinBitDepth   int
+	MinSampleRate int
+	LosslessOnly  bool
+	MaxAttempts   int
+}
+
+// ProviderAttempt records one provider tried by the fallback chain.
+type ProviderAttempt struct {
+	Service    string `json:"service"`
+	Success    bool   `json:"success"`
+	Rejected   bool   `json:"rejected,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Error      string `json:"error,omitempty"`
+	ErrorType  string `json:"error_type,omitempty"`
+	BitDepth   int    `json:"bit_depth,omitempty"`
+	SampleRate int    `json:"sample_rate,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+func qualityPolicyFromRequest(req DownloadRequest) QualityPolicy {
+	return QualityPolicy{
+		MinBitDepth:   req.MinBitDepth,
+		MinSampleRate: req.MinSampleRate,
+		LosslessOnly:  req.LosslessOnly,
+		MaxAttempts:   req.MaxAttempts,
+	}
+}
+
+func (p QualityPolicy) hasFloor() bool {
+	return p.MinBitDepth > 0 || p.MinSampleRate > 0 || p.LosslessOnly
+}
+
+// attemptsExhausted reports whether another provider may be tried after
+// `made` attempts.
+func (p QualityPolicy) attemptsExhausted(made int) bool {
+	return p.MaxAttempts > 0 && made >= p.MaxAttempts
+}
+
+// rejectReason returns why a delivered file falls below the floor, or "" if
+// it meets it. Values that cannot be determined (SAF outputs, encrypted
+// streams) are not held against the file.
+func (p QualityPolicy) rejectReason(filePath string, bitDepth, sampleRate int, encrypted bool) string {
+	if !p.hasFloor() {
+		return ""
+	}
+
+	lossless, known := false, false
+	if !encrypted {
+		lossless, known = isLosslessAudioFile(filePath)
+	}
+	return p.rejectReasonFor(lossless, known, bitDepth, sampleRate)
+}
+
+// rejectReasonFor applies the floor to an already classified format and
+// quality. It is shared with download plans, which have no file to probe.
+func (p QualityPolicy) rejectReasonFor(lossless, known bool, bitDepth, sampleRate int) string {
+	if !p.hasFloor() {
+		return ""
+	}
+	lossy := known && !lossless
+
+	if p.LosslessOnly && lossy {
+		return "lossy format delivered (lossless required)"
+	}
+	if p.MinBitDepth > 0 {
+		if lossy {
+			return fmt.Sprintf("lossy format delivered (minimum %d-bit required)", p.MinBitDepth)
+		}
+		if bitDepth > 0 && bitDepth < p.MinBitDepth {
+			return fmt.Sprintf("%d-bit is below minimum %d-bit", bitDepth, p.MinBitDepth)
+		}
+	}
+	if p.MinSampleRate > 0 && sampleRate > 0 && sampleRate < p.MinSampleRate {
+		return fmt.Sprintf("%dHz is below minimum %dHz", sampleRate, p.MinSampleRate)
+	}
+	return ""
+}
+
+// isLosslessAudioFile classifies a file by container and, for MP4, by its
+// audio sample entry. known is false when the format cannot be determined.
+func isLosslessAudioFile(filePath string) (lossless bool, known bool) {
+	if shouldSkipQualityProbe(filePath) {
+		return false, false
+	}
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".flac", ".wav", ".aiff", ".aif":
+		return true, true
+	case ".mp3", ".opus", ".ogg", ".aac":
+		return false, true
+	case ".m4a", ".mp4":
+		return isLosslessM4A(filePath)
+	}
+	return false, false
+}
+
+func isLosslessM4A(filePath string) (bool, bool) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false, false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, false
+	}
+	fileSize := info.Size()
+
+	moovHeader, found, err := findAtomInRange(f, 0, fileSize, "moov", fileSize)
+	if err != nil || !found {
+		return false, false
+	}
+	if moov, err := readAtomBody(f, moovHeader); err == nil {
+		if _, err := parseFMP4FLACTrack(moov); err == nil {
+			return true, true
+		}
+	}
+
+	_, atomType, err := findAudioSampleEntry(f, moovHeader.offset, moovHeader.offset+moovHeader.size, fileSize)
+	if err != nil {
+		return false, false
+	}
+	return atomType == "alac", true
+}
+
+// discardBelowFloor removes a rejected file so the next provider starts clean.
+// SAF outputs are left alone; they never reach here because their quality
+// cannot be probed.
+func discardBelowFloor(filePath string) {
+	if shouldSkipQualityProbe(filePath) {
+		return
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		GoLog("[QualityPolicy] Failed to remove rejected file %s: %v\n", filePath, err)
+	}
+}
+
+func newProviderAttempt(service string, started time.Time) ProviderAttempt {
+	return ProviderAttempt{
+		Service:    service,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+}
+
+// qualityRejection is returned by a provider whose staged file fell below
+// the request's quality floor. The file was discarded before it could
+// replace anything.
+type qualityRejection struct {
+	reason     string
+	bitDepth   int
+	sampleRate int
+}
+
+func (e *qualityRejection) Error() string {
+	return "quality policy: " + e.reason
+}
+
+// recordRejection marks the attempt as rejected when err is a
+// qualityRejection, and reports whether it was.
+func (a *ProviderAttempt) recordRejection(err error) bool {
+	var rejection *qualityRejection
+	if !errors.As(err, &rejection) {
+		return false
+	}
+	a.Rejected = true
+	a.Reason = rejection.reason
+	a.BitDepth = rejection.bitDepth
+	a.SampleRate = rejection.sampleRate
+	return true
+}
+
+// checkStagedQuality applies policy to a staged download before it is
+// committed, so a file below the floor never replaces an existing one.
+func checkStagedQuality(policy QualityPolicy, workFile string) error {
+	if !policy.hasFloor() {
+		return nil
+	}
+	var bitDepth, sampleRate int
+	if quality, err := GetAudioQuality(workFile); err == nil {
+		bitDepth, sampleRate = quality.BitDepth, quality.SampleRate
+	}
+	reason := policy.rejectReason(workFile, bitDepth, sampleRate, false)
+	if reason == "" {
+		return nil
+	}
+	GoLog("[QualityPolicy] Rejecting staged download: %s\n", reason)
+	return &qualityRejection{reason: reason, bitDepth: bitDepth, sampleRate: sampleRate}
+}
+
+func (a *ProviderAttempt) recordError(err error) {
+	a.Error = err.Error()
+	a.ErrorType = string(ClassifyDownloadError(err))
+}
+
+// acceptDeliveredQuality probes a file a provider just delivered, records its
+// quality on attempt and reports whether it meets policy. Rejected files are
+// removed so the next provider starts clean.
+//
+// An "EXISTS:" result is the user's file and is always kept; when it falls
+// below the floor the attempt's reason says the policy was not applied.
+func acceptDeliveredQuality(policy QualityPolicy, attempt *ProviderAttempt, filePath string, bitDepth, sampleRate int, encrypted bool) bool {
+	attempt.BitDepth = bitDepth
+	attempt.SampleRate = sampleRate
+	if !policy.hasFloor() {
+		return true
+	}
+
+	existing := strings.HasPrefix(filePath, "EXISTS:")
+	if existing {
+		filePath = strings.TrimPrefix(filePath, "EXISTS:")
+		encrypted = false
+	}
+
+	if !encrypted && !shouldSkipQualityProbe(filePath) {
+		if quality, err := GetAudioQuality(filePath); err == nil {
+			attempt.BitDepth = quality.BitDepth
+			attempt.SampleRate = quality.SampleRate
+		}
+	}
+
+	reason := policy.rejectReason(filePath, attempt.BitDepth, attempt.SampleRate, encrypted)
+	if reason == "" {
+		return true
+	}
+	if existing {
+		GoLog("[QualityPolicy] Keeping existing file below floor: %s\n", reason)
+		attempt.Reason = "existing file kept, quality policy not applied: " + reason
+		return true
+	}
+
+	GoLog("[QualityPolicy] Rejecting %s result: %s\n", attempt.Service, reason)
+	discardBelowFloor(filePath)
+	attempt.Rejected = true
+	attempt.Reason = reason
+	return false
+}
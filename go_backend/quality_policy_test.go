@@ -0,0 +1,96 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFLAC(t *testing.T, dir, name string, sampleRate uint32, bitDepth int) string {
+	t.Helper()
+	data := append([]byte("fLaC"), testStreamInfoBlock(sampleRate, bitDepth, 2)...)
+	data = append(data, 0xFF, 0xF8, 0x00, 0x00)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write test FLAC: %v", err)
+	}
+	return path
+}
+
+func TestAcceptDeliveredQuality_RejectsBelowFloorAndDiscards(t *testing.T) {
+	dir := t.TempDir()
+	policy := QualityPolicy{MinBitDepth: 24, MinSampleRate: 48000}
+
+	low := writeTestFLAC(t, dir, "low.flac", 44100, 16)
+	attempt := ProviderAttempt{Service: "tidal"}
+	// Provider claims hi-res; the probe of the actual file must win.
+	if acceptDeliveredQuality(policy, &attempt, low, 24, 96000, false) {
+		t.Fatal("expected 16-bit file to be rejected")
+	}
+	if !attempt.Rejected || attempt.BitDepth != 16 || !strings.Contains(attempt.Reason, "16-bit") {
+		t.Fatalf("unexpected attempt record: %+v", attempt)
+	}
+	if _, err := os.Stat(low); !os.IsNotExist(err) {
+		t.Fatal("expected rejected file to be removed")
+	}
+
+	high := writeTestFLAC(t, dir, "high.flac", 96000, 24)
+	attempt = ProviderAttempt{Service: "qobuz"}
+	if !acceptDeliveredQuality(policy, &attempt, high, 0, 0, false) {
+		t.Fatalf("expected 24/96 file to be accepted, got %+v", attempt)
+	}
+	if attempt.SampleRate != 96000 {
+		t.Fatalf("expected probed sample rate, got %d", attempt.SampleRate)
+	}
+}
+
+func TestAcceptDeliveredQuality_KeepsExistingFileAndReportsIt(t *testing.T) {
+	existing := writeTestFLAC(t, t.TempDir(), "old.flac", 44100, 16)
+	attempt := ProviderAttempt{Service: "tidal"}
+	if !acceptDeliveredQuality(QualityPolicy{MinBitDepth: 24}, &attempt, "EXISTS:"+existing, 0, 0, false) {
+		t.Fatal("expected the existing file to be kept")
+	}
+	if attempt.Rejected || attempt.BitDepth != 16 || !strings.Contains(attempt.Reason, "not applied") {
+		t.Fatalf("unexpected attempt record: %+v", attempt)
+	}
+	if _, err := os.Stat(existing); err != nil {
+		t.Fatalf("expected the existing file to stay: %v", err)
+	}
+}
+
+func TestQualityPolicy_RejectReason(t *testing.T) {
+	dir := t.TempDir()
+	mp3Path := filepath.Join(dir, "track.mp3")
+	if err := os.WriteFile(mp3Path, []byte("ID3"), 0644); err != nil {
+		t.Fatalf("failed to write mp3: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		policy    QualityPolicy
+		path      string
+		bitDepth  int
+		rate      int
+		encrypted bool
+		rejected  bool
+	}{
+		{"no floor", QualityPolicy{}, mp3Path, 0, 0, false, false},
+		{"lossless only rejects mp3", QualityPolicy{LosslessOnly: true}, mp3Path, 0, 0, false, true},
+		{"bit depth floor rejects mp3", QualityPolicy{MinBitDepth: 16}, mp3Path, 0, 0, false, true},
+		{"sample rate floor", QualityPolicy{MinSampleRate: 88200}, "/x/a.flac", 24, 48000, false, true},
+		{"unknown values pass", QualityPolicy{MinBitDepth: 24}, "/proc/self/fd/12", 0, 0, false, false},
+		{"encrypted uses reported values", QualityPolicy{MinBitDepth: 24}, "/x/a.m4a", 24, 48000, true, false},
+	}
+
+	for _, tt := range tests {
+		reason := tt.policy.rejectReason(tt.path, tt.bitDepth, tt.rate, tt.encrypted)
+		if (reason != "") != tt.rejected {
+			t.Errorf("%s: expected rejected=%v, got reason %q", tt.name, tt.rejected, reason)
+		}
+	}
+
+	if !(QualityPolicy{MaxAttempts: 2}).attemptsExhausted(2) || (QualityPolicy{}).attemptsExhausted(10) {
+		t.Fatal("unexpected attemptsExhausted result")
+	}
+}
@@ -1,6 +1,7 @@
 package gobackend
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -48,6 +49,35 @@ func (r *RateLimiter) WaitForSlot() {
 	r.timestamps = append(r.timestamps, time.Now())
 }
 
+// WaitForSlotContext is WaitForSlot for callers with a deadline. It returns
+// ctx's error without taking a slot if ctx ends before one frees up.
+func (r *RateLimiter) WaitForSlotContext(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		now := time.Now()
+		r.cleanOldTimestamps(now)
+		if len(r.timestamps) < r.maxRequests {
+			r.timestamps = append(r.timestamps, now)
+			r.mu.Unlock()
+			return nil
+		}
+		waitDuration := r.timestamps[0].Add(r.window).Sub(now)
+		r.mu.Unlock()
+
+		timer := time.NewTimer(waitDuration)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
 // cleanOldTimestamps removes timestamps that are outside the current window
 func (r *RateLimiter) cleanOldTimestamps(now time.Time) {
 	cutoff := now.Add(-r.window)
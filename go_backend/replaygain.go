@@ -0,0 +1,403 @@
+package gobackend
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-flac/flacvorbis/v2"
+	"github.com/go-flac/go-flac/v2"
+	flacdec "github.com/mewkiz/flac"
+)
+
+// ReplayGain 2.0 targets -18 LUFS, measured as in EBU R128 / ITU-R BS.1770.
+const replayGainReferenceLUFS = -18.0
+
+// BS.1770 gating thresholds and the offset in its loudness formula.
+const (
+	r128AbsoluteGateLUFS = -70.0
+	r128RelativeGateLU   = -10.0
+	r128LoudnessOffset   = -0.691
+)
+
+// r128TruePeakTaps is the length of each phase of the true peak
+// interpolator; four phases give the 48-tap filter BS.1770 suggests.
+const r128TruePeakTaps = 12
+
+// loudness is the measurement of one track: the mean square energy of every
+// 400 ms gating block and the highest true peak, as linear amplitude.
+type loudness struct {
+	blocks []float64
+	peak   float64
+}
+
+// integratedLoudness returns the gated loudness in LUFS of the given blocks,
+// which may come from several tracks when measuring an album. ok is false
+// when no block is above the absolute gate.
+func integratedLoudness(blocks []float64) (lufs float64, ok bool) {
+	gatedMean := func(threshold float64) (float64, bool) {
+		var sum float64
+		var n int
+		for _, z := range blocks {
+			if z > threshold {
+				sum += z
+				n++
+			}
+		}
+		if n == 0 {
+			return 0, false
+		}
+		return sum / float64(n), true
+	}
+
+	mean, ok := gatedMean(lufsToEnergy(r128AbsoluteGateLUFS))
+	if !ok {
+		return 0, false
+	}
+	relative := math.Max(lufsToEnergy(r128AbsoluteGateLUFS), mean*math.Pow(10, r128RelativeGateLU/10))
+	if mean, ok = gatedMean(relative); !ok {
+		return 0, false
+	}
+	return r128LoudnessOffset + 10*math.Log10(mean), true
+}
+
+func lufsToEnergy(lufs float64) float64 {
+	return math.Pow(10, (lufs-r128LoudnessOffset)/10)
+}
+
+// biquad is a second order IIR filter section in direct form I.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeightingFilters returns the BS.1770 K-weighting stages (a high shelf
+// followed by a high pass), derived for sampleRate the way libebur128 does
+// so that rates other than 48 kHz are weighted the same.
+func kWeightingFilters(sampleRate int) [2]biquad {
+	fs := float64(sampleRate)
+
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / fs)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / fs)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return [2]biquad{shelf, highPass}
+}
+
+// r128ChannelWeight returns the BS.1770 weight of a channel in FLAC channel
+// order: surround channels count 1.41 and LFE is left out.
+func r128ChannelWeight(channels, ch int) float64 {
+	switch {
+	case channels == 6 && ch == 3:
+		return 0
+	case (channels == 5 || channels == 6) && ch >= 3:
+		return 1.41
+	}
+	return 1
+}
+
+// truePeakPhases holds the windowed-sinc interpolator used to estimate the
+// peak between samples. Phase p evaluates the signal p/4 of a sample after
+// the sixth sample in its window; phase 0 is the sample itself.
+var truePeakPhases = func() (phases [4][r128TruePeakTaps]float64) {
+	for p := range phases {
+		var sum float64
+		for k := range r128TruePeakTaps {
+			x := float64(k-5) - float64(p)/4
+			h := 1.0
+			if x != 0 {
+				h = math.Sin(math.Pi*x) / (math.Pi * x)
+			}
+			h *= 0.5 * (1 + math.Cos(math.Pi*x/6))
+			phases[p][k] = h
+			sum += h
+		}
+		for k := range phases[p] {
+			phases[p][k] /= sum
+		}
+	}
+	return phases
+}()
+
+// loudnessMeter measures loudness and true peak one sample frame at a time.
+type loudnessMeter struct {
+	weights []float64
+	filters [][2]biquad
+	history [][r128TruePeakTaps]float64
+	phases  []int
+
+	// Energy is summed in 100 ms steps; a gating block is the last four.
+	step    int
+	counted int
+	energy  float64
+	steps   [4]float64
+	nSteps  int
+
+	result loudness
+}
+
+func newLoudnessMeter(sampleRate, channels int) *loudnessMeter {
+	m := &loudnessMeter{
+		weights: make([]float64, channels),
+		filters: make([][2]biquad, channels),
+		history: make([][r128TruePeakTaps]float64, channels),
+		step:    sampleRate / 10,
+	}
+	for ch := range channels {
+		m.weights[ch] = r128ChannelWeight(channels, ch)
+		m.filters[ch] = kWeightingFilters(sampleRate)
+	}
+	// Oversample 4x below 96 kHz and 2x below 192 kHz; higher rates are
+	// already close enough to their true peak.
+	switch {
+	case sampleRate < 96000:
+		m.phases = []int{1, 2, 3}
+	case sampleRate < 192000:
+		m.phases = []int{2}
+	}
+	return m
+}
+
+// add feeds one sample per channel, scaled to [-1, 1).
+func (m *loudnessMeter) add(frame []float64) {
+	for ch, x := range frame {
+		m.result.peak = math.Max(m.result.peak, math.Abs(x))
+		if len(m.phases) > 0 {
+			h := &m.history[ch]
+			copy(h[:], h[1:])
+			h[r128TruePeakTaps-1] = x
+			for _, p := range m.phases {
+				var y float64
+				for k, c := range truePeakPhases[p] {
+					y += c * h[k]
+				}
+				m.result.peak = math.Max(m.result.peak, math.Abs(y))
+			}
+		}
+
+		if m.weights[ch] == 0 {
+			continue
+		}
+		y := m.filters[ch][0].process(x)
+		y = m.filters[ch][1].process(y)
+		m.energy += m.weights[ch] * y * y
+	}
+
+	m.counted++
+	if m.counted < m.step {
+		return
+	}
+	m.steps[m.nSteps%4] = m.energy
+	m.nSteps++
+	m.energy, m.counted = 0, 0
+	if m.nSteps >= 4 {
+		block := (m.steps[0] + m.steps[1] + m.steps[2] + m.steps[3]) / float64(4*m.step)
+		m.result.blocks = append(m.result.blocks, block)
+	}
+}
+
+// measureFLACLoudness decodes a FLAC file and measures it.
+func measureFLACLoudness(path string) (*loudness, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stream, err := flacdec.New(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open FLAC stream: %w", err)
+	}
+	info := stream.Info
+	channels := int(info.NChannels)
+	if info.SampleRate < 10 || channels == 0 {
+		return nil, fmt.Errorf("invalid FLAC stream info")
+	}
+
+	meter := newLoudnessMeter(int(info.SampleRate), channels)
+	frame := make([]float64, channels)
+	scale := 1 / float64(int64(1)<<(info.BitsPerSample-1))
+	for {
+		audio, err := stream.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode FLAC frame: %w", err)
+		}
+		for i := range int(audio.BlockSize) {
+			for ch, sub := range audio.Subframes {
+				frame[ch] = float64(sub.Samples[i]) * scale
+			}
+			meter.add(frame)
+		}
+	}
+	return &meter.result, nil
+}
+
+// ReplayGainTrack is the measured loudness of one file.
+type ReplayGainTrack struct {
+	FilePath string  `json:"file_path"`
+	Loudness float64 `json:"loudness_lufs,omitempty"`
+	Gain     float64 `json:"gain_db,omitempty"`
+	Peak     float64 `json:"peak,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// ReplayGainResult is the outcome of analysing a set of files, with album
+// values when they were analysed as an album.
+type ReplayGainResult struct {
+	Tracks        []ReplayGainTrack `json:"tracks"`
+	AlbumLoudness float64           `json:"album_loudness_lufs,omitempty"`
+	AlbumGain     float64           `json:"album_gain_db,omitempty"`
+	AlbumPeak     float64           `json:"album_peak,omitempty"`
+}
+
+func formatReplayGain(gain float64) string {
+	return fmt.Sprintf("%.2f dB", gain)
+}
+
+func formatReplayGainPeak(peak float64) string {
+	return fmt.Sprintf("%.6f", peak)
+}
+
+// applyReplayGain measures each FLAC file and writes its track gain and
+// peak. With album set, the files are also measured together and the album
+// gain and peak are written to every file that could be measured.
+func applyReplayGain(paths []string, album bool) *ReplayGainResult {
+	result := &ReplayGainResult{Tracks: make([]ReplayGainTrack, len(paths))}
+	var albumBlocks []float64
+	var albumPeak float64
+	var measured []int
+
+	for i, path := range paths {
+		track := &result.Tracks[i]
+		track.FilePath = path
+		if !strings.EqualFold(filepath.Ext(path), ".flac") {
+			track.Error = "ReplayGain analysis is only supported for FLAC files"
+			continue
+		}
+		l, err := measureFLACLoudness(path)
+		if err != nil {
+			track.Error = err.Error()
+			continue
+		}
+		lufs, ok := integratedLoudness(l.blocks)
+		if !ok {
+			track.Error = "track is silent or too short to measure"
+			continue
+		}
+		track.Loudness = lufs
+		track.Gain = replayGainReferenceLUFS - lufs
+		track.Peak = l.peak
+		measured = append(measured, i)
+		if album {
+			albumBlocks = append(albumBlocks, l.blocks...)
+			albumPeak = math.Max(albumPeak, l.peak)
+		}
+	}
+
+	hasAlbum := false
+	if lufs, ok := integratedLoudness(albumBlocks); ok {
+		result.AlbumLoudness = lufs
+		result.AlbumGain = replayGainReferenceLUFS - lufs
+		result.AlbumPeak = albumPeak
+		hasAlbum = true
+	}
+
+	for _, i := range measured {
+		track := &result.Tracks[i]
+		tags := [][2]string{
+			{"REPLAYGAIN_TRACK_GAIN", formatReplayGain(track.Gain)},
+			{"REPLAYGAIN_TRACK_PEAK", formatReplayGainPeak(track.Peak)},
+		}
+		if hasAlbum {
+			tags = append(tags,
+				[2]string{"REPLAYGAIN_ALBUM_GAIN", formatReplayGain(result.AlbumGain)},
+				[2]string{"REPLAYGAIN_ALBUM_PEAK", formatReplayGainPeak(result.AlbumPeak)},
+			)
+		}
+		err := updateFLACComments(track.FilePath, func(cmt *flacvorbis.MetaDataBlockVorbisComment) {
+			for _, tag := range tags {
+				setComment(cmt, tag[0], tag[1])
+			}
+		})
+		if err != nil {
+			track.Error = err.Error()
+			continue
+		}
+		GoLog("[ReplayGain] %s: %.2f LUFS, gain %s, peak %s\n",
+			filepath.Base(track.FilePath), track.Loudness, formatReplayGain(track.Gain), formatReplayGainPeak(track.Peak))
+	}
+	return result
+}
+
+// applyTrackReplayGain tags a finished FLAC download with its track gain.
+// Failures are only logged since the download itself is fine.
+func applyTrackReplayGain(path string) {
+	if !strings.EqualFold(filepath.Ext(path), ".flac") {
+		return
+	}
+	if track := applyReplayGain([]string{path}, false).Tracks[0]; track.Error != "" {
+		GoLog("[ReplayGain] Skipped %s: %s\n", filepath.Base(path), track.Error)
+	}
+}
+
+// updateFLACComments applies edit to the Vorbis comment block of a FLAC
+// file, creating the block if the file has none.
+func updateFLACComments(filePath string, edit func(cmt *flacvorbis.MetaDataBlockVorbisComment)) error {
+	f, err := flac.ParseFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse FLAC file: %w", err)
+	}
+
+	cmtIdx := -1
+	cmt := flacvorbis.New()
+	for idx, meta := range f.Meta {
+		if meta.Type == flac.VorbisComment {
+			cmtIdx = idx
+			if cmt, err = flacvorbis.ParseFromMetaDataBlock(*meta); err != nil {
+				return fmt.Errorf("failed to parse vorbis comment: %w", err)
+			}
+			break
+		}
+	}
+	edit(cmt)
+
+	cmtBlock := cmt.Marshal()
+	if cmtIdx >= 0 {
+		f.Meta[cmtIdx] = &cmtBlock
+	} else {
+		f.Meta = append(f.Meta, &cmtBlock)
+	}
+	return f.Save(filePath)
+}
@@ -0,0 +1,127 @@
+package gobackend
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-flac/flacvorbis/v2"
+	"github.com/go-flac/go-flac/v2"
+	flacdec "github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+// writeTestSineFLAC encodes seconds of a stereo 16-bit sine wave at 48 kHz.
+func writeTestSineFLAC(t *testing.T, dir, name string, freq, amplitude, phase float64, seconds int) string {
+	t.Helper()
+	const rate, blockSize = 48000, 4096
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create FLAC: %v", err)
+	}
+	info := &meta.StreamInfo{BlockSizeMin: blockSize, BlockSizeMax: blockSize, SampleRate: rate, NChannels: 2, BitsPerSample: 16}
+	enc, err := flacdec.NewEncoder(f, info)
+	if err != nil {
+		t.Fatalf("failed to create encoder: %v", err)
+	}
+
+	total := rate * seconds
+	for start := 0; start < total; start += blockSize {
+		n := min(blockSize, total-start)
+		samples := make([]int32, n)
+		for i := range samples {
+			samples[i] = int32(math.Round(32767 * amplitude * math.Sin(2*math.Pi*freq*float64(start+i)/rate+phase)))
+		}
+		fr := &frame.Frame{
+			Header: frame.Header{HasFixedBlockSize: n == blockSize, BlockSize: uint16(n), SampleRate: rate, Channels: frame.ChannelsLR, BitsPerSample: 16},
+			Subframes: []*frame.Subframe{
+				{SubHeader: frame.SubHeader{Pred: frame.PredVerbatim}, Samples: samples, NSamples: n},
+				{SubHeader: frame.SubHeader{Pred: frame.PredVerbatim}, Samples: append([]int32(nil), samples...), NSamples: n},
+			},
+		}
+		if err := enc.WriteFrame(fr); err != nil {
+			t.Fatalf("failed to encode frame: %v", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("failed to close encoder: %v", err)
+	}
+	return path
+}
+
+func TestApplyReplayGainMeasuresAndTags(t *testing.T) {
+	dir := t.TempDir()
+	// A 1 kHz stereo sine at -20 dBFS measures -20 LUFS.
+	quiet := writeTestSineFLAC(t, dir, "quiet.flac", 1000, 0.1, 0, 5)
+	loud := writeTestSineFLAC(t, dir, "loud.flac", 1000, 0.5, 0, 5)
+
+	result := applyReplayGain([]string{quiet, loud, filepath.Join(dir, "song.mp3")}, true)
+
+	q, l := result.Tracks[0], result.Tracks[1]
+	if q.Error != "" || l.Error != "" {
+		t.Fatalf("unexpected errors: %q, %q", q.Error, l.Error)
+	}
+	if math.Abs(q.Loudness+20) > 0.1 || math.Abs(q.Gain-2) > 0.1 {
+		t.Fatalf("quiet track measured %.2f LUFS, gain %.2f", q.Loudness, q.Gain)
+	}
+	if math.Abs(l.Loudness+6.02) > 0.1 || math.Abs(l.Peak-0.5) > 0.01 {
+		t.Fatalf("loud track measured %.2f LUFS, peak %.4f", l.Loudness, l.Peak)
+	}
+	if result.Tracks[2].Error == "" {
+		t.Fatal("expected non-FLAC file to be reported")
+	}
+	// The relative gate drops the quiet track's blocks from the album value.
+	if math.Abs(result.AlbumLoudness-l.Loudness) > 0.1 || result.AlbumPeak != l.Peak {
+		t.Fatalf("unexpected album values: %.2f LUFS, peak %.4f", result.AlbumLoudness, result.AlbumPeak)
+	}
+
+	f, err := flac.ParseFile(quiet)
+	if err != nil {
+		t.Fatalf("failed to parse tagged FLAC: %v", err)
+	}
+	var cmt *flacvorbis.MetaDataBlockVorbisComment
+	for _, block := range f.Meta {
+		if block.Type == flac.VorbisComment {
+			cmt, _ = flacvorbis.ParseFromMetaDataBlock(*block)
+		}
+	}
+	if cmt == nil || getComment(cmt, "REPLAYGAIN_TRACK_GAIN") != formatReplayGain(q.Gain) ||
+		getComment(cmt, "REPLAYGAIN_TRACK_PEAK") != formatReplayGainPeak(q.Peak) ||
+		getComment(cmt, "REPLAYGAIN_ALBUM_GAIN") != formatReplayGain(result.AlbumGain) ||
+		getComment(cmt, "REPLAYGAIN_ALBUM_PEAK") != formatReplayGainPeak(result.AlbumPeak) {
+		t.Fatalf("unexpected tags: %+v", cmt)
+	}
+}
+
+func TestReplayGainTruePeakBetweenSamples(t *testing.T) {
+	// At a quarter of the sample rate and a 45 degree phase, every sample
+	// falls at 0.707 of the real peak.
+	path := writeTestSineFLAC(t, t.TempDir(), "peak.flac", 12000, 0.5, math.Pi/4, 1)
+
+	l, err := measureFLACLoudness(path)
+	if err != nil {
+		t.Fatalf("measureFLACLoudness: %v", err)
+	}
+	if math.Abs(l.peak-0.5) > 0.01 {
+		t.Fatalf("expected true peak near 0.5, got %.4f", l.peak)
+	}
+}
+
+func TestStagedCommitWritesTrackGain(t *testing.T) {
+	stage := newStagedOutput(filepath.Join(t.TempDir(), "song.flac"))
+	stage.replayGain = true
+	writeTestSineFLAC(t, filepath.Dir(stage.workPath), filepath.Base(stage.workPath), 1000, 0.1, 0, 1)
+
+	dest, err := stage.commit(stage.workPath, true)
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	data, _ := os.ReadFile(dest)
+	if !bytes.Contains(data, []byte("REPLAYGAIN_TRACK_GAIN=")) || bytes.Contains(data, []byte("REPLAYGAIN_ALBUM_GAIN=")) {
+		t.Fatal("expected only track gain to be written on commit")
+	}
+}
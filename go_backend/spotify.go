@@ -141,6 +141,8 @@ type TrackMetadata struct {
 	ExternalURL string `json:"external_urls"`
 	ISRC        string `json:"isrc"`
 	AlbumType   string `json:"album_type,omitempty"`
+
+	ArtistCredits []ArtistCredit `json:"artist_credits,omitempty"`
 }
 
 type AlbumTrackMetadata struct {
@@ -160,6 +162,8 @@ type AlbumTrackMetadata struct {
 	AlbumID     string `json:"album_id,omitempty"`
 	AlbumURL    string `json:"album_url,omitempty"`
 	AlbumType   string `json:"album_type,omitempty"`
+
+	ArtistCredits []ArtistCredit `json:"artist_credits,omitempty"`
 }
 
 type AlbumInfoMetadata struct {
@@ -376,6 +380,8 @@ func (c *SpotifyMetadataClient) SearchTracks(ctx context.Context, query string,
 			ExternalURL: track.ExternalURL.Spotify,
 			ISRC:        track.ExternalID.ISRC,
 			AlbumType:   track.Album.AlbumType,
+
+			ArtistCredits: spotifyArtistCredits(track.Artists),
 		})
 	}
 
@@ -441,6 +447,8 @@ func (c *SpotifyMetadataClient) SearchAll(ctx context.Context, query string, tra
 			ExternalURL: track.ExternalURL.Spotify,
 			ISRC:        track.ExternalID.ISRC,
 			AlbumType:   track.Album.AlbumType,
+
+			ArtistCredits: spotifyArtistCredits(track.Artists),
 		})
 	}
 
@@ -491,6 +499,8 @@ func (c *SpotifyMetadataClient) fetchTrack(ctx context.Context, trackID, token s
 			DiscNumber:  data.DiscNumber,
 			ExternalURL: data.ExternalURL.Spotify,
 			ISRC:        data.ExternalID.ISRC,
+
+			ArtistCredits: spotifyArtistCredits(data.Artists),
 		},
 	}, nil
 }
@@ -589,6 +599,8 @@ func (c *SpotifyMetadataClient) fetchAlbum(ctx context.Context, albumID, token s
 			ExternalURL: item.ExternalURL.Spotify,
 			ISRC:        isrc,
 			AlbumID:     albumID,
+
+			ArtistCredits: spotifyArtistCredits(item.Artists),
 		})
 	}
 
@@ -692,6 +704,8 @@ func (c *SpotifyMetadataClient) fetchPlaylist(ctx context.Context, playlistID, t
 			ISRC:        item.Track.ExternalID.ISRC,
 			AlbumID:     item.Track.Album.ID,
 			AlbumURL:    item.Track.Album.ExternalURL.Spotify,
+
+			ArtistCredits: spotifyArtistCredits(item.Track.Artists),
 		})
 	}
 
@@ -730,6 +744,8 @@ func (c *SpotifyMetadataClient) fetchPlaylist(ctx context.Context, playlistID, t
 				ISRC:        item.Track.ExternalID.ISRC,
 				AlbumID:     item.Track.Album.ID,
 				AlbumURL:    item.Track.Album.ExternalURL.Spotify,
+
+				ArtistCredits: spotifyArtistCredits(item.Track.Artists),
 			})
 		}
 
@@ -1042,6 +1058,16 @@ func cleanPathParts(path string) []string {
 	return parts
 }
 
+// spotifyArtistCredits credits every listed artist as a main artist, since
+// Spotify does not mark featured artists.
+func spotifyArtistCredits(artists []artist) []ArtistCredit {
+	credits := make([]ArtistCredit, 0, len(artists))
+	for _, a := range artists {
+		credits = append(credits, ArtistCredit{Name: a.Name, ID: a.ID, Role: ArtistRoleMain})
+	}
+	return credits
+}
+
 func joinArtists(artists []artist) string {
 	names := make([]string, len(artists))
 	for i, a := range artists {
@@ -0,0 +1,350 @@
+package gobackend
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Tag rule actions.
+const (
+	// TagRuleReplace replaces matches of pattern in the field with
+	// replacement, which may refer to groups as $1.
+	TagRuleReplace = "replace"
+	// TagRuleSet sets the field to replacement, in which {field}
+	// placeholders expand to the other fields' values.
+	TagRuleSet = "set"
+	// TagRuleMap replaces the whole value when it is a key of map, ignoring
+	// case.
+	TagRuleMap = "map"
+	// TagRuleMove removes the first match of pattern from the field and
+	// appends replacement, expanded against the match, to target.
+	TagRuleMove = "move"
+)
+
+// tagRuleFieldNames are the metadata fields rules can read and rewrite.
+var tagRuleFieldNames = map[string]bool{
+	"title":        true,
+	"artist":       true,
+	"album":        true,
+	"album_artist": true,
+	"album_type":   true,
+	"genre":        true,
+	"label":        true,
+	"copyright":    true,
+	"date":         true,
+}
+
+// TagRule rewrites one metadata field when all of its conditions hold.
+//
+// Moving "(feat. X)" from the title into the artist, for example:
+//
+//	{"field": "title", "action": "move", "pattern": "\\s*\\(feat\\. ([^)]+)\\)",
+//	 "target": "artist", "replacement": " feat. $1"}
+type TagRule struct {
+	Name        string             `json:"name,omitempty"`
+	Disabled    bool               `json:"disabled,omitempty"`
+	Field       string             `json:"field"`
+	Action      string             `json:"action"`
+	Pattern     string             `json:"pattern,omitempty"`
+	Replacement string             `json:"replacement,omitempty"`
+	Target      string             `json:"target,omitempty"`
+	Map         map[string]string  `json:"map,omitempty"`
+	Conditions  []TagRuleCondition `json:"conditions,omitempty"`
+}
+
+// TagRuleCondition holds when field matches pattern, or is non-empty when
+// pattern is empty. Negate inverts it.
+type TagRuleCondition struct {
+	Field   string `json:"field"`
+	Pattern string `json:"pattern,omitempty"`
+	Negate  bool   `json:"negate,omitempty"`
+}
+
+type compiledTagCondition struct {
+	TagRuleCondition
+	re *regexp.Regexp
+}
+
+type compiledTagRule struct {
+	TagRule
+	label      string
+	re         *regexp.Regexp
+	conditions []compiledTagCondition
+	lookup     map[string]string
+}
+
+var (
+	tagRulesMu sync.RWMutex
+	tagRules   []TagRule
+	// compiledTagRules always holds the compiled form of tagRules.
+	compiledTagRules []compiledTagRule
+)
+
+// compileTagRules validates rules and compiles their patterns.
+func compileTagRules(rules []TagRule) ([]compiledTagRule, error) {
+	compiled := make([]compiledTagRule, 0, len(rules))
+	for i, rule := range rules {
+		label := rule.Name
+		if label == "" {
+			label = fmt.Sprintf("rule %d", i+1)
+		}
+		if rule.Disabled {
+			continue
+		}
+
+		c := compiledTagRule{TagRule: rule, label: label}
+		if !tagRuleFieldNames[rule.Field] {
+			return nil, fmt.Errorf("%s: unknown field %q", label, rule.Field)
+		}
+		switch rule.Action {
+		case TagRuleReplace, TagRuleMove:
+			if rule.Pattern == "" {
+				return nil, fmt.Errorf("%s: pattern is required", label)
+			}
+			if rule.Action == TagRuleMove && !tagRuleFieldNames[rule.Target] {
+				return nil, fmt.Errorf("%s: unknown target %q", label, rule.Target)
+			}
+		case TagRuleSet:
+		case TagRuleMap:
+			c.lookup = make(map[string]string, len(rule.Map))
+			for from, to := range rule.Map {
+				c.lookup[strings.ToLower(strings.TrimSpace(from))] = to
+			}
+		default:
+			return nil, fmt.Errorf("%s: unknown action %q", label, rule.Action)
+		}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid pattern: %w", label, err)
+			}
+			c.re = re
+		}
+
+		for _, cond := range rule.Conditions {
+			if !tagRuleFieldNames[cond.Field] {
+				return nil, fmt.Errorf("%s: unknown condition field %q", label, cond.Field)
+			}
+			cc := compiledTagCondition{TagRuleCondition: cond}
+			if cond.Pattern != "" {
+				re, err := regexp.Compile(cond.Pattern)
+				if err != nil {
+					return nil, fmt.Errorf("%s: invalid condition pattern: %w", label, err)
+				}
+				cc.re = re
+			}
+			c.conditions = append(c.conditions, cc)
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// SetTagRules replaces the configured rules. Nothing changes when a rule is
+// invalid.
+func SetTagRules(rules []TagRule) error {
+	compiled, err := compileTagRules(rules)
+	if err != nil {
+		return err
+	}
+	tagRulesMu.Lock()
+	defer tagRulesMu.Unlock()
+	tagRules = append([]TagRule(nil), rules...)
+	compiledTagRules = compiled
+	GoLog("[TagRules] %d rules configured\n", len(compiled))
+	return nil
+}
+
+// GetTagRules returns the configured rules.
+func GetTagRules() []TagRule {
+	tagRulesMu.RLock()
+	defer tagRulesMu.RUnlock()
+	return append([]TagRule{}, tagRules...)
+}
+
+func getCompiledTagRules() []compiledTagRule {
+	tagRulesMu.RLock()
+	defer tagRulesMu.RUnlock()
+	return compiledTagRules
+}
+
+func (c compiledTagCondition) holds(fields map[string]*string) bool {
+	value := ""
+	if p := fields[c.Field]; p != nil {
+		value = *p
+	}
+	ok := value != ""
+	if c.re != nil {
+		ok = c.re.MatchString(value)
+	}
+	return ok != c.Negate
+}
+
+var tagRulePlaceholder = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// apply runs the rule against fields and reports whether it changed any.
+func (r compiledTagRule) apply(fields map[string]*string) bool {
+	field := fields[r.Field]
+	if field == nil {
+		return false
+	}
+	for _, cond := range r.conditions {
+		if !cond.holds(fields) {
+			return false
+		}
+	}
+
+	before := *field
+	switch r.Action {
+	case TagRuleReplace:
+		*field = strings.TrimSpace(r.re.ReplaceAllString(*field, r.Replacement))
+	case TagRuleSet:
+		*field = tagRulePlaceholder.ReplaceAllStringFunc(r.Replacement, func(m string) string {
+			if p := fields[m[1:len(m)-1]]; p != nil {
+				return *p
+			}
+			return m
+		})
+	case TagRuleMap:
+		if to, ok := r.lookup[strings.ToLower(strings.TrimSpace(*field))]; ok {
+			*field = to
+		}
+	case TagRuleMove:
+		target := fields[r.Target]
+		loc := r.re.FindStringSubmatchIndex(*field)
+		if target == nil || loc == nil {
+			return false
+		}
+		moved := string(r.re.ExpandString(nil, r.Replacement, *field, loc))
+		*field = strings.TrimSpace((*field)[:loc[0]] + (*field)[loc[1]:])
+		*target += moved
+		return true
+	}
+	return *field != before
+}
+
+// applyTagRules runs rules in order against fields, which maps field names
+// to the values to rewrite, and returns the names of the rules that changed
+// something. Unnamed rules are named by their position.
+func applyTagRules(rules []compiledTagRule, fields map[string]*string) []string {
+	var applied []string
+	for _, rule := range rules {
+		if rule.apply(fields) {
+			applied = append(applied, rule.label)
+		}
+	}
+	return applied
+}
+
+// tagRuleTargets points at the values the tag rules may rewrite. Fields left
+// nil are not offered to the rules.
+type tagRuleTargets struct {
+	Title       *string
+	Artist      *string
+	Album       *string
+	AlbumArtist *string
+	AlbumType   *string
+	Genre       *string
+	Label       *string
+	Copyright   *string
+	Date        *string
+}
+
+// apply runs the configured rules against the targets and returns the names
+// of the rules that changed something.
+func (t tagRuleTargets) apply() []string {
+	rules := getCompiledTagRules()
+	if len(rules) == 0 {
+		return nil
+	}
+	return applyTagRules(rules, map[string]*string{
+		"title":        t.Title,
+		"artist":       t.Artist,
+		"album":        t.Album,
+		"album_artist": t.AlbumArtist,
+		"album_type":   t.AlbumType,
+		"genre":        t.Genre,
+		"label":        t.Label,
+		"copyright":    t.Copyright,
+		"date":         t.Date,
+	})
+}
+
+func requestTagRuleTargets(req *DownloadRequest) tagRuleTargets {
+	return tagRuleTargets{
+		Title:       &req.TrackName,
+		Artist:      &req.ArtistName,
+		Album:       &req.AlbumName,
+		AlbumArtist: &req.AlbumArtist,
+		AlbumType:   &req.AlbumType,
+		Genre:       &req.Genre,
+		Label:       &req.Label,
+		Copyright:   &req.Copyright,
+		Date:        &req.ReleaseDate,
+	}
+}
+
+// applyTagRulesToRequest rewrites the request's metadata with the configured
+// rules. Providers call it once the track is resolved, so rewriting never
+// affects matching, and before building the filename and tags; the extension
+// fallback rewrites a copy and hands the built-in providers the original. A
+// request is only rewritten once.
+func applyTagRulesToRequest(req *DownloadRequest) {
+	if req.tagRulesApplied {
+		return
+	}
+	req.tagRulesApplied = true
+	if applied := requestTagRuleTargets(req).apply(); len(applied) > 0 {
+		GoLog("[TagRules] Applied %s: %s - %s\n", strings.Join(applied, ", "), req.ArtistName, req.TrackName)
+	}
+}
+
+// applyTagRulesToLateFields rewrites the genre and label filled in after the
+// request's rules ran and stores them on req; empty ones are left alone. The
+// other fields are only offered to the rules as copies, so nothing is
+// rewritten twice.
+func applyTagRulesToLateFields(req *DownloadRequest, genre, label string) {
+	if genre == "" && label == "" {
+		return
+	}
+	rest := *req
+	targets := requestTagRuleTargets(&rest)
+	if genre != "" {
+		req.Genre = genre
+		targets.Genre = &req.Genre
+	}
+	if label != "" {
+		req.Label = label
+		targets.Label = &req.Label
+	}
+	targets.apply()
+}
+
+// applyTagRulesToMap rewrites the string fields of a metadata map such as
+// the one BuildFilename takes, returning the names of the rules applied.
+// "release_date" stands in for "date" when only it is present.
+func applyTagRulesToMap(rules []compiledTagRule, metadata map[string]interface{}) []string {
+	keys := make(map[string]string)
+	fields := make(map[string]*string)
+	for name := range tagRuleFieldNames {
+		key := name
+		if _, ok := metadata[key]; !ok && name == "date" {
+			if _, ok := metadata["release_date"]; ok {
+				key = "release_date"
+			}
+		}
+		value := getString(metadata, key)
+		keys[name] = key
+		fields[name] = &value
+	}
+
+	applied := applyTagRules(rules, fields)
+	for name, value := range fields {
+		if *value != getString(metadata, keys[name]) {
+			metadata[keys[name]] = *value
+		}
+	}
+	return applied
+}
@@ -0,0 +1,117 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testTagRulesJSON = `[
+	{"name": "feat to artist", "field": "title", "action": "move",
+	 "pattern": "\\s*\\((?:feat\\.|ft\\.) ([^)]+)\\)", "target": "artist", "replacement": " feat. $1"},
+	{"name": "strip remaster", "field": "title", "action": "replace",
+	 "pattern": "(?i)\\s*-\\s*remastered(\\s+\\d{4})?$"},
+	{"name": "and to ampersand", "field": "artist", "action": "replace", "pattern": "\\s+and\\s+", "replacement": " & "},
+	{"name": "genre aliases", "field": "genre", "action": "map", "map": {"hip hop": "Hip-Hop", "rap": "Hip-Hop"}},
+	{"name": "compilations", "field": "album_artist", "action": "set", "replacement": "Various Artists",
+	 "conditions": [{"field": "album_type", "pattern": "^compilation$"}]},
+	{"name": "disabled", "disabled": true, "field": "title", "action": "set", "replacement": "x"}
+]`
+
+func TestPreviewTagRules(t *testing.T) {
+	metadata := `{"title": "Song (feat. Guest) - Remastered 2011", "artist": "Simon and Garfunkel",
+		"genre": "Rap", "album_type": "compilation", "album_artist": "Simon and Garfunkel", "track": 3}`
+	resultJSON, err := PreviewTagRulesJSON(testTagRulesJSON, metadata)
+	if err != nil {
+		t.Fatalf("PreviewTagRulesJSON: %v", err)
+	}
+	var result struct {
+		Before  map[string]interface{} `json:"before"`
+		After   map[string]interface{} `json:"after"`
+		Applied []string               `json:"applied"`
+	}
+	if err := json.Unmarshal([]byte(resultJSON), &result); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"title":        "Song",
+		"artist":       "Simon & Garfunkel feat. Guest",
+		"genre":        "Hip-Hop",
+		"album_type":   "compilation",
+		"album_artist": "Various Artists",
+		"track":        float64(3),
+	}
+	if !reflect.DeepEqual(result.After, want) {
+		t.Fatalf("unexpected result: %+v", result.After)
+	}
+	if result.Before["title"] != "Song (feat. Guest) - Remastered 2011" {
+		t.Fatalf("expected the original metadata, got %+v", result.Before)
+	}
+	if strings.Join(result.Applied, ",") != "feat to artist,strip remaster,and to ampersand,genre aliases,compilations" {
+		t.Fatalf("unexpected applied rules: %v", result.Applied)
+	}
+}
+
+func TestSetTagRulesRejectsInvalidRules(t *testing.T) {
+	defer SetTagRules(nil)
+	if err := SetTagRulesJSON(`[{"field": "title", "action": "replace", "pattern": "Live", "replacement": ""}]`); err != nil {
+		t.Fatalf("SetTagRulesJSON: %v", err)
+	}
+
+	for _, rules := range []string{
+		`[{"field": "title", "action": "replace", "pattern": "("}]`,
+		`[{"field": "lyrics", "action": "set"}]`,
+		`[{"field": "title", "action": "move", "pattern": "x", "target": "nope"}]`,
+		`[{"field": "title", "action": "upper"}]`,
+	} {
+		if err := SetTagRulesJSON(rules); err == nil {
+			t.Fatalf("expected %s to be rejected", rules)
+		}
+	}
+	if len(GetTagRules()) != 1 {
+		t.Fatal("expected invalid rules to leave the configured ones")
+	}
+
+	filename, err := BuildFilename("{artist} - {title}", `{"title": "Song Live", "artist": "Artist"}`)
+	if err != nil || filename != "Artist - Song" {
+		t.Fatalf("expected BuildFilename to apply the rules, got %q, %v", filename, err)
+	}
+
+	req := DownloadRequest{TrackName: "Other Live", ArtistName: "Artist"}
+	applyTagRulesToRequest(&req)
+	if req.TrackName != "Other" {
+		t.Fatalf("expected the request to be rewritten, got %q", req.TrackName)
+	}
+}
+
+func TestApplyTagRulesToRequestOnce(t *testing.T) {
+	defer SetTagRules(nil)
+	rules := `[
+		{"field": "title", "action": "replace", "pattern": "$", "replacement": " (Edit)"},
+		{"field": "label", "action": "replace", "pattern": "$", "replacement": " Ltd"},
+		{"field": "genre", "action": "map", "map": {"rap": "Hip-Hop"}}
+	]`
+	if err := SetTagRulesJSON(rules); err != nil {
+		t.Fatalf("SetTagRulesJSON: %v", err)
+	}
+
+	req := DownloadRequest{TrackName: "Song", ArtistName: "Artist", Label: "Label"}
+	applyTagRulesToRequest(&req)
+	applyTagRulesToRequest(&req)
+	if req.TrackName != "Song (Edit)" || req.Label != "Label Ltd" {
+		t.Fatalf("expected the rules to run once, got %q / %q", req.TrackName, req.Label)
+	}
+
+	// Only the genre filled in after the rules ran is rewritten; the fields
+	// already rewritten are left alone.
+	applyTagRulesToLateFields(&req, "Rap", "")
+	if req.Genre != "Hip-Hop" || req.TrackName != "Song (Edit)" || req.Label != "Label Ltd" {
+		t.Fatalf("unexpected late rewrite: %q / %q / %q", req.Genre, req.TrackName, req.Label)
+	}
+	applyTagRulesToLateFields(&req, "", "")
+	if req.Genre != "Hip-Hop" || req.Label != "Label Ltd" {
+		t.Fatalf("expected nothing to be rewritten, got %q / %q", req.Genre, req.Label)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -48,7 +49,9 @@ type TidalTrack struct {
 		ReleaseDate string `json:"releaseDate"`
 	} `json:"album"`
 	Artists []struct {
+		ID   int64  `json:"id"`
 		Name string `json:"name"`
+		Type string `json:"type"`
 	} `json:"artists"`
 	Artist struct {
 		Name string `json:"name"`
@@ -324,10 +327,10 @@ func (t *TidalDownloader) SearchTrackByISRC(isrc string) (*TidalTrack, error) {
 	}
 
 	if len(result.Items) == 0 {
-		return nil, fmt.Errorf("no tracks found for ISRC: %s", isrc)
+		return nil, newDownloadError(ErrKindNotFound, "tidal", nil, "no tracks found for ISRC: %s", isrc)
 	}
 
-	return nil, fmt.Errorf("no exact ISRC match found for: %s", isrc)
+	return nil, newDownloadError(ErrKindNotFound, "tidal", nil, "no exact ISRC match found for: %s", isrc)
 }
 
 // Now includes romaji conversion for Japanese text (4 search strategies like PC)
@@ -458,7 +461,7 @@ func (t *TidalDownloader) SearchTrackByMetadataWithISRC(trackName, artistName, s
 	}
 
 	if len(allTracks) == 0 {
-		return nil, fmt.Errorf("no tracks found for any search query")
+		return nil, newDownloadError(ErrKindNotFound, "tidal", nil, "no tracks found for any search query")
 	}
 
 	if spotifyISRC != "" {
@@ -573,6 +576,7 @@ type TidalDownloadInfo struct {
 	URL        string
 	BitDepth   int
 	SampleRate int
+	Mirror     string // API that returned the URL
 }
 
 type tidalAPIResult struct {
@@ -614,12 +618,7 @@ func fetchTidalURLWithRetry(api string, trackID int64, quality string, timeout t
 		resp, err := client.Do(req)
 		if err != nil {
 			lastErr = err
-			// Check for retryable errors (timeout, connection reset)
-			errStr := strings.ToLower(err.Error())
-			if strings.Contains(errStr, "timeout") ||
-				strings.Contains(errStr, "reset") ||
-				strings.Contains(errStr, "connection refused") ||
-				strings.Contains(errStr, "eof") {
+			if isTransientNetworkError(err) {
 				continue // Retry
 			}
 			break // Non-retryable error
@@ -628,7 +627,7 @@ func fetchTidalURLWithRetry(api string, trackID int64, quality string, timeout t
 		if resp.StatusCode >= 500 {
 			io.Copy(io.Discard, resp.Body)
 			resp.Body.Close()
-			lastErr = fmt.Errorf("HTTP %d", resp.StatusCode)
+			lastErr = httpStatusError("tidal", resp.StatusCode, "")
 			continue
 		}
 
@@ -636,7 +635,7 @@ func fetchTidalURLWithRetry(api string, trackID int64, quality string, timeout t
 		if resp.StatusCode == 429 {
 			io.Copy(io.Discard, resp.Body)
 			resp.Body.Close()
-			lastErr = fmt.Errorf("rate limited")
+			lastErr = newDownloadError(ErrKindRateLimited, "tidal", nil, "rate limited")
 			retryDelay = 2 * time.Second // Wait longer for rate limit
 			continue
 		}
@@ -644,7 +643,7 @@ func fetchTidalURLWithRetry(api string, trackID int64, quality string, timeout t
 		if resp.StatusCode != 200 {
 			io.Copy(io.Discard, resp.Body)
 			resp.Body.Close()
-			return TidalDownloadInfo{}, fmt.Errorf("HTTP %d", resp.StatusCode)
+			return TidalDownloadInfo{}, httpStatusError("tidal", resp.StatusCode, "")
 		}
 
 		body, err := io.ReadAll(resp.Body)
@@ -658,7 +657,7 @@ func fetchTidalURLWithRetry(api string, trackID int64, quality string, timeout t
 		var v2Response TidalAPIResponseV2
 		if err := json.Unmarshal(body, &v2Response); err == nil && v2Response.Data.Manifest != "" {
 			if v2Response.Data.AssetPresentation == "PREVIEW" {
-				return TidalDownloadInfo{}, fmt.Errorf("returned PREVIEW instead of FULL")
+				return TidalDownloadInfo{}, newDownloadError(ErrKindRegionLocked, "tidal", nil, "returned PREVIEW instead of FULL")
 			}
 
 			return TidalDownloadInfo{
@@ -694,6 +693,8 @@ func fetchTidalURLWithRetry(api string, trackID int64, quality string, timeout t
 }
 
 func getDownloadURLParallel(apis []string, trackID int64, quality string) (string, TidalDownloadInfo, error) {
+	health := GetMirrorHealthRegistry()
+	apis = health.Order("tidal", apis)
 	if len(apis) == 0 {
 		return "", TidalDownloadInfo{}, fmt.Errorf("no APIs available")
 	}
@@ -707,6 +708,11 @@ func getDownloadURLParallel(apis []string, trackID int64, quality string) (strin
 		go func(api string) {
 			reqStart := time.Now()
 			info, err := fetchTidalURLWithRetry(api, trackID, quality, tidalAPITimeoutMobile)
+			if err != nil {
+				health.RecordFailure("tidal", api, err, time.Since(reqStart))
+			} else {
+				health.RecordSuccess("tidal", api, time.Since(reqStart))
+			}
 			resultChan <- tidalAPIResult{
 				apiURL:   api,
 				info:     info,
@@ -750,11 +756,12 @@ func (t *TidalDownloader) GetDownloadURL(trackID int64, quality string) (TidalDo
 		return TidalDownloadInfo{}, fmt.Errorf("no API URL configured")
 	}
 
-	_, info, err := getDownloadURLParallel(apis, trackID, quality)
+	apiURL, info, err := getDownloadURLParallel(apis, trackID, quality)
 	if err != nil {
 		return TidalDownloadInfo{}, fmt.Errorf("failed to get download URL: %w", err)
 	}
 
+	info.Mirror = apiURL
 	return info, nil
 }
 
@@ -851,7 +858,9 @@ func parseManifest(manifestB64 string) (directURL string, initURL string, mediaU
 	return "", initURL, mediaURLs, nil
 }
 
-func (t *TidalDownloader) DownloadFile(downloadURL, outputPath string, outputFD int, itemID string) error {
+// DownloadFile downloads a track URL or manifest. source identifies the
+// track, such as "tidal:123", so a partial file is only resumed for it.
+func (t *TidalDownloader) DownloadFile(downloadURL, outputPath string, outputFD int, itemID, source string) error {
 	ctx := context.Background()
 
 	if strings.HasPrefix(downloadURL, "MANIFEST:") {
@@ -864,7 +873,7 @@ func (t *TidalDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 		if isDownloadCancelled(itemID) {
 			return ErrDownloadCancelled
 		}
-		return t.downloadFromManifest(ctx, strings.TrimPrefix(downloadURL, "MANIFEST:"), outputPath, outputFD, itemID)
+		return t.downloadFromManifest(ctx, strings.TrimPrefix(downloadURL, "MANIFEST:"), outputPath, outputFD, itemID, source)
 	}
 
 	if itemID != "" {
@@ -878,72 +887,11 @@ func (t *TidalDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 		return ErrDownloadCancelled
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := DoRequestWithUserAgent(t.client, req)
-	if err != nil {
-		if isDownloadCancelled(itemID) {
-			return ErrDownloadCancelled
-		}
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("download failed: HTTP %d", resp.StatusCode)
-	}
-
-	expectedSize := resp.ContentLength
-	if expectedSize > 0 && itemID != "" {
-		SetItemBytesTotal(itemID, expectedSize)
-	}
-
-	out, err := openOutputForWrite(outputPath, outputFD)
-	if err != nil {
-		return err
-	}
-
-	bufWriter := bufio.NewWriterSize(out, 256*1024)
-
-	var written int64
-	if itemID != "" {
-		progressWriter := NewItemProgressWriter(bufWriter, itemID)
-		written, err = io.Copy(progressWriter, resp.Body)
-	} else {
-		written, err = io.Copy(bufWriter, resp.Body)
-	}
-
-	flushErr := bufWriter.Flush()
-	closeErr := out.Close()
-
-	if err != nil {
-		cleanupOutputOnError(outputPath, outputFD)
-		if isDownloadCancelled(itemID) {
-			return ErrDownloadCancelled
-		}
-		return fmt.Errorf("download interrupted: %w", err)
-	}
-	if flushErr != nil {
-		cleanupOutputOnError(outputPath, outputFD)
-		return fmt.Errorf("failed to flush buffer: %w", flushErr)
-	}
-	if closeErr != nil {
-		cleanupOutputOnError(outputPath, outputFD)
-		return fmt.Errorf("failed to close file: %w", closeErr)
-	}
-
-	if expectedSize > 0 && written != expectedSize {
-		cleanupOutputOnError(outputPath, outputFD)
-		return fmt.Errorf("incomplete download: expected %d bytes, got %d bytes", expectedSize, written)
-	}
-
-	return nil
+	_, err := downloadWithResume(ctx, t.client, downloadURL, outputPath, outputFD, itemID, source)
+	return err
 }
 
-func (t *TidalDownloader) downloadFromManifest(ctx context.Context, manifestB64, outputPath string, outputFD int, itemID string) error {
+func (t *TidalDownloader) downloadFromManifest(ctx context.Context, manifestB64, outputPath string, outputFD int, itemID, source string) error {
 	fmt.Println("[Tidal] Parsing manifest...")
 	directURL, initURL, mediaURLs, err := parseManifest(manifestB64)
 	if err != nil {
@@ -961,65 +909,14 @@ func (t *TidalDownloader) downloadFromManifest(ctx context.Context, manifestB64,
 			return ErrDownloadCancelled
 		}
 
-		req, err := http.NewRequestWithContext(ctx, "GET", directURL, nil)
-		if err != nil {
-			GoLog("[Tidal] BTS request creation failed: %v\n", err)
-			return fmt.Errorf("failed to create request: %w", err)
-		}
-
-		resp, err := client.Do(req)
-		if err != nil {
-			if isDownloadCancelled(itemID) {
-				return ErrDownloadCancelled
-			}
-			GoLog("[Tidal] BTS download failed: %v\n", err)
-			return fmt.Errorf("failed to download file: %w", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != 200 {
-			GoLog("[Tidal] BTS download HTTP error: %d\n", resp.StatusCode)
-			return fmt.Errorf("download failed with status %d", resp.StatusCode)
-		}
-		GoLog("[Tidal] BTS response OK, Content-Length: %d\n", resp.ContentLength)
-
-		expectedSize := resp.ContentLength
-		if expectedSize > 0 && itemID != "" {
-			SetItemBytesTotal(itemID, expectedSize)
-		}
-
-		out, err := openOutputForWrite(outputPath, outputFD)
-		if err != nil {
-			return fmt.Errorf("failed to create file: %w", err)
-		}
-
-		var written int64
-		if itemID != "" {
-			progressWriter := NewItemProgressWriter(out, itemID)
-			written, err = io.Copy(progressWriter, resp.Body)
-		} else {
-			written, err = io.Copy(out, resp.Body)
-		}
-
-		closeErr := out.Close()
-
+		written, err := downloadWithResume(ctx, client, directURL, outputPath, outputFD, itemID, source)
 		if err != nil {
-			cleanupOutputOnError(outputPath, outputFD)
-			if isDownloadCancelled(itemID) {
-				return ErrDownloadCancelled
+			if err != ErrDownloadCancelled {
+				GoLog("[Tidal] BTS download failed: %v\n", err)
 			}
-			return fmt.Errorf("download interrupted: %w", err)
-		}
-		if closeErr != nil {
-			cleanupOutputOnError(outputPath, outputFD)
-			return fmt.Errorf("failed to close file: %w", closeErr)
-		}
-
-		if expectedSize > 0 && written != expectedSize {
-			cleanupOutputOnError(outputPath, outputFD)
-			return fmt.Errorf("incomplete download: expected %d bytes, got %d bytes", expectedSize, written)
+			return err
 		}
-
+		GoLog("[Tidal] BTS download complete: %d bytes\n", written)
 		return nil
 	}
 
@@ -1043,101 +940,33 @@ func (t *TidalDownloader) downloadFromManifest(ctx context.Context, manifestB64,
 		return fmt.Errorf("failed to create M4A file: %w", err)
 	}
 
-	GoLog("[Tidal] Downloading init segment...\n")
 	if isDownloadCancelled(itemID) {
 		out.Close()
 		cleanupOutputOnError(m4aPath, outputFD)
 		return ErrDownloadCancelled
 	}
-	req, err := http.NewRequestWithContext(ctx, "GET", initURL, nil)
-	if err != nil {
-		out.Close()
-		cleanupOutputOnError(m4aPath, outputFD)
-		GoLog("[Tidal] Init segment request failed: %v\n", err)
-		return fmt.Errorf("failed to create init segment request: %w", err)
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		out.Close()
-		cleanupOutputOnError(m4aPath, outputFD)
-		if isDownloadCancelled(itemID) {
-			return ErrDownloadCancelled
-		}
-		GoLog("[Tidal] Init segment download failed: %v\n", err)
-		return fmt.Errorf("failed to download init segment: %w", err)
-	}
-	if resp.StatusCode != 200 {
-		resp.Body.Close()
-		out.Close()
-		cleanupOutputOnError(m4aPath, outputFD)
-		GoLog("[Tidal] Init segment HTTP error: %d\n", resp.StatusCode)
-		return fmt.Errorf("init segment download failed with status %d", resp.StatusCode)
+
+	// The init segment goes first so the fetcher writes a playable fMP4 in one pass.
+	segmentURLs := make([]string, 0, len(mediaURLs)+1)
+	segmentURLs = append(segmentURLs, initURL)
+	segmentURLs = append(segmentURLs, mediaURLs...)
+
+	fetcher := newDashSegmentFetcher(client, itemID)
+	bufWriter := bufio.NewWriterSize(out, 256*1024)
+	written, err := fetcher.fetchInto(ctx, segmentURLs, bufWriter)
+	if err == nil {
+		err = bufWriter.Flush()
 	}
-	_, err = io.Copy(out, resp.Body)
-	resp.Body.Close()
 	if err != nil {
 		out.Close()
 		cleanupOutputOnError(m4aPath, outputFD)
 		if isDownloadCancelled(itemID) {
 			return ErrDownloadCancelled
 		}
-		GoLog("[Tidal] Init segment write failed: %v\n", err)
-		return fmt.Errorf("failed to write init segment: %w", err)
-	}
-
-	totalSegments := len(mediaURLs)
-	for i, mediaURL := range mediaURLs {
-		if isDownloadCancelled(itemID) {
-			out.Close()
-			cleanupOutputOnError(m4aPath, outputFD)
-			return ErrDownloadCancelled
-		}
-
-		if i%10 == 0 || i == totalSegments-1 {
-			GoLog("[Tidal] Downloading segment %d/%d...\n", i+1, totalSegments)
-		}
-
-		if itemID != "" {
-			progress := float64(i+1) / float64(totalSegments)
-			SetItemProgress(itemID, progress, 0, 0)
-		}
-
-		req, err := http.NewRequestWithContext(ctx, "GET", mediaURL, nil)
-		if err != nil {
-			out.Close()
-			cleanupOutputOnError(m4aPath, outputFD)
-			GoLog("[Tidal] Segment %d request failed: %v\n", i+1, err)
-			return fmt.Errorf("failed to create segment %d request: %w", i+1, err)
-		}
-		resp, err := client.Do(req)
-		if err != nil {
-			out.Close()
-			cleanupOutputOnError(m4aPath, outputFD)
-			if isDownloadCancelled(itemID) {
-				return ErrDownloadCancelled
-			}
-			GoLog("[Tidal] Segment %d download failed: %v\n", i+1, err)
-			return fmt.Errorf("failed to download segment %d: %w", i+1, err)
-		}
-		if resp.StatusCode != 200 {
-			resp.Body.Close()
-			out.Close()
-			cleanupOutputOnError(m4aPath, outputFD)
-			GoLog("[Tidal] Segment %d HTTP error: %d\n", i+1, resp.StatusCode)
-			return fmt.Errorf("segment %d download failed with status %d", i+1, resp.StatusCode)
-		}
-		_, err = io.Copy(out, resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			out.Close()
-			cleanupOutputOnError(m4aPath, outputFD)
-			if isDownloadCancelled(itemID) {
-				return ErrDownloadCancelled
-			}
-			GoLog("[Tidal] Segment %d write failed: %v\n", i+1, err)
-			return fmt.Errorf("failed to write segment %d: %w", i+1, err)
-		}
+		GoLog("[Tidal] DASH download failed: %v\n", err)
+		return err
 	}
+	GoLog("[Tidal] DASH segments downloaded: %d segments, %.2f MB\n", len(segmentURLs), float64(written)/(1024*1024))
 
 	if err := out.Close(); err != nil {
 		cleanupOutputOnError(m4aPath, outputFD)
@@ -1161,9 +990,30 @@ type TidalDownloadResult struct {
 	DiscNumber  int
 	ISRC        string
 	LyricsLRC   string // LRC content for embedding in converted files
+
+	ProviderTrackID string
+	Mirror          string
+	LyricsSource    string
+	ReplacedFile    string
 }
 
-func artistsMatch(spotifyArtist, tidalArtist string) bool {
+// artistCredits returns the track's artists, which Tidal marks as "MAIN" or
+// "FEATURED".
+func (t *TidalTrack) artistCredits() []ArtistCredit {
+	credits := make([]ArtistCredit, 0, len(t.Artists))
+	for _, a := range t.Artists {
+		role := ArtistRoleMain
+		if strings.EqualFold(a.Type, "FEATURED") {
+			role = ArtistRoleFeatured
+		}
+		credits = append(credits, ArtistCredit{Name: a.Name, ID: strconv.FormatInt(a.ID, 10), Role: role})
+	}
+	return credits
+}
+
+// artistsMatch reports whether the expected and found artist strings share an
+// artist. The expected side is split from credits when the request has them.
+func artistsMatch(spotifyArtist, tidalArtist string, credits []ArtistCredit) bool {
 	normSpotify := strings.ToLower(strings.TrimSpace(spotifyArtist))
 	normTidal := strings.ToLower(strings.TrimSpace(tidalArtist))
 
@@ -1175,7 +1025,7 @@ func artistsMatch(spotifyArtist, tidalArtist string) bool {
 		return true
 	}
 
-	spotifyArtists := splitArtists(normSpotify)
+	spotifyArtists := splitArtistsWithCredits(normSpotify, credits)
 	tidalArtists := splitArtists(normTidal)
 
 	for _, exp := range spotifyArtists {
@@ -1406,16 +1256,9 @@ func isLatinScript(s string) bool {
 	return true
 }
 
-func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
-	downloader := NewTidalDownloader()
-
-	isSafOutput := isFDOutput(req.OutputFD) || strings.TrimSpace(req.OutputPath) != ""
-	if !isSafOutput {
-		if existingFile, exists := checkISRCExistsInternal(req.OutputDir, req.ISRC); exists {
-			return TidalDownloadResult{FilePath: "EXISTS:" + existingFile}, nil
-		}
-	}
-
+// resolveTidalTrack finds the Tidal track for req, trying the Odesli ID, the
+// track ID cache, ISRC search, SongLink and finally a metadata search.
+func resolveTidalTrack(downloader *TidalDownloader, req DownloadRequest) (*TidalTrack, error) {
 	expectedDurationSec := req.DurationMS / 1000
 
 	var track *TidalTrack
@@ -1459,7 +1302,7 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 				}
 				tidalArtist = strings.Join(artistNames, ", ")
 			}
-			if !artistsMatch(req.ArtistName, tidalArtist) {
+			if !artistsMatch(req.ArtistName, tidalArtist, req.ArtistCredits) {
 				GoLog("[Tidal] Artist mismatch from ISRC search: expected '%s', got '%s'. Rejecting.\n",
 					req.ArtistName, tidalArtist)
 				track = nil
@@ -1525,7 +1368,7 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 					tidalArtist = strings.Join(artistNames, ", ")
 				}
 
-				if !artistsMatch(req.ArtistName, tidalArtist) {
+				if !artistsMatch(req.ArtistName, tidalArtist, req.ArtistCredits) {
 					GoLog("[Tidal] Artist mismatch from SongLink: expected '%s', got '%s'. Rejecting.\n",
 						req.ArtistName, tidalArtist)
 					track = nil
@@ -1568,7 +1411,7 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 				GoLog("[Tidal] Title mismatch from metadata search: expected '%s', got '%s'. Rejecting.\n",
 					req.TrackName, track.Title)
 				track = nil
-			} else if !artistsMatch(req.ArtistName, tidalArtist) {
+			} else if !artistsMatch(req.ArtistName, tidalArtist, req.ArtistCredits) {
 				GoLog("[Tidal] Artist mismatch from metadata search: expected '%s', got '%s'. Rejecting.\n",
 					req.ArtistName, tidalArtist)
 				track = nil
@@ -1577,11 +1420,11 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 	}
 
 	if track == nil {
-		errMsg := "could not find matching track on Tidal (artist/duration mismatch)"
 		if err != nil {
-			errMsg = err.Error()
+			return nil, fmt.Errorf("tidal search failed: %w", err)
 		}
-		return TidalDownloadResult{}, fmt.Errorf("tidal search failed: %s", errMsg)
+		return nil, newDownloadError(ErrKindNotFound, "tidal", nil,
+			"tidal search failed: could not find matching track on Tidal (artist/duration mismatch)")
 	}
 
 	tidalArtist := track.Artist.Name
@@ -1598,6 +1441,27 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 		GetTrackIDCache().SetTidal(req.ISRC, track.ID)
 	}
 
+	return track, nil
+}
+
+func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
+	downloader := NewTidalDownloader()
+
+	isSafOutput := isFDOutput(req.OutputFD) || strings.TrimSpace(req.OutputPath) != ""
+	var upgrade *pendingUpgrade
+	if !isSafOutput {
+		if existingFile, exists := checkISRCExistsInternal(req.OutputDir, req.ISRC); exists && keepExistingFile(req, existingFile, &upgrade) {
+			return TidalDownloadResult{FilePath: "EXISTS:" + existingFile}, nil
+		}
+	}
+
+	track, err := resolveTidalTrack(downloader, req)
+	if err != nil {
+		return TidalDownloadResult{}, err
+	}
+
+	applyTagRulesToRequest(&req)
+
 	quality := req.Quality
 	if quality == "" {
 		quality = "LOSSLESS"
@@ -1643,14 +1507,22 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 			m4aPath = strings.TrimSuffix(outputPath, ".flac") + ".m4a"
 		}
 
-		if fileInfo, statErr := os.Stat(outputPath); statErr == nil && fileInfo.Size() > 0 {
+		if fileInfo, statErr := os.Stat(outputPath); statErr == nil && fileInfo.Size() > 0 && keepExistingFile(req, outputPath, &upgrade) {
 			return TidalDownloadResult{FilePath: "EXISTS:" + outputPath}, nil
 		}
 		if quality != "HIGH" {
-			if fileInfo, statErr := os.Stat(m4aPath); statErr == nil && fileInfo.Size() > 0 {
+			if fileInfo, statErr := os.Stat(m4aPath); statErr == nil && fileInfo.Size() > 0 && keepExistingFile(req, m4aPath, &upgrade) {
 				return TidalDownloadResult{FilePath: "EXISTS:" + m4aPath}, nil
 			}
 		}
+		if upgrade == nil {
+			if legacy := findLegacyVersion(req, outputPath); legacy != "" && keepExistingFile(req, legacy, &upgrade) {
+				return TidalDownloadResult{FilePath: "EXISTS:" + legacy}, nil
+			}
+		}
+		if upgrade != nil && !upgrade.worthDownloading(expectedAudioGrade(expectedTidalQuality(track, quality))) {
+			return TidalDownloadResult{FilePath: "EXISTS:" + upgrade.path}, nil
+		}
 	}
 
 	if !isSafOutput {
@@ -1670,6 +1542,7 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 
 	GoLog("[Tidal] Actual quality: %d-bit/%dHz\n", downloadInfo.BitDepth, downloadInfo.SampleRate)
 
+	musicBrainzIDs := startMusicBrainzLookup(req, track.ISRC)
 	var parallelResult *ParallelDownloadResult
 	parallelDone := make(chan struct{})
 	go func() {
@@ -1685,6 +1558,25 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 		)
 	}()
 
+	var stage *stagedOutput
+	if isSafOutput {
+		stage, err = newSAFStagedOutput(outputPath, req.OutputFD, outputExt)
+		if err != nil {
+			<-parallelDone
+			return TidalDownloadResult{}, err
+		}
+	} else {
+		stage = newStagedOutput(outputPath)
+		stage.upgrade = upgrade
+	}
+	stage.replayGain = req.ReplayGain
+	stage.policy = qualityPolicyFromRequest(req)
+	workPath := stage.workPath
+	workM4APath := workPath
+	if strings.HasSuffix(workPath, ".flac") {
+		workM4APath = strings.TrimSuffix(workPath, ".flac") + ".m4a"
+	}
+
 	GoLog("[Tidal] Starting download to: %s\n", outputPath)
 	GoLog("[Tidal] Download URL type: %s\n", func() string {
 		if strings.HasPrefix(downloadInfo.URL, "MANIFEST:") {
@@ -1693,7 +1585,8 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 		return "Direct URL"
 	}())
 
-	if err := downloader.DownloadFile(downloadInfo.URL, outputPath, req.OutputFD, req.ItemID); err != nil {
+	if err := downloader.DownloadFile(downloadInfo.URL, workPath, 0, req.ItemID, fmt.Sprintf("tidal:%d", track.ID)); err != nil {
+		stage.discard()
 		if errors.Is(err, ErrDownloadCancelled) {
 			return TidalDownloadResult{}, ErrDownloadCancelled
 		}
@@ -1709,13 +1602,30 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 		SetItemFinalizing(req.ItemID)
 	}
 
-	actualOutputPath := outputPath
-	if !isSafOutput {
-		if _, err := os.Stat(m4aPath); err == nil {
-			actualOutputPath = m4aPath
-			GoLog("[Tidal] File saved as M4A (DASH stream): %s\n", actualOutputPath)
-		} else if _, err := os.Stat(outputPath); err != nil {
-			return TidalDownloadResult{}, fmt.Errorf("download completed but file not found at %s or %s", outputPath, m4aPath)
+	// Everything up to the commit below works on the staged file.
+	actualOutputPath := workPath
+	if _, err := os.Stat(workM4APath); err == nil {
+		actualOutputPath = workM4APath
+		GoLog("[Tidal] File saved as M4A (DASH stream): %s\n", actualOutputPath)
+	} else if _, err := os.Stat(workPath); err != nil {
+		stage.discard()
+		return TidalDownloadResult{}, fmt.Errorf("download completed but file not found at %s or %s", workPath, workM4APath)
+	}
+
+	// DASH lossless streams are FLAC inside fMP4; unwrap them natively so the
+	// file can be tagged here instead of waiting on an FFmpeg conversion. The
+	// staged file is local for SAF outputs too.
+	demuxedFLAC := false
+	if actualOutputPath == workM4APath && strings.HasSuffix(workPath, ".flac") {
+		if err := demuxFMP4ToFLAC(workM4APath, workPath); err == nil {
+			os.Remove(workM4APath)
+			actualOutputPath = workPath
+			demuxedFLAC = true
+			GoLog("[Tidal] Extracted native FLAC from DASH stream: %s\n", outputPath)
+		} else if errors.Is(err, errFMP4NotFLAC) {
+			GoLog("[Tidal] DASH stream is not FLAC, keeping M4A for conversion\n")
+		} else {
+			GoLog("[Tidal] Native FLAC extraction failed, keeping M4A: %v\n", err)
 		}
 	}
 
@@ -1747,6 +1657,10 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 		Genre:       req.Genre,
 		Label:       req.Label,
 		Copyright:   req.Copyright,
+		Provenance:  newDownloadProvenance(req, "tidal", strconv.FormatInt(track.ID, 10)),
+		MusicBrainz: musicBrainzIDs(),
+
+		ArtistCredits: mergeArtistCredits(req.ArtistCredits, track.artistCredits()),
 	}
 
 	var coverData []byte
@@ -1756,7 +1670,7 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 	}
 
 	actualExt := outputExt
-	if strings.HasPrefix(downloadInfo.URL, "MANIFEST:") {
+	if strings.HasPrefix(downloadInfo.URL, "MANIFEST:") && !demuxedFLAC {
 		actualExt = ".m4a"
 	}
 	if actualExt == "" && !isSafOutput {
@@ -1776,7 +1690,7 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 
 			if !isSafOutput && (lyricsMode == "external" || lyricsMode == "both") {
 				GoLog("[Tidal] Saving external LRC file...\n")
-				if lrcPath, lrcErr := SaveLRCFile(actualOutputPath, parallelResult.LyricsLRC); lrcErr != nil {
+				if lrcPath, lrcErr := SaveLRCFile(stage.destinationFor(actualOutputPath), parallelResult.LyricsLRC); lrcErr != nil {
 					GoLog("[Tidal] Warning: failed to save LRC file: %v\n", lrcErr)
 				} else {
 					GoLog("[Tidal] LRC file saved: %s\n", lrcPath)
@@ -1796,7 +1710,9 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 		}
 	} else if (isSafOutput && actualExt == ".m4a") || (!isSafOutput && strings.HasSuffix(actualOutputPath, ".m4a")) {
 		if quality == "HIGH" {
-			GoLog("[Tidal] HIGH quality M4A - skipping metadata embedding (file from server is already valid)\n")
+			if err := EmbedMetadataWithCoverData(actualOutputPath, metadata, coverData); err != nil {
+				GoLog("[Tidal] Warning: failed to embed M4A metadata: %v\n", err)
+			}
 
 			if req.EmbedLyrics && parallelResult != nil && parallelResult.LyricsLRC != "" {
 				lyricsMode := req.LyricsMode
@@ -1806,18 +1722,32 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 
 				if !isSafOutput && (lyricsMode == "external" || lyricsMode == "both") {
 					GoLog("[Tidal] Saving external LRC file for M4A (mode: %s)...\n", lyricsMode)
-					if lrcPath, lrcErr := SaveLRCFile(actualOutputPath, parallelResult.LyricsLRC); lrcErr != nil {
+					if lrcPath, lrcErr := SaveLRCFile(stage.destinationFor(actualOutputPath), parallelResult.LyricsLRC); lrcErr != nil {
 						GoLog("[Tidal] Warning: failed to save LRC file: %v\n", lrcErr)
 					} else {
 						GoLog("[Tidal] LRC file saved: %s\n", lrcPath)
 					}
 				}
+
+				if lyricsMode == "embed" || lyricsMode == "both" {
+					if embedErr := EmbedLyrics(actualOutputPath, parallelResult.LyricsLRC); embedErr != nil {
+						GoLog("[Tidal] Warning: failed to embed lyrics: %v\n", embedErr)
+					}
+				}
 			}
 		} else {
 			fmt.Println("[Tidal] Skipping metadata embedding for M4A file (will be handled after FFmpeg conversion)")
 		}
 	}
 
+	actualOutputPath, err = stage.commit(actualOutputPath, true)
+	if errors.Is(err, errNotAnUpgrade) {
+		return TidalDownloadResult{FilePath: "EXISTS:" + upgrade.path}, nil
+	}
+	if err != nil {
+		return TidalDownloadResult{}, err
+	}
+
 	if !isSafOutput {
 		AddToISRCIndex(req.OutputDir, req.ISRC, actualOutputPath)
 	}
@@ -1845,6 +1775,11 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 		DiscNumber:  actualDiscNumber,
 		ISRC:        track.ISRC,
 		LyricsLRC:   lyricsLRC,
+
+		ProviderTrackID: strconv.FormatInt(track.ID, 10),
+		Mirror:          downloadInfo.Mirror,
+		LyricsSource:    parallelLyricsSource(parallelResult, lyricsLRC),
+		ReplacedFile:    upgrade.replacedFile(),
 	}, nil
 }
 
@@ -2,7 +2,6 @@
 package gobackend
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -249,7 +248,9 @@ func (y *YouTubeDownloader) requestSpotubeDL(videoID, audioFormat, audioBitrate
 	}, nil
 }
 
-func (y *YouTubeDownloader) DownloadFile(downloadURL, outputPath string, outputFD int, itemID string) error {
+// DownloadFile downloads a stream URL. source identifies the video, so a
+// partial file is only resumed for it.
+func (y *YouTubeDownloader) DownloadFile(downloadURL, outputPath string, outputFD int, itemID, source string) error {
 	ctx := context.Background()
 
 	if itemID != "" {
@@ -263,66 +264,9 @@ func (y *YouTubeDownloader) DownloadFile(downloadURL, outputPath string, outputF
 		return ErrDownloadCancelled
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
+	written, err := downloadWithResume(ctx, y.client, downloadURL, outputPath, outputFD, itemID, source)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := DoRequestWithUserAgent(y.client, req)
-	if err != nil {
-		if isDownloadCancelled(itemID) {
-			return ErrDownloadCancelled
-		}
-		return fmt.Errorf("download request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("download failed: HTTP %d", resp.StatusCode)
-	}
-
-	expectedSize := resp.ContentLength
-	if expectedSize > 0 && itemID != "" {
-		SetItemBytesTotal(itemID, expectedSize)
-	}
-
-	out, err := openOutputForWrite(outputPath, outputFD)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-
-	bufWriter := bufio.NewWriterSize(out, 256*1024)
-
-	var written int64
-	if itemID != "" {
-		progressWriter := NewItemProgressWriter(bufWriter, itemID)
-		written, err = io.Copy(progressWriter, resp.Body)
-	} else {
-		written, err = io.Copy(bufWriter, resp.Body)
-	}
-
-	flushErr := bufWriter.Flush()
-	closeErr := out.Close()
-
-	if err != nil {
-		cleanupOutputOnError(outputPath, outputFD)
-		if isDownloadCancelled(itemID) {
-			return ErrDownloadCancelled
-		}
-		return fmt.Errorf("download interrupted: %w", err)
-	}
-	if flushErr != nil {
-		cleanupOutputOnError(outputPath, outputFD)
-		return fmt.Errorf("failed to flush buffer: %w", flushErr)
-	}
-	if closeErr != nil {
-		cleanupOutputOnError(outputPath, outputFD)
-		return fmt.Errorf("failed to close file: %w", closeErr)
-	}
-
-	if expectedSize > 0 && written != expectedSize {
-		cleanupOutputOnError(outputPath, outputFD)
-		return fmt.Errorf("incomplete download: expected %d bytes, got %d bytes", expectedSize, written)
+		return err
 	}
 
 	GoLog("[YouTube] Download completed: %d bytes written\n", written)
@@ -474,6 +418,7 @@ func downloadFromYouTube(req DownloadRequest) (YouTubeDownloadResult, error) {
 	}
 
 	GoLog("[YouTube] Requesting download from Cobalt for: %s\n", youtubeURL)
+	applyTagRulesToRequest(&req)
 
 	cobaltResp, err := downloader.GetDownloadURL(youtubeURL, quality)
 	if err != nil {
@@ -533,10 +478,30 @@ func downloadFromYouTube(req DownloadRequest) (YouTubeDownloadResult, error) {
 		)
 	}
 
-	if err := downloader.DownloadFile(cobaltResp.URL, outputPath, req.OutputFD, req.ItemID); err != nil {
+	var stage *stagedOutput
+	if isSafOutput {
+		stage, err = newSAFStagedOutput(outputPath, req.OutputFD, ext)
+		if err != nil {
+			return YouTubeDownloadResult{}, err
+		}
+	} else {
+		stage = newStagedOutput(outputPath)
+	}
+
+	if err := downloader.DownloadFile(cobaltResp.URL, stage.workPath, 0, req.ItemID, "youtube:"+youtubeURL); err != nil {
+		stage.discard()
 		return YouTubeDownloadResult{}, fmt.Errorf("download failed: %w", err)
 	}
 
+	if err := embedDownloadTags(stage.workPath, newDownloadProvenance(req, "youtube", youtubeURL), nil); err != nil {
+		GoLog("[YouTube] Warning: failed to embed provenance: %v\n", err)
+	}
+
+	outputPath, err = stage.commit(stage.workPath, true)
+	if err != nil {
+		return YouTubeDownloadResult{}, err
+	}
+
 	lyricsLRC := ""
 	var coverData []byte
 	if parallelResult != nil {